@@ -0,0 +1,27 @@
+package caddy_wedos_ip
+
+import (
+	"net/netip"
+	"slices"
+)
+
+// accumulate returns prefixes unioned with the ranges fetched so far, for
+// Additive mode. prefixes are kept as the latest fetch for resetAdditive.
+func (s *WedosIPRange) accumulate(prefixes []netip.Prefix) []netip.Prefix {
+	s.lock.Lock()
+	s.latest = prefixes
+	acc := s.fetched
+	s.lock.Unlock()
+	return normalizePrefixes(append(slices.Clone(acc), prefixes...))
+}
+
+// resetAdditive drops the accumulated ranges, keeping only those of the
+// latest successful fetch.
+func (s *WedosIPRange) resetAdditive() {
+	s.applyLock.Lock()
+	defer s.applyLock.Unlock()
+	s.lock.RLock()
+	latest, refreshed := s.latest, s.lastRefresh
+	s.lock.RUnlock()
+	s.applyRanges(latest, refreshed)
+}
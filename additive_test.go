@@ -0,0 +1,46 @@
+package caddy_wedos_ip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestAdditive(t *testing.T) {
+	s := newTestRange(sequenceServer(t, "192.0.2.0/24", "198.51.100.0/24", "198.51.100.0/24").URL)
+	s.Additive = true
+
+	for i := 0; i < 2; i++ {
+		if err := s.refresh(); err != nil {
+			t.Fatalf("refresh %d: %v", i+1, err)
+		}
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24", "198.51.100.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected the union %v, got %v", want, got)
+	}
+
+	registerInstance(s)
+	defer unregisterInstance(s)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/wedos/reset", nil)
+	if err := (adminWedos{}).handleReset(rec, req); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "198.51.100.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected only the latest fetch %v after a reset, got %v", want, got)
+	}
+
+	// Accumulation starts again from the latest fetch.
+	if err := s.refresh(); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if got := len(s.GetIPRanges(nil)); got != 1 {
+		t.Errorf("expected 1 range, got %d", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/wedos/reset", nil)
+	if err := (adminWedos{}).handleReset(httptest.NewRecorder(), req); err == nil {
+		t.Errorf("expected GET to be rejected")
+	}
+}
@@ -0,0 +1,373 @@
+package caddy_wedos_ip
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func init() {
+	caddy.RegisterModule(adminWedos{})
+}
+
+// Provisioned module instances, reported by the admin API.
+var (
+	instances     []*WedosIPRange
+	instancesLock sync.Mutex
+)
+
+// moduleIndex maps the source of each provisioned module, named sets
+// aside, to the one provisioned last, for findModule. It is replaced by
+// indexInstances whenever instances changes, so the request path looks
+// modules up without taking instancesLock.
+var moduleIndex atomic.Pointer[map[string]*WedosIPRange]
+
+// indexInstances rebuilds moduleIndex. instancesLock must be held.
+func indexInstances() {
+	index := make(map[string]*WedosIPRange)
+	for _, s := range instances {
+		if !s.setChild {
+			index[s.source()] = s
+		}
+	}
+	moduleIndex.Store(&index)
+}
+
+// registerInstance also publishes the state of s in the expvar, replacing
+// that of an older instance with the same source.
+func registerInstance(s *WedosIPRange) {
+	instancesLock.Lock()
+	defer instancesLock.Unlock()
+	instances = append(instances, s)
+	indexInstances()
+	publishSourceExpvar(s)
+}
+
+// unregisterInstance also drops the expvar and metrics of s, unless another
+// instance with the same source, such as the one a config reload replaced
+// s with, remains.
+func unregisterInstance(s *WedosIPRange) {
+	instancesLock.Lock()
+	defer instancesLock.Unlock()
+	instances = slices.DeleteFunc(instances, func(i *WedosIPRange) bool { return i == s })
+	indexInstances()
+	source := s.source()
+	if slices.ContainsFunc(instances, func(i *WedosIPRange) bool { return i.source() == source }) {
+		return
+	}
+	wedosExpvarSources.Delete(source)
+	forgetFreshness(source)
+}
+
+// adminWedos is a module that provides the /wedos/ endpoints
+// for the Caddy admin API.
+type adminWedos struct{}
+
+// instanceStatus holds the status of one provisioned module.
+type instanceStatus struct {
+	URL                 string         `json:"url"`
+	Count               int            `json:"count"`
+	Hash                string         `json:"hash"`
+	LastRefresh         time.Time      `json:"last_refresh,omitzero"`
+	ConsecutiveFailures int            `json:"consecutive_failures"`
+	LastError           string         `json:"last_error,omitempty"`
+	LastErrorClass      string         `json:"last_error_class,omitempty"`
+	Breaker             string         `json:"breaker,omitempty"`
+	Interval            string         `json:"interval"`
+	Pinned              []string       `json:"pinned,omitempty"`
+	Serial              uint64         `json:"serial,omitempty"`
+	Sources             []sourceStatus `json:"sources,omitempty"`
+	// MemoryBytes estimates the memory taken by the ranges, see MaxMemory.
+	MemoryBytes int64 `json:"memory_bytes"`
+	// Override is the temporary override set through /wedos/override.
+	Override *overrideStatus `json:"override,omitempty"`
+	// PausedSince is when refreshes were paused for maintenance.
+	PausedSince time.Time `json:"paused_since,omitzero"`
+	// EffectiveInterval is the interval stretched by AdaptInterval.
+	EffectiveInterval string `json:"effective_interval,omitempty"`
+	// DegradedSources are the sources serving their last good prefixes,
+	// see PartialFallback.
+	DegradedSources []string `json:"degraded_sources,omitempty"`
+	// Healthy is set once ranges were loaded, and with
+	// VerifyStartupStability only once the startup fetches agreed.
+	Healthy bool `json:"healthy"`
+}
+
+// CaddyModule returns the Caddy module information.
+func (adminWedos) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "admin.api.wedos",
+		New: func() caddy.Module { return new(adminWedos) },
+	}
+}
+
+// Routes returns the routes for the /wedos/ endpoints.
+func (a adminWedos) Routes() []caddy.AdminRoute {
+	return []caddy.AdminRoute{
+		{
+			Pattern: "/wedos/status",
+			Handler: caddy.AdminHandlerFunc(a.handleStatus),
+		},
+		{
+			Pattern: "/wedos/check",
+			Handler: caddy.AdminHandlerFunc(a.handleCheck),
+		},
+		{
+			Pattern: "/wedos/interval",
+			Handler: caddy.AdminHandlerFunc(a.handleInterval),
+		},
+		{
+			Pattern: "/wedos/reset",
+			Handler: caddy.AdminHandlerFunc(a.handleReset),
+		},
+		{
+			Pattern: "/wedos/pause",
+			Handler: caddy.AdminHandlerFunc(a.handlePause),
+		},
+		{
+			Pattern: "/wedos/resume",
+			Handler: caddy.AdminHandlerFunc(a.handlePause),
+		},
+		{
+			Pattern: "/wedos/config",
+			Handler: caddy.AdminHandlerFunc(a.handleConfig),
+		},
+		{
+			Pattern: "/wedos/override",
+			Handler: caddy.AdminHandlerFunc(a.handleOverride),
+		},
+		{
+			Pattern: "/wedos/refresh",
+			Handler: caddy.AdminHandlerFunc(a.handleRefresh),
+		},
+		{
+			Pattern: "/wedos/quarantine",
+			Handler: caddy.AdminHandlerFunc(a.handleQuarantine),
+		},
+		{
+			Pattern: "/wedos/quarantine/approve",
+			Handler: caddy.AdminHandlerFunc(a.handleQuarantine),
+		},
+		{
+			Pattern: "/wedos/quarantine/reject",
+			Handler: caddy.AdminHandlerFunc(a.handleQuarantine),
+		},
+	}
+}
+
+// handleStatus reports the status of every provisioned module.
+func (adminWedos) handleStatus(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+
+	instancesLock.Lock()
+	results := make([]instanceStatus, 0, len(instances))
+	for _, s := range instances {
+		results = append(results, s.status())
+	}
+	instancesLock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusInternalServerError,
+			Err:        err,
+		}
+	}
+	return nil
+}
+
+// checkResult reports whether an address is trusted by one module.
+// Prefix is the most specific matching prefix and Containing lists every
+// matching prefix, broadest first. For an untrusted address, Nearest lists
+// the prefixes sorting right before and after it.
+type checkResult struct {
+	URL        string   `json:"url"`
+	Trusted    bool     `json:"trusted"`
+	Prefix     string   `json:"prefix,omitempty"`
+	Containing []string `json:"containing,omitempty"`
+	Nearest    []string `json:"nearest,omitempty"`
+}
+
+// handleCheck reports, for every provisioned module, whether the address
+// in the ip query parameter is trusted and which prefix matched.
+func (adminWedos) handleCheck(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+
+	addr, err := netip.ParseAddr(r.URL.Query().Get("ip"))
+	if err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("invalid ip parameter: %v", err),
+		}
+	}
+
+	instancesLock.Lock()
+	results := make([]checkResult, 0, len(instances))
+	for _, s := range instances {
+		results = append(results, s.check(addr))
+	}
+	instancesLock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusInternalServerError,
+			Err:        err,
+		}
+	}
+	return nil
+}
+
+// check reports whether s trusts addr, for handleCheck.
+func (s *WedosIPRange) check(addr netip.Addr) checkResult {
+	res := checkResult{URL: s.source()}
+	addr = addr.Unmap()
+	ranges := s.GetIPRanges(nil)
+	containing := containingPrefixes(ranges, addr)
+	if len(containing) == 0 {
+		before, after := nearestPrefixes(ranges, addr)
+		for _, p := range []netip.Prefix{before, after} {
+			if p.IsValid() {
+				res.Nearest = append(res.Nearest, p.String())
+			}
+		}
+		return res
+	}
+	res.Trusted = true
+	res.Prefix = containing[len(containing)-1].String()
+	for _, p := range containing {
+		res.Containing = append(res.Containing, p.String())
+	}
+	return res
+}
+
+// intervalRequest is the body of PUT /wedos/interval.
+type intervalRequest struct {
+	Interval string `json:"interval"`
+}
+
+// handleInterval changes the refresh interval of every provisioned module
+// without a config reload. The new interval applies immediately. It fails
+// with 409 Conflict, changing nothing, if any module refreshes on Schedule.
+func (adminWedos) handleInterval(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPut {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+	if err := authorizeMutation(r); err != nil {
+		return err
+	}
+
+	var body intervalRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("decoding request body: %v", err),
+		}
+	}
+	interval, err := caddy.ParseDuration(body.Interval)
+	if err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("invalid interval: %v", err),
+		}
+	}
+	if interval < minInterval {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("interval %v is below the minimum of %v", interval, minInterval),
+		}
+	}
+
+	instancesLock.Lock()
+	defer instancesLock.Unlock()
+	// A schedule overrides the interval, so the change would do nothing
+	// there; refuse it rather than apply it to only some modules.
+	var scheduled []string
+	for _, s := range instances {
+		if s.schedule != nil {
+			scheduled = append(scheduled, s.source())
+		}
+	}
+	if len(scheduled) > 0 {
+		return caddy.APIError{
+			HTTPStatus: http.StatusConflict,
+			Err:        fmt.Errorf("refreshes follow a schedule, not an interval: %s", strings.Join(scheduled, ", ")),
+		}
+	}
+	for _, s := range instances {
+		s.setInterval(interval)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// handleReset drops the ranges accumulated by every module in additive
+// mode, keeping only those of its latest successful fetch.
+func (adminWedos) handleReset(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+	if err := authorizeMutation(r); err != nil {
+		return err
+	}
+
+	instancesLock.Lock()
+	defer instancesLock.Unlock()
+	for _, s := range instances {
+		if s.Additive {
+			s.resetAdditive()
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// status returns a consistent view of the module's state.
+func (s *WedosIPRange) status() instanceStatus {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return instanceStatus{
+		URL:                 s.source(),
+		Count:               len(s.ranges),
+		Hash:                contentHash(s.ranges),
+		LastRefresh:         s.lastRefresh,
+		ConsecutiveFailures: s.failures,
+		LastError:           s.lastError,
+		LastErrorClass:      s.lastErrorClass,
+		Breaker:             s.breaker,
+		Interval:            time.Duration(s.Interval).String(),
+		Pinned:              slices.Concat(s.Pinned, s.RangesJSON),
+		Serial:              s.serial,
+		Sources:             s.sourceStatuses(),
+		MemoryBytes:         rangesMemory(len(s.ranges)),
+		Override:            s.overrideStatus(),
+		PausedSince:         s.pausedSince,
+		EffectiveInterval:   s.effectiveInterval(),
+		DegradedSources:     s.degradedSources(),
+		Healthy:             !s.unsettled && !s.lastRefresh.IsZero(),
+	}
+}
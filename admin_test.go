@@ -0,0 +1,155 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestAdminStatus(t *testing.T) {
+	r := &WedosIPRange{URL: "https://example.com/ips.txt", lock: new(sync.RWMutex), applyLock: new(sync.Mutex)}
+	r.setRanges([]netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}, time.Now())
+	registerInstance(r)
+	defer unregisterInstance(r)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/wedos/status", nil)
+	if err := (adminWedos{}).handleStatus(rec, req); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+
+	var got []instanceStatus
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if len(got) != 1 || got[0].URL != r.URL || got[0].Count != 1 || got[0].LastRefresh.IsZero() {
+		t.Errorf("unexpected status: %+v", got)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/wedos/status", nil)
+	if err := (adminWedos{}).handleStatus(httptest.NewRecorder(), req); err == nil {
+		t.Errorf("expected POST to be rejected")
+	}
+}
+
+func TestAdminCheck(t *testing.T) {
+	r := &WedosIPRange{URL: "https://example.com/ips.txt", lock: new(sync.RWMutex), applyLock: new(sync.Mutex)}
+	r.setRanges([]netip.Prefix{
+		netip.MustParsePrefix("192.0.2.0/24"),
+		netip.MustParsePrefix("192.0.2.128/25"),
+	}, time.Now())
+	registerInstance(r)
+	defer unregisterInstance(r)
+
+	tests := []struct {
+		ip      string
+		trusted bool
+		prefix  string
+	}{
+		{"192.0.2.200", true, "192.0.2.128/25"},
+		{"192.0.2.1", true, "192.0.2.0/24"},
+		{"::ffff:192.0.2.1", true, "192.0.2.0/24"},
+		{"198.51.100.1", false, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/wedos/check?ip="+tt.ip, nil)
+		if err := (adminWedos{}).handleCheck(rec, req); err != nil {
+			t.Fatalf("handler error: %v", err)
+		}
+		var got []checkResult
+		if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+		if len(got) != 1 || got[0].Trusted != tt.trusted || got[0].Prefix != tt.prefix {
+			t.Errorf("check %s: got %+v, want trusted=%v prefix=%q", tt.ip, got, tt.trusted, tt.prefix)
+		}
+	}
+
+	if got := r.check(netip.MustParseAddr("192.0.2.200")); !slices.Equal(got.Containing, []string{"192.0.2.0/24", "192.0.2.128/25"}) {
+		t.Errorf("expected both containing prefixes, got %v", got.Containing)
+	}
+	if got := r.check(netip.MustParseAddr("198.51.100.1")); !slices.Equal(got.Nearest, []string{"192.0.2.128/25"}) {
+		t.Errorf("expected the nearest prefix, got %v", got.Nearest)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/wedos/check?ip=bogus", nil)
+	if err := (adminWedos{}).handleCheck(httptest.NewRecorder(), req); err == nil {
+		t.Errorf("expected an invalid ip to be rejected")
+	}
+}
+
+func TestAdminInterval(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := &WedosIPRange{URL: srv.URL, Interval: caddy.Duration(time.Hour)}
+	if err := r.Provision(ctx); err != nil {
+		t.Fatalf("provision error: %v", err)
+	}
+	defer r.Cleanup()
+	waitFor(t, func() bool { return hits.Load() == 1 })
+
+	for _, body := range []string{`{"interval":"1s"}`, `{"interval":"soon"}`, `nope`} {
+		req := httptest.NewRequest(http.MethodPut, "/wedos/interval", strings.NewReader(body))
+		if err := (adminWedos{}).handleInterval(httptest.NewRecorder(), req); err == nil {
+			t.Errorf("expected %s to be rejected", body)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/wedos/interval", strings.NewReader(`{"interval":"10s"}`))
+	if err := (adminWedos{}).handleInterval(rec, req); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+	if got := r.status().Interval; got != "10s" {
+		t.Errorf("expected interval 10s, got %s", got)
+	}
+	// The hour-long timer is replaced by the new interval right away.
+	if d := r.nextDelay(); d != 10*time.Second {
+		t.Errorf("expected next delay 10s, got %v", d)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/wedos/interval", nil)
+	if err := (adminWedos{}).handleInterval(httptest.NewRecorder(), req); err == nil {
+		t.Errorf("expected GET to be rejected")
+	}
+
+	// A module on a schedule would ignore the interval.
+	scheduled := newTestRange("https://example.com/scheduled.txt")
+	sched, err := parseCron("0 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduled.schedule = sched
+	registerInstance(scheduled)
+	defer unregisterInstance(scheduled)
+	req = httptest.NewRequest(http.MethodPut, "/wedos/interval", strings.NewReader(`{"interval":"20s"}`))
+	err = (adminWedos{}).handleInterval(httptest.NewRecorder(), req)
+	if apiErr, ok := err.(caddy.APIError); !ok || apiErr.HTTPStatus != http.StatusConflict {
+		t.Errorf("expected 409 with a scheduled module, got %v", err)
+	}
+	if got := r.status().Interval; got != "10s" {
+		t.Errorf("expected interval 10s kept, got %s", got)
+	}
+}
@@ -0,0 +1,51 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// authorizeMutation rejects a request changing the ranges or refreshes
+// unless its client address is in the AdminAllow ranges of every module
+// that sets them. The admin API's own access control applies first.
+func authorizeMutation(r *http.Request) error {
+	instancesLock.Lock()
+	defer instancesLock.Unlock()
+	var client netip.Addr
+	parsed := false
+	for _, s := range instances {
+		if len(s.adminAllow) == 0 {
+			continue
+		}
+		if !parsed {
+			client = remoteAddr(r)
+			parsed = true
+		}
+		if !client.IsValid() || !slices.ContainsFunc(s.adminAllow, func(p netip.Prefix) bool { return p.Contains(client) }) {
+			return caddy.APIError{
+				HTTPStatus: http.StatusForbidden,
+				Err:        fmt.Errorf("client address %q is not in admin_allow", r.RemoteAddr),
+			}
+		}
+	}
+	return nil
+}
+
+// remoteAddr returns the client address of r, invalid if it has none, as
+// over a Unix socket.
+func remoteAddr(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
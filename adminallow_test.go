@@ -0,0 +1,68 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestAdminAllow(t *testing.T) {
+	srv := sequenceServer(t, "192.0.2.0/24")
+	s, err := New(Options{Config: WedosIPRange{
+		URL:            srv.URL,
+		AdminAllow:     []string{"10.0.0.0/8", "::1/128"},
+		RequireOnStart: true,
+		Interval:       caddy.Duration(time.Hour),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	for _, tc := range []struct {
+		remote string
+		want   int
+	}{
+		{"10.1.2.3:5000", http.StatusNoContent},
+		{"[::1]:5000", http.StatusNoContent},
+		{"[::ffff:10.0.0.1]:5000", http.StatusNoContent},
+		{"192.0.2.1:5000", http.StatusForbidden},
+		{"@", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/wedos/reset", nil)
+		req.RemoteAddr = tc.remote
+		rec := httptest.NewRecorder()
+		err := (adminWedos{}).handleReset(rec, req)
+		got := rec.Code
+		if apiErr, ok := err.(caddy.APIError); ok {
+			got = apiErr.HTTPStatus
+		} else if err != nil {
+			t.Fatalf("%s: unexpected error %v", tc.remote, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.remote, tc.want, got)
+		}
+	}
+
+	// Read endpoints are not restricted.
+	req := httptest.NewRequest(http.MethodGet, "/wedos/status", nil)
+	req.RemoteAddr = "192.0.2.1:5000"
+	if err := (adminWedos{}).handleStatus(httptest.NewRecorder(), req); err != nil {
+		t.Errorf("expected the status to be readable, got %v", err)
+	}
+
+	// Nor is anything once the module is gone.
+	s.Stop()
+	req = httptest.NewRequest(http.MethodPost, "/wedos/reset", nil)
+	req.RemoteAddr = "192.0.2.1:5000"
+	if err := (adminWedos{}).handleReset(httptest.NewRecorder(), req); err != nil {
+		t.Errorf("expected no restriction without admin_allow, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package caddy_wedos_ip
+
+import (
+	"net/netip"
+	"slices"
+)
+
+// comparePrefixes orders prefixes by address, then by prefix length.
+func comparePrefixes(a, b netip.Prefix) int {
+	if c := a.Addr().Compare(b.Addr()); c != 0 {
+		return c
+	}
+	return a.Bits() - b.Bits()
+}
+
+// normalizePrefixes returns a masked copy of in, sorted with
+// comparePrefixes and without duplicates. Unlike aggregatePrefixes it
+// keeps overlapping prefixes.
+func normalizePrefixes(in []netip.Prefix) []netip.Prefix {
+	out := make([]netip.Prefix, 0, len(in))
+	for _, p := range in {
+		if p.IsValid() {
+			out = append(out, p.Masked())
+		}
+	}
+	slices.SortFunc(out, comparePrefixes)
+	return slices.Compact(out)
+}
+
+// aggregatePrefixes returns the smallest set of prefixes covering exactly
+// the same addresses as in: duplicates and prefixes contained in another
+// are dropped, and adjacent siblings are merged into their parent until
+// nothing more can be combined.
+func aggregatePrefixes(in []netip.Prefix) []netip.Prefix {
+	out := make([]netip.Prefix, 0, len(in))
+	for _, p := range in {
+		if p.IsValid() {
+			out = append(out, p.Masked())
+		}
+	}
+
+	for {
+		slices.SortFunc(out, comparePrefixes)
+		n := len(out)
+		out = collapseContained(out)
+		out = mergeSiblings(out)
+		if len(out) == n {
+			return out
+		}
+	}
+}
+
+// collapseContained drops prefixes covered by a preceding prefix.
+// The input must be sorted with comparePrefixes.
+func collapseContained(ps []netip.Prefix) []netip.Prefix {
+	out := ps[:0]
+	for _, p := range ps {
+		if len(out) > 0 {
+			last := out[len(out)-1]
+			if last.Bits() <= p.Bits() && last.Contains(p.Addr()) {
+				continue
+			}
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// mergeSiblings replaces each pair of adjacent sibling prefixes with their
+// parent. The input must be sorted and free of contained prefixes.
+func mergeSiblings(ps []netip.Prefix) []netip.Prefix {
+	out := ps[:0]
+	for i := 0; i < len(ps); i++ {
+		p := ps[i]
+		if i+1 < len(ps) && p.Bits() > 0 && p.Bits() == ps[i+1].Bits() {
+			parent := netip.PrefixFrom(p.Addr(), p.Bits()-1).Masked()
+			if parent == netip.PrefixFrom(ps[i+1].Addr(), p.Bits()-1).Masked() {
+				out = append(out, parent)
+				i++
+				continue
+			}
+		}
+		out = append(out, p)
+	}
+	return out
+}
@@ -0,0 +1,101 @@
+package caddy_wedos_ip
+
+import (
+	"net/netip"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func parsePrefixes(t *testing.T, in ...string) []netip.Prefix {
+	t.Helper()
+	out := make([]netip.Prefix, 0, len(in))
+	for _, s := range in {
+		out = append(out, netip.MustParsePrefix(s))
+	}
+	return out
+}
+
+func TestAggregatePrefixes(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []string
+		want []string
+	}{
+		{
+			name: "empty",
+			in:   nil,
+			want: []string{},
+		},
+		{
+			name: "siblings v4",
+			in:   []string{"192.0.2.128/25", "192.0.2.0/25"},
+			want: []string{"192.0.2.0/24"},
+		},
+		{
+			name: "non-siblings v4",
+			in:   []string{"192.0.2.128/25", "192.0.3.0/25"},
+			want: []string{"192.0.2.128/25", "192.0.3.0/25"},
+		},
+		{
+			name: "adjacent but not aligned",
+			in:   []string{"192.0.2.0/24", "192.0.3.0/24", "192.0.4.0/24"},
+			want: []string{"192.0.2.0/23", "192.0.4.0/24"},
+		},
+		{
+			name: "fixed point",
+			in:   []string{"10.0.0.0/26", "10.0.0.64/26", "10.0.0.128/26", "10.0.0.192/26", "10.0.1.0/24"},
+			want: []string{"10.0.0.0/23"},
+		},
+		{
+			name: "duplicates and contained",
+			in:   []string{"10.0.0.0/8", "10.1.0.0/16", "10.0.0.0/8", "10.255.255.255/32"},
+			want: []string{"10.0.0.0/8"},
+		},
+		{
+			name: "unmasked input",
+			in:   []string{"192.0.2.1/25", "192.0.2.200/25"},
+			want: []string{"192.0.2.0/24"},
+		},
+		{
+			name: "siblings v6",
+			in:   []string{"2001:db8:0:1::/64", "2001:db8::/64"},
+			want: []string{"2001:db8::/63"},
+		},
+		{
+			name: "mixed families",
+			in:   []string{"2001:db8::/33", "192.0.2.0/25", "2001:db8:8000::/33", "192.0.2.128/25"},
+			want: []string{"192.0.2.0/24", "2001:db8::/32"},
+		},
+		{
+			name: "v4 and v6 do not merge",
+			in:   []string{"0.0.0.0/1", "128.0.0.0/1", "::/1", "8000::/1"},
+			want: []string{"0.0.0.0/0", "::/0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := aggregatePrefixes(parsePrefixes(t, tt.in...))
+			want := parsePrefixes(t, tt.want...)
+			if !slices.Equal(got, want) {
+				t.Errorf("aggregatePrefixes(%v) = %v, want %v", tt.in, got, want)
+			}
+		})
+	}
+}
+
+func TestGetIPRangesSorted(t *testing.T) {
+	s := WedosIPRange{lock: new(sync.RWMutex), applyLock: new(sync.Mutex)}
+	s.setRanges(parsePrefixes(t, "2001:db8::/32", "198.51.100.7/24", "192.0.2.0/24", "192.0.2.0/25", "198.51.100.0/24"), time.Now())
+
+	got := s.GetIPRanges(nil)
+	want := parsePrefixes(t, "192.0.2.0/24", "192.0.2.0/25", "198.51.100.0/24", "2001:db8::/32")
+	if !slices.Equal(got, want) {
+		t.Errorf("GetIPRanges() = %v, want %v", got, want)
+	}
+	if !slices.IsSortedFunc(got, comparePrefixes) {
+		t.Errorf("GetIPRanges() is not sorted: %v", got)
+	}
+}
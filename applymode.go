@@ -0,0 +1,26 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// Values of ApplyMode.
+const (
+	applyBestEffort = "best-effort"
+	applyVerified   = "verified"
+)
+
+// checkVerified fails the candidate list when a filtering guard dropped
+// prefixes from it and ApplyMode is verified, so the previous ranges are
+// kept unchanged rather than replaced by a partially filtered list.
+func (s *WedosIPRange) checkVerified(guard string, before, after int) error {
+	if s.ApplyMode != applyVerified || before == after {
+		return nil
+	}
+	s.logger.Error("WEDOS IP list failed a guard, keeping the previous ranges",
+		zap.String("guard", guard),
+		zap.Int("rejected", before-after))
+	return fmt.Errorf("%s guard rejected %d of %d prefixes", guard, before-after, before)
+}
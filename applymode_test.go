@@ -0,0 +1,49 @@
+package caddy_wedos_ip
+
+import (
+	"slices"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestApplyMode(t *testing.T) {
+	for _, tc := range []struct {
+		mode string
+		want []string
+	}{
+		{"", []string{"192.0.2.0/24"}},
+		{applyBestEffort, []string{"192.0.2.0/24"}},
+		{applyVerified, []string{"198.51.100.0/24"}},
+	} {
+		t.Run(tc.mode, func(t *testing.T) {
+			srv := sequenceServer(t, "198.51.100.0/24", "192.0.2.0/24 0.0.0.0/0")
+			s := newTestRange(srv.URL)
+			s.ApplyMode = tc.mode
+			core, logs := observer.New(zap.ErrorLevel)
+			s.logger = zap.New(core)
+
+			if err := s.refresh(); err != nil {
+				t.Fatal(err)
+			}
+			err := s.refresh()
+			if got, want := s.GetIPRanges(nil), parsePrefixes(t, tc.want...); !slices.Equal(got, want) {
+				t.Errorf("expected %v, got %v", want, got)
+			}
+			if tc.mode != applyVerified {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Error("expected the list to be rejected")
+			}
+			entries := logs.FilterMessage("WEDOS IP list failed a guard, keeping the previous ranges").All()
+			if len(entries) != 1 || entries[0].ContextMap()["guard"] != "min_prefix_len" {
+				t.Errorf("expected the failing guard to be logged, got %v", entries)
+			}
+		})
+	}
+}
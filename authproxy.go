@@ -0,0 +1,48 @@
+package caddy_wedos_ip
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// errAuthProxy is returned for a fetch redirected to another host that
+// answered with something other than a list, typically the login page of
+// an SSO or authenticating proxy.
+var errAuthProxy = errors.New("likely intercepted by an auth proxy")
+
+// offHostRedirect returns the final URL of resp if its request was
+// redirected to a different host.
+func offHostRedirect(resp *http.Response) (string, bool) {
+	if resp.Request == nil || resp.Request.URL == nil {
+		return "", false
+	}
+	orig := resp.Request
+	for orig.Response != nil && orig.Response.Request != nil {
+		orig = orig.Response.Request
+	}
+	if strings.EqualFold(orig.URL.Host, resp.Request.URL.Host) {
+		return "", false
+	}
+	return resp.Request.URL.String(), true
+}
+
+// checkAuthProxy turns err, the failure to parse or accept the body of
+// resp, into errAuthProxy if the fetch was redirected to another host. An
+// HTML body from another host is reported even if it parsed.
+func checkAuthProxy(api string, resp *http.Response, err error) error {
+	final, ok := offHostRedirect(resp)
+	if !ok {
+		return err
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err == nil && mediaType != "text/html" {
+		return nil
+	}
+	if err == nil {
+		err = fmt.Errorf("unexpected content type %s", mediaType)
+	}
+	return fmt.Errorf("%w: %s redirected to %s: %w", errAuthProxy, redactURL(api), redactURL(final), err)
+}
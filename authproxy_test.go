@@ -0,0 +1,48 @@
+package caddy_wedos_ip
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthProxyRedirect(t *testing.T) {
+	login := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ips.txt" {
+			w.Write([]byte("192.0.2.0/24"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html><body>Sign in</body></html>"))
+	}))
+	defer login.Close()
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sso":
+			http.Redirect(w, r, login.URL+"/login", http.StatusFound)
+		case "/moved":
+			http.Redirect(w, r, login.URL+"/ips.txt", http.StatusFound)
+		case "/local":
+			http.Redirect(w, r, "/page", http.StatusFound)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html></html>"))
+		}
+	}))
+	defer origin.Close()
+
+	s := newTestRange(origin.URL)
+	if _, err := s.fetch(origin.URL + "/sso"); !errors.Is(err, errAuthProxy) {
+		t.Errorf("expected an auth proxy error, got %v", err)
+	}
+	// A list served from another host is fine.
+	if _, err := s.fetch(origin.URL + "/moved"); err != nil {
+		t.Errorf("expected the moved list to be accepted, got %v", err)
+	}
+	// HTML from the configured host is a plain parse error.
+	if _, err := s.fetch(origin.URL + "/local"); err == nil || errors.Is(err, errAuthProxy) {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+}
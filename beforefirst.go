@@ -0,0 +1,49 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"time"
+)
+
+// What GetIPRanges returns before the first successful fetch, see
+// BeforeFirstFetch.
+const (
+	beforeEmpty    = "empty"
+	beforeFallback = "fallback"
+)
+
+// provisionBeforeFirstFetch checks BeforeFirstFetch and parses Fallback.
+func (s *WedosIPRange) provisionBeforeFirstFetch() error {
+	switch s.BeforeFirstFetch {
+	case "", beforeEmpty:
+		if len(s.Fallback) > 0 {
+			return fmt.Errorf("fallback requires before_first_fetch %s", beforeFallback)
+		}
+		return nil
+	case beforeFallback:
+	default:
+		return fmt.Errorf("unknown before_first_fetch %q", s.BeforeFirstFetch)
+	}
+	if len(s.Fallback) == 0 {
+		return fmt.Errorf("before_first_fetch %s requires fallback ranges", beforeFallback)
+	}
+	fallback, err := parseCIDRList("fallback", s.Fallback)
+	if err != nil {
+		return err
+	}
+	s.fallback = fallback
+	return nil
+}
+
+// withFallback returns fetched with the Fallback ranges added while no
+// fetch has succeeded yet, that is while refreshed is zero. The first
+// successful fetch, or ranges loaded from the cache file or storage,
+// replace them.
+func (s *WedosIPRange) withFallback(fetched []netip.Prefix, refreshed time.Time) []netip.Prefix {
+	if len(s.fallback) == 0 || !refreshed.IsZero() {
+		return fetched
+	}
+	return append(slices.Clip(fetched), s.fallback...)
+}
@@ -0,0 +1,118 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestBeforeFirstFetch(t *testing.T) {
+	for _, tc := range []struct {
+		mode     string
+		fallback []string
+		want     []string
+	}{
+		{"", nil, nil},
+		{beforeEmpty, nil, nil},
+		{beforeFallback, []string{"203.0.113.0/24"}, []string{"203.0.113.0/24"}},
+	} {
+		t.Run(tc.mode, func(t *testing.T) {
+			var up atomic.Bool
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !up.Load() {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.Write([]byte("192.0.2.0/24"))
+			}))
+			defer srv.Close()
+
+			s, err := New(Options{Config: WedosIPRange{
+				URL:              srv.URL,
+				Interval:         caddy.Duration(time.Hour),
+				BeforeFirstFetch: tc.mode,
+				Fallback:         tc.fallback,
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := parsePrefixes(t, tc.want...)
+			if got := s.GetIPRanges(nil); !slices.Equal(got, want) {
+				t.Errorf("expected %v before any fetch, got %v", want, got)
+			}
+
+			// A failed fetch keeps the cold-start ranges.
+			if err := s.refresh(); err == nil {
+				t.Fatal("expected the fetch to fail")
+			}
+			if got := s.GetIPRanges(nil); !slices.Equal(got, want) {
+				t.Errorf("expected %v after a failed fetch, got %v", want, got)
+			}
+			if _, fresh := s.GetIPRangesWithFreshness(nil); fresh {
+				t.Error("expected the cold-start ranges not to be fresh")
+			}
+
+			// The first successful fetch replaces them.
+			up.Store(true)
+			if err := s.refresh(); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24"); !slices.Equal(got, want) {
+				t.Errorf("expected %v after the first fetch, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestBeforeFirstFetchFallbackStartsBeforeFetch(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	s, err := New(Options{Config: WedosIPRange{
+		URL:              srv.URL,
+		Interval:         caddy.Duration(time.Hour),
+		BeforeFirstFetch: beforeFallback,
+		Fallback:         []string{"203.0.113.0/24"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	// The background first fetch hangs: the fallback is trusted meanwhile.
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "203.0.113.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected %v while the first fetch runs, got %v", want, got)
+	}
+}
+
+func TestBeforeFirstFetchValidation(t *testing.T) {
+	for _, tc := range []struct {
+		mode     string
+		fallback []string
+		want     string
+	}{
+		{"fallback", nil, "requires fallback ranges"},
+		{"", []string{"203.0.113.0/24"}, "requires before_first_fetch fallback"},
+		{"open", nil, `unknown before_first_fetch "open"`},
+		{"fallback", []string{"not-a-cidr"}, "fallback"},
+	} {
+		_, err := New(Options{Config: WedosIPRange{URL: "https://example.com/ips.txt", BeforeFirstFetch: tc.mode, Fallback: tc.fallback}})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q %v: expected an error containing %q, got %v", tc.mode, tc.fallback, tc.want, err)
+		}
+	}
+}
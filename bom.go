@@ -0,0 +1,39 @@
+package caddy_wedos_ip
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// utf8BOM is the UTF-8 encoded byte order mark some editors and servers
+// put before a text file.
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// stripBOM returns r without a leading UTF-8 byte order mark and the
+// control characters other than whitespace around it, which would
+// otherwise stick to the first prefix of the list and fail it.
+func stripBOM(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	for {
+		if b, _ := br.Peek(len(utf8BOM)); bytes.Equal(b, utf8BOM) {
+			br.Discard(len(utf8BOM))
+			continue
+		}
+		b, err := br.Peek(1)
+		if err != nil || !leadingJunk(b[0]) {
+			return br
+		}
+		br.Discard(1)
+	}
+}
+
+// leadingJunk reports whether c is a control character that can't start a
+// list: anything below a space except whitespace, and DEL.
+func leadingJunk(c byte) bool {
+	switch c {
+	case '\t', '\n', '\v', '\f', '\r':
+		return false
+	}
+	return c < ' ' || c == 0x7f
+}
@@ -0,0 +1,42 @@
+package caddy_wedos_ip
+
+import (
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestStripBOM(t *testing.T) {
+	for in, want := range map[string]string{
+		"\ufeff192.0.2.0/24\n":       "192.0.2.0/24\n",
+		"\x00\ufeff\x01192.0.2.0/24": "192.0.2.0/24",
+		"\n192.0.2.0/24":             "\n192.0.2.0/24",
+		"\ufeff":                     "",
+		"192.0.2.0/24 \ufeff":        "192.0.2.0/24 \ufeff",
+	} {
+		got, err := io.ReadAll(stripBOM(strings.NewReader(in)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("stripBOM(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestBOMPrefixedList(t *testing.T) {
+	for format, body := range map[string]string{
+		formatText: "\ufeff192.0.2.0/24 198.51.100.0/24\n",
+		formatJSON: "\ufeff[\"192.0.2.0/24\", \"198.51.100.0/24\"]",
+	} {
+		s := newTestRange(sequenceServer(t, body).URL)
+		s.Format = format
+		if err := s.refresh(); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24", "198.51.100.0/24"); !slices.Equal(got, want) {
+			t.Errorf("%s: expected %v, got %v", format, want, got)
+		}
+	}
+}
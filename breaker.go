@@ -0,0 +1,68 @@
+package caddy_wedos_ip
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Circuit breaker states, see BreakerThreshold.
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// defaultBreakerMaxDelay caps the open-breaker delay if not configured.
+const defaultBreakerMaxDelay = 24 * time.Hour
+
+// updateBreaker moves the circuit breaker after a refresh attempt. The
+// caller must hold the write lock and have updated failures already.
+func (s *WedosIPRange) updateBreaker(err error) {
+	if s.BreakerThreshold <= 0 {
+		return
+	}
+	prev := s.breaker
+	switch {
+	case err == nil:
+		s.breaker = breakerClosed
+	case s.failures >= s.BreakerThreshold:
+		s.breaker = breakerOpen
+	}
+	if s.breaker == prev {
+		return
+	}
+	switch s.breaker {
+	case breakerOpen:
+		s.logger.Warn("circuit breaker opened, backing off WEDOS refreshes",
+			zap.Int("consecutive_failures", s.failures),
+			zap.Duration("delay", s.breakerDelay()))
+	case breakerClosed:
+		s.logger.Info("circuit breaker closed")
+	}
+}
+
+// halfOpenBreaker marks an open breaker as half-open before its single
+// trial fetch.
+func (s *WedosIPRange) halfOpenBreaker() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.breaker == breakerOpen {
+		s.breaker = breakerHalfOpen
+	}
+}
+
+// breakerDelay returns the delay before the next trial fetch while the
+// breaker is open: the interval doubled for every failure at or past the
+// threshold, capped at BreakerMaxDelay.
+func (s *WedosIPRange) breakerDelay() time.Duration {
+	maxDelay := time.Duration(s.BreakerMaxDelay)
+	if maxDelay <= 0 {
+		maxDelay = defaultBreakerMaxDelay
+	}
+	d := time.Duration(s.Interval)
+	for i := s.BreakerThreshold; i <= s.failures && d < maxDelay; i++ {
+		d *= 2
+	}
+	return min(d, maxDelay)
+}
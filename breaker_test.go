@@ -0,0 +1,60 @@
+package caddy_wedos_ip
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	r := WedosIPRange{
+		Interval:         caddy.Duration(time.Hour),
+		BreakerThreshold: 2,
+		BreakerMaxDelay:  caddy.Duration(6 * time.Hour),
+		breaker:          breakerClosed,
+		lock:             new(sync.RWMutex),
+		logger:           zap.NewNop(),
+	}
+	fetchErr := errors.New("upstream down")
+
+	r.recordRefresh(fetchErr)
+	if r.breaker != breakerClosed || r.nextDelay() != time.Hour {
+		t.Fatalf("expected closed breaker below threshold, got %s with delay %v", r.breaker, r.nextDelay())
+	}
+
+	r.recordRefresh(fetchErr)
+	if r.breaker != breakerOpen {
+		t.Fatalf("expected open breaker at threshold, got %s", r.breaker)
+	}
+	if d := r.nextDelay(); d != 2*time.Hour {
+		t.Errorf("incorrect delay after opening: expected 2h, got %v", d)
+	}
+
+	// A failed trial fetch reopens the breaker with a longer delay.
+	r.halfOpenBreaker()
+	if r.breaker != breakerHalfOpen {
+		t.Fatalf("expected half-open breaker, got %s", r.breaker)
+	}
+	r.recordRefresh(fetchErr)
+	if r.breaker != breakerOpen {
+		t.Fatalf("expected open breaker after failed trial, got %s", r.breaker)
+	}
+	if d := r.nextDelay(); d != 4*time.Hour {
+		t.Errorf("incorrect delay after failed trial: expected 4h, got %v", d)
+	}
+
+	r.recordRefresh(fetchErr)
+	if d := r.nextDelay(); d != 6*time.Hour {
+		t.Errorf("expected delay capped at 6h, got %v", d)
+	}
+
+	r.halfOpenBreaker()
+	r.recordRefresh(nil)
+	if r.breaker != breakerClosed || r.nextDelay() != time.Hour {
+		t.Errorf("expected closed breaker after successful trial, got %s with delay %v", r.breaker, r.nextDelay())
+	}
+}
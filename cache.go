@@ -0,0 +1,239 @@
+package caddy_wedos_ip
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// cacheEntry is the content of the cache file: the last applied ranges
+// plus what is needed to revalidate them with a conditional request.
+type cacheEntry struct {
+	Source   string
+	ETag     string
+	Serial   uint64
+	Updated  time.Time
+	Prefixes []netip.Prefix
+}
+
+// formatCache renders a cache entry as "# key: value" header lines
+// followed by one CIDR per line.
+func formatCache(e cacheEntry) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# source: %s\n", e.Source)
+	if e.ETag != "" {
+		fmt.Fprintf(&buf, "# etag: %s\n", e.ETag)
+	}
+	if e.Serial != 0 {
+		fmt.Fprintf(&buf, "# serial: %d\n", e.Serial)
+	}
+	fmt.Fprintf(&buf, "# updated: %s\n", e.Updated.UTC().Format(time.RFC3339))
+	buf.Write(formatPrefixList(e.Prefixes))
+	return buf.Bytes()
+}
+
+// parseCache parses data written by formatCache.
+func parseCache(data []byte) (cacheEntry, error) {
+	var e cacheEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if header, ok := strings.CutPrefix(text, "#"); ok {
+			key, val, _ := strings.Cut(header, ":")
+			val = strings.TrimSpace(val)
+			switch strings.TrimSpace(key) {
+			case "source":
+				e.Source = val
+			case "etag":
+				e.ETag = val
+			case "serial":
+				n, err := strconv.ParseUint(val, 10, 64)
+				if err != nil {
+					return e, fmt.Errorf("line %d: %v", line, err)
+				}
+				e.Serial = n
+			case "updated":
+				t, err := time.Parse(time.RFC3339, val)
+				if err != nil {
+					return e, fmt.Errorf("line %d: %v", line, err)
+				}
+				e.Updated = t
+			}
+			continue
+		}
+		prefix, err := netip.ParsePrefix(text)
+		if err != nil {
+			return e, fmt.Errorf("line %d: %v", line, err)
+		}
+		e.Prefixes = append(e.Prefixes, prefix)
+	}
+	return e, scanner.Err()
+}
+
+// loadCache seeds the ranges and the ETag from the cache file, so
+// GetIPRanges is non-empty before the first fetch completes.
+func (s *WedosIPRange) loadCache() {
+	data, err := os.ReadFile(s.CacheFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		s.logger.Warn("reading cache_file failed", zap.String("path", s.CacheFile), zap.Error(err))
+		return
+	}
+
+	data, err = decodeCache(data)
+	if err != nil {
+		s.logger.Warn("decompressing cache_file failed", zap.String("path", s.CacheFile), zap.Error(err))
+		return
+	}
+	e, err := parseCacheEntry(data)
+	if err != nil {
+		s.logger.Warn("parsing cache_file failed", zap.String("path", s.CacheFile), zap.Error(err))
+		return
+	}
+	if e.Source != s.source() {
+		s.logger.Info("ignoring cache_file written for a different source",
+			zap.String("path", s.CacheFile),
+			zap.String("cached_source", e.Source))
+		return
+	}
+	if s.CacheMaxAge > 0 {
+		updated := e.Updated
+		if updated.IsZero() {
+			if fi, err := os.Stat(s.CacheFile); err == nil {
+				updated = fi.ModTime()
+			}
+		}
+		if age := ageAt(s.now(), updated); age > time.Duration(s.CacheMaxAge) {
+			s.logger.Warn("ignoring cache_file older than cache_max_age",
+				zap.String("path", s.CacheFile),
+				zap.Time("updated", updated),
+				zap.Duration("age", age))
+			return
+		}
+	}
+
+	if err := s.applyStored(e); err != nil {
+		s.logger.Warn("cache_file not applied", zap.String("path", s.CacheFile), zap.Error(err))
+		return
+	}
+	s.logger.Info("loaded WEDOS IP ranges from cache_file",
+		zap.String("path", s.CacheFile),
+		zap.Int("count", len(e.Prefixes)),
+		zap.Time("updated", e.Updated))
+}
+
+// etagOfURL returns the ETag URL last served an applied list with, for the
+// cache file and storage. Those of Mirrors aren't kept across restarts.
+// The caller must hold lock or be the refresh goroutine.
+func (s *WedosIPRange) etagOfURL() string {
+	return s.etags[s.URL]
+}
+
+// saveCache writes the applied ranges to the cache file.
+func (s *WedosIPRange) saveCache(prefixes []netip.Prefix, updated time.Time) {
+	s.writeCache(cacheEntry{Source: s.source(), ETag: s.etagOfURL(), Serial: s.serial, Updated: updated, Prefixes: prefixes})
+}
+
+// writeCache writes e to the cache file in CacheFormat, compressed if
+// configured.
+func (s *WedosIPRange) writeCache(e cacheEntry) {
+	data := formatCache(e)
+	if s.CacheFormat == cacheFormatBinary {
+		data = formatBinaryCache(e)
+	}
+	if s.CacheCompress {
+		var err error
+		if data, err = gzipBytes(data); err != nil {
+			s.logger.Warn("compressing cache_file failed", zap.Error(err))
+			return
+		}
+	}
+	if err := writeFileAtomic(s.CacheFile, data); err != nil {
+		s.logger.Warn("writing cache_file failed", zap.String("path", s.CacheFile), zap.Error(err))
+	}
+}
+
+// flushCacheTimeout bounds the final cache write on shutdown.
+const flushCacheTimeout = 2 * time.Second
+
+// flushCache writes the current ranges to the cache file one last time,
+// so the next start is seeded with the time of the latest refresh even if
+// it was a 304 Not Modified. It gives up after flushCacheTimeout rather
+// than delay shutdown.
+func (s *WedosIPRange) flushCache() {
+	s.lock.RLock()
+	prefixes, updated, etag, serial := s.fetched, s.lastRefresh, s.etagOfURL(), s.serial
+	s.lock.RUnlock()
+	if updated.IsZero() {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e := cacheEntry{Source: s.source(), ETag: etag, Serial: serial, Updated: updated, Prefixes: prefixes}
+		s.writeCache(e)
+	}()
+	select {
+	case <-done:
+	case <-time.After(flushCacheTimeout):
+		s.logger.Warn("writing cache_file on shutdown timed out", zap.String("path", s.CacheFile))
+	}
+}
+
+// cacheFileTaken reports whether a module provisioned after s, such as the
+// one a config reload replaced it with, uses the same cache file. That one
+// owns the file, and s must not write its older state over it.
+func (s *WedosIPRange) cacheFileTaken() bool {
+	instancesLock.Lock()
+	defer instancesLock.Unlock()
+	newer := instances[slices.Index(instances, s)+1:]
+	return slices.ContainsFunc(newer, func(i *WedosIPRange) bool { return i.CacheFile == s.CacheFile })
+}
+
+// gzipMagic starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// gzipBytes compresses data with gzip.
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeCache decompresses data if it is gzip-compressed, so caches load
+// regardless of the current cache_compress setting.
+func decodeCache(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return data, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
@@ -0,0 +1,274 @@
+package caddy_wedos_ip
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+func TestCacheRoundTrip(t *testing.T) {
+	in := cacheEntry{
+		Source:   "https://example.com/ips.txt",
+		ETag:     `"v1"`,
+		Serial:   2025010101,
+		Updated:  time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		Prefixes: parsePrefixes(t, "192.0.2.0/24", "2001:db8::/32"),
+	}
+	out, err := parseCache(formatCache(in))
+	if err != nil {
+		t.Fatalf("parseCache error: %v", err)
+	}
+	if out.Source != in.Source || out.ETag != in.ETag || out.Serial != in.Serial || !out.Updated.Equal(in.Updated) || !slices.Equal(out.Prefixes, in.Prefixes) {
+		t.Errorf("round trip mismatch: got %+v, want %+v", out, in)
+	}
+}
+
+// cacheServer serves body with ETag etag, answering 304 to a matching
+// If-None-Match, and counts the requests it receives.
+func cacheServer(t *testing.T, etag, body string) (*httptest.Server, *atomic.Int32) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func writeCache(t *testing.T, e cacheEntry) string {
+	path := filepath.Join(t.TempDir(), "cache.txt")
+	if err := os.WriteFile(path, formatCache(e), 0o644); err != nil {
+		t.Fatalf("writing cache: %v", err)
+	}
+	return path
+}
+
+// waitFor polls cond until it holds or a deadline passes.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCacheHitNotModified(t *testing.T) {
+	srv, hits := cacheServer(t, `"v1"`, "198.51.100.0/24")
+	cached := parsePrefixes(t, "192.0.2.0/24")
+	path := writeCache(t, cacheEntry{Source: srv.URL, ETag: `"v1"`, Updated: time.Now(), Prefixes: cached})
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{URL: srv.URL, CacheFile: path}
+	if err := r.Provision(ctx); err != nil {
+		t.Fatalf("error provisioning: %v", err)
+	}
+	if got := r.GetIPRanges(nil); !slices.Equal(got, cached) {
+		t.Errorf("expected cached ranges right after provisioning, got %v", got)
+	}
+
+	waitFor(t, func() bool { return hits.Load() > 0 })
+	if got := r.GetIPRanges(nil); !slices.Equal(got, cached) {
+		t.Errorf("expected cached ranges after 304, got %v", got)
+	}
+}
+
+func TestCacheMissFetches(t *testing.T) {
+	srv, _ := cacheServer(t, `"v2"`, "198.51.100.0/24")
+	path := writeCache(t, cacheEntry{Source: srv.URL, ETag: `"v1"`, Updated: time.Now(), Prefixes: parsePrefixes(t, "192.0.2.0/24")})
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{URL: srv.URL, CacheFile: path}
+	if err := r.Provision(ctx); err != nil {
+		t.Fatalf("error provisioning: %v", err)
+	}
+
+	want := parsePrefixes(t, "198.51.100.0/24")
+	waitFor(t, func() bool { return slices.Equal(r.GetIPRanges(nil), want) })
+
+	waitFor(t, func() bool {
+		data, err := os.ReadFile(path)
+		return err == nil && strings.Contains(string(data), `etag: "v2"`)
+	})
+	data, _ := os.ReadFile(path)
+	e, err := parseCache(data)
+	if err != nil {
+		t.Fatalf("parseCache error: %v", err)
+	}
+	if !slices.Equal(e.Prefixes, want) {
+		t.Errorf("cache not updated: %+v", e)
+	}
+}
+
+func TestCacheIgnoredForOtherSource(t *testing.T) {
+	path := writeCache(t, cacheEntry{Source: "https://other.example.com/ips.txt", Updated: time.Now(), Prefixes: parsePrefixes(t, "192.0.2.0/24")})
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	cancel()
+
+	r := WedosIPRange{URL: "https://example.com/ips.txt", CacheFile: path}
+	if err := r.Provision(ctx); err != nil {
+		t.Fatalf("error provisioning: %v", err)
+	}
+	if got := r.GetIPRanges(nil); len(got) != 0 {
+		t.Errorf("expected cache for another source to be ignored, got %v", got)
+	}
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		updated time.Time
+		want    int
+	}{
+		{"recent", time.Now().Add(-time.Hour), 1},
+		{"expired", time.Now().Add(-48 * time.Hour), 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := WedosIPRange{URL: "https://example.com/ips.txt", CacheMaxAge: caddy.Duration(24 * time.Hour)}
+			r.CacheFile = writeCache(t, cacheEntry{Source: r.URL, Updated: tc.updated, Prefixes: parsePrefixes(t, "192.0.2.0/24")})
+
+			ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+			cancel()
+			if err := r.Provision(ctx); err != nil {
+				t.Fatalf("error provisioning: %v", err)
+			}
+			if got := r.GetIPRanges(nil); len(got) != tc.want {
+				t.Errorf("expected %d cached prefixes, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCacheCompress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.txt.gz")
+	want := parsePrefixes(t, "192.0.2.0/24", "2001:db8::/32")
+
+	for _, compress := range []bool{true, false, true} {
+		writer := WedosIPRange{URL: "https://example.com/ips.txt", CacheFile: path, CacheCompress: compress, logger: zap.NewNop()}
+		writer.saveCache(want, time.Now())
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("reading cache: %v", err)
+		}
+		if got := bytes.HasPrefix(data, gzipMagic); got != compress {
+			t.Errorf("cache_compress %v: file compressed = %v", compress, got)
+		}
+
+		// Loading must not depend on the reader's cache_compress setting.
+		reader := WedosIPRange{URL: "https://example.com/ips.txt", CacheFile: path, CacheCompress: !compress, lock: new(sync.RWMutex), applyLock: new(sync.Mutex), logger: zap.NewNop()}
+		reader.loadCache()
+		if got := reader.GetIPRanges(nil); !slices.Equal(got, want) {
+			t.Errorf("cache_compress %v: loaded %v, want %v", compress, got, want)
+		}
+	}
+}
+
+func TestCacheFlushedOnCleanup(t *testing.T) {
+	srv, hits := cacheServer(t, `"v1"`, "198.51.100.0/24")
+	cached := parsePrefixes(t, "192.0.2.0/24")
+	old := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	path := writeCache(t, cacheEntry{Source: srv.URL, ETag: `"v1"`, Updated: old, Prefixes: cached})
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{URL: srv.URL, CacheFile: path, Pinned: []string{"203.0.113.0/24"}}
+	if err := r.Provision(ctx); err != nil {
+		t.Fatalf("error provisioning: %v", err)
+	}
+	waitFor(t, func() bool { return hits.Load() > 0 && r.status().LastRefresh.After(old) })
+	r.Cleanup()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := parseCache(data)
+	if err != nil {
+		t.Fatalf("parsing cache: %v", err)
+	}
+	// The 304 refreshed the timestamp; pinned ranges are not cached.
+	if !e.Updated.After(old) || e.ETag != `"v1"` || !slices.Equal(e.Prefixes, cached) {
+		t.Errorf("unexpected cache after cleanup: %+v", e)
+	}
+}
+
+func TestCacheGuarded(t *testing.T) {
+	const url = "https://example.com/ips.txt"
+	path := writeCache(t, cacheEntry{Source: url, Updated: time.Now(), Prefixes: parsePrefixes(t, "0.0.0.0/0", "192.0.2.0/24")})
+
+	for _, tc := range []struct {
+		name     string
+		required []string
+		want     []netip.Prefix
+	}{
+		// min_prefix_len drops the default route, like from a fetched list.
+		{"too broad", nil, parsePrefixes(t, "192.0.2.0/24")},
+		{"missing required", []string{"198.51.100.0/24"}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+			cancel()
+			r := WedosIPRange{URL: url, CacheFile: path, Required: tc.required}
+			if err := r.Provision(ctx); err != nil {
+				t.Fatalf("error provisioning: %v", err)
+			}
+			if got := r.GetIPRanges(nil); !slices.Equal(got, tc.want) {
+				t.Errorf("expected %v loaded, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCacheFlushSkippedAfterReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.txt")
+	old := newTestRange("https://example.com/ips.txt")
+	old.CacheFile = path
+	old.setRanges(parsePrefixes(t, "192.0.2.0/24"), time.Now().Add(-time.Hour))
+	reloaded := newTestRange(old.URL)
+	reloaded.CacheFile = path
+	withInstances(t, old, reloaded)
+
+	want := parsePrefixes(t, "198.51.100.0/24")
+	reloaded.saveCache(want, time.Now())
+	// The old instance stops after the new one took over the file.
+	old.Cleanup()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := parseCache(data)
+	if err != nil {
+		t.Fatalf("parsing cache: %v", err)
+	}
+	if !slices.Equal(e.Prefixes, want) {
+		t.Errorf("expected the new instance's cache kept, got %v", e.Prefixes)
+	}
+}
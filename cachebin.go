@@ -0,0 +1,135 @@
+package caddy_wedos_ip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"time"
+)
+
+// Cache file formats accepted by the cache_format option.
+const (
+	cacheFormatText   = "text"
+	cacheFormatBinary = "binary"
+)
+
+// binaryCacheMagic starts every binary cache file, followed by a version.
+var binaryCacheMagic = []byte("WDIP")
+
+const binaryCacheVersion = 1
+
+// formatBinaryCache renders a cache entry in the compact binary format:
+// the magic and version, the source and ETag as length-prefixed strings,
+// the serial, the update time in Unix nanoseconds, the prefix count, and
+// for every prefix its address length (4 or 16), address and length in
+// bits. Integers are uvarints except the fixed-size serial and time.
+func formatBinaryCache(e cacheEntry) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, 32+len(e.Source)+len(e.ETag)+18*len(e.Prefixes)))
+	buf.Write(binaryCacheMagic)
+	buf.WriteByte(binaryCacheVersion)
+	writeString(buf, e.Source)
+	writeString(buf, e.ETag)
+	buf.Write(binary.BigEndian.AppendUint64(nil, e.Serial))
+	buf.Write(binary.BigEndian.AppendUint64(nil, uint64(e.Updated.UnixNano())))
+	buf.Write(binary.AppendUvarint(nil, uint64(len(e.Prefixes))))
+	for _, p := range e.Prefixes {
+		addr := p.Addr().AsSlice()
+		buf.WriteByte(byte(len(addr)))
+		buf.Write(addr)
+		buf.WriteByte(byte(p.Bits()))
+	}
+	return buf.Bytes()
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	buf.Write(binary.AppendUvarint(nil, uint64(len(s))))
+	buf.WriteString(s)
+}
+
+// errTruncatedCache is returned for a binary cache file cut short.
+var errTruncatedCache = errors.New("truncated binary cache")
+
+// parseBinaryCache parses data written by formatBinaryCache.
+func parseBinaryCache(data []byte) (cacheEntry, error) {
+	var e cacheEntry
+	r := bytes.NewReader(data)
+	magic := make([]byte, len(binaryCacheMagic)+1)
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic[:len(binaryCacheMagic)], binaryCacheMagic) {
+		return e, fmt.Errorf("not a binary cache")
+	}
+	if v := magic[len(binaryCacheMagic)]; v != binaryCacheVersion {
+		return e, fmt.Errorf("unsupported binary cache version %d", v)
+	}
+
+	var err error
+	if e.Source, err = readString(r); err != nil {
+		return e, err
+	}
+	if e.ETag, err = readString(r); err != nil {
+		return e, err
+	}
+	var fixed [16]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return e, errTruncatedCache
+	}
+	e.Serial = binary.BigEndian.Uint64(fixed[:8])
+	e.Updated = time.Unix(0, int64(binary.BigEndian.Uint64(fixed[8:]))).UTC()
+
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return e, errTruncatedCache
+	}
+	// Each prefix takes at least 6 bytes, which bounds the allocation.
+	if n > uint64(r.Len())/6 {
+		return e, errTruncatedCache
+	}
+	e.Prefixes = make([]netip.Prefix, 0, n)
+	var addr [16]byte
+	for i := uint64(0); i < n; i++ {
+		size, err := r.ReadByte()
+		if err != nil {
+			return e, errTruncatedCache
+		}
+		if size != 4 && size != 16 {
+			return e, fmt.Errorf("prefix %d: invalid address length %d", i+1, size)
+		}
+		if _, err := io.ReadFull(r, addr[:size]); err != nil {
+			return e, errTruncatedCache
+		}
+		bits, err := r.ReadByte()
+		if err != nil {
+			return e, errTruncatedCache
+		}
+		a, _ := netip.AddrFromSlice(addr[:size])
+		p := netip.PrefixFrom(a, int(bits))
+		if !p.IsValid() {
+			return e, fmt.Errorf("prefix %d: invalid length %d for %s", i+1, bits, a)
+		}
+		e.Prefixes = append(e.Prefixes, p)
+	}
+	if r.Len() != 0 {
+		return e, fmt.Errorf("%d trailing bytes in binary cache", r.Len())
+	}
+	return e, nil
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		return "", errTruncatedCache
+	}
+	b := make([]byte, n)
+	io.ReadFull(r, b)
+	return string(b), nil
+}
+
+// parseCacheEntry parses a decompressed cache file in either format.
+func parseCacheEntry(data []byte) (cacheEntry, error) {
+	if bytes.HasPrefix(data, binaryCacheMagic) {
+		return parseBinaryCache(data)
+	}
+	return parseCache(data)
+}
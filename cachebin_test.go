@@ -0,0 +1,80 @@
+package caddy_wedos_ip
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestBinaryCacheRoundTrip(t *testing.T) {
+	in := cacheEntry{
+		Source:   "https://example.com/ips.txt",
+		ETag:     `"v1"`,
+		Serial:   2025010101,
+		Updated:  time.Date(2025, 1, 2, 3, 4, 5, 6, time.UTC),
+		Prefixes: parsePrefixes(t, "192.0.2.0/24", "198.51.100.7/32", "2001:db8::/32", "::/0"),
+	}
+	data := formatBinaryCache(in)
+	out, err := parseCacheEntry(data)
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if out.Source != in.Source || out.ETag != in.ETag || out.Serial != in.Serial || !out.Updated.Equal(in.Updated) || !slices.Equal(out.Prefixes, in.Prefixes) {
+		t.Errorf("round trip mismatch: got %+v, want %+v", out, in)
+	}
+
+	for i := range data {
+		if _, err := parseBinaryCache(data[:i]); err == nil {
+			t.Errorf("expected an error for a file truncated to %d bytes", i)
+		}
+	}
+	if _, err := parseBinaryCache(append(slices.Clone(data), 0)); err == nil {
+		t.Error("expected an error for trailing bytes")
+	}
+}
+
+func TestBinaryCacheSmaller(t *testing.T) {
+	var prefixes []netip.Prefix
+	for i := 0; i < 1000; i++ {
+		prefixes = append(prefixes, netip.MustParsePrefix(fmt.Sprintf("10.%d.%d.0/24", i/256, i%256)))
+	}
+	e := cacheEntry{Source: "https://example.com/ips.txt", Updated: time.Now(), Prefixes: prefixes}
+	if text, bin := len(formatCache(e)), len(formatBinaryCache(e)); bin >= text {
+		t.Errorf("expected the binary cache (%d bytes) to be smaller than the text one (%d bytes)", bin, text)
+	}
+}
+
+func TestCacheFormatAutoDetected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	want := parsePrefixes(t, "192.0.2.0/24", "2001:db8::/32")
+
+	for _, format := range []string{cacheFormatBinary, cacheFormatText, cacheFormatBinary} {
+		for _, compress := range []bool{false, true} {
+			writer := WedosIPRange{URL: "https://example.com/ips.txt", CacheFile: path, CacheFormat: format, CacheCompress: compress, logger: zap.NewNop()}
+			writer.saveCache(want, time.Now())
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := bytes.HasPrefix(data, binaryCacheMagic); got != (format == cacheFormatBinary && !compress) {
+				t.Errorf("%s, compress %v: unexpected binary magic %v", format, compress, got)
+			}
+
+			// The reader's own cache_format does not matter.
+			reader := WedosIPRange{URL: "https://example.com/ips.txt", CacheFile: path, lock: new(sync.RWMutex), applyLock: new(sync.Mutex), logger: zap.NewNop()}
+			reader.loadCache()
+			if got := reader.GetIPRanges(nil); !slices.Equal(got, want) {
+				t.Errorf("%s, compress %v: loaded %v, want %v", format, compress, got, want)
+			}
+		}
+	}
+}
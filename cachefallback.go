@@ -0,0 +1,86 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+)
+
+// checkCacheFallback validates CacheFallbackAfter.
+func (s *WedosIPRange) checkCacheFallback() error {
+	if s.CacheFallbackAfter < 0 {
+		return fmt.Errorf("cache_fallback_after must not be negative")
+	}
+	if s.CacheFallbackAfter > 0 && s.CacheFile == "" {
+		return fmt.Errorf("cache_fallback_after requires cache_file")
+	}
+	return nil
+}
+
+// networkFailure reports whether err means the source couldn't be reached,
+// as opposed to answering with something unusable.
+func networkFailure(err error) bool {
+	switch classifyError(err) {
+	case errClassTimeout, errClassDNS, errClassConnection:
+		return true
+	}
+	return false
+}
+
+// cacheFallback counts a failed refresh and, from the CacheFallbackAfter-th
+// network failure in a row, reloads the cache file if another process
+// updated it since it was last looked at and it holds newer ranges. Only
+// called by the refresh goroutine.
+func (s *WedosIPRange) cacheFallback(err error) {
+	if !networkFailure(err) {
+		s.netFailures = 0
+		return
+	}
+	s.netFailures++
+	if s.netFailures < s.CacheFallbackAfter {
+		return
+	}
+
+	fi, err := os.Stat(s.CacheFile)
+	if err != nil || fi.ModTime().Equal(s.cacheFallbackMod) {
+		return
+	}
+	s.cacheFallbackMod = fi.ModTime()
+	data, err := os.ReadFile(s.CacheFile)
+	if err == nil {
+		data, err = decodeCache(data)
+	}
+	var e cacheEntry
+	if err == nil {
+		e, err = parseCacheEntry(data)
+	}
+	if err != nil {
+		s.logger.Warn("reloading cache_file failed", zap.String("path", s.CacheFile), zap.Error(err))
+		return
+	}
+	if e.Source != s.source() {
+		return
+	}
+	updated := e.Updated
+	if updated.IsZero() {
+		updated = fi.ModTime()
+	}
+	s.lock.RLock()
+	last := s.lastRefresh
+	s.lock.RUnlock()
+	// Also skips the file as this module last wrote it.
+	if !updated.After(last) {
+		return
+	}
+	if err := s.applyStored(cacheEntry{ETag: e.ETag, Serial: e.Serial, Updated: updated, Prefixes: e.Prefixes}); err != nil {
+		s.logger.Warn("cache_file not reloaded", zap.String("path", s.CacheFile), zap.Error(err))
+		return
+	}
+	s.logger.Info("reloaded WEDOS IP ranges from cache_file after network failures",
+		zap.String("path", s.CacheFile),
+		zap.Int("count", len(e.Prefixes)),
+		zap.Int("consecutive_network_failures", s.netFailures),
+		zap.Time("updated", updated),
+		zap.Duration("age", ageAt(s.now(), updated)))
+}
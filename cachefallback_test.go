@@ -0,0 +1,68 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestCacheFallback(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	s := newTestRange(srv.URL)
+	s.CacheFallbackAfter = 2
+	core, logs := observer.New(zap.InfoLevel)
+	s.logger = zap.New(core)
+	now := time.Now()
+	s.setRanges(parsePrefixes(t, "192.0.2.0/24"), now.Add(-2*time.Hour))
+
+	// A sidecar with connectivity wrote newer ranges.
+	s.CacheFile = writeCache(t, cacheEntry{Source: s.source(), Updated: now.Add(-time.Hour), Prefixes: parsePrefixes(t, "198.51.100.0/24")})
+	want := parsePrefixes(t, "198.51.100.0/24")
+
+	if err := s.refresh(); err == nil {
+		t.Fatal("expected the refresh to fail")
+	}
+	if slices.Equal(s.GetIPRanges(nil), want) {
+		t.Fatal("expected no reload before cache_fallback_after failures")
+	}
+	s.refresh()
+	if got := s.GetIPRanges(nil); !slices.Equal(got, want) {
+		t.Fatalf("expected the cache file reloaded, got %v", got)
+	}
+	s.refresh()
+	if n := logs.FilterMessageSnippet("reloaded").Len(); n != 1 {
+		t.Errorf("expected an unmodified cache file not to be reloaded, got %d reloads", n)
+	}
+
+	// Older ranges than the applied ones are ignored, even in a new file.
+	older := cacheEntry{Source: s.source(), Updated: now.Add(-3 * time.Hour), Prefixes: parsePrefixes(t, "203.0.113.0/24")}
+	if err := os.WriteFile(s.CacheFile, formatCache(older), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(s.CacheFile, now, now.Add(time.Second))
+	s.refresh()
+	if got := s.GetIPRanges(nil); !slices.Equal(got, want) {
+		t.Errorf("expected older cached ranges to be ignored, got %v", got)
+	}
+}
+
+func TestCacheFallbackNetworkOnly(t *testing.T) {
+	if !networkFailure(context.DeadlineExceeded) {
+		t.Error("expected a timeout to be a network failure")
+	}
+	if networkFailure(&StatusError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}) {
+		t.Error("expected a status error not to be a network failure")
+	}
+	s := &WedosIPRange{CacheFallbackAfter: 1}
+	if err := s.checkCacheFallback(); err == nil {
+		t.Error("expected cache_fallback_after without cache_file to be rejected")
+	}
+}
@@ -0,0 +1,46 @@
+package caddy_wedos_ip
+
+import (
+	"os"
+
+	"go.uber.org/zap"
+)
+
+// verifyCache compares the hash of the fetched ranges in memory with that
+// of the ranges in the cache file, which hold the same list after every
+// successful refresh, and warns if they differ. It runs on the refresh
+// goroutine, so no refresh can be between applying and saving a list.
+func (s *WedosIPRange) verifyCache() {
+	s.lock.RLock()
+	fetched, updated := s.fetched, s.lastRefresh
+	s.lock.RUnlock()
+	// Nothing was persisted yet.
+	if updated.IsZero() {
+		return
+	}
+
+	data, err := os.ReadFile(s.CacheFile)
+	if err == nil {
+		data, err = decodeCache(data)
+	}
+	var e cacheEntry
+	if err == nil {
+		e, err = parseCacheEntry(data)
+	}
+	if err != nil {
+		s.logger.Warn("verifying cache_file failed", zap.String("path", s.CacheFile), zap.Error(err))
+		return
+	}
+
+	memHash, fileHash := contentHash(fetched), contentHash(e.Prefixes)
+	if memHash != fileHash {
+		s.logger.Warn("in-memory WEDOS IP ranges do not match cache_file",
+			zap.String("path", s.CacheFile),
+			zap.String("memory_hash", memHash),
+			zap.Int("memory_count", len(fetched)),
+			zap.String("cache_hash", fileHash),
+			zap.Int("cache_count", len(e.Prefixes)))
+		return
+	}
+	s.logger.Debug("in-memory WEDOS IP ranges match cache_file", zap.String("hash", memHash))
+}
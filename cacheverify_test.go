@@ -0,0 +1,42 @@
+package caddy_wedos_ip
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestVerifyCache(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	s := newTestRange("https://example.com/ips.txt")
+	s.logger = zap.New(core)
+	s.CacheFile = writeCache(t, cacheEntry{Source: s.URL, Updated: time.Now(), Prefixes: parsePrefixes(t, "192.0.2.0/24", "198.51.100.0/24")})
+
+	// Nothing applied yet, so nothing to compare.
+	s.verifyCache()
+	if logs.Len() != 0 {
+		t.Errorf("expected no warnings before the first refresh, got %v", logs.All())
+	}
+
+	// The same set in another order matches.
+	s.setRanges(parsePrefixes(t, "198.51.100.0/24", "192.0.2.0/24"), time.Now())
+	s.verifyCache()
+	if logs.Len() != 0 {
+		t.Errorf("expected no warnings for a matching cache, got %v", logs.All())
+	}
+
+	s.setRanges(parsePrefixes(t, "192.0.2.0/24"), time.Now())
+	s.verifyCache()
+	if n := logs.FilterMessage("in-memory WEDOS IP ranges do not match cache_file").Len(); n != 1 {
+		t.Errorf("expected a mismatch warning, got %v", logs.All())
+	}
+
+	s.CacheFile = filepath.Join(t.TempDir(), "missing.txt")
+	s.verifyCache()
+	if n := logs.FilterMessage("verifying cache_file failed").Len(); n != 1 {
+		t.Errorf("expected a warning for an unreadable cache, got %v", logs.All())
+	}
+}
@@ -3,16 +3,27 @@
 package caddy_wedos_ip
 
 import (
-	"bufio"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/dustin/go-humanize"
+	"github.com/quic-go/quic-go/http3"
+	"go.uber.org/zap"
 )
 
 const (
@@ -25,16 +36,660 @@ func init() {
 
 // WedosIPRange provides a range of IP address prefixes (CIDRs) retrieved from WEDOS Global.
 type WedosIPRange struct {
+	// URL of the IP list. Defaults to the WEDOS Global ips.txt.
+	URL string `json:"url,omitempty"`
+	// GitRaw is the URL template of a raw file in a Git repository, with
+	// {ref} replaced by GitRef (default "main"). Pinning GitRef to a
+	// reviewed commit pins the list. It sets URL.
+	GitRaw string `json:"git_raw,omitempty"`
+	GitRef string `json:"git_ref,omitempty"`
+	// Mirrors serve the same list as URL and are tried in order when it
+	// fails. Not used with URLv4/URLv6 or DNSTXT.
+	Mirrors []string `json:"mirrors,omitempty"`
+	// SourceFormats overrides Format for the list at a source URL, keyed by
+	// URL, so mirrors serving different formats are each parsed correctly.
+	SourceFormats map[string]string `json:"source_formats,omitempty"`
+	// SourceMaxFailures disables URL or a mirror for SourceCooldown after
+	// this many consecutive failures, after which it is probed again.
+	// Defaults: 3 and 10m.
+	SourceMaxFailures int            `json:"source_max_failures,omitempty"`
+	SourceCooldown    caddy.Duration `json:"source_cooldown,omitempty"`
+	// Source is "url" (the default) to fetch and refresh from the URLs,
+	// "file" to read File on every refresh, "stdin" to read the ranges
+	// once from standard input at startup and never refresh them, or
+	// "env" to read them once from the Env variable.
+	Source string `json:"source,omitempty"`
+	// File is the local list read by the "file" source. Setting it
+	// selects that source.
+	File string `json:"file,omitempty"`
+	// Env names the environment variable holding the space or newline
+	// separated CIDRs read by the "env" source. Setting it selects that
+	// source.
+	Env string `json:"env,omitempty"`
+	// Watch reloads File as soon as it changes, in addition to the
+	// interval refreshes.
+	Watch bool `json:"watch,omitempty"`
+	// SSEURL is a Server-Sent Events channel pushing the whole list as the
+	// data of each event. While it is connected, pushed lists are applied
+	// as they arrive and the interval refreshes are skipped; when it drops
+	// or can't be reached, the module polls until it reconnects. Only
+	// supported with a single URL.
+	SSEURL string `json:"sse_url,omitempty"`
+	// TriggerFile is a sentinel file whose change, including a touch that
+	// only updates its mtime, triggers an immediate refresh in addition to
+	// the interval ones, for any source.
+	TriggerFile string `json:"trigger_file,omitempty"`
+	// URLv4 and URLv6 fetch IPv4 and IPv6 ranges from separate lists and
+	// merge them. When either is set, URL is not used.
+	URLv4 string `json:"url_v4,omitempty"`
+	URLv6 string `json:"url_v6,omitempty"`
+	// DNSTXT is a DNS name whose TXT records hold CIDRs. The records are
+	// merged with the URL list; without a URL they are the only source.
+	DNSTXT string `json:"dns_txt,omitempty"`
+	// Family keeps only the fetched prefixes of one address family, "ipv4"
+	// or "ipv6". With FamilyMode "soft" (the default) others are dropped
+	// and logged; with "hard" they fail the fetch.
+	Family     string `json:"family,omitempty"`
+	FamilyMode string `json:"family_mode,omitempty"`
+	// PartialFallback keeps the merged set complete when one of DNSTXT,
+	// URL, URLv4 and URLv6 fails but another succeeds: the failed source
+	// contributes the prefixes of its last successful fetch instead of
+	// failing the refresh.
+	PartialFallback bool `json:"partial_fallback,omitempty"`
+	// CheckRoutes looks up each applied prefix in the host's routing table
+	// after a refresh and logs the ones no route covers, hinting at a
+	// network misconfiguration on routers and gateways. Linux only.
+	CheckRoutes bool `json:"check_routes,omitempty"`
+	// WarnSelfOverlap reads the addresses of the host's interfaces at
+	// Provision and, after each refresh, logs the fetched prefixes
+	// containing one: the host would trust itself as a proxy, usually a
+	// sign of an overly broad list or a misconfiguration.
+	WarnSelfOverlap bool `json:"warn_self_overlap,omitempty"`
+	// DryValidate checks Exclude and Pinned against the first fetched list
+	// and logs the exclude entries matching nothing and the pinned entries
+	// the list already covers. Informational only.
+	DryValidate bool `json:"dry_validate,omitempty"`
+	// QuarantineFile holds back a fetched list that changes more than
+	// QuarantineMaxChange percent of the prefixes, grows their count by as
+	// much, or adds a prefix broader than a trusted one: the list is
+	// written to this file as JSON and the previous ranges are kept until
+	// it is approved through the admin API.
+	QuarantineFile string `json:"quarantine_file,omitempty"`
+	// QuarantineMaxChange is the percentage of changed prefixes beyond
+	// which QuarantineFile holds a list back. Defaults to 25.
+	QuarantineMaxChange int `json:"quarantine_max_change,omitempty"`
+	// MergePolicy reconciles DNSTXT with the URL lists: "union" (the
+	// default) keeps every prefix, "primary-wins" drops the DNSTXT prefixes
+	// overlapping a prefix of the URL lists.
+	MergePolicy string `json:"merge_policy,omitempty"`
+	// ApplyMode is "best-effort" (the default), where the min prefix length
+	// and verify_asn guards drop offending prefixes and apply the rest, or
+	// "verified", where any prefix they reject fails the whole list. Either
+	// way every guard runs on the candidate list before it is swapped in,
+	// and a failing guard keeps the previous ranges.
+	ApplyMode string `json:"apply_mode,omitempty"`
+	// SignatureURL is the URL of a detached Ed25519 signature of the list
+	// at URL, raw or base64-encoded. A list that does not verify against
+	// PublicKey is rejected. Requires PublicKey.
+	SignatureURL string `json:"signature_url,omitempty"`
+	// PublicKey is the path of the PEM-encoded Ed25519 public key used to
+	// verify SignatureURL.
+	PublicKey string `json:"public_key,omitempty"`
+	// Format of the list: "text" (whitespace-separated CIDRs), "json",
+	// "labeled" (one CIDR per line followed by an ignored label), "range"
+	// (text that may also hold start-end address ranges), the name of a
+	// parser registered with RegisterRangeParser, or "auto" (the
+	// default) to choose between text and JSON by URL extension and
+	// Content-Type.
+	Format string `json:"format,omitempty"`
+	// JSONPath locates the CIDRs in a JSON list, as a dotted path with
+	// bracket indexes where "[]" selects every array element, e.g.
+	// "data.prefixes[].cidr". It may end at strings, arrays of strings or
+	// objects with a CIDR field such as "cidr" or "ip_prefix".
+	JSONPath string `json:"json_path,omitempty"`
 	// refresh Interval
 	Interval caddy.Duration `json:"interval,omitempty"`
-	// request Timeout
+	// AdaptInterval stretches the effective interval to AdaptIntervalFactor
+	// (2 by default) times the refresh duration once several scheduled
+	// refreshes in a row took longer than Interval, until one is quick
+	// again. Either way such refreshes are logged as a warning.
+	AdaptInterval       bool `json:"adapt_interval,omitempty"`
+	AdaptIntervalFactor int  `json:"adapt_interval_factor,omitempty"`
+	// Schedule is a five-field cron expression (minute hour day month
+	// weekday, local time) for refreshes. It takes precedence over Interval.
+	Schedule string `json:"schedule,omitempty"`
+	// Timeout bounds each HTTP attempt, including reading the body. Its
+	// context derives from that of MaxCycleDuration, so a hung attempt
+	// gives up after Timeout and leaves the rest of the cycle budget to
+	// the retries. "per_try_timeout" in the Caddyfile.
 	Timeout caddy.Duration `json:"timeout,omitempty"`
+	// ConnectTimeout bounds establishing the TCP connection, separately
+	// from the overall request Timeout.
+	ConnectTimeout caddy.Duration `json:"connect_timeout,omitempty"`
+	// MaxCycleDuration bounds one whole refresh cycle, including all
+	// sources, mirrors, checksum and signature fetches. When it runs out,
+	// the current ranges are kept until the next cycle. It also bounds the
+	// retries of PerCycleRetries, so a retrying cycle always ends.
+	// "cycle_timeout" in the Caddyfile.
+	MaxCycleDuration caddy.Duration `json:"max_cycle_duration,omitempty"`
+	// Tracing emits an OpenTelemetry span for each fetch, using the
+	// tracer provider of the context or the global one. Without a
+	// configured provider the spans are no-ops.
+	Tracing bool `json:"tracing,omitempty"`
+	// Aggregate merges adjacent prefixes into their parent after each fetch.
+	Aggregate bool `json:"aggregate,omitempty"`
+	// RequireOnStart makes Provision fail if the initial fetch fails,
+	// instead of starting with an empty set.
+	RequireOnStart bool `json:"require_on_start,omitempty"`
+	// TestIP is an address known to be trusted, checked against the ranges
+	// after the initial fetch to catch a source or format that fetches
+	// fine but doesn't cover it. With RequireOnStart a miss fails
+	// Provision, otherwise it is logged as an error.
+	TestIP string `json:"test_ip,omitempty"`
+	// StartupRetries is how many times a failed first fetch is retried,
+	// StartupRetryDelay apart (2s by default), before giving up until the
+	// next interval or, with RequireOnStart, failing provisioning.
+	StartupRetries    int            `json:"startup_retries,omitempty"`
+	StartupRetryDelay caddy.Duration `json:"startup_retry_delay,omitempty"`
+	// VerifyStartupStability applies the first fetched list only once a
+	// fetch StartupStabilityDelay later (5s by default) returns the same
+	// set, fetching again while they differ, and reports the module
+	// healthy only then.
+	VerifyStartupStability bool           `json:"verify_startup_stability,omitempty"`
+	StartupStabilityDelay  caddy.Duration `json:"startup_stability_delay,omitempty"`
+	// RefetchOnParseError fetches a list that fails to parse on a
+	// scheduled refresh once more RefetchDelay later (2s by default)
+	// before the cycle fails, recovering from a mirror caught mid-write
+	// without waiting for the next interval.
+	RefetchOnParseError bool           `json:"refetch_on_parse_error,omitempty"`
+	RefetchDelay        caddy.Duration `json:"refetch_delay,omitempty"`
+	// PerCycleRetries is how many times a fetch failing with a 5xx status
+	// or a network error is retried within the same refresh cycle, a short
+	// fixed delay apart, before the cycle gives up.
+	PerCycleRetries int `json:"per_cycle_retries,omitempty"`
+	// StartupTimeout bounds the total time spent retrying the first fetch.
+	StartupTimeout caddy.Duration `json:"startup_timeout,omitempty"`
+	// MinPrefixLenV4 and MinPrefixLenV6 drop fetched prefixes broader than
+	// this, such as 0.0.0.0/0, which would trust the whole internet.
+	// Defaults: 8 and 16.
+	MinPrefixLenV4 int `json:"min_prefix_len_v4,omitempty"`
+	MinPrefixLenV6 int `json:"min_prefix_len_v6,omitempty"`
+	// ApplyDelay debounces a flapping upstream: a changed list is fetched
+	// again after this delay and applied only if both fetches agree.
+	ApplyDelay caddy.Duration `json:"apply_delay,omitempty"`
+	// ShrinkGrace keeps trusting the prefixes a fetched list no longer
+	// contains for this long after their removal, so clients behind them
+	// aren't cut off abruptly. Zero drops them right away.
+	ShrinkGrace caddy.Duration `json:"shrink_grace,omitempty"`
+	// Additive unions each fetched list with the current ranges instead of
+	// replacing them, so the trusted set never shrinks until it is reset
+	// through the admin API.
+	Additive bool `json:"additive,omitempty"`
+	// Required lists prefixes the fetched list itself must contain, exactly
+	// or within a broader prefix. A list missing any of them is rejected and
+	// the previous ranges are kept. Unlike Pinned, they are never added.
+	Required []string `json:"required,omitempty"`
+	// MinPrefixes rejects a fetched list with fewer prefixes than this, so
+	// a truncated download keeps the previous ranges. Zero disables it.
+	MinPrefixes int `json:"min_prefixes,omitempty"`
+	// MaxMemory rejects a fetched list whose set is estimated to take more
+	// than this many bytes (the prefix count times the size of a prefix),
+	// keeping the previous ranges, for memory-constrained devices.
+	MaxMemory int64 `json:"max_memory,omitempty"`
+	// ScanBufferSize is the longest line, or token of a whitespace
+	// separated list, the parsers accept, in bytes. It bounds what is
+	// buffered at a time, not the size of the list. Defaults to 1MiB.
+	ScanBufferSize int64 `json:"scan_buffer_size,omitempty"`
+	// VerifyASN drops fetched prefixes that the registered PrefixVerifier
+	// does not attribute to this autonomous system number.
+	VerifyASN uint32 `json:"verify_asn,omitempty"`
+	// LogChanges logs the prefixes added and removed by each refresh.
+	LogChanges bool `json:"log_changes,omitempty"`
+	// DebugParse logs, for each refresh, every token of a text list with
+	// how it parsed, and every prefix with whether it was kept or why it
+	// was dropped. At most DebugParseMax lines (default 200) are logged
+	// per refresh.
+	DebugParse    bool `json:"debug_parse,omitempty"`
+	DebugParseMax int  `json:"debug_parse_max,omitempty"`
+	// DebugDistribution logs, after each refresh, how the applied ranges
+	// spread over /8 (IPv4) and /16 (IPv6) blocks, listing the
+	// DebugDistributionMax largest (default 10) per family.
+	DebugDistribution    bool `json:"debug_distribution,omitempty"`
+	DebugDistributionMax int  `json:"debug_distribution_max,omitempty"`
+	// CacheFile persists the applied ranges and their ETag. At startup the
+	// ranges are served from it immediately while a conditional request
+	// revalidates them in the background.
+	CacheFile string `json:"cache_file,omitempty"`
+	// CacheCompress gzip-compresses the cache file. Compressed and plain
+	// caches are both detected on load.
+	CacheCompress bool `json:"cache_compress,omitempty"`
+	// CacheFormat is "text" (the default) or "binary", a compact encoding
+	// that loads faster for very large lists. Either is read on load.
+	CacheFormat string `json:"cache_format,omitempty"`
+	// CacheMaxAge skips seeding from a cache file last updated longer ago
+	// than this, so a long-dormant node doesn't boot trusting outdated
+	// ranges. The embedded timestamp is used, or the file's mtime without
+	// one. Zero means no limit.
+	CacheMaxAge caddy.Duration `json:"cache_max_age,omitempty"`
+	// CacheFallbackAfter reloads the cache file once this many refreshes
+	// in a row failed to reach the source, and after each further one, if
+	// it was modified and holds newer ranges: a process with connectivity
+	// can then feed a disconnected node. Zero disables it.
+	CacheFallbackAfter int `json:"cache_fallback_after,omitempty"`
+	// CacheVerifyInterval periodically compares the hash of the ranges in
+	// memory with that of the cache file and warns on a mismatch, a
+	// diagnostic for chasing state bugs. Zero (the default) disables it.
+	CacheVerifyInterval caddy.Duration `json:"cache_verify_interval,omitempty"`
+	// StorageKey keeps the ranges under this key in Caddy's configured
+	// storage, shared by every node of a cluster. The stored set is loaded
+	// synchronously at Provision, falling back to a first fetch when the
+	// key is missing; each successful refresh writes it back, and a node
+	// whose fetch fails adopts a newer set written by another node.
+	StorageKey string `json:"storage_key,omitempty"`
+	// PublishFile is written atomically after each successful refresh with
+	// the current ranges, for consumption by other tools on the host.
+	PublishFile string `json:"publish_file,omitempty"`
+	// ReportFile is rewritten atomically after each refresh cycle with a
+	// JSON report of its outcome, for monitoring agents that scrape files.
+	ReportFile string `json:"report_file,omitempty"`
+	// MaxAge is how long after the last successful refresh the ranges count
+	// as fresh for GetIPRangesWithFreshness. Zero means no limit.
+	MaxAge caddy.Duration `json:"max_age,omitempty"`
+	// Tolerate lists the classes of refresh errors ("timeout", "dns",
+	// "connection", "status" or "other") that are only logged at debug
+	// level and do not count toward the failure counters or the breaker.
+	Tolerate []string `json:"tolerate,omitempty"`
+	// TolerateStatus maps response status codes to how long after the last
+	// successful refresh they are tolerated like the classes of Tolerate,
+	// for mirrors known to answer them briefly while they regenerate. Past
+	// that they are failures again.
+	TolerateStatus map[int]caddy.Duration `json:"tolerate_status,omitempty"`
+	// NotifyURL receives a JSON POST when NotifyFailures refreshes in a row
+	// have failed or the ranges got older than MaxAge, and again on
+	// recovery. Each notification is bounded by NotifyTimeout. It is sent
+	// with a plain client: UnixSocket, the TLS settings, HTTP3 and
+	// RateLimit only apply to the list host. Defaults: 3 and 10s.
+	NotifyURL      string         `json:"notify_url,omitempty"`
+	NotifyFailures int            `json:"notify_failures,omitempty"`
+	NotifyTimeout  caddy.Duration `json:"notify_timeout,omitempty"`
+	// AllowEmpty applies a successful response holding no prefixes, which
+	// is rejected by default as it usually means a publishing bug upstream.
+	// Either way it is counted in wedos_ip_empty_response_total.
+	AllowEmpty bool `json:"allow_empty,omitempty"`
+	// WarnInterval limits how often repeated refresh failures are logged.
+	// The first failure and the recovery are always logged.
+	WarnInterval caddy.Duration `json:"warn_interval,omitempty"`
+	// BreakerThreshold opens a circuit breaker after this many consecutive
+	// failures. While open, the delay between attempts doubles up to
+	// BreakerMaxDelay. Zero disables the breaker.
+	BreakerThreshold int `json:"breaker_threshold,omitempty"`
+	// BreakerMaxDelay caps the delay while the breaker is open. Default: 24h.
+	BreakerMaxDelay caddy.Duration `json:"breaker_max_delay,omitempty"`
+	// OnUpdateCommand is run after a refresh that changed the ranges, with
+	// the new ranges on stdin, one CIDR per line. Failures are only logged.
+	OnUpdateCommand []string `json:"on_update_command,omitempty"`
+	// OnUpdateTimeout bounds OnUpdateCommand. Default: 30s.
+	OnUpdateTimeout caddy.Duration `json:"on_update_timeout,omitempty"`
+	// Region keeps only the prefixes of a labeled list with one of these
+	// labels, such as "eu" for "192.0.2.0/24 eu". It requires the labeled
+	// format. Empty keeps all prefixes.
+	Region []string `json:"region,omitempty"`
+	// EntryTTL reads a "ttl=" label on the entries of a labeled list, in
+	// seconds or as a duration such as "ttl=30m", and drops each entry
+	// once its TTL has elapsed since the fetch, without waiting for the
+	// next refresh. It requires the labeled format.
+	EntryTTL bool `json:"entry_ttl,omitempty"`
+	// Tiers partitions the ranges by a "proxy" or "direct" label on the
+	// entries of a labeled list, for GetProxyRanges and GetDirectRanges.
+	// Only entries labeled "proxy" and the pinned ranges are in the proxy
+	// tier; unlabeled entries and ranges of unknown tier are direct.
+	// GetIPRanges still returns both. It requires the labeled format.
+	Tiers bool `json:"tiers,omitempty"`
+	// Transform names registered list transforms, such as "first-column"
+	// or "strip-comments", applied in order to each list before it is
+	// parsed.
+	Transform []string `json:"transform,omitempty"`
+	// TransformCommand is run with each list on stdin before Transform;
+	// its standard output is parsed instead.
+	TransformCommand []string `json:"transform_command,omitempty"`
+	// Sets are additional named range sets, each with its own URL and
+	// options, selected per request through HostSets.
+	Sets map[string]*WedosIPRange `json:"sets,omitempty"`
+	// HostSets maps request hosts ("example.com" or "*.example.com") to
+	// names in Sets. Requests for other hosts use this module's own ranges.
+	// For a TLS request with a server name, that is matched instead of the
+	// Host header. Both are chosen by the client, so any of them may pick
+	// the set it is judged by: a set must not trust more than the default.
+	HostSets map[string]string `json:"host_sets,omitempty"`
+	// SNISets maps TLS server names to names in Sets, like HostSets. They
+	// take precedence over HostSets for TLS requests. The server name is
+	// chosen by the client as well.
+	SNISets map[string]string `json:"sni_sets,omitempty"`
+	// BasicAuth sends HTTP Basic Auth credentials with each fetch.
+	BasicAuth *BasicAuth `json:"basic_auth,omitempty"`
+	// Method is the HTTP method of fetches: "GET" (the default) or "POST",
+	// for range APIs that filter their results by a query in the request.
+	Method string `json:"method,omitempty"`
+	// Body is the JSON request body sent with Method POST.
+	Body string `json:"body,omitempty"`
+	// TLSMinVersion is the minimum TLS version of fetches: "tls1.2" or
+	// "tls1.3". Defaults to Go's minimum.
+	TLSMinVersion string `json:"tls_min_version,omitempty"`
+	// TLSCipherSuites restricts the TLS 1.2 cipher suites of fetches, by
+	// their standard names such as TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256.
+	// TLS 1.3 suites are not configurable.
+	TLSCipherSuites []string `json:"tls_cipher_suites,omitempty"`
+	// TLSServerName is sent as SNI and verified against the certificate
+	// instead of the URL host, for mirrors addressed by IP or behind
+	// SNI-routing front-ends. It applies to every fetched URL.
+	TLSServerName string `json:"tls_server_name,omitempty"`
+	// Serial is the start of a line in the list holding its serial, such
+	// as "# serial". A fetched list with a lower serial than the applied
+	// one, or without a serial line, is rejected. Only supported with a
+	// single url, optionally with mirrors.
+	Serial string `json:"serial,omitempty"`
+	// RateLimit is the minimum time between outbound requests to the same
+	// host, across all sources and triggers of the module, with bursts of
+	// up to RateBurst (default 1). Requests over the limit wait. Only the
+	// fetches of the list are counted, not their retries, HEAD probes,
+	// signatures or the warmup.
+	RateLimit caddy.Duration `json:"rate_limit,omitempty"`
+	RateBurst int            `json:"rate_burst,omitempty"`
+	// RequireHTTPS rejects any configured URL that is not https, including
+	// NotifyURL, and the dns_txt source, at provisioning.
+	RequireHTTPS bool `json:"require_https,omitempty"`
+	// Zstd negotiates zstd or gzip compressed responses with
+	// Accept-Encoding and decodes them by their Content-Encoding.
+	Zstd bool `json:"zstd,omitempty"`
+	// SniffGzip decompresses a body starting with the gzip magic bytes
+	// even without a Content-Encoding header, for misconfigured mirrors.
+	SniffGzip bool `json:"sniff_gzip,omitempty"`
+	// Encoding unwraps a list body delivered as "base64" or "hex" before
+	// parsing it, for channels that can't carry plain text. "none" (the
+	// default) parses the body as is.
+	Encoding string `json:"encoding,omitempty"`
+	// RequestID sends a random X-Request-ID header with each fetch and logs
+	// it, so both sides can correlate a fetch attempt.
+	RequestID bool `json:"request_id,omitempty"`
+	// Proxy is the URL of an HTTP(S) or SOCKS5 proxy for fetches. Without
+	// it, the proxy environment variables apply.
+	Proxy string `json:"proxy,omitempty"`
+	// NoProxy lists hosts, domains and CIDRs fetched directly, bypassing
+	// the proxy, with NO_PROXY semantics. It replaces NO_PROXY.
+	NoProxy []string `json:"no_proxy,omitempty"`
+	// Maintenance starts the module with refreshes paused, keeping the
+	// ranges loaded from the cache file or storage frozen until
+	// POST /wedos/resume. Without any, the first fetch still runs.
+	Maintenance bool `json:"maintenance,omitempty"`
+	// ExposeRanges lists the applied ranges at GET /wedos/config on the
+	// admin API, so operators inspecting the running config can see what
+	// was actually loaded.
+	ExposeRanges bool `json:"expose_ranges,omitempty"`
+	// HTTP3 fetches https URLs over HTTP/3 (QUIC), which copes better with
+	// lossy links, falling back to HTTP/2 over TCP when it fails. It cannot
+	// be combined with Proxy or UnixSocket.
+	HTTP3 bool `json:"http3,omitempty"`
+	// UnixSocket fetches over this Unix domain socket instead of TCP,
+	// whatever the host in the URL, e.g. http://unix/ips.txt.
+	UnixSocket string `json:"unix_socket,omitempty"`
+	// Resolver is the address of a DNS server, port 53 if none is given,
+	// resolving the URL hosts, over TCP and HTTP/3, and DNSTXT instead of
+	// the system resolver.
+	Resolver string `json:"resolver,omitempty"`
+	// ParseCacheSize keeps the parsed prefixes of this many recent bodies,
+	// so a body seen before is not parsed again. Zero disables it.
+	ParseCacheSize int `json:"parse_cache_size,omitempty"`
+	// HeadProbe sends a HEAD request before each fetch and skips the GET
+	// if ETag, Last-Modified and Content-Length are unchanged, for servers
+	// that do not answer If-None-Match with 304. Only used with a single
+	// URL and its Mirrors.
+	HeadProbe bool `json:"head_probe,omitempty"`
+	// ProbeCapabilities probes URL once at startup to detect whether it
+	// honors If-None-Match, whether HEAD can stand in for it and whether
+	// it serves zstd, and fetches accordingly. Anything uncertain keeps
+	// the default fetches. Only supported with method GET.
+	ProbeCapabilities bool `json:"probe_capabilities,omitempty"`
+	// AdminAllow lists the client ranges allowed to change the ranges or
+	// refreshes through the admin API: /wedos/refresh, /wedos/override,
+	// /wedos/pause, /wedos/resume, /wedos/interval and /wedos/reset. Read
+	// endpoints stay open to any admin API client. Empty allows all.
+	AdminAllow []string `json:"admin_allow,omitempty"`
+	// Shared makes modules with identical configs, across sites and config
+	// reloads, share one background fetcher and its ranges instead of each
+	// fetching on its own. The fetcher stops when the last of them is
+	// cleaned up. It cannot be combined with Sets.
+	Shared bool `json:"shared,omitempty"`
+	// Warmup establishes a pooled connection to the upstream during
+	// Provision, so the first fetch skips the TCP and TLS handshakes.
+	Warmup bool `json:"warmup,omitempty"`
+	// Pinned ranges are always trusted, before the first fetch and no
+	// matter what the upstream list contains. They are listed separately
+	// in the admin API status.
+	Pinned []string `json:"pinned,omitempty"`
+	// RangesJSON lists more ranges trusted exactly like Pinned, for tools
+	// generating JSON configs that keep their own list apart from the
+	// hand-written pinned ranges. It has no Caddyfile form: there, use
+	// pinned.
+	RangesJSON []string `json:"ranges_json,omitempty"`
+	// IncludePrivate pins the private, loopback and link-local ranges, for
+	// internal load balancers in front of Caddy.
+	IncludePrivate bool `json:"include_private,omitempty"`
+	// Exclude lists ranges that are never trusted, whatever the upstream
+	// list or Pinned contain. A listed prefix containing an excluded range
+	// is trusted only outside it.
+	Exclude []string `json:"exclude,omitempty"`
+	// BeforeFirstFetch chooses what the module trusts until a fetch
+	// succeeds: "empty" (the default) fails closed with no ranges,
+	// "fallback" trusts the Fallback ranges, a bootstrap set that the
+	// first fetched list replaces.
+	BeforeFirstFetch string   `json:"before_first_fetch,omitempty"`
+	Fallback         []string `json:"fallback,omitempty"`
 
-	// Holds the parsed CIDR ranges from Ranges.
+	// Holds the parsed CIDR ranges from Ranges. Each refresh publishes
+	// freshly allocated, clipped slices that are never modified afterwards,
+	// so callers may hold them across refreshes; see setRanges.
 	ranges []netip.Prefix
+	// ranges indexed for Lookup, and their content hash, published with
+	// them.
+	set  *PrefixSet
+	hash string
+	// ranges partitioned by address family, see GetIPRangesByFamily.
+	ranges4 []netip.Prefix
+	ranges6 []netip.Prefix
+	// Time of the last successful refresh.
+	lastRefresh time.Time
+	// Whether NotifyURL was told about a failure it wasn't told the
+	// recovery of yet, and when. Only touched by the refresh goroutine.
+	notified   bool
+	notifiedAt time.Time
+	// Client posting to NotifyURL, see provisionNotify.
+	notifyClient *http.Client
+	// Source of the current time, see now. Nil outside tests.
+	clock func() time.Time
+	// Parsed Pinned ranges, included in ranges.
+	pinned []netip.Prefix
+	// Parsed Fallback ranges, see withFallback.
+	fallback []netip.Prefix
+	// Parsed AdminAllow ranges, see authorizeMutation.
+	adminAllow []netip.Prefix
+	// Whether DryValidate already ran. Only used by the refresh goroutine.
+	dryValidated bool
+	// Addresses of the host's interfaces, for WarnSelfOverlap.
+	selfAddrs []netip.Addr
+	// The list held back by QuarantineFile and the hashes of the lists
+	// approved and rejected through the admin API. Guarded by lock.
+	quarantined        *quarantinedList
+	quarantineApproved string
+	quarantineRejected string
+	// Parsed Exclude ranges, removed from ranges.
+	exclude []netip.Prefix
+	// Parsed Required ranges, see checkRequired.
+	required []netip.Prefix
+	// The ranges as fetched, without pinned ranges, for the cache file.
+	fetched []netip.Prefix
+	// Resolver for the hosts of URLs built from Resolver, nil for the
+	// default one.
+	resolver *net.Resolver
+	// Labels of the prefixes fetched in the running refresh cycle, see
+	// Region. Only touched by the refresh goroutine.
+	labels map[netip.Prefix][]string
+	// Expiries of the entries with a TTL, see EntryTTL, or removed within
+	// ShrinkGrace: those of the running refresh cycle and those applied,
+	// reaped by reapTimer. Only touched by the refresh goroutine.
+	pendingExpiries map[netip.Prefix]time.Time
+	expiries        map[netip.Prefix]time.Time
+	reapTimer       *time.Timer
+	// Tiers of the prefixes fetched in the running refresh cycle, true for
+	// proxy, only touched by the refresh goroutine; the proxy and direct
+	// prefixes of the applied list and the ranges of each tier, guarded by
+	// lock.
+	pendingTiers map[netip.Prefix]bool
+	proxy        []netip.Prefix
+	direct       []netip.Prefix
+	proxyRanges  []netip.Prefix
+	directRanges []netip.Prefix
+	// Cancels ctx of a module created with New.
+	stop context.CancelFunc
+	// Consecutive network failures and the cache file mtime last seen by
+	// cacheFallback. Only used by the refresh goroutine.
+	netFailures      int
+	cacheFallbackMod time.Time
+	// Whether VerifyStartupStability still waits for two startup fetches
+	// to agree. Guarded by lock.
+	unsettled bool
+	// When the running refresh cycle started, for ReportFile, and how many
+	// scheduled ones in a row took at least Interval. Only used by the
+	// refresh goroutine.
+	refreshStarted time.Time
+	slowRefreshes  int
+	// The interval stretched by AdaptInterval, zero unless adapted.
+	// Guarded by lock.
+	adaptedInterval time.Duration
+	// Whether Provision succeeded, see there.
+	provisioned bool
+	// Where StorageKey is kept, from the Caddy context or Options.
+	storage keyValueStorage
+	// When refreshes were paused, zero unless paused. Guarded by lock.
+	pausedSince time.Time
+	// HTTP/3 transport of HTTP3, closed by Cleanup.
+	h3 *http3.Transport
+	// Last good prefixes of each source, see PartialFallback, and the
+	// sources that fell back to them in the running refresh cycle, only
+	// touched by the refresh goroutine; those of the applied list,
+	// guarded by lock.
+	lastGood       map[string]goodSource
+	pendingPartial *partialError
+	partial        *partialError
+	// Parsed TestIP, invalid without one.
+	testIP netip.Addr
+	// Compiled JSONPath, nil without one.
+	jsonPath []jsonStep
+	// Temporary override set through the admin API, nil without one.
+	// Guarded by lock.
+	override *rangeOverride
+	// Parse decision log of the running refresh cycle, nil unless
+	// DebugParse is set. Only touched by the refresh goroutine.
+	pdebug *parseDebug
+	// Resolved TransformCommand and Transform, in order.
+	transforms []ListTransform
+	// Parsed TLSMinVersion, TLSCipherSuites and TLSServerName.
+	tlsMinVersion uint16
+	cipherSuites  []uint16
+	tlsServerName string
+	// The ranges of the latest fetch alone, in Additive mode.
+	latest []netip.Prefix
+
+	// Consecutive refresh failures, the last error and the circuit breaker
+	// state. Guarded by lock and only written by the refresh goroutine.
+	failures  int
+	lastError string
+	// Class of lastError, see classifyError.
+	lastErrorClass string
+	breaker        string
+	// When a refresh failure was last logged.
+	lastWarn time.Time
+	// Health of URL and Mirrors, keyed by URL. Guarded by lock.
+	health map[string]*sourceHealth
+
+	// ETag each of URL and Mirrors last served an applied list with, keyed
+	// by URL, so it is only sent back to the server that issued it, and
+	// that of the list being fetched until it is applied. pendingSource
+	// is the URL the list being fetched came from, empty unless it was
+	// fetched by fetchMirrors. Only used with a single URL and only
+	// touched by the refresh goroutine, etags also under lock for
+	// flushCache.
+	etags         map[string]string
+	pendingETag   string
+	pendingSource string
+	// Context of the running refresh cycle, see MaxCycleDuration. Only
+	// touched by the refresh goroutine.
+	cycleCtx context.Context
+	// Serial of the applied list and of the list being fetched, see
+	// Serial. Handled like etags and pendingETag.
+	serial        uint64
+	pendingSerial uint64
+	// HEAD validators of the applied lists and of the list being fetched,
+	// see HeadProbe. Handled like etags and pendingETag.
+	validators        map[string]headValidators
+	pendingValidators headValidators
+
+	// Parsed Schedule, nil if refreshing on Interval.
+	schedule *cronSchedule
+	// Signals the refresh loop that Interval was changed, see setInterval.
+	intervalChanged chan struct{}
+	// Signals the refresh loop that File or TriggerFile was changed, see
+	// watchFile, or that the push channel dropped.
+	fileChanged chan struct{}
+	// Forced refreshes for the refresh loop, see forceRefresh. forcing is
+	// the one in flight, guarded by forceLock.
+	forceRequested chan *forceCall
+	forcing        *forceCall
+	forceLock      *sync.Mutex
+	// Lists pushed on SSEURL for the refresh loop, and whether the channel
+	// is connected, see streamSSE. pushBody is the list being applied,
+	// only used by the refresh goroutine.
+	pushed        chan []byte
+	pushConnected *atomic.Bool
+	pushBody      []byte
+
+	// The fetcher of a Shared module, which holds its ranges, and its key
+	// in sharedFetchers.
+	shared        *WedosIPRange
+	sharedKeyHash string
+	// Whether this is one of the named Sets of another module.
+	setChild bool
+	// What ProbeCapabilities detected.
+	caps capabilities
+
+	// Parsed PublicKey.
+	publicKey ed25519.PublicKey
+	// Recently parsed lists, nil unless ParseCacheSize is set.
+	parsed *prefixLRU
+
+	// Basic Auth credentials with placeholders resolved.
+	username string
+	password string
+
+	// Refresh subscribers, see Subscribe.
+	subs       []chan RefreshResult
+	subsClosed bool
+	subsLock   *sync.Mutex
 
 	ctx  caddy.Context
 	lock *sync.RWMutex
+	// Held by setRanges from composing the ranges to publishing them, so
+	// a caller recomposing the applied ones, see reapplyRanges, cannot
+	// interleave with a refresh and publish a stale list.
+	applyLock *sync.Mutex
+	logger    *zap.Logger
+	client    *http.Client
+}
+
+// BasicAuth holds HTTP Basic Auth credentials for the upstream.
+// The password may be a placeholder such as {env.WEDOS_PASSWORD}.
+type BasicAuth struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
 }
 
 // CaddyModule returns the Caddy module information.
@@ -48,139 +703,2050 @@ func (WedosIPRange) CaddyModule() caddy.ModuleInfo {
 // getContext returns a cancelable context, with a timeout if configured.
 func (s *WedosIPRange) getContext() (context.Context, context.CancelFunc) {
 	if s.Timeout > 0 {
-		return context.WithTimeout(s.ctx, time.Duration(s.Timeout))
+		return context.WithTimeout(s.baseContext(), time.Duration(s.Timeout))
 	}
-	return context.WithCancel(s.ctx)
+	return context.WithCancel(s.baseContext())
 }
 
 func (s *WedosIPRange) fetch(api string) ([]netip.Prefix, error) {
+	prefixes, _, err := s.fetchConditional(api, "")
+	return prefixes, err
+}
+
+// errNotModified is returned by fetchConditional if the list is unchanged.
+var errNotModified = errors.New("not modified")
+
+// withRequestID adds the X-Request-ID of a failed fetch to its error.
+func withRequestID(err error, reqID string) error {
+	if reqID == "" {
+		return err
+	}
+	return fmt.Errorf("request %s: %w", reqID, err)
+}
+
+// fetchConditional fetches api, sending If-None-Match if etag is set, and
+// returns the parsed prefixes with the response's ETag. It returns
+// errNotModified if the server answers 304 Not Modified. Transient
+// failures are retried up to PerCycleRetries times, see retryFetch.
+func (s *WedosIPRange) fetchConditional(api, etag string) ([]netip.Prefix, string, error) {
+	return s.retryFetch(api, func(retry bool) ([]netip.Prefix, string, error) {
+		return s.fetchAttempt(api, etag, retry)
+	})
+}
+
+// fetchAttempt makes a single request for fetchConditional. A retry is
+// not charged to RateLimit.
+func (s *WedosIPRange) fetchAttempt(api, etag string, retry bool) ([]netip.Prefix, string, error) {
 	ctx, cancel := s.getContext()
 	defer cancel()
+	if retry {
+		ctx = uncharged(ctx)
+	}
+
+	if !s.Tracing {
+		return s.fetchList(ctx, api, etag, nil)
+	}
+	ctx, span := startFetchSpan(ctx, api)
+	var ft fetchTrace
+	prefixes, newETag, err := s.fetchList(ctx, api, etag, &ft)
+	ft.end(span, len(prefixes), err)
+	return prefixes, newETag, err
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, api, nil)
+// fetchList does the work of fetchAttempt, reporting the response to ft
+// if it is not nil.
+func (s *WedosIPRange) fetchList(ctx context.Context, api, etag string, ft *fetchTrace) ([]netip.Prefix, string, error) {
+	req, err := s.newFetchRequest(ctx, api)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if s.Zstd || s.capsOf(api).zstd {
+		req.Header.Set("Accept-Encoding", acceptZstd)
+	}
+	var reqID string
+	if s.RequestID {
+		reqID = rand.Text()
+		req.Header.Set("X-Request-ID", reqID)
+		s.logger.Debug("fetching WEDOS IP ranges", zap.String("url", api), zap.String("request_id", reqID))
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := s.client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, "", withRequestID(err, reqID)
 	}
 	defer resp.Body.Close()
+	ft.setStatus(resp.StatusCode)
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, etag, errNotModified
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, "", withRequestID(&StatusError{StatusCode: resp.StatusCode, Status: resp.Status}, reqID)
+	}
+
+	tr := watchTruncation(resp)
+	body, err := decodeBody(resp, s.SniffGzip)
+	if err != nil {
+		return nil, "", withRequestID(err, reqID)
+	}
+	defer body.Close()
 
-	scanner := bufio.NewScanner(resp.Body)
-	// WEDOS ips.txt can be space-separated, so scan tokens instead of lines.
-	scanner.Split(bufio.ScanWords)
+	format := detectFormat(s.sourceFormat(api), resp)
+	prefixes, err := s.parseList(format, ft.countBytes(body))
+	// A body cut off mid-token fails to parse, but the cause is the
+	// transport, so report the truncation instead.
+	if tr.truncated {
+		s.logger.Warn("truncated response",
+			zap.String("url", redactURL(api)),
+			zap.Int64("read", tr.read),
+			zap.Int64("content_length", tr.want))
+		return nil, "", withRequestID(tr.err(), reqID)
+	}
+	if err != nil {
+		if errors.Is(err, errBadSignature) {
+			return nil, "", err
+		}
+		return nil, "", withRequestID(checkAuthProxy(api, resp, err), reqID)
+	}
+	if err := checkAuthProxy(api, resp, s.checkEmpty(api, prefixes)); err != nil {
+		return nil, "", withRequestID(err, reqID)
+	}
+	return prefixes, resp.Header.Get("ETag"), nil
+}
 
-	var prefixes []netip.Prefix
-	for scanner.Scan() {
-		tok := scanner.Text()
-		prefix, err := caddyhttp.CIDRExpressionToPrefix(tok)
+func (s *WedosIPRange) collectPrefixes() ([]netip.Prefix, error) {
+	s.labels = nil
+	s.pendingPartial = nil
+	s.pendingExpiries = nil
+	s.pendingTiers = nil
+	if s.DebugParse {
+		s.pdebug = &parseDebug{logger: s.logger, max: s.DebugParseMax}
+		defer func() {
+			s.pdebug.finish()
+			s.pdebug = nil
+		}()
+	}
+	prefixes, err := s.fetchSources()
+	if err != nil {
+		return nil, err
+	}
+	prefixes, err = s.filterFamily(prefixes)
+	if err != nil {
+		return nil, err
+	}
+	prefixes = s.filterRegion(prefixes)
+	n := len(prefixes)
+	prefixes = s.dropTooBroad(prefixes)
+	if err := s.checkVerified("min_prefix_len", n, len(prefixes)); err != nil {
+		return nil, err
+	}
+	if s.VerifyASN != 0 {
+		n = len(prefixes)
+		prefixes, err = s.verifyPrefixes(prefixes)
 		if err != nil {
 			return nil, err
 		}
-		prefixes = append(prefixes, prefix)
+		if err := s.checkVerified("verify_asn", n, len(prefixes)); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.checkMinPrefixes(prefixes); err != nil {
+		return nil, err
+	}
+	if err := s.checkRequired(prefixes); err != nil {
+		return nil, err
+	}
+	if s.Tiers {
+		s.recordTiers(prefixes)
+	}
+	s.pdebug.decide(prefixes, s.exclude)
+	if s.Aggregate {
+		stable, expiring := s.splitExpiring(prefixes)
+		prefixes = append(aggregatePrefixes(stable), expiring...)
 	}
-	if err := scanner.Err(); err != nil {
+	if err := s.checkMaxMemory(prefixes); err != nil {
 		return nil, err
 	}
 	return prefixes, nil
 }
 
-func (s *WedosIPRange) getPrefixes() ([]netip.Prefix, error) {
-	return s.fetch(wedosIPsTxt)
+func (s *WedosIPRange) Provision(ctx caddy.Context) error {
+	// Provisioning twice would start a second refresh loop, or take a
+	// second reference to the shared fetcher, and leak the first.
+	if s.provisioned {
+		if s.fetcher().ctx.Err() != nil {
+			return fmt.Errorf("module already stopped, provision a new one")
+		}
+		s.logger.Debug("module already provisioned, keeping it running")
+		return nil
+	}
+	s.logger = ctx.Logger()
+	if err := registerMetrics(ctx); err != nil {
+		return err
+	}
+	if s.Shared {
+		if err := s.provisionShared(ctx); err != nil {
+			return err
+		}
+	} else {
+		if s.StorageKey != "" {
+			s.storage = ctx.Storage()
+		}
+		if err := s.setup(ctx); err != nil {
+			return err
+		}
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	s.provisioned = true
+	return nil
 }
 
-func (s *WedosIPRange) Provision(ctx caddy.Context) error {
+// setup validates the config and prepares the module, without fetching.
+// s.logger must be set.
+func (s *WedosIPRange) setup(ctx caddy.Context) error {
 	s.ctx = ctx
 	s.lock = new(sync.RWMutex)
+	s.applyLock = new(sync.Mutex)
+	s.subsLock = new(sync.Mutex)
+	s.intervalChanged = make(chan struct{}, 1)
+	s.fileChanged = make(chan struct{}, 1)
+	s.forceRequested = make(chan *forceCall, 1)
+	s.forceLock = new(sync.Mutex)
+	s.pushed = make(chan []byte, 1)
+	s.pushConnected = new(atomic.Bool)
+	if s.Maintenance {
+		s.pausedSince = s.now()
+	}
 
-	// update in background
-	go s.refreshLoop()
-	return nil
-}
-
-func (s *WedosIPRange) refreshLoop() {
+	if s.GitRaw != "" {
+		if s.URL != "" {
+			return fmt.Errorf("git_raw and url cannot both be set")
+		}
+		raw, err := gitRawURL(s.GitRaw, s.GitRef)
+		if err != nil {
+			return err
+		}
+		s.URL = raw
+	}
+	if s.File != "" && s.Source == "" {
+		s.Source = sourceFile
+	}
+	if s.Source == sourceFile && s.File == "" {
+		return fmt.Errorf("source file requires the file option")
+	}
+	if s.Env != "" && s.Source == "" {
+		s.Source = sourceEnv
+	}
+	if s.Source == sourceEnv && s.Env == "" {
+		return fmt.Errorf("source env requires the env option")
+	}
+	if s.Watch && s.Source != sourceFile {
+		return fmt.Errorf("watch requires the file source")
+	}
+	if err := s.checkSSE(); err != nil {
+		return err
+	}
+	if s.URL == "" && s.URLv4 == "" && s.URLv6 == "" && s.DNSTXT == "" && s.Source != sourceFile {
+		s.URL = wedosIPsTxt
+	}
 	if s.Interval == 0 {
 		s.Interval = caddy.Duration(time.Hour)
 	}
+	if err := s.normalizeURLs(); err != nil {
+		return err
+	}
+	if s.RequireHTTPS {
+		if err := s.checkHTTPS(); err != nil {
+			return err
+		}
+	}
 
-	ticker := time.NewTicker(time.Duration(s.Interval))
-	// first time update
-	s.lock.Lock()
-	// it's nil anyway if there is an error
-	s.ranges, _ = s.getPrefixes()
-	s.lock.Unlock()
-	for {
-		select {
-		case <-ticker.C:
-			fullPrefixes, err := s.getPrefixes()
-			if err != nil {
-				break
-			}
+	if s.Serial != "" && (s.URLv4 != "" || s.URLv6 != "" || s.DNSTXT != "" || s.Source == sourceStdin || s.Source == sourceFile || s.Source == sourceEnv) {
+		return fmt.Errorf("serial is only supported with a single url")
+	}
+	if len(s.Mirrors) > 0 && (s.URLv4 != "" || s.URLv6 != "" || s.DNSTXT != "" || s.Source == sourceStdin || s.Source == sourceFile || s.Source == sourceEnv) {
+		return fmt.Errorf("mirrors are only supported with a single url")
+	}
+	if s.SourceMaxFailures == 0 {
+		s.SourceMaxFailures = defaultSourceMaxFailures
+	}
+	if s.SourceCooldown == 0 {
+		s.SourceCooldown = caddy.Duration(defaultSourceCooldown)
+	}
+	if s.SourceMaxFailures < 0 || s.SourceCooldown < 0 {
+		return fmt.Errorf("source_health values must not be negative")
+	}
 
-			s.lock.Lock()
-			s.ranges = fullPrefixes
-			s.lock.Unlock()
-		case <-s.ctx.Done():
-			ticker.Stop()
-			return
+	if s.MinPrefixLenV4 == 0 {
+		s.MinPrefixLenV4 = defaultMinPrefixLenV4
+	}
+	if s.MinPrefixLenV6 == 0 {
+		s.MinPrefixLenV6 = defaultMinPrefixLenV6
+	}
+	if s.MinPrefixLenV4 < 0 || s.MinPrefixLenV4 > 32 {
+		return fmt.Errorf("min_prefix_len_v4 must be between 1 and 32")
+	}
+	if s.MinPrefixLenV6 < 0 || s.MinPrefixLenV6 > 128 {
+		return fmt.Errorf("min_prefix_len_v6 must be between 1 and 128")
+	}
+
+	if s.ParseCacheSize < 0 {
+		return fmt.Errorf("parse_cache must not be negative")
+	}
+	if s.ParseCacheSize > 0 {
+		s.parsed = newPrefixLRU(s.ParseCacheSize)
+	}
+	if len(s.Region) > 0 {
+		if s.Format != formatLabeled {
+			return fmt.Errorf("region requires format labeled")
+		}
+		// The cache holds prefixes without their labels.
+		if s.ParseCacheSize > 0 {
+			return fmt.Errorf("region cannot be combined with parse_cache_size")
 		}
 	}
-}
+	if err := s.checkEntryTTL(); err != nil {
+		return err
+	}
+	if err := s.checkTiers(); err != nil {
+		return err
+	}
+	for _, class := range s.Tolerate {
+		if !slices.Contains(errClasses, class) {
+			return fmt.Errorf("unknown error class %q", class)
+		}
+	}
+	if err := s.checkTolerateStatus(); err != nil {
+		return err
+	}
+	if s.MaxCycleDuration < 0 {
+		return fmt.Errorf("max_cycle_duration must not be negative")
+	}
+	if s.PerCycleRetries < 0 {
+		return fmt.Errorf("per_cycle_retries must not be negative")
+	}
+	if s.StartupRetries < 0 || s.StartupRetryDelay < 0 || s.StartupTimeout < 0 {
+		return fmt.Errorf("startup retry values must not be negative")
+	}
+	switch s.MergePolicy {
+	case "", mergeUnion, mergePrimaryWins:
+	default:
+		return fmt.Errorf("unknown merge_policy %q", s.MergePolicy)
+	}
+	switch s.ApplyMode {
+	case "", applyBestEffort, applyVerified:
+	default:
+		return fmt.Errorf("unknown apply_mode %q", s.ApplyMode)
+	}
+	switch s.CacheFormat {
+	case "", cacheFormatText, cacheFormatBinary:
+	default:
+		return fmt.Errorf("unknown cache_format %q", s.CacheFormat)
+	}
+	if s.CacheMaxAge < 0 {
+		return fmt.Errorf("cache_max_age must not be negative")
+	}
+	if err := s.checkCacheFallback(); err != nil {
+		return err
+	}
+	if err := s.checkQuarantineOptions(); err != nil {
+		return err
+	}
+	if s.CacheVerifyInterval < 0 {
+		return fmt.Errorf("cache_verify_interval must not be negative")
+	}
+	if s.MaxAge < 0 {
+		return fmt.Errorf("max_age must not be negative")
+	}
+	if s.ApplyDelay < 0 {
+		return fmt.Errorf("apply_delay must not be negative")
+	}
+	if s.DebugParseMax < 0 {
+		return fmt.Errorf("debug_parse max must not be negative")
+	}
+	if s.DebugParseMax == 0 {
+		s.DebugParseMax = defaultDebugParseMax
+	}
+	if s.DebugDistributionMax < 0 {
+		return fmt.Errorf("debug_distribution max must not be negative")
+	}
+	if err := s.provisionStartupStability(); err != nil {
+		return err
+	}
+	if err := s.provisionRefetch(); err != nil {
+		return err
+	}
+	if err := s.checkAdaptInterval(); err != nil {
+		return err
+	}
+	if s.DebugDistribution && s.DebugDistributionMax == 0 {
+		s.DebugDistributionMax = defaultDebugDistributionMax
+	}
+	if s.MaxMemory < 0 {
+		return fmt.Errorf("max_memory must not be negative")
+	}
+	if s.ScanBufferSize < 0 {
+		return fmt.Errorf("scan_buffer_size must not be negative")
+	}
+	if s.MinPrefixes < 0 {
+		return fmt.Errorf("min_prefixes must not be negative")
+	}
 
-func (s *WedosIPRange) GetIPRanges(_ *http.Request) []netip.Prefix {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
-	return s.ranges
+	switch s.Source {
+	case "", sourceURL, sourceStdin, sourceFile, sourceEnv:
+	default:
+		return fmt.Errorf("unknown source %q", s.Source)
+	}
+
+	if s.Format != "" && s.Format != formatAuto {
+		if _, ok := lookupRangeParser(s.Format); !ok {
+			return fmt.Errorf("unknown format %q", s.Format)
+		}
+	}
+	if err := s.provisionFamily(); err != nil {
+		return err
+	}
+	if err := s.provisionTestIP(); err != nil {
+		return err
+	}
+	if err := s.provisionJSONPath(); err != nil {
+		return err
+	}
+	if err := s.provisionSourceFormats(); err != nil {
+		return err
+	}
+	if err := s.provisionTransforms(); err != nil {
+		return err
+	}
+	if err := s.provisionMethod(); err != nil {
+		return err
+	}
+	if err := s.checkProbeCapabilities(); err != nil {
+		return err
+	}
+	if err := s.provisionNotify(); err != nil {
+		return err
+	}
+
+	if s.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	if s.ConnectTimeout < 0 {
+		return fmt.Errorf("connect_timeout must not be negative")
+	}
+	if s.Timeout > 0 && s.ConnectTimeout > s.Timeout {
+		return fmt.Errorf("connect_timeout %v exceeds timeout %v", time.Duration(s.ConnectTimeout), time.Duration(s.Timeout))
+	}
+	if s.UnixSocket != "" {
+		if err := checkUnixSocket(s.UnixSocket); err != nil {
+			return err
+		}
+	}
+	if err := s.provisionResolver(); err != nil {
+		return err
+	}
+	if (s.SignatureURL == "") != (s.PublicKey == "") {
+		return fmt.Errorf("signature_url and public_key must be set together")
+	}
+	if s.SignatureURL != "" {
+		if s.Source == sourceStdin || s.Source == sourceFile || s.Source == sourceEnv || s.URLv4 != "" || s.URLv6 != "" || s.DNSTXT != "" {
+			return fmt.Errorf("signature_url is only supported with a single url")
+		}
+		key, err := loadPublicKey(s.PublicKey)
+		if err != nil {
+			return err
+		}
+		s.publicKey = key
+	}
+
+	if s.RateLimit < 0 || s.RateBurst < 0 {
+		return fmt.Errorf("rate_limit values must not be negative")
+	}
+	if err := s.provisionTLS(); err != nil {
+		return err
+	}
+	if err := s.checkEncoding(); err != nil {
+		return err
+	}
+	if err := s.checkHTTP3(); err != nil {
+		return err
+	}
+	if err := s.checkRouteSupport(); err != nil {
+		return err
+	}
+	s.provisionSelfOverlap()
+	if err := s.checkProxy(); err != nil {
+		return err
+	}
+	if s.client == nil {
+		s.client = s.newClient()
+	}
+
+	if s.BreakerThreshold < 0 {
+		return fmt.Errorf("breaker_threshold must not be negative")
+	}
+	if s.BreakerThreshold > 0 {
+		s.breaker = breakerClosed
+	}
+
+	if s.Schedule != "" {
+		sched, err := parseCron(s.Schedule)
+		if err != nil {
+			return err
+		}
+		if sched.next(s.now()).IsZero() {
+			return fmt.Errorf("cron expression %q never fires", s.Schedule)
+		}
+		s.schedule = sched
+	}
+
+	if s.BasicAuth != nil {
+		repl := caddy.NewReplacer()
+		s.username = repl.ReplaceKnown(s.BasicAuth.Username, "")
+		s.password = repl.ReplaceKnown(s.BasicAuth.Password, "")
+		if s.username != "" && s.password == "" {
+			return fmt.Errorf("basic_auth: password is required when a username is set")
+		}
+	}
+
+	if err := s.provisionPinned(); err != nil {
+		return err
+	}
+	adminAllow, err := parseCIDRList("admin_allow", s.AdminAllow)
+	if err != nil {
+		return err
+	}
+	s.adminAllow = adminAllow
+	required, err := parseCIDRList("required", s.Required)
+	if err != nil {
+		return err
+	}
+	s.required = required
+	exclude, err := parseCIDRList("exclude", s.Exclude)
+	if err != nil {
+		return err
+	}
+	s.exclude = exclude
+	if err := s.provisionBeforeFirstFetch(); err != nil {
+		return err
+	}
+	if len(s.pinned) > 0 || len(s.fallback) > 0 {
+		s.setRanges(nil, time.Time{})
+	}
+
+	if err := s.provisionSets(); err != nil {
+		return err
+	}
+	s.logEffectiveConfig()
+	return nil
 }
 
-// UnmarshalCaddyfile implements caddyfile.Unmarshaler.
-//
-//	wedos {
-//	   interval val
-//	   timeout val
-//	}
-func (m *WedosIPRange) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
-	d.Next() // Skip module name.
+// start loads the initial ranges and starts the refresh loop.
+func (s *WedosIPRange) start() error {
+	// Standard input can only be read once and environment variables don't
+	// change in-process, so there is nothing to refresh.
+	if s.Source == sourceStdin || s.Source == sourceEnv {
+		if err := s.refresh(); err != nil {
+			return fmt.Errorf("reading WEDOS IP ranges from %s: %v", s.source(), err)
+		}
+		if err := s.checkTestIP(); err != nil {
+			return err
+		}
+		registerInstance(s)
+		return nil
+	}
 
-	// No same-line options are supported
-	if d.NextArg() {
-		return d.ArgErr()
+	if s.Warmup {
+		s.warmup()
+	}
+	if s.ProbeCapabilities && (s.Source == "" || s.Source == sourceURL) && s.URL != "" {
+		s.probeCapabilities()
 	}
 
-	for nesting := d.Nesting(); d.NextBlock(nesting); {
-		switch d.Val() {
-		case "interval":
-			if !d.NextArg() {
-				return d.ArgErr()
-			}
-			val, err := caddy.ParseDuration(d.Val())
-			if err != nil {
-				return err
-			}
-			m.Interval = caddy.Duration(val)
-		case "timeout":
-			if !d.NextArg() {
-				return d.ArgErr()
-			}
-			val, err := caddy.ParseDuration(d.Val())
-			if err != nil {
-				return err
-			}
-			m.Timeout = caddy.Duration(val)
-		default:
-			return d.ArgErr()
+	if s.CacheFile != "" {
+		s.loadCache()
+	}
+
+	// Fail fast: refuse to start with an empty trusted set. Otherwise the
+	// first fetch happens in the background and Caddy boots regardless.
+	fetched := s.RequireOnStart
+	if s.RequireOnStart && !(len(s.GetIPRanges(nil)) > 0 && s.paused()) {
+		if err := s.initialRefresh(); err != nil {
+			return fmt.Errorf("initial fetch of WEDOS IP ranges failed: %v", err)
+		}
+		if err := s.checkTestIP(); err != nil {
+			return err
+		}
+	} else if s.StorageKey != "" && !s.loadStorage() {
+		// Nothing stored yet: fetch now rather than boot with an empty set.
+		err := s.initialRefresh()
+		s.recordRefresh(err)
+		if err == nil {
+			s.warnTestIP()
 		}
+		fetched = true
+	}
+
+	registerInstance(s)
+
+	if s.Watch {
+		s.startWatch(s.File, false)
+	}
+	if s.TriggerFile != "" && !s.startWatch(s.TriggerFile, true) {
+		go s.pollTriggerFile()
 	}
 
+	if s.SSEURL != "" {
+		go s.streamSSE()
+	}
+
+	// update in background
+	go s.refreshLoop(!fetched)
 	return nil
 }
 
-// interface guards
-var (
-	_ caddy.Module            = (*WedosIPRange)(nil)
-	_ caddy.Provisioner       = (*WedosIPRange)(nil)
-	_ caddyfile.Unmarshaler   = (*WedosIPRange)(nil)
-	_ caddyhttp.IPRangeSource = (*WedosIPRange)(nil)
+// refresh fetches the ranges and applies them on success.
+func (s *WedosIPRange) refresh() error {
+	s.refreshStarted = s.now()
+	fullPrefixes, err := s.getPrefixes()
+	stable := s.isStartupStable()
+	if err == nil && !stable {
+		fullPrefixes, err = s.verifyStartupStability(fullPrefixes)
+	} else if err == nil && s.ApplyDelay > 0 {
+		fullPrefixes, err = s.confirmStable(fullPrefixes)
+	}
+	if errors.Is(err, errNotModified) {
+		// Unchanged from the cached list, which was complete.
+		if !stable {
+			s.markStartupStable()
+		}
+		count := s.touchRefresh(s.now())
+		s.notify(RefreshResult{Time: s.now(), Count: count})
+		return nil
+	}
+	// A flapping upstream is not a failure; retry on the next cycle.
+	if errors.Is(err, errUnstable) {
+		s.notify(RefreshResult{Time: s.now(), Count: len(s.GetIPRanges(nil))})
+		return nil
+	}
+	if err != nil {
+		if s.StorageKey != "" {
+			s.adoptStorage()
+		}
+		if s.CacheFallbackAfter > 0 {
+			s.cacheFallback(err)
+		}
+		s.notify(RefreshResult{Time: s.now(), Err: err})
+		return err
+	}
+	s.netFailures = 0
+	if s.QuarantineFile != "" {
+		if err := s.checkQuarantine(fullPrefixes); err != nil {
+			s.notify(RefreshResult{Time: s.now(), Err: err})
+			return err
+		}
+	}
+	if s.Additive {
+		fullPrefixes = s.accumulate(fullPrefixes)
+	}
+	if s.ShrinkGrace > 0 {
+		fullPrefixes = s.withShrinkGrace(fullPrefixes)
+	}
+	if s.Tiers {
+		s.commitTiers(fullPrefixes)
+	}
+	prev := s.GetIPRanges(nil)
+	now := s.now()
+	applied := s.setRanges(fullPrefixes, now)
+	// Under the lock only for flushCache; the refresh goroutine is the
+	// only writer.
+	s.lock.Lock()
+	s.commitValidators()
+	s.serial = s.pendingSerial
+	s.partial = s.pendingPartial
+	s.lock.Unlock()
+	if s.reapTimer != nil {
+		s.commitEntryTTLs()
+	}
+	// The cache holds only the fetched list; pinned ranges come from the config.
+	if s.CacheFile != "" {
+		s.saveCache(fullPrefixes, now)
+	}
+	if s.StorageKey != "" {
+		s.saveStorage(fullPrefixes, now)
+	}
+	if s.LogChanges || len(s.OnUpdateCommand) > 0 {
+		added, removed := diffPrefixes(prev, applied)
+		if s.LogChanges {
+			s.logChanges(added, removed)
+		}
+		if len(s.OnUpdateCommand) > 0 && (len(added) > 0 || len(removed) > 0) {
+			s.runUpdateCommand(applied)
+		}
+	}
+	if s.CheckRoutes {
+		s.checkRoutes(applied)
+	}
+	if len(s.selfAddrs) > 0 {
+		s.checkSelfOverlap(fullPrefixes)
+	}
+	if s.DryValidate {
+		s.dryValidate(fullPrefixes)
+	}
+	if s.DebugDistribution {
+		s.logDistribution(applied)
+	}
+	if s.PublishFile != "" {
+		if err := writeFileAtomic(s.PublishFile, formatPublished(applied, s.source(), s.now())); err != nil {
+			s.logger.Warn("writing publish_file failed", zap.String("path", s.PublishFile), zap.Error(err))
+		}
+	}
+	s.notify(RefreshResult{Time: s.now(), Count: len(applied)})
+	return nil
+}
+
+// nextDelay returns how long to wait before the next refresh.
+func (s *WedosIPRange) nextDelay() time.Duration {
+	if s.breaker == breakerOpen {
+		return s.breakerDelay()
+	}
+	if s.schedule != nil {
+		now := s.now()
+		if next := s.schedule.next(now); !next.IsZero() {
+			return next.Sub(now)
+		}
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return max(time.Duration(s.Interval), s.adaptedInterval)
+}
+
+// minInterval is the shortest interval accepted through the admin API.
+const minInterval = 10 * time.Second
+
+// setInterval changes Interval at runtime, dropping any stretch by
+// AdaptInterval, and makes the refresh loop re-arm its timer with the new
+// interval right away.
+func (s *WedosIPRange) setInterval(interval time.Duration) {
+	s.lock.Lock()
+	s.Interval = caddy.Duration(interval)
+	s.adaptedInterval = 0
+	s.lock.Unlock()
+	select {
+	case s.intervalChanged <- struct{}{}:
+	default:
+	}
+}
+
+func (s *WedosIPRange) refreshLoop(fetchFirst bool) {
+	timer := time.NewTimer(s.nextDelay())
+	var verifyCache <-chan time.Time
+	if s.CacheFile != "" && s.CacheVerifyInterval > 0 {
+		ticker := time.NewTicker(time.Duration(s.CacheVerifyInterval))
+		defer ticker.Stop()
+		verifyCache = ticker.C
+	}
+	var reap <-chan time.Time
+	if s.reapTimer != nil {
+		reap = s.reapTimer.C
+	}
+	// first time update, unless paused with ranges to keep
+	if fetchFirst && !(len(s.GetIPRanges(nil)) > 0 && s.paused()) {
+		err := s.initialRefresh()
+		s.recordRefresh(err)
+		if err == nil {
+			s.warnTestIP()
+		}
+	}
+	for {
+		select {
+		case <-timer.C:
+			if !s.paused() && !s.pushing() {
+				s.halfOpenBreaker()
+				s.recordRefresh(s.tickRefresh())
+				s.trackRefreshDuration(s.now().Sub(s.refreshStarted))
+			}
+			timer.Reset(s.nextDelay())
+		case <-s.intervalChanged:
+			timer.Reset(s.nextDelay())
+		case <-s.fileChanged:
+			if !s.paused() {
+				s.recordRefresh(s.refresh())
+			}
+			timer.Reset(s.nextDelay())
+		case c := <-s.forceRequested:
+			s.runForced(c)
+			timer.Reset(s.nextDelay())
+		case data := <-s.pushed:
+			if !s.paused() {
+				s.pushBody = data
+				s.recordRefresh(s.refresh())
+				s.pushBody = nil
+			}
+		case <-verifyCache:
+			s.verifyCache()
+		case <-reap:
+			s.reapExpired()
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// recordRefresh tracks the outcome of a refresh. Failures are logged at
+// most once per WarnInterval while the upstream keeps failing, and the
+// recovery is logged once.
+func (s *WedosIPRange) recordRefresh(err error) {
+	// A refresh applied with fallbacks is degraded, and recorded like a
+	// failure, except by the breaker.
+	breakerErr := err
+	if err == nil {
+		s.lock.RLock()
+		if s.partial != nil {
+			err = s.partial
+		}
+		s.lock.RUnlock()
+	}
+	var class string
+	if err != nil {
+		class = classifyError(err)
+	}
+	transient, sinceSuccess := s.transientStatus(err)
+	if transient {
+		recordToleratedRefresh()
+	} else {
+		recordRefreshResult(class)
+	}
+	s.lock.RLock()
+	recordFreshness(s.source(), s.freshnessRatio(s.now()))
+	s.lock.RUnlock()
+
+	if transient {
+		s.logger.Debug("tolerating transient WEDOS IP list status",
+			zap.Error(err),
+			zap.Duration("since_success", sinceSuccess))
+		return
+	}
+
+	// Tolerated errors leave the failure counters, the breaker and the
+	// last error alone, as if the refresh had been skipped.
+	if s.tolerated(err) {
+		s.logger.Debug("tolerating WEDOS IP ranges refresh error",
+			zap.Error(err),
+			zap.String("class", class))
+		return
+	}
+
+	s.lock.Lock()
+	prevFailures := s.failures
+	if err == nil {
+		s.failures = 0
+		s.lastError = ""
+	} else {
+		s.failures++
+		s.lastError = err.Error()
+	}
+	s.lastErrorClass = class
+	s.updateBreaker(breakerErr)
+	publishExpvarError(s.lastError)
+	s.lock.Unlock()
+	s.updateNotify(err)
+
+	if err == nil {
+		if prevFailures > 0 {
+			s.logger.Info("refreshing WEDOS IP ranges recovered", zap.Int("failures", prevFailures))
+		}
+		return
+	}
+
+	now := s.now()
+	if s.failures == 1 || now.Sub(s.lastWarn) >= time.Duration(s.WarnInterval) {
+		msg := "refreshing WEDOS IP ranges failed"
+		switch class {
+		case errClassDNS:
+			// Usually a resolver problem on this host rather than at WEDOS.
+			msg = "resolving the WEDOS IP list host failed, check the DNS resolver"
+		case errClassEmpty:
+			msg = "WEDOS IP list source answered with an empty list, keeping the previous ranges"
+		case errClassPartial:
+			msg = "WEDOS IP list sources failed, serving their last good prefixes"
+		}
+		s.logger.Warn(msg,
+			zap.Error(err),
+			zap.String("class", class),
+			zap.Int("consecutive_failures", s.failures))
+		s.lastWarn = now
+	}
+}
+
+// touchRefresh records a successful refresh that left the ranges
+// unchanged, and returns the current prefix count.
+func (s *WedosIPRange) touchRefresh(refreshed time.Time) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.lastRefresh = refreshed
+	publishExpvar(len(s.ranges), s.lastRefresh)
+	return len(s.ranges)
+}
+
+// setRanges replaces the current ranges after a successful refresh, and
+// returns them as applied, with Pinned and Exclude.
+func (s *WedosIPRange) setRanges(prefixes []netip.Prefix, refreshed time.Time) []netip.Prefix {
+	s.applyLock.Lock()
+	defer s.applyLock.Unlock()
+	return s.applyRanges(prefixes, refreshed)
+}
+
+// reapplyRanges recomposes the ranges from the fetched ones, after a
+// change to what composeRanges adds to them, such as an override.
+func (s *WedosIPRange) reapplyRanges() {
+	s.applyLock.Lock()
+	defer s.applyLock.Unlock()
+	s.lock.RLock()
+	fetched, refreshed := s.fetched, s.lastRefresh
+	s.lock.RUnlock()
+	s.applyRanges(fetched, refreshed)
+}
+
+// applyRanges does the work of setRanges. s.applyLock must be held.
+func (s *WedosIPRange) applyRanges(prefixes []netip.Prefix, refreshed time.Time) []netip.Prefix {
+	// Sorted and deduplicated, so consumers combining sources get a
+	// deterministic set.
+	fetched := prefixes
+	prefixes = s.composeRanges(s.withFallback(prefixes, refreshed))
+	set := newPrefixSet(slices.Clip(prefixes))
+	hash := contentHash(set.prefixes)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.fetched = fetched
+	// composeRanges allocates a new slice. Clipped, an append by a caller
+	// holding it reallocates instead of writing past its end into memory
+	// another caller might see.
+	s.ranges = set.prefixes
+	s.ranges4, s.ranges6 = splitFamilies(prefixes)
+	if s.Tiers {
+		s.proxyRanges, s.directRanges = s.splitTiers(s.ranges)
+	}
+	s.set = set
+	s.hash = hash
+	s.lastRefresh = refreshed
+	publishExpvar(len(s.ranges), s.lastRefresh)
+	publishExpvarHash(hash)
+	return s.ranges
+}
+
+// splitFamilies returns newly allocated copies of the IPv4 and the IPv6
+// prefixes of prefixes, each exactly as long as needed.
+func splitFamilies(prefixes []netip.Prefix) (v4, v6 []netip.Prefix) {
+	n4 := 0
+	for _, p := range prefixes {
+		if p.Addr().Is4() {
+			n4++
+		}
+	}
+	if n4 > 0 {
+		v4 = make([]netip.Prefix, 0, n4)
+	}
+	if n6 := len(prefixes) - n4; n6 > 0 {
+		v6 = make([]netip.Prefix, 0, n6)
+	}
+	for _, p := range prefixes {
+		if p.Addr().Is4() {
+			v4 = append(v4, p)
+		} else {
+			v6 = append(v6, p)
+		}
+	}
+	return v4, v6
+}
+
+// Cleanup writes the final state to the cache file, closes all refresh
+// subscriber channels and removes the module from the admin API.
+func (s *WedosIPRange) Cleanup() error {
+	if s.shared != nil {
+		_, err := sharedFetchers.Delete(s.sharedKeyHash)
+		return err
+	}
+	for _, set := range s.Sets {
+		set.Cleanup()
+	}
+	if s.CacheFile != "" && !s.cacheFileTaken() {
+		s.flushCache()
+	}
+	if s.lock != nil {
+		s.stopOverride()
+	}
+	if s.h3 != nil {
+		s.h3.Close()
+	}
+	unregisterInstance(s)
+	s.closeSubscribers()
+	return nil
+}
+
+// GetIPRanges returns the current ranges of the set selected for the
+// request's host, see HostSets. The ranges are sorted by address and then
+// prefix length, without duplicates. The returned slice is shared by all
+// callers and must not be modified. It is never modified by the module
+// either: a refresh publishes a new one, so it may be held across
+// refreshes.
+func (s *WedosIPRange) GetIPRanges(r *http.Request) []netip.Prefix {
+	s = s.selectSet(r)
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.ranges
+}
+
+// Snapshot returns the current ranges together with the time of the
+// last successful refresh, read under a single lock acquisition so the
+// two are always consistent. err is the error of the latest refresh if
+// it failed; the ranges are then the ones from the last success.
+func (s *WedosIPRange) Snapshot() (ranges []netip.Prefix, lastRefresh time.Time, err error) {
+	s = s.fetcher()
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.lastError != "" {
+		err = errors.New(s.lastError)
+	}
+	return s.ranges, s.lastRefresh, err
+}
+
+// GetIPRangesByFamily returns the current IPv6 ranges if is6 is set,
+// otherwise the current IPv4 ranges. Like those of GetIPRanges, the
+// returned slice is shared and must not be modified.
+func (s *WedosIPRange) GetIPRangesByFamily(is6 bool) []netip.Prefix {
+	s = s.fetcher()
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if is6 {
+		return s.ranges6
+	}
+	return s.ranges4
+}
+
+// IsTrusted reports whether addr is within the current ranges, and if so
+// the most specific prefix containing it.
+func (s *WedosIPRange) IsTrusted(addr netip.Addr) (netip.Prefix, bool) {
+	return s.Lookup(addr)
+}
+
+// UnmarshalCaddyfile implements caddyfile.Unmarshaler.
+//
+//	wedos {
+//	   source url|file|stdin|env
+//	   file path
+//	   env VARNAME
+//	   watch
+//	   trigger_file path
+//	   sse_url <url>
+//	   url val [format]
+//	   git_raw url_template [ref]
+//	   mirrors url...
+//	   source_health max_failures [cooldown]
+//	   url_v4 val
+//	   url_v6 val
+//	   signature_url url
+//	   public_key path
+//	   format auto|text|json|labeled|range|<registered parser>
+//	   json_path path
+//	   region <tag...>
+//	   entry_ttl
+//	   tiers
+//	   transform <name...>
+//	   transform_command cmd [args...]
+//	   interval val
+//	   adapt_interval [factor]
+//	   schedule "min hour day month weekday"
+//	   timeout|per_try_timeout val
+//	   connect_timeout val
+//	   max_cycle_duration|cycle_timeout val
+//	   tracing
+//	   aggregate
+//	   require_on_start
+//	   test_ip ip
+//	   startup_retries <n>
+//	   per_cycle_retries <n>
+//	   startup_retry_delay val
+//	   startup_timeout val
+//	   basic_auth user password
+//	   method GET|POST
+//	   body <json>
+//	   verify_asn number
+//	   min_prefix_len_v4 bits
+//	   min_prefix_len_v6 bits
+//	   publish_file path
+//	   report_file path
+//	   cache_file path
+//	   cache_compress
+//	   cache_format text|binary
+//	   cache_max_age val
+//	   cache_fallback_after n
+//	   quarantine_file path
+//	   quarantine_max_change percent
+//	   storage_key key
+//	   cache_verify_interval val
+//	   log_changes
+//	   debug_parse [max_lines]
+//	   debug_distribution [max_blocks]
+//	   verify_startup_stability [delay]
+//	   refetch_on_parse_error [delay]
+//	   warn_interval val
+//	   max_age val
+//	   tolerate <class...>
+//	   tolerate_status <code> <duration>
+//	   circuit_breaker threshold [max_delay]
+//	   on_update_command cmd [args...]
+//	   on_update_timeout val
+//	   set name {
+//	      url val
+//	      ...
+//	   }
+//	   host set_name pattern...
+//	   sni set_name pattern...
+//	   pinned cidr...
+//	   before_first_fetch empty|fallback
+//	   fallback cidr...
+//	   include_private
+//	   exclude cidr...
+//	   required cidr...
+//	   warmup
+//	   head_probe
+//	   probe_capabilities
+//	   admin_allow cidr...
+//	   shared
+//	   parse_cache n
+//	   unix_socket path
+//	   resolver addr
+//	   http3
+//	   expose_ranges
+//	   maintenance
+//	   proxy url
+//	   no_proxy host|cidr...
+//	   request_id
+//	   tls_min_version tls1.2|tls1.3
+//	   tls_cipher_suites <name...>
+//	   tls_server_name <name>
+//	   serial <marker>
+//	   rate_limit <interval> [burst]
+//	   require_https
+//	   zstd
+//	   sniff_gzip
+//	   encoding base64|hex|none
+//	   allow_empty
+//	   notify_url <url>
+//	   notify_failures <n>
+//	   notify_timeout val
+//	   min_prefixes n
+//	   max_memory size
+//	   scan_buffer_size size
+//	   apply_delay val
+//	   shrink_grace val
+//	   additive
+//	   dns_txt name
+//	   merge_policy union|primary-wins
+//	   partial_fallback
+//	   check_routes
+//	   warn_self_overlap
+//	   dry_validate
+//	   apply_mode best-effort|verified
+//	   family ipv4|ipv6 [soft|hard]
+//	}
+func (m *WedosIPRange) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next() // Skip module name.
+
+	// No same-line options are supported
+	if d.NextArg() {
+		return newCaddyfileError("wedos", d.File(), d.Line(), unexpectedArg(d))
+	}
+
+	return m.unmarshalBlock(d)
+}
+
+// unmarshalBlock parses the options block of the module or of a named set.
+func (m *WedosIPRange) unmarshalBlock(d *caddyfile.Dispenser) error {
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		opt, file, line := d.Val(), d.File(), d.Line()
+		if err := m.unmarshalOption(d); err != nil {
+			return newCaddyfileError(opt, file, line, err)
+		}
+	}
+	return nil
+}
+
+// unmarshalOption parses the option at the cursor of d.
+func (m *WedosIPRange) unmarshalOption(d *caddyfile.Dispenser) error {
+	switch d.Val() {
+	case "url":
+		args := d.RemainingArgs()
+		if len(args) == 0 || len(args) > 2 {
+			return argCountErr(d)
+		}
+		// Repeated url lines add mirrors.
+		if m.URL == "" {
+			m.URL = args[0]
+		} else {
+			m.Mirrors = append(m.Mirrors, args[0])
+		}
+		if len(args) == 2 {
+			if m.SourceFormats == nil {
+				m.SourceFormats = make(map[string]string)
+			}
+			m.SourceFormats[args[0]] = args[1]
+		}
+	case "git_raw":
+		args := d.RemainingArgs()
+		if len(args) == 0 || len(args) > 2 {
+			return argCountErr(d)
+		}
+		m.GitRaw = args[0]
+		if len(args) == 2 {
+			m.GitRef = args[1]
+		}
+	case "mirrors":
+		args := d.RemainingArgs()
+		if len(args) == 0 {
+			return argCountErr(d)
+		}
+		m.Mirrors = append(m.Mirrors, args...)
+	case "source_health":
+		args := d.RemainingArgs()
+		if len(args) == 0 || len(args) > 2 {
+			return argCountErr(d)
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return d.Errf("invalid source_health max failures %q: %v", args[0], err)
+		}
+		m.SourceMaxFailures = n
+		if len(args) == 2 {
+			val, err := caddy.ParseDuration(args[1])
+			if err != nil {
+				return d.Errf("invalid source_health cooldown %q: %v", args[1], err)
+			}
+			m.SourceCooldown = caddy.Duration(val)
+		}
+	case "source":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.Source = arg
+	case "url_v4":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.URLv4 = arg
+	case "env":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.Env = arg
+	case "url_v6":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.URLv6 = arg
+	case "signature_url":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.SignatureURL = arg
+	case "public_key":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.PublicKey = arg
+	case "format":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.Format = arg
+	case "json_path":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.JSONPath = arg
+	case "interval":
+		val, err := parseDurationArg(d)
+		if err != nil {
+			return err
+		}
+		m.Interval = val
+	case "schedule":
+		args := d.RemainingArgs()
+		if len(args) == 0 {
+			return argCountErr(d)
+		}
+		m.Schedule = strings.Join(args, " ")
+	case "timeout", "per_try_timeout":
+		val, err := parseDurationArg(d)
+		if err != nil {
+			return err
+		}
+		m.Timeout = val
+	case "connect_timeout":
+		val, err := parseDurationArg(d)
+		if err != nil {
+			return err
+		}
+		m.ConnectTimeout = val
+	case "max_cycle_duration", "cycle_timeout":
+		val, err := parseDurationArg(d)
+		if err != nil {
+			return err
+		}
+		m.MaxCycleDuration = val
+	case "tracing":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.Tracing = true
+	case "aggregate":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.Aggregate = true
+	case "require_on_start":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.RequireOnStart = true
+	case "test_ip":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.TestIP = arg
+	case "per_cycle_retries":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return d.Errf("invalid per_cycle_retries %q: %v", arg, err)
+		}
+		m.PerCycleRetries = n
+	case "startup_retries":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return d.Errf("invalid startup_retries %q: %v", arg, err)
+		}
+		m.StartupRetries = n
+	case "startup_retry_delay":
+		val, err := parseDurationArg(d)
+		if err != nil {
+			return err
+		}
+		m.StartupRetryDelay = val
+	case "startup_timeout":
+		val, err := parseDurationArg(d)
+		if err != nil {
+			return err
+		}
+		m.StartupTimeout = val
+	case "basic_auth":
+		args := d.RemainingArgs()
+		if len(args) != 2 {
+			return argCountErr(d)
+		}
+		m.BasicAuth = &BasicAuth{Username: args[0], Password: args[1]}
+	case "verify_asn":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		val, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(arg), "AS"), 10, 32)
+		if err != nil {
+			return d.Errf("invalid verify_asn %q: %v", arg, err)
+		}
+		m.VerifyASN = uint32(val)
+	case "log_changes":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.LogChanges = true
+	case "debug_parse":
+		m.DebugParse = true
+		if d.NextArg() {
+			n, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return d.Errf("invalid debug_parse max %q: %v", d.Val(), err)
+			}
+			m.DebugParseMax = n
+		}
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+	case "verify_startup_stability":
+		m.VerifyStartupStability = true
+		if d.NextArg() {
+			val, err := caddy.ParseDuration(d.Val())
+			if err != nil {
+				return d.Errf("invalid verify_startup_stability delay %q: %v", d.Val(), err)
+			}
+			m.StartupStabilityDelay = caddy.Duration(val)
+		}
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+	case "adapt_interval":
+		m.AdaptInterval = true
+		if d.NextArg() {
+			n, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return d.Errf("invalid adapt_interval factor %q: %v", d.Val(), err)
+			}
+			m.AdaptIntervalFactor = n
+		}
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+	case "refetch_on_parse_error":
+		m.RefetchOnParseError = true
+		if d.NextArg() {
+			val, err := caddy.ParseDuration(d.Val())
+			if err != nil {
+				return d.Errf("invalid refetch_on_parse_error delay %q: %v", d.Val(), err)
+			}
+			m.RefetchDelay = caddy.Duration(val)
+		}
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+	case "debug_distribution":
+		m.DebugDistribution = true
+		if d.NextArg() {
+			n, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return d.Errf("invalid debug_distribution max %q: %v", d.Val(), err)
+			}
+			m.DebugDistributionMax = n
+		}
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+	case "min_prefix_len_v4", "min_prefix_len_v6":
+		opt := d.Val()
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		bits, err := strconv.Atoi(strings.TrimPrefix(arg, "/"))
+		if err != nil {
+			return d.Errf("invalid %s %q: %v", opt, arg, err)
+		}
+		if opt == "min_prefix_len_v4" {
+			m.MinPrefixLenV4 = bits
+		} else {
+			m.MinPrefixLenV6 = bits
+		}
+	case "cache_file":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.CacheFile = arg
+	case "cache_format":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.CacheFormat = arg
+	case "storage_key":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.StorageKey = arg
+	case "cache_max_age":
+		val, err := parseDurationArg(d)
+		if err != nil {
+			return err
+		}
+		m.CacheMaxAge = val
+	case "cache_verify_interval":
+		val, err := parseDurationArg(d)
+		if err != nil {
+			return err
+		}
+		m.CacheVerifyInterval = val
+	case "cache_compress":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.CacheCompress = true
+	case "publish_file":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.PublishFile = arg
+	case "report_file":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.ReportFile = arg
+	case "circuit_breaker":
+		args := d.RemainingArgs()
+		if len(args) < 1 || len(args) > 2 {
+			return argCountErr(d)
+		}
+		threshold, err := strconv.Atoi(args[0])
+		if err != nil {
+			return d.Errf("invalid circuit_breaker threshold %q: %v", args[0], err)
+		}
+		m.BreakerThreshold = threshold
+		if len(args) == 2 {
+			val, err := caddy.ParseDuration(args[1])
+			if err != nil {
+				return d.Errf("invalid circuit_breaker max delay %q: %v", args[1], err)
+			}
+			m.BreakerMaxDelay = caddy.Duration(val)
+		}
+	case "on_update_command":
+		m.OnUpdateCommand = d.RemainingArgs()
+		if len(m.OnUpdateCommand) == 0 {
+			return argCountErr(d)
+		}
+	case "region":
+		m.Region = d.RemainingArgs()
+		if len(m.Region) == 0 {
+			return argCountErr(d)
+		}
+	case "entry_ttl":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.EntryTTL = true
+	case "tiers":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.Tiers = true
+	case "transform":
+		m.Transform = d.RemainingArgs()
+		if len(m.Transform) == 0 {
+			return argCountErr(d)
+		}
+	case "transform_command":
+		m.TransformCommand = d.RemainingArgs()
+		if len(m.TransformCommand) == 0 {
+			return argCountErr(d)
+		}
+	case "on_update_timeout":
+		val, err := parseDurationArg(d)
+		if err != nil {
+			return err
+		}
+		m.OnUpdateTimeout = val
+	case "set":
+		name, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		set := new(WedosIPRange)
+		if err := set.unmarshalBlock(d); err != nil {
+			return err
+		}
+		if m.Sets == nil {
+			m.Sets = make(map[string]*WedosIPRange)
+		}
+		m.Sets[name] = set
+	case "host":
+		args := d.RemainingArgs()
+		if len(args) < 2 {
+			return argCountErr(d)
+		}
+		if m.HostSets == nil {
+			m.HostSets = make(map[string]string)
+		}
+		for _, pattern := range args[1:] {
+			m.HostSets[strings.ToLower(pattern)] = args[0]
+		}
+	case "sni":
+		args := d.RemainingArgs()
+		if len(args) < 2 {
+			return argCountErr(d)
+		}
+		if m.SNISets == nil {
+			m.SNISets = make(map[string]string)
+		}
+		for _, pattern := range args[1:] {
+			m.SNISets[strings.ToLower(pattern)] = args[0]
+		}
+	case "file":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.File = arg
+	case "watch":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.Watch = true
+	case "sse_url":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.SSEURL = arg
+	case "trigger_file":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.TriggerFile = arg
+	case "dns_txt":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.DNSTXT = arg
+	case "family":
+		args := d.RemainingArgs()
+		if len(args) == 0 || len(args) > 2 {
+			return argCountErr(d)
+		}
+		m.Family = args[0]
+		if len(args) == 2 {
+			m.FamilyMode = args[1]
+		}
+	case "merge_policy":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.MergePolicy = arg
+	case "partial_fallback":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.PartialFallback = true
+	case "check_routes":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.CheckRoutes = true
+	case "warn_self_overlap":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.WarnSelfOverlap = true
+	case "dry_validate":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.DryValidate = true
+	case "apply_mode":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.ApplyMode = arg
+	case "additive":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.Additive = true
+	case "apply_delay":
+		val, err := parseDurationArg(d)
+		if err != nil {
+			return err
+		}
+		m.ApplyDelay = val
+	case "shrink_grace":
+		val, err := parseDurationArg(d)
+		if err != nil {
+			return err
+		}
+		m.ShrinkGrace = val
+	case "max_memory":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		n, err := humanize.ParseBytes(arg)
+		if err != nil {
+			return d.Errf("invalid max_memory %q: %v", arg, err)
+		}
+		m.MaxMemory = int64(n)
+	case "scan_buffer_size":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		n, err := humanize.ParseBytes(arg)
+		if err != nil {
+			return d.Errf("invalid scan_buffer_size %q: %v", arg, err)
+		}
+		m.ScanBufferSize = int64(n)
+	case "cache_fallback_after":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return d.Errf("invalid cache_fallback_after %q: %v", arg, err)
+		}
+		m.CacheFallbackAfter = n
+	case "quarantine_file":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.QuarantineFile = arg
+	case "quarantine_max_change":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return d.Errf("invalid quarantine_max_change %q: %v", arg, err)
+		}
+		m.QuarantineMaxChange = n
+	case "min_prefixes":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return d.Errf("invalid min_prefixes %q: %v", arg, err)
+		}
+		m.MinPrefixes = n
+	case "tls_min_version":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.TLSMinVersion = arg
+	case "tls_server_name":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.TLSServerName = arg
+	case "tls_cipher_suites":
+		m.TLSCipherSuites = d.RemainingArgs()
+		if len(m.TLSCipherSuites) == 0 {
+			return argCountErr(d)
+		}
+	case "serial":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.Serial = arg
+	case "rate_limit":
+		val, err := durationArg(d, "rate_limit")
+		if err != nil {
+			return err
+		}
+		m.RateLimit = val
+		if d.NextArg() {
+			n, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return d.Errf("invalid rate_limit burst %q: %v", d.Val(), err)
+			}
+			m.RateBurst = n
+		}
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+	case "require_https":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.RequireHTTPS = true
+	case "method":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.Method = arg
+	case "body":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.Body = arg
+	case "notify_url":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.NotifyURL = arg
+	case "notify_failures":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return d.Errf("invalid notify_failures %q: %v", arg, err)
+		}
+		m.NotifyFailures = n
+	case "notify_timeout":
+		val, err := parseDurationArg(d)
+		if err != nil {
+			return err
+		}
+		m.NotifyTimeout = val
+	case "allow_empty":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.AllowEmpty = true
+	case "zstd":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.Zstd = true
+	case "sniff_gzip":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.SniffGzip = true
+	case "encoding":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.Encoding = arg
+	case "request_id":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.RequestID = true
+	case "proxy":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.Proxy = arg
+	case "no_proxy":
+		args := d.RemainingArgs()
+		if len(args) == 0 {
+			return argCountErr(d)
+		}
+		m.NoProxy = append(m.NoProxy, args...)
+	case "unix_socket":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.UnixSocket = arg
+	case "resolver":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.Resolver = arg
+	case "http3":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.HTTP3 = true
+	case "expose_ranges":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.ExposeRanges = true
+	case "maintenance":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.Maintenance = true
+	case "parse_cache":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return d.Errf("invalid parse_cache %q: %v", arg, err)
+		}
+		m.ParseCacheSize = n
+	case "head_probe":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.HeadProbe = true
+	case "shared":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.Shared = true
+	case "admin_allow":
+		args := d.RemainingArgs()
+		if len(args) == 0 {
+			return argCountErr(d)
+		}
+		m.AdminAllow = append(m.AdminAllow, args...)
+	case "probe_capabilities":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.ProbeCapabilities = true
+	case "warmup":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.Warmup = true
+	case "before_first_fetch":
+		arg, err := singleArg(d)
+		if err != nil {
+			return err
+		}
+		m.BeforeFirstFetch = arg
+	case "fallback":
+		args := d.RemainingArgs()
+		if len(args) == 0 {
+			return argCountErr(d)
+		}
+		m.Fallback = append(m.Fallback, args...)
+	case "pinned":
+		args := d.RemainingArgs()
+		if len(args) == 0 {
+			return argCountErr(d)
+		}
+		m.Pinned = append(m.Pinned, args...)
+	case "include_private":
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		m.IncludePrivate = true
+	case "required":
+		args := d.RemainingArgs()
+		if len(args) == 0 {
+			return argCountErr(d)
+		}
+		m.Required = append(m.Required, args...)
+	case "exclude":
+		args := d.RemainingArgs()
+		if len(args) == 0 {
+			return argCountErr(d)
+		}
+		m.Exclude = append(m.Exclude, args...)
+	case "tolerate":
+		m.Tolerate = d.RemainingArgs()
+		if len(m.Tolerate) == 0 {
+			return argCountErr(d)
+		}
+	case "tolerate_status":
+		if !d.NextArg() {
+			return missingArg(d)
+		}
+		code, err := strconv.Atoi(d.Val())
+		if err != nil {
+			return d.Errf("invalid tolerate_status code %q", d.Val())
+		}
+		window, err := durationArg(d, "tolerate_status")
+		if err != nil {
+			return err
+		}
+		if d.NextArg() {
+			return unexpectedArg(d)
+		}
+		// Repeated lines add codes.
+		if m.TolerateStatus == nil {
+			m.TolerateStatus = make(map[int]caddy.Duration)
+		}
+		m.TolerateStatus[code] = window
+	case "max_age":
+		val, err := parseDurationArg(d)
+		if err != nil {
+			return err
+		}
+		m.MaxAge = val
+	case "warn_interval":
+		val, err := parseDurationArg(d)
+		if err != nil {
+			return err
+		}
+		m.WarnInterval = val
+	default:
+		return d.WrapErr(errUnknownOption)
+	}
+	return nil
+}
+
+// singleArg returns the only argument of the current option, failing if
+// it is missing or followed by another on the same line.
+func singleArg(d *caddyfile.Dispenser) (string, error) {
+	if !d.NextArg() {
+		return "", missingArg(d)
+	}
+	arg := d.Val()
+	if d.NextArg() {
+		return "", unexpectedArg(d)
+	}
+	return arg, nil
+}
+
+// parseDurationArg parses the only argument of the current option as a
+// duration.
+func parseDurationArg(d *caddyfile.Dispenser) (caddy.Duration, error) {
+	val, err := durationArg(d, d.Val())
+	if err != nil {
+		return 0, err
+	}
+	if d.NextArg() {
+		return 0, unexpectedArg(d)
+	}
+	return val, nil
+}
+
+// durationArg parses the next argument of option opt as a duration.
+func durationArg(d *caddyfile.Dispenser, opt string) (caddy.Duration, error) {
+	if !d.NextArg() {
+		return 0, missingArg(d)
+	}
+	val, err := caddy.ParseDuration(d.Val())
+	if err != nil {
+		return 0, d.Errf("invalid %s duration %q: %v", opt, d.Val(), err)
+	}
+	return caddy.Duration(val), nil
+}
+
+// interface guards
+var (
+	_ caddy.Module            = (*WedosIPRange)(nil)
+	_ caddy.Provisioner       = (*WedosIPRange)(nil)
+	_ caddy.CleanerUpper      = (*WedosIPRange)(nil)
+	_ caddyfile.Unmarshaler   = (*WedosIPRange)(nil)
+	_ caddyhttp.IPRangeSource = (*WedosIPRange)(nil)
+	_ caddy.AdminRouter       = (*adminWedos)(nil)
+
+	_ caddy.Provisioner           = (*WedosVars)(nil)
+	_ caddyhttp.MiddlewareHandler = (*WedosVars)(nil)
+	_ caddyfile.Unmarshaler       = (*WedosVars)(nil)
+
+	_ caddyhttp.MiddlewareHandler = (*WedosList)(nil)
+	_ caddyfile.Unmarshaler       = (*WedosList)(nil)
 )
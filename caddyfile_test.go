@@ -4,13 +4,41 @@ package caddy_wedos_ip
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
+// newTestRange returns an unprovisioned module for url with the defaults
+// the refresh path relies on, for tests calling its methods directly.
+func newTestRange(url string) *WedosIPRange {
+	s := &WedosIPRange{
+		URL:            url,
+		MinPrefixLenV4: defaultMinPrefixLenV4,
+		MinPrefixLenV6: defaultMinPrefixLenV6,
+		ctx:            caddy.Context{Context: context.Background()},
+		lock:           new(sync.RWMutex),
+		applyLock:      new(sync.Mutex),
+		subsLock:       new(sync.Mutex),
+		logger:         zap.NewNop(),
+	}
+	s.client = s.newClient()
+	return s
+}
+
 func TestDefault(t *testing.T) {
 	testDefault(t, `wedos`)
 	testDefault(t, `wedos { }`)
@@ -37,8 +65,116 @@ func testDefault(t *testing.T, input string) {
 func TestUnmarshal(t *testing.T) {
 	input := `
 	wedos {
+		url https://mirror.example.com/ips.txt
 		interval 1.5h
+		adapt_interval 3
 		timeout 30s
+		aggregate
+		require_on_start
+		startup_retries 3
+		per_cycle_retries 2
+		startup_retry_delay 5s
+		startup_timeout 1m
+		basic_auth user {env.WEDOS_PASSWORD}
+		verify_asn AS64500
+		publish_file /run/wedos.txt
+		report_file /run/wedos-report.json
+		warn_interval 10m
+		max_age 3h
+		tolerate timeout status
+		tolerate_status 404 5m
+		schedule "5 * * * *"
+		connect_timeout 5s
+		max_cycle_duration 2m
+		tracing
+		log_changes
+		debug_parse 50
+		debug_distribution 5
+		verify_startup_stability 2s
+		refetch_on_parse_error 500ms
+		format json
+		transform strip-comments first-column
+		region eu cz
+		entry_ttl
+		tiers
+		transform_command /usr/local/bin/wedos-filter --region cz
+		circuit_breaker 3 6h
+		url_v4 https://mirror.example.com/ips4.txt
+		url_v6 https://mirror.example.com/ips6.txt
+		source stdin
+		min_prefix_len_v4 /12
+		min_prefix_len_v6 24
+		pinned 203.0.113.0/24
+		pinned 2001:db8::/32
+		include_private
+		exclude 192.0.2.128/25 198.51.100.7
+		required 192.0.2.0/25
+		warmup
+		unix_socket /run/wedos.sock
+		resolver 192.0.2.53
+		request_id
+		tls_min_version tls1.3
+		tls_server_name ips.example.com
+		tls_cipher_suites TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+		serial "# serial"
+		rate_limit 30s 2
+		require_https
+		zstd
+		sniff_gzip
+		allow_empty
+		notify_url https://hooks.example.com/wedos
+		notify_failures 5
+		notify_timeout 3s
+		method post
+		body "{\"product\": \"cdn\"}"
+		min_prefixes 5
+		max_memory 1MiB
+		scan_buffer_size 8MiB
+		apply_delay 2m
+		shrink_grace 10m
+		additive
+		dns_txt _ips.example.com
+		merge_policy primary-wins
+		apply_mode verified
+		partial_fallback
+		check_routes
+		warn_self_overlap
+		dry_validate
+		before_first_fetch fallback
+		fallback 192.0.2.0/24
+		fallback 2001:db8::/32
+		http3
+		expose_ranges
+		maintenance
+		encoding base64
+		test_ip 192.0.2.1
+		json_path data.prefixes[].cidr
+		family ipv4 hard
+		file /etc/wedos.txt
+		env WEDOS_RANGES
+		watch
+		trigger_file /run/wedos/refresh
+		sse_url https://mirror.example.com/ips/events
+		proxy http://proxy.internal:3128
+		no_proxy .internal 10.0.0.0/8
+		signature_url https://mirror.example.com/ips.txt.sig
+		public_key /etc/wedos.pub
+		mirrors https://a.example.com/ips.txt https://b.example.com/ips.txt
+		source_health 5 30m
+		head_probe
+		probe_capabilities
+		admin_allow 127.0.0.1/32 ::1/128
+		shared
+		sni tenant tenant.example.com
+		parse_cache 4
+		cache_format binary
+		cache_max_age 72h
+		cache_fallback_after 3
+		quarantine_file /var/lib/caddy/wedos-quarantine.json
+		quarantine_max_change 40
+		storage_key wedos/ranges
+		cache_verify_interval 6h
+		git_raw https://git.example.com/org/repo/raw/{ref}/ips.txt 3f2a9c1
 	}`
 
 	d := caddyfile.NewTestDispenser(input)
@@ -53,11 +189,411 @@ func TestUnmarshal(t *testing.T) {
 	if expectedInterval != r.Interval {
 		t.Errorf("incorrect interval: expected %v, got %v", expectedInterval, r.Interval)
 	}
+	if !r.AdaptInterval || r.AdaptIntervalFactor != 3 {
+		t.Errorf("incorrect adapt_interval: %v %d", r.AdaptInterval, r.AdaptIntervalFactor)
+	}
 
 	expectedTimeout := caddy.Duration(30 * time.Second)
 	if expectedTimeout != r.Timeout {
 		t.Errorf("incorrect timeout: expected %v, got %v", expectedTimeout, r.Timeout)
 	}
+
+	if !r.Aggregate {
+		t.Errorf("expected aggregate to be enabled")
+	}
+
+	if !r.RequireOnStart {
+		t.Errorf("expected require_on_start to be enabled")
+	}
+
+	if r.StartupRetries != 3 || r.StartupRetryDelay != caddy.Duration(5*time.Second) || r.StartupTimeout != caddy.Duration(time.Minute) {
+		t.Errorf("incorrect startup retries: got %d, %v, %v", r.StartupRetries, r.StartupRetryDelay, r.StartupTimeout)
+	}
+	if r.PerCycleRetries != 2 {
+		t.Errorf("incorrect per_cycle_retries: expected 2, got %d", r.PerCycleRetries)
+	}
+
+	expectedURL := "https://mirror.example.com/ips.txt"
+	if expectedURL != r.URL {
+		t.Errorf("incorrect url: expected %v, got %v", expectedURL, r.URL)
+	}
+
+	expectedAuth := BasicAuth{Username: "user", Password: "{env.WEDOS_PASSWORD}"}
+	if r.BasicAuth == nil || *r.BasicAuth != expectedAuth {
+		t.Errorf("incorrect basic_auth: expected %v, got %v", expectedAuth, r.BasicAuth)
+	}
+
+	if r.VerifyASN != 64500 {
+		t.Errorf("incorrect verify_asn: expected 64500, got %v", r.VerifyASN)
+	}
+
+	if r.PublishFile != "/run/wedos.txt" {
+		t.Errorf("incorrect publish_file: expected /run/wedos.txt, got %v", r.PublishFile)
+	}
+	if r.ReportFile != "/run/wedos-report.json" {
+		t.Errorf("incorrect report_file: expected /run/wedos-report.json, got %v", r.ReportFile)
+	}
+
+	if expected := caddy.Duration(3 * time.Hour); r.MaxAge != expected {
+		t.Errorf("incorrect max_age: expected %v, got %v", expected, r.MaxAge)
+	}
+
+	if !slices.Equal(r.Tolerate, []string{"timeout", "status"}) {
+		t.Errorf("incorrect tolerate: expected [timeout status], got %v", r.Tolerate)
+	}
+	if r.TolerateStatus[404] != caddy.Duration(5*time.Minute) || len(r.TolerateStatus) != 1 {
+		t.Errorf("incorrect tolerate_status: expected map[404:5m], got %v", r.TolerateStatus)
+	}
+
+	expectedWarnInterval := caddy.Duration(10 * time.Minute)
+	if expectedWarnInterval != r.WarnInterval {
+		t.Errorf("incorrect warn_interval: expected %v, got %v", expectedWarnInterval, r.WarnInterval)
+	}
+
+	if r.Schedule != "5 * * * *" {
+		t.Errorf("incorrect schedule: expected %q, got %q", "5 * * * *", r.Schedule)
+	}
+
+	expectedConnectTimeout := caddy.Duration(5 * time.Second)
+	if expectedConnectTimeout != r.ConnectTimeout {
+		t.Errorf("incorrect connect_timeout: expected %v, got %v", expectedConnectTimeout, r.ConnectTimeout)
+	}
+	if r.MaxCycleDuration != caddy.Duration(2*time.Minute) {
+		t.Errorf("incorrect max_cycle_duration: expected 2m, got %v", r.MaxCycleDuration)
+	}
+	if !r.Tracing {
+		t.Errorf("incorrect tracing: expected true")
+	}
+
+	if !r.LogChanges {
+		t.Errorf("expected log_changes to be enabled")
+	}
+	if !r.DebugParse || r.DebugParseMax != 50 {
+		t.Errorf("incorrect debug_parse: %v %d", r.DebugParse, r.DebugParseMax)
+	}
+	if !r.DebugDistribution || r.DebugDistributionMax != 5 {
+		t.Errorf("incorrect debug_distribution: %v %d", r.DebugDistribution, r.DebugDistributionMax)
+	}
+	if !r.VerifyStartupStability || r.StartupStabilityDelay != caddy.Duration(2*time.Second) {
+		t.Errorf("incorrect verify_startup_stability: %v %v", r.VerifyStartupStability, r.StartupStabilityDelay)
+	}
+	if !r.RefetchOnParseError || r.RefetchDelay != caddy.Duration(500*time.Millisecond) {
+		t.Errorf("incorrect refetch_on_parse_error: %v %v", r.RefetchOnParseError, r.RefetchDelay)
+	}
+
+	if r.Format != "json" {
+		t.Errorf("incorrect format: expected json, got %q", r.Format)
+	}
+	if !slices.Equal(r.Region, []string{"eu", "cz"}) {
+		t.Errorf("incorrect region: got %v", r.Region)
+	}
+	if !r.EntryTTL {
+		t.Errorf("incorrect entry_ttl: expected true")
+	}
+	if !r.Tiers {
+		t.Errorf("incorrect tiers: expected true")
+	}
+	if !slices.Equal(r.Transform, []string{"strip-comments", "first-column"}) {
+		t.Errorf("incorrect transform: got %v", r.Transform)
+	}
+	if !slices.Equal(r.TransformCommand, []string{"/usr/local/bin/wedos-filter", "--region", "cz"}) {
+		t.Errorf("incorrect transform_command: got %v", r.TransformCommand)
+	}
+
+	if r.BreakerThreshold != 3 {
+		t.Errorf("incorrect circuit_breaker threshold: expected 3, got %d", r.BreakerThreshold)
+	}
+	if expected := caddy.Duration(6 * time.Hour); expected != r.BreakerMaxDelay {
+		t.Errorf("incorrect circuit_breaker max delay: expected %v, got %v", expected, r.BreakerMaxDelay)
+	}
+
+	if r.URLv4 != "https://mirror.example.com/ips4.txt" || r.URLv6 != "https://mirror.example.com/ips6.txt" {
+		t.Errorf("incorrect family urls: got %q and %q", r.URLv4, r.URLv6)
+	}
+
+	if r.Source != "stdin" {
+		t.Errorf("incorrect source: expected stdin, got %q", r.Source)
+	}
+
+	if r.MinPrefixLenV4 != 12 || r.MinPrefixLenV6 != 24 {
+		t.Errorf("incorrect minimum prefix lengths: got %d and %d", r.MinPrefixLenV4, r.MinPrefixLenV6)
+	}
+
+	if !slices.Equal(r.Pinned, []string{"203.0.113.0/24", "2001:db8::/32"}) {
+		t.Errorf("incorrect pinned: got %v", r.Pinned)
+	}
+	if !r.IncludePrivate {
+		t.Error("expected include_private to be set")
+	}
+
+	if !slices.Equal(r.Exclude, []string{"192.0.2.128/25", "198.51.100.7"}) {
+		t.Errorf("incorrect exclude: got %v", r.Exclude)
+	}
+
+	if !slices.Equal(r.Required, []string{"192.0.2.0/25"}) {
+		t.Errorf("incorrect required: got %v", r.Required)
+	}
+
+	if !r.Warmup {
+		t.Errorf("expected warmup to be enabled")
+	}
+
+	if r.UnixSocket != "/run/wedos.sock" {
+		t.Errorf("incorrect unix_socket: expected /run/wedos.sock, got %q", r.UnixSocket)
+	}
+
+	if r.Resolver != "192.0.2.53" {
+		t.Errorf("incorrect resolver: expected 192.0.2.53, got %q", r.Resolver)
+	}
+
+	if !r.RequestID {
+		t.Errorf("expected request_id to be enabled")
+	}
+
+	if r.TLSMinVersion != "tls1.3" {
+		t.Errorf("incorrect tls_min_version: expected tls1.3, got %q", r.TLSMinVersion)
+	}
+	if !slices.Equal(r.TLSCipherSuites, []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}) {
+		t.Errorf("incorrect tls_cipher_suites: got %v", r.TLSCipherSuites)
+	}
+	if r.TLSServerName != "ips.example.com" {
+		t.Errorf("incorrect tls_server_name: expected ips.example.com, got %q", r.TLSServerName)
+	}
+
+	if r.Serial != "# serial" {
+		t.Errorf("incorrect serial: expected %q, got %q", "# serial", r.Serial)
+	}
+
+	if r.RateLimit != caddy.Duration(30*time.Second) || r.RateBurst != 2 {
+		t.Errorf("incorrect rate_limit: got %v burst %d", r.RateLimit, r.RateBurst)
+	}
+
+	if !r.RequireHTTPS {
+		t.Errorf("expected require_https to be enabled")
+	}
+
+	if !r.Zstd {
+		t.Errorf("expected zstd to be enabled")
+	}
+	if !r.SniffGzip {
+		t.Errorf("expected sniff_gzip to be enabled")
+	}
+	if !r.AllowEmpty {
+		t.Errorf("expected allow_empty to be enabled")
+	}
+	if r.NotifyURL != "https://hooks.example.com/wedos" || r.NotifyFailures != 5 || r.NotifyTimeout != caddy.Duration(3*time.Second) {
+		t.Errorf("incorrect notify options: got %q %d %v", r.NotifyURL, r.NotifyFailures, r.NotifyTimeout)
+	}
+	if r.Method != "post" || r.Body != `{"product": "cdn"}` {
+		t.Errorf("incorrect method/body: got %q %q", r.Method, r.Body)
+	}
+
+	if r.MinPrefixes != 5 {
+		t.Errorf("incorrect min_prefixes: expected 5, got %d", r.MinPrefixes)
+	}
+	if r.MaxMemory != 1<<20 {
+		t.Errorf("incorrect max_memory: expected 1MiB, got %d", r.MaxMemory)
+	}
+	if r.ScanBufferSize != 8<<20 {
+		t.Errorf("incorrect scan_buffer_size: expected 8MiB, got %d", r.ScanBufferSize)
+	}
+
+	if expected := caddy.Duration(2 * time.Minute); expected != r.ApplyDelay {
+		t.Errorf("incorrect apply_delay: expected %v, got %v", expected, r.ApplyDelay)
+	}
+	if expected := caddy.Duration(10 * time.Minute); expected != r.ShrinkGrace {
+		t.Errorf("incorrect shrink_grace: expected %v, got %v", expected, r.ShrinkGrace)
+	}
+
+	if !r.Additive {
+		t.Errorf("expected additive to be enabled")
+	}
+
+	if r.DNSTXT != "_ips.example.com" {
+		t.Errorf("incorrect dns_txt: expected _ips.example.com, got %q", r.DNSTXT)
+	}
+	if r.MergePolicy != "primary-wins" {
+		t.Errorf("incorrect merge_policy: expected primary-wins, got %q", r.MergePolicy)
+	}
+	if r.JSONPath != "data.prefixes[].cidr" {
+		t.Errorf("incorrect json_path: expected data.prefixes[].cidr, got %q", r.JSONPath)
+	}
+	if r.TestIP != "192.0.2.1" {
+		t.Errorf("incorrect test_ip: expected 192.0.2.1, got %q", r.TestIP)
+	}
+	if r.Encoding != "base64" {
+		t.Errorf("incorrect encoding: expected base64, got %q", r.Encoding)
+	}
+	if !r.Maintenance {
+		t.Errorf("incorrect maintenance: expected true")
+	}
+	if !r.ExposeRanges {
+		t.Errorf("incorrect expose_ranges: expected true")
+	}
+	if !r.HTTP3 {
+		t.Errorf("incorrect http3: expected true")
+	}
+	if !r.PartialFallback {
+		t.Errorf("incorrect partial_fallback: expected true")
+	}
+	if r.BeforeFirstFetch != "fallback" {
+		t.Errorf("incorrect before_first_fetch: expected fallback, got %q", r.BeforeFirstFetch)
+	}
+	if !slices.Equal(r.Fallback, []string{"192.0.2.0/24", "2001:db8::/32"}) {
+		t.Errorf("incorrect fallback: got %v", r.Fallback)
+	}
+	if !r.CheckRoutes {
+		t.Errorf("incorrect check_routes: expected true")
+	}
+	if !r.WarnSelfOverlap {
+		t.Errorf("incorrect warn_self_overlap: expected true")
+	}
+	if !r.DryValidate {
+		t.Errorf("incorrect dry_validate: expected true")
+	}
+	if r.ApplyMode != "verified" {
+		t.Errorf("incorrect apply_mode: expected verified, got %q", r.ApplyMode)
+	}
+	if r.Family != "ipv4" || r.FamilyMode != "hard" {
+		t.Errorf("incorrect family: expected ipv4 hard, got %q %q", r.Family, r.FamilyMode)
+	}
+
+	if r.File != "/etc/wedos.txt" || !r.Watch {
+		t.Errorf("incorrect file source: got %q, watch %v", r.File, r.Watch)
+	}
+	if r.TriggerFile != "/run/wedos/refresh" {
+		t.Errorf("incorrect trigger_file: got %q", r.TriggerFile)
+	}
+	if r.SSEURL != "https://mirror.example.com/ips/events" {
+		t.Errorf("incorrect sse_url: got %q", r.SSEURL)
+	}
+	if r.Env != "WEDOS_RANGES" {
+		t.Errorf("incorrect env: expected WEDOS_RANGES, got %q", r.Env)
+	}
+
+	if r.Proxy != "http://proxy.internal:3128" || !slices.Equal(r.NoProxy, []string{".internal", "10.0.0.0/8"}) {
+		t.Errorf("incorrect proxy: got %q, no_proxy %v", r.Proxy, r.NoProxy)
+	}
+
+	if r.SignatureURL != "https://mirror.example.com/ips.txt.sig" || r.PublicKey != "/etc/wedos.pub" {
+		t.Errorf("incorrect signature options: got %q and %q", r.SignatureURL, r.PublicKey)
+	}
+
+	if len(r.Mirrors) != 2 || r.SourceMaxFailures != 5 || r.SourceCooldown != caddy.Duration(30*time.Minute) {
+		t.Errorf("incorrect mirrors: got %v, source_health %d %v", r.Mirrors, r.SourceMaxFailures, r.SourceCooldown)
+	}
+
+	if !r.Shared {
+		t.Errorf("incorrect shared: expected true")
+	}
+	if !slices.Equal(r.AdminAllow, []string{"127.0.0.1/32", "::1/128"}) {
+		t.Errorf("incorrect admin_allow: got %v", r.AdminAllow)
+	}
+	if !r.ProbeCapabilities {
+		t.Errorf("expected probe_capabilities to be enabled")
+	}
+	if !r.HeadProbe {
+		t.Errorf("expected head_probe to be enabled")
+	}
+
+	if r.SNISets["tenant.example.com"] != "tenant" {
+		t.Errorf("incorrect sni mapping: %v", r.SNISets)
+	}
+
+	if r.ParseCacheSize != 4 {
+		t.Errorf("incorrect parse_cache: expected 4, got %d", r.ParseCacheSize)
+	}
+
+	if r.CacheFormat != "binary" {
+		t.Errorf("incorrect cache_format: expected binary, got %q", r.CacheFormat)
+	}
+	if r.StorageKey != "wedos/ranges" {
+		t.Errorf("incorrect storage_key: expected wedos/ranges, got %q", r.StorageKey)
+	}
+	if r.CacheMaxAge != caddy.Duration(72*time.Hour) {
+		t.Errorf("incorrect cache_max_age: expected 72h, got %v", r.CacheMaxAge)
+	}
+	if r.CacheFallbackAfter != 3 {
+		t.Errorf("incorrect cache_fallback_after: expected 3, got %d", r.CacheFallbackAfter)
+	}
+	if r.QuarantineFile != "/var/lib/caddy/wedos-quarantine.json" || r.QuarantineMaxChange != 40 {
+		t.Errorf("incorrect quarantine: got %q and %d", r.QuarantineFile, r.QuarantineMaxChange)
+	}
+	if r.CacheVerifyInterval != caddy.Duration(6*time.Hour) {
+		t.Errorf("incorrect cache_verify_interval: expected 6h, got %v", r.CacheVerifyInterval)
+	}
+
+	if r.GitRaw != "https://git.example.com/org/repo/raw/{ref}/ips.txt" || r.GitRef != "3f2a9c1" {
+		t.Errorf("incorrect git_raw: got %q at %q", r.GitRaw, r.GitRef)
+	}
+}
+
+func TestConnectTimeoutValidation(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{
+		Timeout:        caddy.Duration(5 * time.Second),
+		ConnectTimeout: caddy.Duration(10 * time.Second),
+	}
+	if err := r.Provision(ctx); err == nil {
+		t.Errorf("expected connect_timeout above timeout to be rejected")
+	}
+}
+
+func TestRequireOnStart(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	// A canceled context makes the initial fetch fail immediately.
+	cancel()
+
+	r := WedosIPRange{RequireOnStart: true}
+	if err := r.Provision(ctx); err == nil {
+		t.Errorf("expected provisioning to fail when the initial fetch fails")
+	}
+}
+
+func TestProvisionTwice(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+
+	before := runtime.NumGoroutine()
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	r := &WedosIPRange{URL: srv.URL, Interval: caddy.Duration(time.Hour)}
+	for range 2 {
+		if err := r.Provision(ctx); err != nil {
+			t.Fatalf("provision error: %v", err)
+		}
+	}
+	waitFor(t, func() bool { return hits.Load() >= 1 })
+	time.Sleep(50 * time.Millisecond)
+	// A second refresh loop would have fetched again.
+	if n := hits.Load(); n != 1 {
+		t.Errorf("expected one refresh loop fetching once, got %d fetches", n)
+	}
+	instancesLock.Lock()
+	n := 0
+	for _, s := range instances {
+		if s == r {
+			n++
+		}
+	}
+	instancesLock.Unlock()
+	if n != 1 {
+		t.Errorf("expected the module registered once, got %d", n)
+	}
+
+	cancel()
+	r.Cleanup()
+	srv.CloseClientConnections()
+	waitFor(t, func() bool { return runtime.NumGoroutine() <= before })
+
+	if err := r.Provision(ctx); err == nil {
+		t.Error("expected provisioning a stopped module to fail")
+	}
 }
 
 // Simulates being nested in another block.
@@ -97,3 +633,183 @@ func TestUnmarshalNested(t *testing.T) {
 		t.Errorf("cursor at unexpected position, expected 'other_module', got %v", d.Val())
 	}
 }
+
+func TestBasicAuth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "user" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("192.0.2.0/24\n"))
+	}))
+	defer srv.Close()
+
+	t.Setenv("WEDOS_TEST_PASSWORD", "secret")
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{
+		URL:            srv.URL,
+		RequireOnStart: true,
+		BasicAuth:      &BasicAuth{Username: "user", Password: "{env.WEDOS_TEST_PASSWORD}"},
+	}
+	if err := r.Provision(ctx); err != nil {
+		t.Fatalf("error provisioning: %v", err)
+	}
+
+	got := r.GetIPRanges(nil)
+	if len(got) != 1 || got[0] != netip.MustParsePrefix("192.0.2.0/24") {
+		t.Errorf("unexpected ranges: %v", got)
+	}
+}
+
+func TestBasicAuthMissingPassword(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{BasicAuth: &BasicAuth{Username: "user", Password: "{env.WEDOS_TEST_UNSET}"}}
+	if err := r.Provision(ctx); err == nil {
+		t.Errorf("expected provisioning to fail without a password")
+	}
+}
+
+func TestRecordRefreshRateLimit(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	r := WedosIPRange{WarnInterval: caddy.Duration(time.Hour), logger: zap.New(core), lock: new(sync.RWMutex)}
+
+	fetchErr := errors.New("upstream down")
+	for i := 0; i < 5; i++ {
+		r.recordRefresh(fetchErr)
+	}
+	if n := logs.FilterMessage("refreshing WEDOS IP ranges failed").Len(); n != 1 {
+		t.Errorf("expected 1 failure log within warn_interval, got %d", n)
+	}
+
+	r.recordRefresh(nil)
+	if n := logs.FilterMessage("refreshing WEDOS IP ranges recovered").Len(); n != 1 {
+		t.Errorf("expected 1 recovery log, got %d", n)
+	}
+
+	r.recordRefresh(nil)
+	if n := logs.FilterMessage("refreshing WEDOS IP ranges recovered").Len(); n != 1 {
+		t.Errorf("expected no further recovery logs, got %d", n)
+	}
+
+	r.recordRefresh(fetchErr)
+	if n := logs.FilterMessage("refreshing WEDOS IP ranges failed").Len(); n != 2 {
+		t.Errorf("expected a new outage to be logged, got %d failure logs", n)
+	}
+}
+
+func TestGetIPRangesByFamily(t *testing.T) {
+	r := WedosIPRange{lock: new(sync.RWMutex), applyLock: new(sync.Mutex)}
+	r.setRanges([]netip.Prefix{
+		netip.MustParsePrefix("192.0.2.0/24"),
+		netip.MustParsePrefix("2001:db8::/32"),
+		netip.MustParsePrefix("198.51.100.0/24"),
+	}, time.Now())
+
+	v4 := r.GetIPRangesByFamily(false)
+	if len(v4) != 2 || v4[0].String() != "192.0.2.0/24" || v4[1].String() != "198.51.100.0/24" {
+		t.Errorf("unexpected IPv4 ranges: %v", v4)
+	}
+	v6 := r.GetIPRangesByFamily(true)
+	if len(v6) != 1 || v6[0].String() != "2001:db8::/32" {
+		t.Errorf("unexpected IPv6 ranges: %v", v6)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"wedos {\n\tintervall 1h\n}", `wedos: unknown option "intervall"`},
+		{"wedos {\n\tinterval soon\n}", `invalid interval duration "soon"`},
+		{"wedos {\n\ttimeout 1x\n}", `invalid timeout duration "1x"`},
+		{"wedos {\n\ttolerate_status 503 soon\n}", `invalid tolerate_status duration "soon"`},
+		{"wedos {\n\turl_v4 https://a.example/ips aggregate\n}", `unexpected_argument: option "url_v4"`},
+		{"wedos {\n\tinterval 1h extra\n}", `unexpected_argument: option "interval"`},
+		{"wedos {\n\trate_limit 1m 3 4\n}", `unexpected_argument: option "rate_limit"`},
+	}
+	for _, tt := range tests {
+		r := WedosIPRange{}
+		err := r.UnmarshalCaddyfile(caddyfile.NewTestDispenser(tt.input))
+		if err == nil {
+			t.Errorf("expected error for %q", tt.input)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) || !strings.Contains(err.Error(), ":2") {
+			t.Errorf("error %q should contain %q and the line number", err, tt.want)
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	r := WedosIPRange{lock: new(sync.RWMutex), applyLock: new(sync.Mutex), logger: zap.NewNop()}
+	refreshed := time.Now()
+	r.setRanges(parsePrefixes(t, "192.0.2.0/24"), refreshed)
+
+	ranges, last, err := r.Snapshot()
+	if err != nil || !last.Equal(refreshed) || len(ranges) != 1 {
+		t.Errorf("unexpected snapshot: %v %v %v", ranges, last, err)
+	}
+
+	r.recordRefresh(errors.New("upstream down"))
+	ranges, last, err = r.Snapshot()
+	if err == nil || err.Error() != "upstream down" {
+		t.Errorf("expected the last refresh error, got %v", err)
+	}
+	if !last.Equal(refreshed) || len(ranges) != 1 {
+		t.Errorf("expected the last successful ranges to be kept, got %v %v", ranges, last)
+	}
+}
+
+// Run with -race: readers hold and extend snapshots while refreshes
+// publish new ones.
+func TestSnapshotsImmutable(t *testing.T) {
+	r := &WedosIPRange{lock: new(sync.RWMutex), applyLock: new(sync.Mutex)}
+	lists := [][]netip.Prefix{
+		parsePrefixes(t, "192.0.2.0/24", "192.0.2.0/24", "2001:db8::/32", "198.51.100.0/24"),
+		parsePrefixes(t, "203.0.113.0/24", "2001:db8:1::/48"),
+	}
+	r.setRanges(lists[0], time.Now())
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				held := r.GetIPRanges(nil)
+				want := slices.Clone(held)
+				// Appending must not write into memory shared with others.
+				_ = append(held, netip.MustParsePrefix("0.0.0.0/0"))
+				_ = append(r.GetIPRangesByFamily(true), netip.MustParsePrefix("::/0"))
+				if !slices.Equal(held, want) {
+					t.Error("a held snapshot changed")
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 500; i++ {
+		r.setRanges(lists[i%2], time.Now())
+	}
+	close(stop)
+	wg.Wait()
+
+	for _, got := range [][]netip.Prefix{r.GetIPRanges(nil), r.GetIPRangesByFamily(false), r.GetIPRangesByFamily(true)} {
+		if len(got) != cap(got) {
+			t.Errorf("expected a clipped snapshot, got len %d cap %d", len(got), cap(got))
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package caddy_wedos_ip
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+// Codes of a CaddyfileError.
+const (
+	CaddyfileUnknownOption      = "unknown_option"
+	CaddyfileMissingArgument    = "missing_argument"
+	CaddyfileUnexpectedArgument = "unexpected_argument"
+	CaddyfileArgumentCount      = "argument_count"
+	CaddyfileInvalidValue       = "invalid_value"
+)
+
+var (
+	errUnknownOption = errors.New("unknown option")
+	errMissingArg    = errors.New("missing argument")
+	errUnexpectedArg = errors.New("unexpected argument")
+	errArgCount      = errors.New("wrong argument count")
+)
+
+// CaddyfileError is returned by UnmarshalCaddyfile for any invalid option,
+// so config tooling can tell what failed with errors.As or by marshaling
+// it to JSON. Its message always starts with "wedos: ".
+type CaddyfileError struct {
+	// Option is the name of the failing option, "wedos" for arguments
+	// on the module line itself.
+	Option string `json:"option"`
+	// Code is one of the Caddyfile* codes.
+	Code string `json:"code"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+	// Message describes the failure, without the location.
+	Message string `json:"message"`
+	Err     error  `json:"-"`
+}
+
+func (e *CaddyfileError) Error() string {
+	if e.Code == CaddyfileUnknownOption {
+		return fmt.Sprintf("wedos: unknown option %q at %s:%d", e.Option, e.File, e.Line)
+	}
+	return fmt.Sprintf("wedos: %s: option %q at %s:%d: %s", e.Code, e.Option, e.File, e.Line, e.Message)
+}
+
+func (e *CaddyfileError) Unwrap() error {
+	return e.Err
+}
+
+// newCaddyfileError wraps err, returned for option at file:line. An error
+// of a nested block is already a CaddyfileError and is returned as is.
+func newCaddyfileError(option, file string, line int, err error) error {
+	var cerr *CaddyfileError
+	if errors.As(err, &cerr) {
+		return err
+	}
+	code := CaddyfileInvalidValue
+	switch {
+	case errors.Is(err, errUnknownOption):
+		code = CaddyfileUnknownOption
+	case errors.Is(err, errMissingArg):
+		code = CaddyfileMissingArgument
+	case errors.Is(err, errUnexpectedArg):
+		code = CaddyfileUnexpectedArgument
+	case errors.Is(err, errArgCount):
+		code = CaddyfileArgumentCount
+	}
+	// Dispenser errors end with their location, which Error reports itself.
+	msg := err.Error()
+	if inner := errors.Unwrap(err); inner != nil && strings.HasPrefix(msg, inner.Error()+", at ") {
+		msg = inner.Error()
+	}
+	return &CaddyfileError{Option: option, Code: code, File: file, Line: line, Message: msg, Err: err}
+}
+
+// missingArg reports that the option at the cursor of d lacks an argument.
+func missingArg(d *caddyfile.Dispenser) error {
+	return d.WrapErr(fmt.Errorf("%w after %q", errMissingArg, d.Val()))
+}
+
+// unexpectedArg reports the argument at the cursor of d as one too many.
+func unexpectedArg(d *caddyfile.Dispenser) error {
+	return d.WrapErr(fmt.Errorf("%w %q", errUnexpectedArg, d.Val()))
+}
+
+// argCountErr reports that an option got the wrong number of arguments.
+func argCountErr(d *caddyfile.Dispenser) error {
+	return d.WrapErr(fmt.Errorf("%w after %q", errArgCount, d.Val()))
+}
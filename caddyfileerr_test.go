@@ -0,0 +1,64 @@
+package caddy_wedos_ip
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func TestCaddyfileErrorCodes(t *testing.T) {
+	tests := []struct {
+		input  string
+		option string
+		code   string
+		line   int
+	}{
+		{"wedos {\n\tintervall 1h\n}", "intervall", CaddyfileUnknownOption, 2},
+		{"wedos {\n\ttimeout\n}", "timeout", CaddyfileMissingArgument, 2},
+		{"wedos {\n\turl\n}", "url", CaddyfileArgumentCount, 2},
+		{"wedos {\n\taggregate x\n}", "aggregate", CaddyfileUnexpectedArgument, 2},
+		{"wedos {\n\n\tinterval soon\n}", "interval", CaddyfileInvalidValue, 3},
+		{"wedos extra", "wedos", CaddyfileUnexpectedArgument, 1},
+	}
+	for _, tt := range tests {
+		r := WedosIPRange{}
+		err := r.UnmarshalCaddyfile(caddyfile.NewTestDispenser(tt.input))
+		var cerr *CaddyfileError
+		if !errors.As(err, &cerr) {
+			t.Errorf("%q: expected a *CaddyfileError, got %v", tt.input, err)
+			continue
+		}
+		if cerr.Option != tt.option || cerr.Code != tt.code || cerr.Line != tt.line {
+			t.Errorf("%q: unexpected error %+v", tt.input, cerr)
+		}
+		if !strings.HasPrefix(err.Error(), "wedos: ") {
+			t.Errorf("%q: error %q should start with \"wedos: \"", tt.input, err)
+		}
+		if strings.Contains(cerr.Message, ", at ") {
+			t.Errorf("%q: message %q should not repeat the location", tt.input, cerr.Message)
+		}
+	}
+}
+
+func TestCaddyfileErrorJSON(t *testing.T) {
+	r := WedosIPRange{}
+	err := r.UnmarshalCaddyfile(caddyfile.NewTestDispenser("wedos {\n\tintervall 1h\n}"))
+	var cerr *CaddyfileError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expected a *CaddyfileError, got %v", err)
+	}
+	data, err := json.Marshal(cerr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["code"] != CaddyfileUnknownOption || got["option"] != "intervall" || got["line"] != float64(2) {
+		t.Errorf("unexpected JSON %s", data)
+	}
+}
@@ -0,0 +1,119 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// capabilities are the upstream features ProbeCapabilities detected at
+// url. Mirrors aren't probed and get none. Set before the refresh loop
+// starts and only read afterwards.
+type capabilities struct {
+	url string
+	// The upstream doesn't answer If-None-Match with 304 Not Modified, but
+	// HEAD returns the validators of GET, so head_probe can skip unchanged
+	// lists.
+	headProbe bool
+	// It serves zstd compressed lists.
+	zstd bool
+}
+
+// checkProbeCapabilities rejects ProbeCapabilities with a POST query, whose
+// answers the probe requests can't tell apart.
+func (s *WedosIPRange) checkProbeCapabilities() error {
+	if s.ProbeCapabilities && s.Method == http.MethodPost {
+		return fmt.Errorf("probe_capabilities is only supported with method GET")
+	}
+	return nil
+}
+
+// probeCapabilities detects what URL supports, with up to three requests,
+// and enables the most efficient fetch strategy it allows. Anything it
+// can't establish, including any failure, leaves the default fetches.
+func (s *WedosIPRange) probeCapabilities() {
+	u := s.URL
+	caps := capabilities{url: u}
+
+	header := http.Header{}
+	if !s.Zstd {
+		header.Set("Accept-Encoding", acceptZstd)
+	}
+	resp, err := s.probeRequest(http.MethodGet, u, header)
+	if err != nil {
+		s.logger.Debug("capability probe failed, using the default fetches", zap.String("url", u), zap.Error(err))
+		return
+	}
+	caps.zstd = strings.EqualFold(strings.TrimSpace(resp.Header.Get("Content-Encoding")), "zstd")
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+
+	// Conditional requests are always sent; a HEAD probe is only worth it
+	// for an upstream that ignores them.
+	conditional := false
+	if etag != "" {
+		header := http.Header{"If-None-Match": {etag}}
+		if resp, err := s.probeRequest(http.MethodGet, u, header); err == nil {
+			conditional = resp.StatusCode == http.StatusNotModified
+		}
+	}
+	if !conditional && !s.HeadProbe {
+		if v, err := s.probe(u); err == nil {
+			caps.headProbe = etag != "" && v.ETag == etag ||
+				lastModified != "" && v.LastModified == lastModified
+		}
+	}
+
+	s.caps = caps
+	s.logger.Info("detected WEDOS upstream capabilities",
+		zap.String("url", u),
+		zap.Bool("conditional", conditional),
+		zap.Bool("head_probe", caps.headProbe),
+		zap.Bool("zstd", caps.zstd),
+		zap.String("format", detectFormat(s.Format, resp)))
+}
+
+// probeRequest sends a request for probeCapabilities and drains its body.
+// Statuses other than 2xx and 304 are errors.
+func (s *WedosIPRange) probeRequest(method, u string, header http.Header) (*http.Response, error) {
+	ctx, cancel := s.getContext()
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// capsOf returns the capabilities detected at u, none for a URL that
+// wasn't probed.
+func (s *WedosIPRange) capsOf(u string) capabilities {
+	if u != s.caps.url {
+		return capabilities{}
+	}
+	return s.caps
+}
+
+// headProbing reports whether fetches of u start with a HEAD probe,
+// configured or detected.
+func (s *WedosIPRange) headProbing(u string) bool {
+	return s.HeadProbe || s.capsOf(u).headProbe
+}
@@ -0,0 +1,166 @@
+package caddy_wedos_ip
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestProbeCapabilities(t *testing.T) {
+	const list = "192.0.2.0/24\n"
+	var zbuf bytes.Buffer
+	zw, _ := zstd.NewWriter(&zbuf)
+	zw.Write([]byte(list))
+	zw.Close()
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    capabilities
+	}{
+		{"conditional and zstd", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			if strings.Contains(r.Header.Get("Accept-Encoding"), "zstd") {
+				w.Header().Set("Content-Encoding", "zstd")
+				w.Write(zbuf.Bytes())
+				return
+			}
+			w.Write([]byte(list))
+		}, capabilities{zstd: true}},
+		{"head validators", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Last-Modified", "Mon, 12 Oct 2026 10:00:00 GMT")
+			w.Write([]byte(list))
+		}, capabilities{headProbe: true}},
+		{"no validators", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(list))
+		}, capabilities{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+
+			s, err := New(Options{Config: WedosIPRange{
+				URL:               srv.URL,
+				ProbeCapabilities: true,
+				RequireOnStart:    true,
+				Interval:          caddy.Duration(time.Hour),
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			defer s.Stop()
+			tt.want.url = srv.URL
+			if s.caps != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, s.caps)
+			}
+			if len(s.GetIPRanges(nil)) != 1 {
+				t.Errorf("expected the list to be fetched, got %v", s.GetIPRanges(nil))
+			}
+		})
+	}
+}
+
+func TestProbeCapabilitiesEnablesHeadProbe(t *testing.T) {
+	var gets atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Method == http.MethodGet {
+			gets.Add(1)
+		}
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+
+	s, err := New(Options{Config: WedosIPRange{
+		URL:               srv.URL,
+		ProbeCapabilities: true,
+		RequireOnStart:    true,
+		Interval:          caddy.Duration(time.Hour),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	// The upstream ignores If-None-Match, so later refreshes check HEAD
+	// and skip the unchanged list.
+	before := gets.Load()
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if n := gets.Load() - before; n > 1 {
+		t.Errorf("expected HEAD to skip the unchanged list, got %d GETs", n)
+	}
+}
+
+func TestProbeCapabilitiesFailureKeepsDefaults(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+
+	s, err := New(Options{Config: WedosIPRange{
+		URL:               srv.URL,
+		ProbeCapabilities: true,
+		RequireOnStart:    true,
+		Interval:          caddy.Duration(time.Hour),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	if s.caps != (capabilities{}) {
+		t.Errorf("expected no capabilities after a failed probe, got %+v", s.caps)
+	}
+}
+
+func TestProbeCapabilitiesRequiresGET(t *testing.T) {
+	_, err := New(Options{Config: WedosIPRange{URL: "https://example.com/ips", Method: http.MethodPost, ProbeCapabilities: true}})
+	if err == nil || !strings.Contains(err.Error(), "probe_capabilities") {
+		t.Errorf("expected probe_capabilities to be rejected with POST, got %v", err)
+	}
+}
+
+func TestProbeCapabilitiesPerURL(t *testing.T) {
+	s := newTestRange("https://a.example.com/ips.txt")
+	s.Mirrors = []string{"https://b.example.com/ips.txt"}
+	s.caps = capabilities{url: s.URL, headProbe: true, zstd: true}
+	if !s.headProbing(s.URL) || !s.capsOf(s.URL).zstd {
+		t.Error("expected the probed url to use its capabilities")
+	}
+	// The mirror was never probed.
+	if s.headProbing(s.Mirrors[0]) || s.capsOf(s.Mirrors[0]).zstd {
+		t.Error("expected the mirror to keep the default fetches")
+	}
+}
@@ -0,0 +1,97 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"time"
+)
+
+// newClient builds the module's HTTP client. It uses its own transport
+// so per-module settings never leak into http.DefaultTransport.
+func (s *WedosIPRange) newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(s.ConnectTimeout),
+		KeepAlive: 30 * time.Second,
+		Resolver:  s.resolver,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = s.proxyFunc()
+	if cfg := s.tlsConfig(); cfg != nil {
+		transport.TLSClientConfig = cfg
+	}
+	if s.UnixSocket != "" {
+		// Dial the socket whatever the URL host, e.g. http://unix/ips.txt.
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", s.UnixSocket)
+		}
+	}
+
+	var rt http.RoundTripper = transport
+	if s.HTTP3 {
+		rt = &h3Fallback{h3: s.newH3Transport(), tcp: transport, logger: s.logger}
+	}
+	if s.RateLimit > 0 {
+		rt = newHostLimiter(rt, time.Duration(s.RateLimit), s.RateBurst)
+	}
+
+	return &http.Client{
+		Transport:     rt,
+		CheckRedirect: checkRedirect,
+	}
+}
+
+// maxRedirects matches the net/http default redirect limit.
+const maxRedirects = 10
+
+// checkRedirect follows up to maxRedirects redirects, but never from https
+// to plain http, which would silently downgrade the fetch.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if prev := via[len(via)-1]; prev.URL.Scheme == "https" && req.URL.Scheme != "https" {
+		return fmt.Errorf("refusing redirect from %s to %s: scheme downgrade", prev.URL, req.URL)
+	}
+	return nil
+}
+
+// checkUnixSocket reports an error if path is not an existing Unix socket.
+func checkUnixSocket(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("unix_socket: %v", err)
+	}
+	if info.Mode().Type() != os.ModeSocket {
+		return fmt.Errorf("unix_socket: %s is not a socket", path)
+	}
+	return nil
+}
+
+// provisionResolver builds s.resolver from Resolver, an IP address with an
+// optional port.
+func (s *WedosIPRange) provisionResolver() error {
+	if s.Resolver == "" {
+		return nil
+	}
+	addr := s.Resolver
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "53")
+	}
+	if _, err := netip.ParseAddrPort(addr); err != nil {
+		return fmt.Errorf("resolver: %q is not an IP address with an optional port", s.Resolver)
+	}
+	dialer := &net.Dialer{Timeout: time.Duration(s.ConnectTimeout)}
+	s.resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+	return nil
+}
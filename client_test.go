@@ -0,0 +1,137 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+func TestRedirectDowngrade(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer plain.Close()
+
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/same" {
+			w.Write([]byte("192.0.2.0/24"))
+			return
+		}
+		if r.URL.Path == "/upgrade" {
+			http.Redirect(w, r, "/same", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, plain.URL+"/ips.txt", http.StatusFound)
+	}))
+	defer secure.Close()
+
+	s := WedosIPRange{ctx: caddy.Context{Context: context.Background()}}
+	s.client = s.newClient()
+	// Trust the test server's certificate.
+	s.client.Transport = secure.Client().Transport
+
+	_, err := s.fetch(secure.URL + "/ips.txt")
+	if err == nil || !strings.Contains(err.Error(), "scheme downgrade") {
+		t.Errorf("expected scheme downgrade error, got %v", err)
+	}
+
+	if _, err := s.fetch(secure.URL + "/upgrade"); err != nil {
+		t.Errorf("unexpected error for an https to https redirect: %v", err)
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wedos.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	srv.Listener = ln
+	srv.Start()
+	defer srv.Close()
+
+	if err := checkUnixSocket(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := checkUnixSocket(filepath.Join(t.TempDir(), "missing.sock")); err == nil {
+		t.Errorf("expected an error for a missing socket")
+	}
+
+	s := WedosIPRange{ctx: caddy.Context{Context: context.Background()}, UnixSocket: path}
+	s.client = s.newClient()
+	prefixes, err := s.fetch("http://unix/ips.txt")
+	if err != nil {
+		t.Fatalf("fetch error: %v", err)
+	}
+	if len(prefixes) != 1 || prefixes[0].String() != "192.0.2.0/24" {
+		t.Errorf("unexpected prefixes %v", prefixes)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("X-Request-ID")
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	s := WedosIPRange{ctx: caddy.Context{Context: context.Background()}, logger: zap.NewNop(), RequestID: true}
+	s.client = s.newClient()
+	_, err := s.fetch(srv.URL)
+	if got == "" {
+		t.Fatalf("expected an X-Request-ID header")
+	}
+	if err == nil || !strings.Contains(err.Error(), got) {
+		t.Errorf("expected the error to name request %s, got %v", got, err)
+	}
+
+	s.RequestID = false
+	s.fetch(srv.URL)
+	if got != "" {
+		t.Errorf("unexpected X-Request-ID header %q", got)
+	}
+}
+
+func TestProvisionResolver(t *testing.T) {
+	for _, addr := range []string{"dns.example.com", "192.0.2.53:dns", "192.0.2.53:53:53"} {
+		s := WedosIPRange{Resolver: addr}
+		if err := s.provisionResolver(); err == nil {
+			t.Errorf("expected resolver %q to be rejected", addr)
+		}
+	}
+
+	// Queries go to the configured server.
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	s := WedosIPRange{Resolver: conn.LocalAddr().String()}
+	if err := s.provisionResolver(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go s.resolver.LookupNetIP(ctx, "ip", "ips.example.com")
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := conn.ReadFrom(make([]byte, 512)); err != nil {
+		t.Errorf("expected a query at the resolver: %v", err)
+	}
+
+	s = WedosIPRange{Resolver: "2001:db8::53"}
+	if err := s.provisionResolver(); err != nil || s.resolver == nil {
+		t.Errorf("expected an IPv6 resolver without a port to be accepted, got %v", err)
+	}
+}
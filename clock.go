@@ -0,0 +1,31 @@
+package caddy_wedos_ip
+
+import "time"
+
+// now returns the current time from clock, or time.Now without one. Times
+// from time.Now carry a monotonic clock reading, so ages computed by
+// subtracting them are not affected when the wall clock steps, as after an
+// NTP correction or a VM resume.
+func (s *WedosIPRange) now() time.Time {
+	if s.clock != nil {
+		return s.clock()
+	}
+	return time.Now()
+}
+
+// ageAt returns how long before now t was. A t after now, a wall-clock time
+// from before the clock stepped back, has age zero.
+func ageAt(now, t time.Time) time.Duration {
+	return max(now.Sub(t), 0)
+}
+
+// anchorTime re-expresses a wall-clock time from outside the process, such
+// as the timestamp of the cache file, relative to now. The result carries
+// now's monotonic reading, so its age keeps growing correctly whatever the
+// wall clock does afterwards.
+func anchorTime(now, t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return now.Add(-ageAt(now, t))
+}
@@ -0,0 +1,86 @@
+package caddy_wedos_ip
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestAgeAt(t *testing.T) {
+	now := time.Now()
+	if got := ageAt(now, now.Add(-time.Minute)); got != time.Minute {
+		t.Errorf("expected an age of 1m, got %v", got)
+	}
+	if got := ageAt(now, now.Add(time.Hour)); got != 0 {
+		t.Errorf("expected a time in the future to have age 0, got %v", got)
+	}
+}
+
+func TestCacheTimeAnchored(t *testing.T) {
+	s := newTestRange("https://example.com/ips.txt")
+	s.CacheFile = writeCache(t, cacheEntry{
+		Source:   s.source(),
+		Updated:  time.Now().Add(-10 * time.Minute),
+		Prefixes: parsePrefixes(t, "192.0.2.0/24"),
+	})
+	s.loadCache()
+
+	// The cache file only holds a wall-clock time; once loaded, the time
+	// must carry a monotonic reading for ages to survive clock steps.
+	if s.lastRefresh.IsZero() || s.lastRefresh == s.lastRefresh.Round(0) {
+		t.Fatalf("expected the cached time to be anchored to the monotonic clock, got %v", s.lastRefresh)
+	}
+	if age := ageAt(time.Now(), s.lastRefresh); age < 10*time.Minute || age > 11*time.Minute {
+		t.Errorf("expected an age of about 10m, got %v", age)
+	}
+}
+
+func TestFreshnessClockJump(t *testing.T) {
+	// A fake wall clock without monotonic readings, as the cache file has.
+	cur := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	s := newTestRange("https://example.com/ips.txt")
+	s.clock = func() time.Time { return cur }
+	s.MaxAge = caddy.Duration(time.Hour)
+	s.CacheFile = writeCache(t, cacheEntry{
+		Source:   s.source(),
+		Updated:  cur.Add(-50 * time.Minute),
+		Prefixes: parsePrefixes(t, "192.0.2.0/24"),
+	})
+	s.loadCache()
+
+	if _, fresh := s.GetIPRangesWithFreshness(nil); !fresh {
+		t.Fatalf("expected the cached ranges to be fresh")
+	}
+
+	// The clock steps back two hours. ageAt only keeps the age from going
+	// negative: without monotonic readings the ranges stay fresh until the
+	// fake clock catches up again, which time.Now readings avoid.
+	cur = cur.Add(-2 * time.Hour)
+	if _, fresh := s.GetIPRangesWithFreshness(nil); !fresh {
+		t.Errorf("expected the ranges to stay fresh after the clock stepped back")
+	}
+	if age := ageAt(s.now(), s.lastRefresh); age != 0 {
+		t.Errorf("expected age 0 after the clock stepped back, got %v", age)
+	}
+
+	// And forward again, past max_age.
+	cur = cur.Add(2*time.Hour + 20*time.Minute)
+	if _, fresh := s.GetIPRangesWithFreshness(nil); fresh {
+		t.Errorf("expected the ranges to be stale 70m after the refresh")
+	}
+}
+
+func TestScheduleUsesClock(t *testing.T) {
+	cur := time.Date(2025, 6, 1, 12, 20, 0, 0, time.UTC)
+	s := newTestRange("https://example.com/ips.txt")
+	s.clock = func() time.Time { return cur }
+	sched, err := parseCron("30 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.schedule = sched
+	if got := s.nextDelay(); got != 10*time.Minute {
+		t.Errorf("expected the next run 10m after the injected time, got %v", got)
+	}
+}
@@ -0,0 +1,131 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed five-field cron expression:
+// minute, hour, day of month, month and day of week.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// Whether day of month or day of week was restricted (not "*"). When
+	// both are, a day matching either one fires, as in classic cron.
+	domRestricted, dowRestricted bool
+}
+
+// parseCron parses a standard five-field cron expression. Each field may
+// be "*", a number, a range "a-b", a list "a,b" and a step "*/n" or "a-b/n".
+// Day of week 7 is accepted as Sunday.
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q: expected 5 fields, got %d", expr, len(fields))
+	}
+
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	var sets [5]uint64
+	for i, f := range fields {
+		set, err := parseCronField(f, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: field %d: %v", expr, i+1, err)
+		}
+		sets[i] = set
+	}
+	// Fold Sunday=7 into Sunday=0.
+	if sets[4]&(1<<7) != 0 {
+		sets[4] = sets[4]&^(1<<7) | 1
+	}
+
+	return &cronSchedule{
+		minute:        sets[0],
+		hour:          sets[1],
+		dom:           sets[2],
+		month:         sets[3],
+		dow:           sets[4],
+		domRestricted: fields[2] != "*",
+		dowRestricted: fields[4] != "*",
+	}, nil
+}
+
+// parseCronField parses one comma-separated field into a bit set.
+func parseCronField(field string, lo, hi int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+			step = n
+		}
+
+		start, end := lo, hi
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if start, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("invalid value %q", a)
+			}
+			end = start
+			if isRange {
+				if end, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("invalid value %q", b)
+				}
+			} else if hasStep {
+				end = hi
+			}
+		}
+		if start < lo || end > hi || start > end {
+			return 0, fmt.Errorf("value %q out of range %d-%d", part, lo, hi)
+		}
+
+		for v := start; v <= end; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// dayMatches reports whether t's day matches the day-of-month and
+// day-of-week fields.
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<t.Weekday()) != 0
+	if c.domRestricted && c.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// next returns the first time strictly after t that matches the schedule,
+// or the zero time if none exists within five years (e.g. "0 0 31 2 *").
+func (c *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if c.month&(1<<t.Month()) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<t.Hour()) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<t.Minute()) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
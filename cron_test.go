@@ -0,0 +1,69 @@
+package caddy_wedos_ip
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// A Wednesday.
+	from := time.Date(2025, 1, 1, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2025, 1, 1, 10, 8, 0, 0, time.UTC)},
+		{"5 * * * *", time.Date(2025, 1, 1, 11, 5, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"0 0 * * *", time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", time.Date(2025, 1, 2, 9, 30, 0, 0, time.UTC)},
+		{"0 12 * * 0", time.Date(2025, 1, 5, 12, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2025, 1, 5, 12, 0, 0, 0, time.UTC)},
+		{"0 0 1 3 *", time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Day of month or day of week when both are restricted.
+		{"0 0 15 * 5", time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"0,30 8-9 * * *", time.Date(2025, 1, 2, 8, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		c, err := parseCron(tt.expr)
+		if err != nil {
+			t.Errorf("parseCron(%q) error: %v", tt.expr, err)
+			continue
+		}
+		if got := c.next(from); !got.Equal(tt.want) {
+			t.Errorf("next(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCronNextNever(t *testing.T) {
+	c, err := parseCron("0 0 31 2 *")
+	if err != nil {
+		t.Fatalf("parseCron error: %v", err)
+	}
+	if got := c.next(time.Now()); !got.IsZero() {
+		t.Errorf("expected no next time, got %v", got)
+	}
+}
+
+func TestCronParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q): expected error", expr)
+		}
+	}
+}
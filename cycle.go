@@ -0,0 +1,52 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// errCycleBudget is returned by getPrefixes if the cycle ran out of
+// MaxCycleDuration.
+var errCycleBudget = errors.New("refresh cycle exceeded max_cycle_duration")
+
+// getPrefixes fetches, filters and checks the ranges of one refresh cycle,
+// bounded by MaxCycleDuration if set, holding a slot in refreshSlots.
+func (s *WedosIPRange) getPrefixes() ([]netip.Prefix, error) {
+	release, err := s.acquireRefreshSlot()
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if s.MaxCycleDuration <= 0 {
+		return s.collectPrefixes()
+	}
+	ctx, cancel := context.WithTimeout(s.ctx, time.Duration(s.MaxCycleDuration))
+	s.cycleCtx = ctx
+	defer func() {
+		s.cycleCtx = nil
+		cancel()
+	}()
+
+	prefixes, err := s.collectPrefixes()
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		s.logger.Warn("refresh cycle exceeded max_cycle_duration, keeping the current ranges",
+			zap.Duration("max_cycle_duration", time.Duration(s.MaxCycleDuration)),
+			zap.Error(err))
+		return nil, fmt.Errorf("%w: %w", errCycleBudget, err)
+	}
+	return prefixes, err
+}
+
+// baseContext returns the context the requests of the running cycle derive
+// from.
+func (s *WedosIPRange) baseContext() context.Context {
+	if s.cycleCtx != nil {
+		return s.cycleCtx
+	}
+	return s.ctx
+}
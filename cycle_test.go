@@ -0,0 +1,53 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestMaxCycleDuration(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	s := newTestRange(srv.URL)
+	s.MaxCycleDuration = caddy.Duration(50 * time.Millisecond)
+	s.setRanges(parsePrefixes(t, "192.0.2.0/24"), time.Now())
+
+	start := time.Now()
+	err := s.refresh()
+	if !errors.Is(err, errCycleBudget) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected cycle budget error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("refresh took %v, expected it to stop at max_cycle_duration", elapsed)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected the current ranges %v to be kept, got %v", want, got)
+	}
+	if s.cycleCtx != nil {
+		t.Errorf("expected the cycle context to be cleared")
+	}
+}
+
+func TestMaxCycleDurationFast(t *testing.T) {
+	s := newTestRange(sequenceServer(t, "192.0.2.0/24").URL)
+	s.MaxCycleDuration = caddy.Duration(5 * time.Second)
+	if err := s.refresh(); err != nil {
+		t.Fatalf("refresh error: %v", err)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
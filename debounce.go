@@ -0,0 +1,44 @@
+package caddy_wedos_ip
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// errUnstable is returned by confirmStable if the list changed again
+// within ApplyDelay.
+var errUnstable = errors.New("WEDOS IP list not stable within apply_delay")
+
+// confirmStable returns the fetched prefixes if they match the current
+// ranges. Otherwise it waits ApplyDelay and fetches again, and returns the
+// second result only if both fetches agree.
+func (s *WedosIPRange) confirmStable(fetched []netip.Prefix) ([]netip.Prefix, error) {
+	current := s.GetIPRanges(nil)
+	if slices.Equal(normalizePrefixes(s.withPinned(fetched)), current) {
+		return fetched, nil
+	}
+
+	timer := time.NewTimer(time.Duration(s.ApplyDelay))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+
+	// A 304 here means the list went back to the applied one.
+	again, err := s.getPrefixes()
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Equal(normalizePrefixes(fetched), normalizePrefixes(again)) {
+		s.logger.Debug("WEDOS IP list changed within apply_delay, keeping the current ranges",
+			zap.Duration("apply_delay", time.Duration(s.ApplyDelay)))
+		return nil, errUnstable
+	}
+	return again, nil
+}
@@ -0,0 +1,53 @@
+package caddy_wedos_ip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// sequenceServer serves the given bodies in turn, repeating the last one.
+func sequenceServer(t *testing.T, bodies ...string) *httptest.Server {
+	var n atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := min(int(n.Add(1))-1, len(bodies)-1)
+		w.Write([]byte(bodies[i]))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newDebounced returns a module for url that confirms each fetched list
+// with a second fetch, see ApplyDelay.
+func newDebounced(url string) *WedosIPRange {
+	s := newTestRange(url)
+	s.ApplyDelay = caddy.Duration(10 * time.Millisecond)
+	return s
+}
+
+func TestApplyDelayStable(t *testing.T) {
+	s := newDebounced(sequenceServer(t, "192.0.2.0/24", "192.0.2.0/24").URL)
+	if err := s.refresh(); err != nil {
+		t.Fatalf("refresh error: %v", err)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestApplyDelayFlapping(t *testing.T) {
+	s := newDebounced(sequenceServer(t, "192.0.2.0/24", "198.51.100.0/24").URL)
+	s.setRanges(parsePrefixes(t, "203.0.113.0/24"), time.Now())
+
+	if err := s.refresh(); err != nil {
+		t.Fatalf("a flapping upstream should not fail the refresh: %v", err)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "203.0.113.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected the current ranges %v to be kept, got %v", want, got)
+	}
+}
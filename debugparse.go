@@ -0,0 +1,126 @@
+package caddy_wedos_ip
+
+import (
+	"io"
+	"net/netip"
+	"slices"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+// defaultDebugParseMax is the default number of lines logged per refresh
+// cycle by DebugParse.
+const defaultDebugParseMax = 200
+
+// parseDebug logs the parse decisions of one refresh cycle for DebugParse,
+// at most max lines. Its methods do nothing on a nil *parseDebug.
+type parseDebug struct {
+	logger     *zap.Logger
+	max        int
+	logged     int
+	suppressed int
+	// The partial token of a text list being written.
+	tok []byte
+}
+
+func (d *parseDebug) log(msg string, fields ...zap.Field) {
+	if d.logged >= d.max {
+		d.suppressed++
+		return
+	}
+	d.logged++
+	d.logger.Info(msg, fields...)
+}
+
+// Write scans a text list for its whitespace-separated tokens and logs how
+// each one parses, the way parseRanges does.
+func (d *parseDebug) Write(p []byte) (int, error) {
+	for _, b := range p {
+		switch b {
+		case ' ', '\t', '\n', '\r', '\v', '\f':
+			d.flush()
+		default:
+			d.tok = append(d.tok, b)
+		}
+	}
+	return len(p), nil
+}
+
+// flush logs the pending token, if any.
+func (d *parseDebug) flush() {
+	if d == nil || len(d.tok) == 0 {
+		return
+	}
+	raw := string(d.tok)
+	d.tok = d.tok[:0]
+	prefix, err := caddyhttp.CIDRExpressionToPrefix(stripZone(raw))
+	if err != nil {
+		d.log("debug_parse token", zap.String("raw", raw), zap.Bool("parsed", false), zap.Error(err))
+		return
+	}
+	d.log("debug_parse token", zap.String("raw", raw), zap.Bool("parsed", true), zap.Stringer("normalized", prefix.Masked()))
+}
+
+// entries logs the prefixes parsed from a list of a format without
+// whitespace-separated tokens.
+func (d *parseDebug) entries(format string, prefixes []netip.Prefix) {
+	if d == nil {
+		return
+	}
+	for _, p := range prefixes {
+		d.log("debug_parse entry", zap.String("format", format), zap.Stringer("normalized", p.Masked()))
+	}
+}
+
+// dropped logs a prefix dropped for reason.
+func (d *parseDebug) dropped(p netip.Prefix, reason string) {
+	if d == nil {
+		return
+	}
+	d.log("debug_parse dropped", zap.Stringer("prefix", p), zap.String("reason", reason))
+}
+
+// decide logs whether each prefix of a cycle's result is kept, dropped
+// by exclude, or kept only outside an excluded range.
+func (d *parseDebug) decide(prefixes, exclude []netip.Prefix) {
+	if d == nil {
+		return
+	}
+	for _, p := range prefixes {
+		m := p.Masked()
+		switch {
+		case slices.ContainsFunc(exclude, func(e netip.Prefix) bool { return e.Bits() <= m.Bits() && e.Contains(m.Addr()) }):
+			d.dropped(p, skipExcluded)
+		case slices.ContainsFunc(exclude, m.Overlaps):
+			d.log("debug_parse kept", zap.Stringer("prefix", p), zap.Bool("partially_excluded", true))
+		default:
+			d.log("debug_parse kept", zap.Stringer("prefix", p))
+		}
+	}
+}
+
+// finish reports how many lines were suppressed by the limit.
+func (d *parseDebug) finish() {
+	if d == nil || d.suppressed == 0 {
+		return
+	}
+	d.logger.Info("debug_parse output truncated",
+		zap.Int("logged", d.logged),
+		zap.Int("suppressed", d.suppressed))
+}
+
+// debugParseList parses a list like parseSourceList, logging its tokens
+// or entries to s.pdebug.
+func (s *WedosIPRange) debugParseList(format string, r io.Reader) ([]netip.Prefix, error) {
+	if format == "" || format == formatAuto || format == formatText {
+		prefixes, err := s.parseRegionList(format, s.scanSized(io.TeeReader(r, s.pdebug)))
+		s.pdebug.flush()
+		return prefixes, err
+	}
+	prefixes, err := s.parseRegionList(format, r)
+	if err == nil {
+		s.pdebug.entries(format, prefixes)
+	}
+	return prefixes, err
+}
@@ -0,0 +1,87 @@
+package caddy_wedos_ip
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestDebugParse(t *testing.T) {
+	srv := sequenceServer(t, "192.0.2.1 198.51.100.0/24\n10.0.0.0/4 203.0.113.0/24")
+
+	core, logs := observer.New(zap.InfoLevel)
+	s := newTestRange(srv.URL)
+	s.logger = zap.New(core)
+	s.DebugParse = true
+	s.DebugParseMax = defaultDebugParseMax
+	s.exclude = parsePrefixes(t, "203.0.113.0/24", "198.51.100.128/25")
+
+	if err := s.refresh(); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	tokens := logs.FilterMessage("debug_parse token").AllUntimed()
+	if len(tokens) != 4 {
+		t.Fatalf("expected 4 token lines, got %d", len(tokens))
+	}
+	if f := tokens[0].ContextMap(); f["raw"] != "192.0.2.1" || f["parsed"] != true || f["normalized"] != "192.0.2.1/32" {
+		t.Errorf("unexpected first token: %v", f)
+	}
+
+	dropped := map[string]string{}
+	for _, e := range logs.FilterMessage("debug_parse dropped").AllUntimed() {
+		f := e.ContextMap()
+		dropped[f["prefix"].(string)] = f["reason"].(string)
+	}
+	if len(dropped) != 2 || dropped["10.0.0.0/4"] != skipTooBroad || dropped["203.0.113.0/24"] != skipExcluded {
+		t.Errorf("unexpected dropped prefixes: %v", dropped)
+	}
+
+	kept := logs.FilterMessage("debug_parse kept").AllUntimed()
+	if len(kept) != 2 {
+		t.Fatalf("expected 2 kept lines, got %d", len(kept))
+	}
+	if f := kept[1].ContextMap(); f["prefix"] != "198.51.100.0/24" || f["partially_excluded"] != true {
+		t.Errorf("expected 198.51.100.0/24 to be kept partially, got %v", f)
+	}
+}
+
+func TestDebugParseUnparsable(t *testing.T) {
+	srv := sequenceServer(t, "192.0.2.0/24 bogus")
+
+	core, logs := observer.New(zap.InfoLevel)
+	s := newTestRange(srv.URL)
+	s.logger = zap.New(core)
+	s.DebugParse = true
+	s.DebugParseMax = defaultDebugParseMax
+
+	if err := s.refresh(); err == nil {
+		t.Fatal("expected the refresh to fail")
+	}
+	tokens := logs.FilterMessage("debug_parse token").AllUntimed()
+	if len(tokens) != 2 || tokens[1].ContextMap()["raw"] != "bogus" || tokens[1].ContextMap()["parsed"] != false {
+		t.Errorf("expected the bogus token to be logged as unparsed, got %v", tokens)
+	}
+}
+
+func TestDebugParseLimit(t *testing.T) {
+	srv := sequenceServer(t, "192.0.2.0/24 198.51.100.0/24 203.0.113.0/24")
+
+	core, logs := observer.New(zap.InfoLevel)
+	s := newTestRange(srv.URL)
+	s.logger = zap.New(core)
+	s.DebugParse = true
+	s.DebugParseMax = 2
+
+	if err := s.refresh(); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if n := logs.FilterMessage("debug_parse token").Len(); n != 2 {
+		t.Errorf("expected 2 token lines, got %d", n)
+	}
+	summary := logs.FilterMessage("debug_parse output truncated").AllUntimed()
+	if len(summary) != 1 || summary[0].ContextMap()["suppressed"] != int64(4) {
+		t.Errorf("expected a summary of 4 suppressed lines, got %v", summary)
+	}
+}
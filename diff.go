@@ -0,0 +1,54 @@
+package caddy_wedos_ip
+
+import (
+	"net/netip"
+	"slices"
+
+	"go.uber.org/zap"
+)
+
+// maxLoggedChanges bounds how many added or removed prefixes are listed
+// in a single change log entry.
+const maxLoggedChanges = 50
+
+// diffPrefixes returns the prefixes in next but not in prev (added) and
+// those in prev but not in next (removed), both sorted. Duplicates are
+// ignored.
+func diffPrefixes(prev, next []netip.Prefix) (added, removed []netip.Prefix) {
+	a := slices.Clone(prev)
+	b := slices.Clone(next)
+	slices.SortFunc(a, comparePrefixes)
+	slices.SortFunc(b, comparePrefixes)
+	a = slices.Compact(a)
+	b = slices.Compact(b)
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch c := comparePrefixes(a[i], b[j]); {
+		case c < 0:
+			removed = append(removed, a[i])
+			i++
+		case c > 0:
+			added = append(added, b[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	removed = append(removed, a[i:]...)
+	added = append(added, b[j:]...)
+	return added, removed
+}
+
+// logChanges logs the prefixes added and removed by a refresh, if any.
+func (s *WedosIPRange) logChanges(added, removed []netip.Prefix) {
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+	s.logger.Info("WEDOS IP ranges changed",
+		zap.Int("added_count", len(added)),
+		zap.Int("removed_count", len(removed)),
+		zap.Stringers("added", added[:min(len(added), maxLoggedChanges)]),
+		zap.Stringers("removed", removed[:min(len(removed), maxLoggedChanges)]))
+}
@@ -0,0 +1,24 @@
+package caddy_wedos_ip
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiffPrefixes(t *testing.T) {
+	prev := parsePrefixes(t, "192.0.2.0/24", "198.51.100.0/24", "2001:db8::/32", "192.0.2.0/24")
+	next := parsePrefixes(t, "2001:db8::/32", "203.0.113.0/24", "192.0.2.0/24", "192.0.2.0/25")
+
+	added, removed := diffPrefixes(prev, next)
+	if want := parsePrefixes(t, "192.0.2.0/25", "203.0.113.0/24"); !slices.Equal(added, want) {
+		t.Errorf("added = %v, want %v", added, want)
+	}
+	if want := parsePrefixes(t, "198.51.100.0/24"); !slices.Equal(removed, want) {
+		t.Errorf("removed = %v, want %v", removed, want)
+	}
+
+	added, removed = diffPrefixes(next, next)
+	if len(added) != 0 || len(removed) != 0 {
+		t.Errorf("expected no changes, got added %v, removed %v", added, removed)
+	}
+}
@@ -0,0 +1,86 @@
+package caddy_wedos_ip
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"net/netip"
+	"slices"
+
+	"go.uber.org/zap"
+)
+
+// defaultDebugDistributionMax is the default number of blocks logged per
+// address family by DebugDistribution.
+const defaultDebugDistributionMax = 10
+
+// blockShare is the part of a set of prefixes within one allocation block.
+type blockShare struct {
+	block    netip.Prefix
+	prefixes int
+	// Fraction of the addresses of the family, counting IPv6 in /64s.
+	share float64
+}
+
+func (b blockShare) String() string {
+	return fmt.Sprintf("%s %d (%.1f%%)", b.block, b.prefixes, 100*b.share)
+}
+
+// distribution groups prefixes of one family by their /8 (IPv4) or /16
+// (IPv6) block, largest address share first. Prefixes broader than the
+// block are their own block.
+func distribution(prefixes []netip.Prefix) []blockShare {
+	shares := make(map[netip.Prefix]*blockShare)
+	var total float64
+	for _, p := range prefixes {
+		bits, hostBits := 8, 32-p.Bits()
+		if p.Addr().Is6() {
+			bits, hostBits = 16, max(0, 64-p.Bits())
+		}
+		block := netip.PrefixFrom(p.Addr(), min(bits, p.Bits())).Masked()
+		b := shares[block]
+		if b == nil {
+			b = &blockShare{block: block}
+			shares[block] = b
+		}
+		weight := math.Exp2(float64(hostBits))
+		b.prefixes++
+		b.share += weight
+		total += weight
+	}
+	out := make([]blockShare, 0, len(shares))
+	for _, b := range shares {
+		b.share /= total
+		out = append(out, *b)
+	}
+	slices.SortFunc(out, func(a, b blockShare) int {
+		if c := cmp.Compare(b.share, a.share); c != 0 {
+			return c
+		}
+		return a.block.Addr().Compare(b.block.Addr())
+	})
+	return out
+}
+
+// logDistribution logs how prefixes spread over allocation blocks, the
+// DebugDistributionMax largest per family, as a quick check that the set
+// looks like the expected address space.
+func (s *WedosIPRange) logDistribution(prefixes []netip.Prefix) {
+	v4, v6 := splitFamilies(prefixes)
+	fields := []zap.Field{zap.Int("count", len(prefixes))}
+	for _, fam := range []struct {
+		name     string
+		prefixes []netip.Prefix
+	}{{"ipv4", v4}, {"ipv6", v6}} {
+		if len(fam.prefixes) == 0 {
+			continue
+		}
+		blocks := distribution(fam.prefixes)
+		if n := len(blocks) - s.DebugDistributionMax; n > 0 {
+			blocks = blocks[:s.DebugDistributionMax]
+			fields = append(fields, zap.Int(fam.name+"_other_blocks", n))
+		}
+		fields = append(fields, zap.Stringers(fam.name, blocks))
+	}
+	s.logger.Info("debug_distribution of WEDOS IP ranges", fields...)
+}
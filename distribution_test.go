@@ -0,0 +1,51 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestDistribution(t *testing.T) {
+	blocks := distribution(parsePrefixes(t, "185.8.236.0/22", "185.8.240.0/24", "46.28.104.0/21", "1.0.0.0/4"))
+	got := fmt.Sprint(blocks)
+	// 1.0.0.0/4 is broader than a /8 and is its own block.
+	want := "[0.0.0.0/4 1 (100.0%) 46.0.0.0/8 1 (0.0%) 185.0.0.0/8 2 (0.0%)]"
+	if got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	blocks = distribution(parsePrefixes(t, "2a02:2b88::/32", "2a02:2b89::/32", "2001:db8::/34"))
+	if got, want := fmt.Sprint(blocks), "[2a02::/16 2 (88.9%) 2001::/16 1 (11.1%)]"; got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestLogDistribution(t *testing.T) {
+	srv := sequenceServer(t, "10.0.0.0/24 11.0.0.0/24 12.0.0.0/16 2001:db8::/32")
+	s := newTestRange(srv.URL)
+	s.DebugDistribution = true
+	s.DebugDistributionMax = 2
+	core, logs := observer.New(zap.InfoLevel)
+	s.logger = zap.New(core)
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := logs.FilterMessageSnippet("debug_distribution").All()
+	if len(entries) != 1 {
+		t.Fatalf("expected one log, got %d", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if got := fmt.Sprint(fields["ipv4"]); got != "[12.0.0.0/8 1 (99.2%) 10.0.0.0/8 1 (0.4%)]" {
+		t.Errorf("unexpected ipv4 blocks %s", got)
+	}
+	if fields["ipv4_other_blocks"] != int64(1) {
+		t.Errorf("expected 1 more IPv4 block, got %v", fields["ipv4_other_blocks"])
+	}
+	if got := fmt.Sprint(fields["ipv6"]); got != "[2001::/16 1 (100.0%)]" {
+		t.Errorf("unexpected ipv6 blocks %s", got)
+	}
+}
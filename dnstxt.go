@@ -0,0 +1,29 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// lookupTXT resolves TXT records for the dns_txt option with r, or the
+// default resolver if r is nil.
+var lookupTXT = func(ctx context.Context, r *net.Resolver, name string) ([]string, error) {
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	return r.LookupTXT(ctx, name)
+}
+
+// lookupTXTRanges parses the CIDR tokens in all TXT records of DNSTXT.
+func (s *WedosIPRange) lookupTXTRanges() ([]netip.Prefix, error) {
+	ctx, cancel := s.getContext()
+	defer cancel()
+
+	records, err := lookupTXT(ctx, s.resolver, s.DNSTXT)
+	if err != nil {
+		return nil, err
+	}
+	return parseRanges(strings.NewReader(strings.Join(records, " ")))
+}
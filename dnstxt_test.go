@@ -0,0 +1,88 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func stubTXT(t *testing.T, records map[string][]string) {
+	orig := lookupTXT
+	lookupTXT = func(_ context.Context, _ *net.Resolver, name string) ([]string, error) {
+		if recs, ok := records[name]; ok {
+			return recs, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	t.Cleanup(func() { lookupTXT = orig })
+}
+
+func TestDNSTXTSource(t *testing.T) {
+	stubTXT(t, map[string][]string{
+		"_ips.example.com": {"192.0.2.0/24 198.51.100.0/24", "2001:db8::/32"},
+	})
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{DNSTXT: "_ips.example.com", RequireOnStart: true}
+	if err := r.Provision(ctx); err != nil {
+		t.Fatalf("provision error: %v", err)
+	}
+	defer r.Cleanup()
+
+	if r.URL != "" {
+		t.Errorf("expected no default URL with dns_txt, got %q", r.URL)
+	}
+	want := parsePrefixes(t, "192.0.2.0/24", "198.51.100.0/24", "2001:db8::/32")
+	if got := r.GetIPRanges(nil); !slices.Equal(got, want) {
+		t.Errorf("GetIPRanges() = %v, want %v", got, want)
+	}
+	if got := r.source(); got != "dns:_ips.example.com" {
+		t.Errorf("unexpected source %q", got)
+	}
+}
+
+func TestDNSTXTMergedWithURL(t *testing.T) {
+	stubTXT(t, map[string][]string{"_ips.example.com": {"198.51.100.0/24"}})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+
+	s := WedosIPRange{URL: srv.URL, DNSTXT: "_ips.example.com", ctx: caddy.Context{Context: context.Background()}}
+	s.client = s.newClient()
+	got, err := s.fetchSources()
+	if err != nil {
+		t.Fatalf("fetch error: %v", err)
+	}
+	if want := parsePrefixes(t, "198.51.100.0/24", "192.0.2.0/24"); !slices.Equal(got, want) {
+		t.Errorf("fetchSources() = %v, want %v", got, want)
+	}
+
+	s.DNSTXT = "_missing.example.com"
+	var dnsErr *net.DNSError
+	if _, err := s.fetchSources(); !errors.As(err, &dnsErr) {
+		t.Errorf("expected a DNS error, got %v", err)
+	}
+}
+
+func TestDNSTXTResolver(t *testing.T) {
+	s := WedosIPRange{DNSTXT: "_ips.example.com", ctx: caddy.Context{Context: context.Background()}}
+	s.resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, errors.New("resolver unavailable")
+		},
+	}
+	if _, err := s.lookupTXTRanges(); err == nil || !strings.Contains(err.Error(), "resolver unavailable") {
+		t.Errorf("expected the lookup to use the configured resolver, got %v", err)
+	}
+}
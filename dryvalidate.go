@@ -0,0 +1,63 @@
+package caddy_wedos_ip
+
+import (
+	"net/netip"
+
+	"go.uber.org/zap"
+)
+
+// dryValidate warns about the exclude entries matching nothing in the first
+// fetched list and the pinned entries it already covers, likely typos and
+// leftovers. It runs once per module and never changes the ranges. Only
+// called by the refresh goroutine.
+func (s *WedosIPRange) dryValidate(fetched []netip.Prefix) {
+	if s.dryValidated {
+		return
+	}
+	s.dryValidated = true
+
+	// An exclude carving a pinned range isn't a mistake either.
+	listed := append(append([]netip.Prefix(nil), fetched...), s.pinned...)
+	if unmatched := unmatchedExcludes(s.exclude, listed); len(unmatched) > 0 {
+		s.logger.Warn("exclude entries match no fetched WEDOS IP prefix, check for typos",
+			zap.Stringers("exclude", unmatched))
+	}
+	if redundant := coveredPrefixes(s.pinned, fetched); len(redundant) > 0 {
+		s.logger.Warn("pinned entries are already covered by the fetched WEDOS IP prefixes",
+			zap.Stringers("pinned", redundant))
+	}
+}
+
+// unmatchedExcludes returns the excluded ranges overlapping none of
+// prefixes.
+func unmatchedExcludes(exclude, prefixes []netip.Prefix) []netip.Prefix {
+	var out []netip.Prefix
+	for _, e := range exclude {
+		matched := false
+		for _, p := range prefixes {
+			if p.Overlaps(e) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// coveredPrefixes returns the prefixes of extra each contained in one of
+// prefixes.
+func coveredPrefixes(extra, prefixes []netip.Prefix) []netip.Prefix {
+	var out []netip.Prefix
+	for _, x := range extra {
+		for _, p := range prefixes {
+			if p.Bits() <= x.Bits() && p.Contains(x.Addr()) {
+				out = append(out, x)
+				break
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,44 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestDryValidate(t *testing.T) {
+	srv := sequenceServer(t, "192.0.2.0/24 198.51.100.0/24", "192.0.2.0/24")
+	s := newTestRange(srv.URL)
+	s.DryValidate = true
+	s.exclude = parsePrefixes(t, "192.0.2.128/25", "203.0.113.0/24", "10.9.0.0/16")
+	s.pinned = parsePrefixes(t, "198.51.100.7/32", "10.0.0.0/8")
+	core, logs := observer.New(zap.WarnLevel)
+	s.logger = zap.New(core)
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 10.9.0.0/16 carves the pinned 10.0.0.0/8.
+	entries := logs.FilterMessageSnippet("exclude entries").All()
+	if len(entries) != 1 || fmt.Sprint(entries[0].ContextMap()["exclude"]) != "[203.0.113.0/24]" {
+		t.Errorf("expected only 203.0.113.0/24 reported as unmatched, got %v", entries)
+	}
+	entries = logs.FilterMessageSnippet("pinned entries").All()
+	if len(entries) != 1 || fmt.Sprint(entries[0].ContextMap()["pinned"]) != "[198.51.100.7/32]" {
+		t.Errorf("expected only 198.51.100.7/32 reported as covered, got %v", entries)
+	}
+	if _, ok := s.Lookup(netip.MustParseAddr("198.51.100.128")); !ok {
+		t.Error("expected the ranges to be applied as without dry_validate")
+	}
+
+	// Only the first fetch is checked.
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if n := logs.Len(); n != 2 {
+		t.Errorf("expected no further warnings, got %d in total", n)
+	}
+}
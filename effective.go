@@ -0,0 +1,67 @@
+package caddy_wedos_ip
+
+import (
+	"maps"
+	"net/url"
+	"slices"
+
+	"go.uber.org/zap"
+)
+
+// redacted replaces secrets in logged configuration.
+const redacted = "REDACTED"
+
+// effectiveConfig returns a copy of the options s runs with, after defaults
+// and placeholder expansion, with secrets redacted. Range sets are left out
+// as each of them logs its own configuration when it is provisioned.
+func (s *WedosIPRange) effectiveConfig() WedosIPRange {
+	c := *s
+	c.Sets = nil
+	c.URL = redactURL(s.URL)
+	c.URLv4 = redactURL(s.URLv4)
+	c.URLv6 = redactURL(s.URLv6)
+	c.SignatureURL = redactURL(s.SignatureURL)
+	c.SSEURL = redactURL(s.SSEURL)
+	c.Proxy = redactURL(s.Proxy)
+	c.NotifyURL = redactURL(s.NotifyURL)
+	c.Mirrors = make([]string, 0, len(s.Mirrors))
+	for _, m := range s.Mirrors {
+		c.Mirrors = append(c.Mirrors, redactURL(m))
+	}
+	if s.BasicAuth != nil {
+		c.BasicAuth = &BasicAuth{Username: s.username}
+		if s.password != "" {
+			c.BasicAuth.Password = redacted
+		}
+	}
+	return c
+}
+
+// logEffectiveConfig logs the effective configuration at debug level.
+func (s *WedosIPRange) logEffectiveConfig() {
+	if ce := s.logger.Check(zap.DebugLevel, "effective configuration"); ce != nil {
+		ce.Write(
+			zap.Reflect("config", s.effectiveConfig()),
+			zap.Strings("sets", slices.Sorted(maps.Keys(s.Sets))),
+		)
+	}
+}
+
+// redactURL hides the password in the user info of a URL. A URL that cannot
+// be parsed is redacted entirely.
+func redactURL(raw string) string {
+	if raw == "" {
+		return raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	if u.User == nil {
+		return raw
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
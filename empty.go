@@ -0,0 +1,27 @@
+package caddy_wedos_ip
+
+import (
+	"errors"
+	"net/netip"
+
+	"go.uber.org/zap"
+)
+
+// errEmptyResponse is returned for a successful response holding no
+// prefixes, see AllowEmpty.
+var errEmptyResponse = errors.New("source answered with an empty list")
+
+// checkEmpty counts a response from api without prefixes, and rejects it
+// unless AllowEmpty is set.
+func (s *WedosIPRange) checkEmpty(api string, prefixes []netip.Prefix) error {
+	if len(prefixes) > 0 {
+		return nil
+	}
+	recordEmptyResponse()
+	if !s.AllowEmpty {
+		return errEmptyResponse
+	}
+	s.logger.Warn("applying an empty WEDOS IP list as allow_empty is set",
+		zap.String("url", redactURL(api)))
+	return nil
+}
@@ -0,0 +1,70 @@
+package caddy_wedos_ip
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestEmptyResponse(t *testing.T) {
+	srv := sequenceServer(t, "192.0.2.0/24", " \n")
+	s := newTestRange(srv.URL)
+	if err := s.refresh(); err != nil {
+		t.Fatalf("refresh error: %v", err)
+	}
+	core, logs := observer.New(zap.WarnLevel)
+	s.logger = zap.New(core)
+
+	initMetrics()
+	emptyBefore := testutil.ToFloat64(wedosMetrics.emptyResponses)
+	resultBefore := testutil.ToFloat64(wedosMetrics.refreshes.WithLabelValues(resultEmpty))
+
+	err := s.refresh()
+	if !errors.Is(err, errEmptyResponse) {
+		t.Fatalf("expected an empty response error, got %v", err)
+	}
+	s.recordRefresh(err)
+
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected the previous ranges %v to be kept, got %v", want, got)
+	}
+	if got := s.status().LastErrorClass; got != errClassEmpty {
+		t.Errorf("expected last_error_class %q, got %q", errClassEmpty, got)
+	}
+	if got := testutil.ToFloat64(wedosMetrics.emptyResponses) - emptyBefore; got != 1 {
+		t.Errorf("expected 1 empty response counted, got %v", got)
+	}
+	if got := testutil.ToFloat64(wedosMetrics.refreshes.WithLabelValues(resultEmpty)) - resultBefore; got != 1 {
+		t.Errorf("expected 1 refresh counted as empty, got %v", got)
+	}
+	if logs.FilterMessageSnippet("empty list").Len() != 1 {
+		t.Errorf("expected a dedicated warning, got %v", logs.All())
+	}
+}
+
+func TestEmptyResponseAllowed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	s := newTestRange(srv.URL)
+	s.AllowEmpty = true
+	s.setRanges(parsePrefixes(t, "192.0.2.0/24"), time.Now())
+
+	initMetrics()
+	before := testutil.ToFloat64(wedosMetrics.emptyResponses)
+	if err := s.refresh(); err != nil {
+		t.Fatalf("refresh error: %v", err)
+	}
+	if got := s.GetIPRanges(nil); len(got) != 0 {
+		t.Errorf("expected the empty list to be applied, got %v", got)
+	}
+	if got := testutil.ToFloat64(wedosMetrics.emptyResponses) - before; got != 1 {
+		t.Errorf("expected the empty response to be counted, got %v", got)
+	}
+}
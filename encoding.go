@@ -0,0 +1,57 @@
+package caddy_wedos_ip
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// acceptZstd is sent when the zstd option is set. Setting Accept-Encoding
+// disables the transport's transparent gzip handling, so decodeBody
+// decompresses both encodings itself.
+const acceptZstd = "zstd, gzip"
+
+// decodeBody returns a reader for the response body decoded according to
+// its Content-Encoding. Identity bodies are returned unchanged, unless
+// sniffGzip is set and they start with the gzip magic bytes: some mirrors
+// serve gzip files without declaring it.
+func decodeBody(resp *http.Response, sniffGzip bool) (io.ReadCloser, error) {
+	switch enc := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); enc {
+	case "", "identity":
+		if sniffGzip {
+			return sniffGzipBody(resp.Body)
+		}
+		return resp.Body, nil
+	case "gzip":
+		return gzip.NewReader(resp.Body)
+	case "zstd":
+		dec, err := zstd.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", enc)
+	}
+}
+
+// sniffGzipBody decompresses body if it starts with the gzip magic bytes,
+// and returns it unchanged otherwise.
+func sniffGzipBody(body io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(body)
+	magic, err := br.Peek(len(gzipMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if !bytes.Equal(magic, gzipMagic) {
+		return io.NopCloser(br), nil
+	}
+	return gzip.NewReader(br)
+}
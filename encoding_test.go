@@ -0,0 +1,113 @@
+package caddy_wedos_ip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestZstdNegotiation(t *testing.T) {
+	const list = "192.0.2.0/24\n2001:db8::/32\n"
+
+	var zbuf bytes.Buffer
+	zw, _ := zstd.NewWriter(&zbuf)
+	zw.Write([]byte(list))
+	zw.Close()
+
+	var gbuf bytes.Buffer
+	gw := gzip.NewWriter(&gbuf)
+	gw.Write([]byte(list))
+	gw.Close()
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+	}{
+		{"zstd", "zstd", zbuf.Bytes()},
+		{"gzip", "gzip", gbuf.Bytes()},
+		{"identity", "", []byte(list)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Accept-Encoding"); got != acceptZstd {
+					t.Errorf("unexpected Accept-Encoding %q", got)
+				}
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				w.Write(tt.body)
+			}))
+			defer srv.Close()
+
+			s := WedosIPRange{ctx: caddy.Context{Context: context.Background()}, Zstd: true}
+			s.client = s.newClient()
+			prefixes, err := s.fetch(srv.URL)
+			if err != nil {
+				t.Fatalf("fetch error: %v", err)
+			}
+			if len(prefixes) != 2 {
+				t.Errorf("expected 2 prefixes, got %v", prefixes)
+			}
+		})
+	}
+}
+
+func TestUnsupportedEncoding(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "br")
+		w.Write([]byte("garbage"))
+	}))
+	defer srv.Close()
+
+	s := WedosIPRange{ctx: caddy.Context{Context: context.Background()}, Zstd: true}
+	s.client = s.newClient()
+	if _, err := s.fetch(srv.URL); err == nil {
+		t.Errorf("expected an error for an unsupported content encoding")
+	}
+}
+
+func TestSniffGzip(t *testing.T) {
+	const list = "192.0.2.0/24\n2001:db8::/32\n"
+	var gbuf bytes.Buffer
+	gw := gzip.NewWriter(&gbuf)
+	gw.Write([]byte(list))
+	gw.Close()
+
+	for _, tt := range []struct {
+		name  string
+		body  []byte
+		sniff bool
+		ok    bool
+	}{
+		{"undeclared gzip", gbuf.Bytes(), true, true},
+		{"plain", []byte(list), true, true},
+		{"one byte", []byte("x"), true, false},
+		{"undeclared gzip without sniffing", gbuf.Bytes(), false, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/octet-stream")
+				w.Write(tt.body)
+			}))
+			defer srv.Close()
+
+			s := WedosIPRange{ctx: caddy.Context{Context: context.Background()}, SniffGzip: tt.sniff}
+			s.client = s.newClient()
+			prefixes, err := s.fetch(srv.URL)
+			if (err == nil) != tt.ok {
+				t.Fatalf("unexpected fetch error: %v", err)
+			}
+			if tt.ok && len(prefixes) != 2 {
+				t.Errorf("expected 2 prefixes, got %v", prefixes)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// checkEntryTTL validates EntryTTL and ShrinkGrace, and prepares the
+// reaper timer for either.
+func (s *WedosIPRange) checkEntryTTL() error {
+	if s.ShrinkGrace < 0 {
+		return fmt.Errorf("shrink_grace must not be negative")
+	}
+	if s.EntryTTL {
+		if s.Format != formatLabeled {
+			return fmt.Errorf("entry_ttl requires format labeled")
+		}
+		// The cache holds prefixes without their labels.
+		if s.ParseCacheSize > 0 {
+			return fmt.Errorf("entry_ttl cannot be combined with parse_cache_size")
+		}
+	}
+	if s.EntryTTL || s.ShrinkGrace > 0 {
+		s.reapTimer = time.NewTimer(time.Hour)
+		s.reapTimer.Stop()
+	}
+	return nil
+}
+
+// parseEntryTTL returns the TTL of a "ttl=" label, either seconds or a
+// duration such as "30m", and whether label is one.
+func parseEntryTTL(label string) (time.Duration, bool, error) {
+	v, ok := strings.CutPrefix(label, "ttl=")
+	if !ok {
+		return 0, false, nil
+	}
+	var ttl time.Duration
+	if n, err := strconv.Atoi(v); err == nil {
+		ttl = time.Duration(n) * time.Second
+	} else if ttl, err = caddy.ParseDuration(v); err != nil {
+		return 0, true, fmt.Errorf("invalid ttl %q", v)
+	}
+	if ttl <= 0 {
+		return 0, true, fmt.Errorf("invalid ttl %q: must be positive", v)
+	}
+	return ttl, true, nil
+}
+
+// recordEntryTTLs notes the expiry of the entries of a parsed labeled list
+// carrying a ttl= label, for the running refresh cycle. A prefix listed
+// again without one never expires.
+func (s *WedosIPRange) recordEntryTTLs(entries []labeledEntry) error {
+	now := s.now()
+	if s.pendingExpiries == nil {
+		s.pendingExpiries = make(map[netip.Prefix]time.Time)
+	}
+	for _, e := range entries {
+		var expires time.Time
+		for _, label := range e.labels {
+			ttl, ok, err := parseEntryTTL(label)
+			if err != nil {
+				return fmt.Errorf("%s: %w", e.prefix, err)
+			}
+			if ok {
+				expires = now.Add(ttl)
+			}
+		}
+		s.notePendingExpiry(e.prefix, expires)
+	}
+	return nil
+}
+
+// notePendingExpiry records that p, listed by a source of the running
+// refresh cycle, expires at expires, zero for never. Listed by several,
+// it expires with the last of them. s.pendingExpiries must be allocated.
+func (s *WedosIPRange) notePendingExpiry(p netip.Prefix, expires time.Time) {
+	prev, seen := s.pendingExpiries[p]
+	switch {
+	case seen && prev.IsZero():
+	case expires.IsZero():
+		s.pendingExpiries[p] = time.Time{}
+	case !seen || expires.After(prev):
+		s.pendingExpiries[p] = expires
+	}
+}
+
+// splitExpiring returns the prefixes of a fetched list that never expire
+// and those with a TTL, so aggregation can't fold an expiring prefix into
+// a stable one.
+func (s *WedosIPRange) splitExpiring(prefixes []netip.Prefix) (stable, expiring []netip.Prefix) {
+	for _, p := range prefixes {
+		if s.pendingExpiries[p].IsZero() {
+			stable = append(stable, p)
+		} else {
+			expiring = append(expiring, p)
+		}
+	}
+	return stable, expiring
+}
+
+// commitEntryTTLs makes the expiries of the refresh cycle that was just
+// applied current and arms the reaper for the earliest.
+func (s *WedosIPRange) commitEntryTTLs() {
+	s.expiries = nil
+	for p, expires := range s.pendingExpiries {
+		if !expires.IsZero() {
+			if s.expiries == nil {
+				s.expiries = make(map[netip.Prefix]time.Time)
+			}
+			s.expiries[p] = expires
+		}
+	}
+	s.pendingExpiries = nil
+	s.armReaper()
+}
+
+// armReaper sets the reaper timer to fire at the earliest expiry, if any.
+func (s *WedosIPRange) armReaper() {
+	var next time.Time
+	for _, expires := range s.expiries {
+		if next.IsZero() || expires.Before(next) {
+			next = expires
+		}
+	}
+	if next.IsZero() {
+		s.reapTimer.Stop()
+		return
+	}
+	s.reapTimer.Reset(max(0, next.Sub(s.now())))
+}
+
+// reapExpired drops the entries whose TTL or shrink_grace elapsed from the
+// applied ranges, without a refetch, and rewrites the cache file and
+// storage so they don't come back on restart. Only called by the refresh
+// goroutine.
+func (s *WedosIPRange) reapExpired() {
+	now := s.now()
+	s.lock.RLock()
+	fetched, refreshed := s.fetched, s.lastRefresh
+	s.lock.RUnlock()
+
+	expired := make(map[netip.Prefix]bool)
+	for p, expires := range s.expiries {
+		if !expires.After(now) {
+			expired[p] = true
+			delete(s.expiries, p)
+		}
+	}
+	var dropped []netip.Prefix
+	kept := slices.DeleteFunc(slices.Clone(fetched), func(p netip.Prefix) bool {
+		if expired[p] {
+			dropped = append(dropped, p)
+			return true
+		}
+		return false
+	})
+	if len(dropped) > 0 {
+		s.setRanges(kept, refreshed)
+		if s.CacheFile != "" {
+			s.saveCache(kept, refreshed)
+		}
+		if s.StorageKey != "" {
+			s.saveStorage(kept, refreshed)
+		}
+		s.logger.Info("expired WEDOS IP prefixes dropped",
+			zap.Int("count", len(dropped)),
+			zap.Stringers("prefixes", dropped))
+	}
+	s.armReaper()
+}
@@ -0,0 +1,91 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestParseEntryTTL(t *testing.T) {
+	for _, tc := range []struct {
+		label string
+		ttl   time.Duration
+		ok    bool
+		err   bool
+	}{
+		{"eu", 0, false, false},
+		{"ttl=3600", time.Hour, true, false},
+		{"ttl=30m", 30 * time.Minute, true, false},
+		{"ttl=0", 0, true, true},
+		{"ttl=soon", 0, true, true},
+	} {
+		ttl, ok, err := parseEntryTTL(tc.label)
+		if ttl != tc.ttl || ok != tc.ok || (err != nil) != tc.err {
+			t.Errorf("%q: got %v %v %v", tc.label, ttl, ok, err)
+		}
+	}
+}
+
+func TestEntryTTLExpires(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("192.0.2.0/25 stable\n192.0.2.128/25 ttl=100ms\n" +
+			"203.0.113.0/24 ttl=100ms\n203.0.113.0/24\n"))
+	}))
+	defer srv.Close()
+
+	s, err := New(Options{Config: WedosIPRange{
+		URL:            srv.URL,
+		Format:         formatLabeled,
+		EntryTTL:       true,
+		Aggregate:      true,
+		RequireOnStart: true,
+		Interval:       caddy.Duration(time.Hour),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	// The expiring half is not aggregated into the stable one.
+	want := parsePrefixes(t, "192.0.2.0/25", "192.0.2.128/25", "203.0.113.0/24")
+	if got := s.GetIPRanges(nil); !slices.Equal(got, want) {
+		t.Errorf("expected %v after the fetch, got %v", want, got)
+	}
+
+	// Once the TTL elapses the entry is dropped without a refetch; the one
+	// also listed without a TTL stays.
+	want = parsePrefixes(t, "192.0.2.0/25", "203.0.113.0/24")
+	waitFor(t, func() bool { return slices.Equal(s.GetIPRanges(nil), want) })
+}
+
+func TestEntryTTLValidation(t *testing.T) {
+	for _, tc := range []struct {
+		config WedosIPRange
+		want   string
+	}{
+		{WedosIPRange{URL: "https://example.com/ips.txt", EntryTTL: true}, "requires format labeled"},
+		{WedosIPRange{URL: "https://example.com/ips.txt", EntryTTL: true, Format: formatLabeled, ParseCacheSize: 2}, "parse_cache_size"},
+	} {
+		_, err := New(Options{Config: tc.config})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("expected an error containing %q, got %v", tc.want, err)
+		}
+	}
+
+	srv := sequenceServer(t, "192.0.2.0/24 ttl=never")
+	s := newTestRange(srv.URL)
+	s.Format = formatLabeled
+	s.EntryTTL = true
+	if err := s.refresh(); err == nil || !strings.Contains(err.Error(), `invalid ttl "never"`) {
+		t.Errorf("expected an invalid ttl error, got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"time"
+)
+
+// Classes of refresh errors, as accepted by the tolerate option.
+const (
+	errClassTimeout    = "timeout"
+	errClassDNS        = "dns"
+	errClassConnection = "connection"
+	errClassStatus     = "status"
+	errClassEmpty      = "empty"
+	errClassOther      = "other"
+	// A refresh some sources of fell back to their last good prefixes,
+	// see partialError.
+	errClassPartial = "partial"
+)
+
+var errClasses = []string{errClassTimeout, errClassDNS, errClassConnection, errClassStatus, errClassEmpty, errClassOther, errClassPartial}
+
+// StatusError is returned when a source answers with a non-2xx status.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected response status %s", e.Status)
+}
+
+// classifyError returns the class of a refresh error. A DNS error wins
+// over a timeout, so a resolver timing out is reported as a DNS problem.
+func classifyError(err error) string {
+	var dnsErr *net.DNSError
+	var statusErr *StatusError
+	var opErr *net.OpError
+	var netErr net.Error
+	var partialErr *partialError
+	switch {
+	case errors.As(err, &partialErr):
+		return errClassPartial
+	case errors.Is(err, errEmptyResponse):
+		return errClassEmpty
+	case errors.As(err, &dnsErr):
+		return errClassDNS
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return errClassTimeout
+	case errors.As(err, &opErr), errors.Is(err, errTruncatedResponse):
+		return errClassConnection
+	case errors.As(err, &statusErr):
+		return errClassStatus
+	default:
+		return errClassOther
+	}
+}
+
+// tolerated reports whether err is of a class listed in Tolerate.
+func (s *WedosIPRange) tolerated(err error) bool {
+	return err != nil && len(s.Tolerate) > 0 && slices.Contains(s.Tolerate, classifyError(err))
+}
+
+// checkTolerateStatus validates TolerateStatus.
+func (s *WedosIPRange) checkTolerateStatus() error {
+	for code, window := range s.TolerateStatus {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("invalid tolerate_status code %d", code)
+		}
+		if window <= 0 {
+			return fmt.Errorf("tolerate_status %d: duration must be positive", code)
+		}
+	}
+	return nil
+}
+
+// transientStatus reports whether err is a status listed in TolerateStatus
+// answered within its window since the last successful refresh, and how
+// long ago that was. Before any success nothing is tolerated.
+func (s *WedosIPRange) transientStatus(err error) (bool, time.Duration) {
+	var statusErr *StatusError
+	if len(s.TolerateStatus) == 0 || !errors.As(err, &statusErr) {
+		return false, 0
+	}
+	window, ok := s.TolerateStatus[statusErr.StatusCode]
+	if !ok {
+		return false, 0
+	}
+	s.lock.RLock()
+	last := s.lastRefresh
+	s.lock.RUnlock()
+	if last.IsZero() {
+		return false, 0
+	}
+	since := s.now().Sub(last)
+	return since <= time.Duration(window), since
+}
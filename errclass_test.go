@@ -0,0 +1,164 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestClassifyError(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer slow.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := "http://" + ln.Addr().String()
+	ln.Close()
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{slow.URL, errClassTimeout},
+		{failing.URL, errClassStatus},
+		{closed, errClassConnection},
+		{"http://wedos.invalid/ips.txt", errClassDNS},
+	}
+	for _, tt := range tests {
+		s := newTestRange(tt.url)
+		s.Timeout = caddy.Duration(50 * time.Millisecond)
+		s.client = s.newClient()
+		err := s.refresh()
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.url)
+			continue
+		}
+		if got := classifyError(err); got != tt.want {
+			t.Errorf("%s: classifyError(%v) = %q, want %q", tt.url, err, got, tt.want)
+		}
+	}
+
+	if got := classifyError(errors.New("token 1 \"x\": invalid")); got != errClassOther {
+		t.Errorf("expected a parse error to be classified as other, got %q", got)
+	}
+	var statusErr *StatusError
+	if err := newTestRange(failing.URL).refresh(); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected a *StatusError with code 503, got %v", err)
+	}
+}
+
+func TestTolerate(t *testing.T) {
+	r := newTestRange("")
+	r.Tolerate = []string{errClassStatus}
+
+	r.recordRefresh(&StatusError{StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway"})
+	if st := r.status(); st.ConsecutiveFailures != 0 || st.LastError != "" {
+		t.Errorf("expected a tolerated error to be ignored, got %+v", st)
+	}
+
+	r.recordRefresh(errors.New("token 1: invalid"))
+	if st := r.status(); st.ConsecutiveFailures != 1 || st.LastError == "" {
+		t.Errorf("expected other errors to count, got %+v", st)
+	}
+}
+
+func TestTolerateStatus(t *testing.T) {
+	r := newTestRange("")
+	r.TolerateStatus = map[int]caddy.Duration{http.StatusNotFound: caddy.Duration(5 * time.Minute)}
+	now := time.Now()
+	r.clock = func() time.Time { return now }
+	notFound := &StatusError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+
+	// Nothing is tolerated before a first success.
+	r.recordRefresh(notFound)
+	if st := r.status(); st.ConsecutiveFailures != 1 {
+		t.Errorf("expected a 404 before any success to count, got %+v", st)
+	}
+	r.recordRefresh(nil)
+
+	r.lastRefresh = now
+	now = now.Add(4 * time.Minute)
+	initMetrics()
+	before := testutil.ToFloat64(wedosMetrics.refreshes.WithLabelValues(resultTolerated))
+	r.recordRefresh(notFound)
+	if st := r.status(); st.ConsecutiveFailures != 0 || st.LastError != "" {
+		t.Errorf("expected a 404 within the window to be tolerated, got %+v", st)
+	}
+	if got := testutil.ToFloat64(wedosMetrics.refreshes.WithLabelValues(resultTolerated)); got != before+1 {
+		t.Errorf("expected the tolerated refresh to be counted as such, got %v", got-before)
+	}
+	r.recordRefresh(&StatusError{StatusCode: http.StatusBadGateway, Status: "502 Bad Gateway"})
+	if st := r.status(); st.ConsecutiveFailures != 1 {
+		t.Errorf("expected other statuses to count, got %+v", st)
+	}
+
+	now = now.Add(2 * time.Minute)
+	r.recordRefresh(notFound)
+	if st := r.status(); st.ConsecutiveFailures != 2 {
+		t.Errorf("expected a 404 past the window to count, got %+v", st)
+	}
+
+	r.TolerateStatus = map[int]caddy.Duration{99: caddy.Duration(time.Minute)}
+	if err := r.checkTolerateStatus(); err == nil {
+		t.Error("expected an invalid code to be rejected")
+	}
+}
+
+func TestDNSFailure(t *testing.T) {
+	s := newTestRange("http://ips.wedos.test/ips.txt")
+	s.resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, errors.New("resolver unavailable")
+		},
+	}
+	s.client = s.newClient()
+	core, logs := observer.New(zap.WarnLevel)
+	s.logger = zap.New(core)
+
+	initMetrics()
+	before := testutil.ToFloat64(wedosMetrics.refreshes.WithLabelValues(resultDNSError))
+
+	err := s.refresh()
+	if err == nil {
+		t.Fatal("expected the refresh to fail")
+	}
+	s.recordRefresh(err)
+
+	if got := classifyError(err); got != errClassDNS {
+		t.Errorf("expected a DNS error, got %q: %v", got, err)
+	}
+	if got := s.status().LastErrorClass; got != errClassDNS {
+		t.Errorf("expected last_error_class %q, got %q", errClassDNS, got)
+	}
+	if got := testutil.ToFloat64(wedosMetrics.refreshes.WithLabelValues(resultDNSError)) - before; got != 1 {
+		t.Errorf("expected 1 refresh counted as dns_error, got %v", got)
+	}
+	if logs.FilterMessageSnippet("DNS resolver").Len() != 1 {
+		t.Errorf("expected a DNS-specific warning, got %v", logs.All())
+	}
+
+	s.recordRefresh(nil)
+	if got := s.status().LastErrorClass; got != "" {
+		t.Errorf("expected last_error_class to be cleared, got %q", got)
+	}
+}
@@ -0,0 +1,74 @@
+package caddy_wedos_ip
+
+import (
+	"net/netip"
+)
+
+// composeRanges layers the configured ranges over a fetched list, in a
+// fixed order of precedence:
+//
+//  1. pinned ranges are added to the fetched ones;
+//  2. excluded ranges are removed from the result, so an exclusion wins
+//     over both the upstream and pinned;
+//  3. a temporary override set through the admin API is applied last, so
+//     it wins over everything configured;
+//  4. the result is masked, sorted and deduplicated.
+func (s *WedosIPRange) composeRanges(fetched []netip.Prefix) []netip.Prefix {
+	return normalizePrefixes(s.withOverride(s.withoutExcluded(s.withPinned(fetched))))
+}
+
+// withoutExcluded returns prefixes with the excluded ranges removed. A
+// prefix inside an excluded range is dropped; one containing an excluded
+// range is split into the parts outside it.
+func (s *WedosIPRange) withoutExcluded(prefixes []netip.Prefix) []netip.Prefix {
+	if len(s.exclude) == 0 {
+		return prefixes
+	}
+	var out []netip.Prefix
+	skipped := 0
+	for _, p := range prefixes {
+		parts := []netip.Prefix{p.Masked()}
+		for _, e := range s.exclude {
+			var next []netip.Prefix
+			for _, part := range parts {
+				next = append(next, subtractPrefix(part, e)...)
+			}
+			parts = next
+		}
+		if len(parts) != 1 || parts[0] != p.Masked() {
+			skipped++
+		}
+		out = append(out, parts...)
+	}
+	recordSkipped(skipExcluded, skipped)
+	return out
+}
+
+// subtractPrefix returns the prefixes covering the addresses of p outside
+// e. Both must be masked.
+func subtractPrefix(p, e netip.Prefix) []netip.Prefix {
+	switch {
+	case !p.Overlaps(e):
+		return []netip.Prefix{p}
+	case e.Bits() <= p.Bits():
+		// e contains p.
+		return nil
+	}
+	// p contains e: keep the half of p without e and recurse into the other.
+	lo, hi := splitPrefix(p)
+	if lo.Contains(e.Addr()) {
+		return append(subtractPrefix(lo, e), hi)
+	}
+	return append([]netip.Prefix{lo}, subtractPrefix(hi, e)...)
+}
+
+// splitPrefix splits p into its two halves. p must be masked and shorter
+// than a single address.
+func splitPrefix(p netip.Prefix) (lo, hi netip.Prefix) {
+	bits := p.Bits() + 1
+	lo = netip.PrefixFrom(p.Addr(), bits)
+	hiAddr := p.Addr().AsSlice()
+	hiAddr[(bits-1)/8] |= 0x80 >> ((bits - 1) % 8)
+	addr, _ := netip.AddrFromSlice(hiAddr)
+	return lo, netip.PrefixFrom(addr, bits)
+}
@@ -0,0 +1,70 @@
+package caddy_wedos_ip
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSubtractPrefix(t *testing.T) {
+	tests := []struct {
+		p, e string
+		want []string
+	}{
+		{"192.0.2.0/24", "198.51.100.0/24", []string{"192.0.2.0/24"}},
+		{"192.0.2.0/24", "192.0.0.0/16", nil},
+		{"192.0.2.0/24", "192.0.2.0/24", nil},
+		{"192.0.2.0/24", "192.0.2.128/25", []string{"192.0.2.0/25"}},
+		{"192.0.2.0/24", "192.0.2.64/26", []string{"192.0.2.0/26", "192.0.2.128/25"}},
+		{"192.0.2.0/30", "192.0.2.1/32", []string{"192.0.2.0/32", "192.0.2.2/31"}},
+		{"2001:db8::/32", "2001:db8:8000::/33", []string{"2001:db8::/33"}},
+		{"2001:db8::/32", "192.0.2.0/24", []string{"2001:db8::/32"}},
+	}
+	for _, tt := range tests {
+		got := subtractPrefix(parsePrefixes(t, tt.p)[0], parsePrefixes(t, tt.e)[0])
+		if want := parsePrefixes(t, tt.want...); !slices.Equal(got, want) {
+			t.Errorf("subtractPrefix(%s, %s) = %v, want %v", tt.p, tt.e, got, want)
+		}
+	}
+}
+
+func TestComposeRangesPrecedence(t *testing.T) {
+	pinned, err := parseCIDRList("pinned", []string{"203.0.113.0/24", "198.51.100.0/24", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exclude, err := parseCIDRList("exclude", []string{"192.0.2.128/25", "198.51.100.0/25", "10.0.0.0/8", "2001:db8:8000::/33"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &WedosIPRange{pinned: pinned, exclude: exclude, lock: new(sync.RWMutex), applyLock: new(sync.Mutex)}
+
+	fetched := parsePrefixes(t,
+		"192.0.2.0/24",   // split around the exclusion
+		"10.1.0.0/16",    // inside an exclusion: dropped
+		"203.0.113.0/24", // also pinned: kept once
+		"203.0.113.0/24", // duplicated upstream: kept once
+		"172.16.0.0/12",  // untouched
+	)
+	got := s.setRanges(fetched, time.Now())
+	want := parsePrefixes(t,
+		"172.16.0.0/12",
+		"192.0.2.0/25",
+		// A pinned range loses to an overlapping exclusion, too.
+		"198.51.100.128/25",
+		"203.0.113.0/24",
+		"2001:db8::/33",
+	)
+	if !slices.Equal(got, want) {
+		t.Errorf("setRanges() = %v, want %v", got, want)
+	}
+	if !slices.Equal(s.GetIPRanges(nil), want) {
+		t.Errorf("GetIPRanges() = %v, want %v", s.GetIPRanges(nil), want)
+	}
+
+	// The fetched list is kept as is, for the cache file.
+	if !slices.Equal(s.fetched, fetched) {
+		t.Errorf("expected the fetched list to be kept unchanged, got %v", s.fetched)
+	}
+}
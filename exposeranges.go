@@ -0,0 +1,65 @@
+package caddy_wedos_ip
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// appliedRanges reflects the ranges a module loaded at runtime, reported
+// by GET /wedos/config for modules with ExposeRanges.
+type appliedRanges struct {
+	URL         string    `json:"url"`
+	LastRefresh time.Time `json:"last_refresh,omitzero"`
+	Hash        string    `json:"hash"`
+	Ranges      []string  `json:"ranges"`
+}
+
+// appliedRanges returns the current ranges of s for handleConfig.
+func (s *WedosIPRange) appliedRanges() appliedRanges {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	res := appliedRanges{
+		URL:         s.source(),
+		LastRefresh: s.lastRefresh,
+		Hash:        contentHash(s.ranges),
+		Ranges:      make([]string, len(s.ranges)),
+	}
+	for i, p := range s.ranges {
+		res.Ranges[i] = p.String()
+	}
+	return res
+}
+
+// handleConfig reports the applied ranges of every module with
+// ExposeRanges, a read-only view of the dynamic state next to the static
+// config under /config/. It never changes the config.
+func (adminWedos) handleConfig(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+
+	instancesLock.Lock()
+	results := []appliedRanges{}
+	for _, s := range instances {
+		if s.ExposeRanges {
+			results = append(results, s.appliedRanges())
+		}
+	}
+	instancesLock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusInternalServerError,
+			Err:        err,
+		}
+	}
+	return nil
+}
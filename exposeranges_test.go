@@ -0,0 +1,44 @@
+package caddy_wedos_ip
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAdminConfig(t *testing.T) {
+	exposed := &WedosIPRange{URL: "https://a.example.com/ips.txt", ExposeRanges: true, lock: new(sync.RWMutex), applyLock: new(sync.Mutex)}
+	exposed.setRanges([]netip.Prefix{netip.MustParsePrefix("192.0.2.0/24"), netip.MustParsePrefix("2001:db8::/32")}, time.Now())
+	hidden := &WedosIPRange{URL: "https://b.example.com/ips.txt", lock: new(sync.RWMutex), applyLock: new(sync.Mutex)}
+	hidden.setRanges([]netip.Prefix{netip.MustParsePrefix("198.51.100.0/24")}, time.Now())
+	registerInstance(exposed)
+	defer unregisterInstance(exposed)
+	registerInstance(hidden)
+	defer unregisterInstance(hidden)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/wedos/config", nil)
+	if err := (adminWedos{}).handleConfig(rec, req); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	var got []appliedRanges
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if len(got) != 1 || got[0].URL != exposed.URL || !slices.Equal(got[0].Ranges, []string{"192.0.2.0/24", "2001:db8::/32"}) {
+		t.Errorf("expected only the exposed module, got %+v", got)
+	}
+	if got[0].Hash != exposed.status().Hash || got[0].LastRefresh.IsZero() {
+		t.Errorf("unexpected hash or refresh time: %+v", got[0])
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/wedos/config", nil)
+	if err := (adminWedos{}).handleConfig(httptest.NewRecorder(), req); err == nil {
+		t.Errorf("expected POST to be rejected")
+	}
+}
@@ -0,0 +1,87 @@
+package caddy_wedos_ip
+
+import (
+	"expvar"
+	"time"
+)
+
+// wedosExpvar is published at /debug/vars as "wedos_ip_ranges" and holds
+// the current prefix count, the time of the last successful refresh, the
+// error of the latest refresh, if it failed, and the content hash of the
+// ranges, as last set by any module. "sources" holds the same for each
+// provisioned module, keyed by its source.
+var (
+	wedosExpvar        = expvar.NewMap("wedos_ip_ranges")
+	wedosExpvarCount   = new(expvar.Int)
+	wedosExpvarUpdate  = new(expvar.String)
+	wedosExpvarError   = new(expvar.String)
+	wedosExpvarHash    = new(expvar.String)
+	wedosExpvarSources = new(expvar.Map)
+)
+
+func init() {
+	wedosExpvar.Set("count", wedosExpvarCount)
+	wedosExpvar.Set("last_refresh", wedosExpvarUpdate)
+	wedosExpvar.Set("last_error", wedosExpvarError)
+	wedosExpvar.Set("hash", wedosExpvarHash)
+	wedosExpvar.Set("sources", wedosExpvarSources)
+}
+
+// moduleVars is the state of one module under "sources", also reported by
+// the wedos_vars placeholders.
+type moduleVars struct {
+	Count       int    `json:"count"`
+	LastRefresh string `json:"last_refresh"`
+	LastError   string `json:"last_error"`
+	Hash        string `json:"hash"`
+}
+
+// vars returns the current state of s.
+func (s *WedosIPRange) vars() moduleVars {
+	s = s.fetcher()
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	v := moduleVars{Count: len(s.ranges), LastError: s.lastError, Hash: s.hash}
+	// Pinned ranges are applied before any refresh.
+	if !s.lastRefresh.IsZero() {
+		v.LastRefresh = s.lastRefresh.UTC().Format(time.RFC3339)
+	}
+	return v
+}
+
+// globalVars returns the process-wide state, as last set by any module.
+func globalVars() moduleVars {
+	return moduleVars{
+		Count:       int(wedosExpvarCount.Value()),
+		LastRefresh: wedosExpvarUpdate.Value(),
+		LastError:   wedosExpvarError.Value(),
+		Hash:        wedosExpvarHash.Value(),
+	}
+}
+
+// publishSourceExpvar publishes the state of s under its source.
+func publishSourceExpvar(s *WedosIPRange) {
+	wedosExpvarSources.Set(s.source(), expvar.Func(func() any { return s.vars() }))
+}
+
+// publishExpvar updates the expvar with the given state.
+func publishExpvar(count int, refreshed time.Time) {
+	wedosExpvarCount.Set(int64(count))
+	// Pinned ranges are applied before any refresh.
+	if refreshed.IsZero() {
+		wedosExpvarUpdate.Set("")
+		return
+	}
+	wedosExpvarUpdate.Set(refreshed.UTC().Format(time.RFC3339))
+}
+
+// publishExpvarHash updates the content hash of the ranges, see
+// contentHash.
+func publishExpvarHash(hash string) {
+	wedosExpvarHash.Set(hash)
+}
+
+// publishExpvarError updates the error of the latest refresh.
+func publishExpvarError(msg string) {
+	wedosExpvarError.Set(msg)
+}
@@ -0,0 +1,110 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// source returns a description of where the ranges come from, for logs,
+// the admin API and publish_file.
+func (s *WedosIPRange) source() string {
+	if s.Source == sourceStdin {
+		return sourceStdin
+	}
+	if s.Source == sourceFile {
+		return s.File
+	}
+	if s.Source == sourceEnv {
+		return "env:" + s.Env
+	}
+	var srcs []string
+	if s.DNSTXT != "" {
+		srcs = append(srcs, "dns:"+s.DNSTXT)
+	}
+	if s.URLv4 == "" && s.URLv6 == "" {
+		if s.URL != "" {
+			srcs = append(srcs, s.URL)
+		}
+	} else {
+		for _, u := range []string{s.URLv4, s.URLv6} {
+			if u != "" {
+				srcs = append(srcs, u)
+			}
+		}
+	}
+	return strings.Join(srcs, " ")
+}
+
+// fetchSources fetches the configured URL, or the family-specific URLs, and
+// the DNSTXT records, and merges them per MergePolicy. Every prefix from
+// URLv4/URLv6 must be of that family.
+func (s *WedosIPRange) fetchSources() ([]netip.Prefix, error) {
+	if s.Source == sourceStdin {
+		return s.readStdinRanges()
+	}
+	if s.Source == sourceFile {
+		return s.readFileRanges()
+	}
+	if s.Source == sourceEnv {
+		return s.readEnvRanges()
+	}
+	if s.pushBody != nil {
+		return s.pushedRanges(s.pushBody)
+	}
+	if s.DNSTXT == "" && s.URLv4 == "" && s.URLv6 == "" {
+		prefixes, etag, err := s.fetchMirrors()
+		s.pendingETag = etag
+		return prefixes, err
+	}
+
+	ps := partialSources{s: s}
+	var txt, all []netip.Prefix
+	if s.DNSTXT != "" {
+		prefixes, err := s.lookupTXTRanges()
+		if err != nil {
+			err = fmt.Errorf("dns_txt %s: %w", s.DNSTXT, err)
+		}
+		if txt, err = ps.done("dns:"+s.DNSTXT, prefixes, err); err != nil {
+			return nil, err
+		}
+	}
+	if s.URL != "" && s.URLv4 == "" && s.URLv6 == "" {
+		prefixes, err := s.fetch(s.URL)
+		if err != nil {
+			err = fmt.Errorf("%s: %w", s.URL, err)
+		}
+		if prefixes, err = ps.done(s.URL, prefixes, err); err != nil {
+			return nil, err
+		}
+		all = append(all, prefixes...)
+	}
+	for _, src := range []struct {
+		url string
+		is6 bool
+	}{{s.URLv4, false}, {s.URLv6, true}} {
+		if src.url == "" {
+			continue
+		}
+		prefixes, err := s.fetch(src.url)
+		if err != nil {
+			err = fmt.Errorf("%s: %w", src.url, err)
+		}
+		for _, p := range prefixes {
+			if err == nil && p.Addr().Is4() == src.is6 {
+				s.pdebug.dropped(p, skipFamily)
+				err = fmt.Errorf("%s: prefix %s does not match the expected address family", src.url, p)
+				break
+			}
+		}
+		if prefixes, err = ps.done(src.url, prefixes, err); err != nil {
+			return nil, err
+		}
+		all = append(all, prefixes...)
+	}
+	if err := ps.err(); err != nil {
+		return nil, err
+	}
+	s.pendingPartial = ps.partial()
+	return s.mergeSources(all, txt), nil
+}
@@ -0,0 +1,47 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestFetchSourcesByFamily(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ips4.txt", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("192.0.2.0/24")) })
+	mux.HandleFunc("/ips6.txt", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("2001:db8::/32")) })
+	mux.HandleFunc("/mixed.txt", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("192.0.2.0/24 2001:db8::/32")) })
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	newRange := func(v4, v6 string) *WedosIPRange {
+		return &WedosIPRange{URLv4: v4, URLv6: v6, client: srv.Client(), ctx: caddy.Context{Context: context.Background()}}
+	}
+
+	got, err := newRange(srv.URL+"/ips4.txt", srv.URL+"/ips6.txt").fetchSources()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := parsePrefixes(t, "192.0.2.0/24", "2001:db8::/32"); !slices.Equal(got, want) {
+		t.Errorf("fetchSources() = %v, want %v", got, want)
+	}
+
+	got, err = newRange("", srv.URL+"/ips6.txt").fetchSources()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := parsePrefixes(t, "2001:db8::/32"); !slices.Equal(got, want) {
+		t.Errorf("fetchSources() with only url_v6 = %v, want %v", got, want)
+	}
+
+	if _, err := newRange(srv.URL+"/mixed.txt", "").fetchSources(); err == nil {
+		t.Errorf("expected an IPv6 prefix from url_v4 to be rejected")
+	}
+	if _, err := newRange("", srv.URL+"/ips4.txt").fetchSources(); err == nil {
+		t.Errorf("expected an IPv4 prefix from url_v6 to be rejected")
+	}
+}
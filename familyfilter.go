@@ -0,0 +1,62 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"net/netip"
+
+	"go.uber.org/zap"
+)
+
+// Values of Family and FamilyMode.
+const (
+	familyIPv4     = "ipv4"
+	familyIPv6     = "ipv6"
+	familyModeSoft = "soft"
+	familyModeHard = "hard"
+)
+
+// provisionFamily checks Family and FamilyMode.
+func (s *WedosIPRange) provisionFamily() error {
+	switch s.Family {
+	case "", familyIPv4, familyIPv6:
+	default:
+		return fmt.Errorf("unknown family %q", s.Family)
+	}
+	switch s.FamilyMode {
+	case "", familyModeSoft, familyModeHard:
+	default:
+		return fmt.Errorf("unknown family mode %q", s.FamilyMode)
+	}
+	if s.FamilyMode != "" && s.Family == "" {
+		return fmt.Errorf("family mode requires family")
+	}
+	return nil
+}
+
+// filterFamily keeps the prefixes of Family. Off-family prefixes are
+// dropped and logged in soft mode, and fail the fetch in hard mode, as
+// they suggest a misconfigured source.
+func (s *WedosIPRange) filterFamily(prefixes []netip.Prefix) ([]netip.Prefix, error) {
+	if s.Family == "" {
+		return prefixes, nil
+	}
+	want4 := s.Family == familyIPv4
+	kept := prefixes[:0]
+	for _, p := range prefixes {
+		if p.Addr().Is4() == want4 {
+			kept = append(kept, p)
+			continue
+		}
+		if s.FamilyMode == familyModeHard {
+			return nil, fmt.Errorf("prefix %s is not %s", p, s.Family)
+		}
+		s.pdebug.dropped(p, skipFamily)
+	}
+	if dropped := len(prefixes) - len(kept); dropped > 0 {
+		s.logger.Warn("dropped prefixes of the other address family",
+			zap.String("family", s.Family),
+			zap.Int("dropped", dropped))
+		recordSkipped(skipFamily, dropped)
+	}
+	return kept, nil
+}
@@ -0,0 +1,58 @@
+package caddy_wedos_ip
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFamilyFilter(t *testing.T) {
+	srv := sequenceServer(t, "192.0.2.0/24 2001:db8::/32 198.51.100.0/24")
+
+	counter := func() float64 {
+		initMetrics()
+		return testutil.ToFloat64(wedosMetrics.entriesSkipped.WithLabelValues(skipFamily))
+	}
+	before := counter()
+
+	s := newTestRange(srv.URL)
+	s.Family = familyIPv4
+	if err := s.refresh(); err != nil {
+		t.Fatalf("soft refresh: %v", err)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24", "198.51.100.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got := counter() - before; got != 1 {
+		t.Errorf("expected 1 entry counted as family, got %v", got)
+	}
+
+	s.FamilyMode = familyModeHard
+	s.Family = familyIPv6
+	if err := s.refresh(); err == nil {
+		t.Error("expected an IPv4 prefix to fail the fetch under family ipv6 hard")
+	}
+	if got := s.GetIPRanges(nil); len(got) != 2 {
+		t.Errorf("expected the previous ranges to be kept, got %v", got)
+	}
+}
+
+func TestProvisionFamily(t *testing.T) {
+	for _, tc := range []struct {
+		family, mode string
+		ok           bool
+	}{
+		{"", "", true},
+		{familyIPv6, "", true},
+		{familyIPv4, familyModeHard, true},
+		{"ipv5", "", false},
+		{familyIPv4, "strict", false},
+		{"", familyModeHard, false},
+	} {
+		s := WedosIPRange{Family: tc.family, FamilyMode: tc.mode}
+		if err := s.provisionFamily(); (err == nil) != tc.ok {
+			t.Errorf("family %q mode %q: unexpected error %v", tc.family, tc.mode, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// errPaused fails a forced refresh while refreshes are paused.
+var errPaused = errors.New("refreshes are paused for maintenance")
+
+// forceCall is a forced refresh waiting for or run by the refresh loop.
+// Its err is set before done is closed.
+type forceCall struct {
+	done chan struct{}
+	err  error
+}
+
+// forceRefresh makes the refresh loop refresh right away and returns the
+// result. A call while another forced refresh is in flight attaches to it
+// and gets the same result instead of starting a new fetch.
+func (s *WedosIPRange) forceRefresh(ctx context.Context) error {
+	// Standard input and environment variables are read once, without a
+	// refresh loop.
+	if s.Source == sourceStdin || s.Source == sourceEnv {
+		return nil
+	}
+	s.forceLock.Lock()
+	c := s.forcing
+	if c == nil {
+		c = &forceCall{done: make(chan struct{})}
+		s.forcing = c
+		// Never blocks: only the in-flight call is ever queued.
+		s.forceRequested <- c
+	}
+	s.forceLock.Unlock()
+
+	select {
+	case <-c.done:
+		return c.err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+// runForced runs the forced refresh c from the refresh loop.
+func (s *WedosIPRange) runForced(c *forceCall) {
+	var err error
+	if s.paused() {
+		err = errPaused
+	} else {
+		s.halfOpenBreaker()
+		err = s.refresh()
+		s.recordRefresh(err)
+	}
+	s.forceLock.Lock()
+	s.forcing = nil
+	s.forceLock.Unlock()
+	c.err = err
+	close(c.done)
+}
+
+// handleRefresh forces a refresh of every provisioned module and waits for
+// it. Concurrent requests share the fetches already in flight.
+func (adminWedos) handleRefresh(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+	if err := authorizeMutation(r); err != nil {
+		return err
+	}
+
+	instancesLock.Lock()
+	targets := append([]*WedosIPRange(nil), instances...)
+	instancesLock.Unlock()
+
+	var failed []string
+	for _, s := range targets {
+		// Skip modules being stopped by a config reload.
+		if s.ctx.Err() != nil {
+			continue
+		}
+		if err := s.forceRefresh(r.Context()); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", s.source(), err))
+		}
+	}
+	if len(failed) > 0 {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadGateway,
+			Err:        fmt.Errorf("refresh failed: %s", strings.Join(failed, "; ")),
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,106 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestForceRefreshCoalesces(t *testing.T) {
+	var hits atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The initial fetch answers right away, forced ones wait.
+		if hits.Add(1) > 1 {
+			<-release
+		}
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+
+	s, err := New(Options{Config: WedosIPRange{URL: srv.URL, RequireOnStart: true, Interval: caddy.Duration(time.Hour)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.forceRefresh(context.Background())
+		}()
+	}
+	waitFor(t, func() bool { return hits.Load() == 2 })
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if n := hits.Load(); n != 2 {
+		t.Errorf("expected the forced refreshes to share one fetch, got %d", n-1)
+	}
+
+	// A later trigger starts a new fetch.
+	if err := s.forceRefresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := hits.Load(); n != 3 {
+		t.Errorf("expected a new fetch after the first completed, got %d fetches", n)
+	}
+}
+
+func TestHandleRefresh(t *testing.T) {
+	var fail atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+
+	s, err := New(Options{Config: WedosIPRange{URL: srv.URL, RequireOnStart: true, Interval: caddy.Duration(time.Hour)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	rec := httptest.NewRecorder()
+	if err := (adminWedos{}).handleRefresh(rec, httptest.NewRequest(http.MethodPost, "/wedos/refresh", nil)); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+
+	fail.Store(true)
+	err = (adminWedos{}).handleRefresh(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/wedos/refresh", nil))
+	if apiErr, ok := err.(caddy.APIError); !ok || apiErr.HTTPStatus != http.StatusBadGateway {
+		t.Errorf("expected a 502 API error, got %v", err)
+	}
+
+	err = (adminWedos{}).handleRefresh(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/wedos/refresh", nil))
+	if err == nil {
+		t.Error("expected GET to be rejected")
+	}
+}
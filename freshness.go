@@ -0,0 +1,53 @@
+package caddy_wedos_ip
+
+import (
+	"net/http"
+	"net/netip"
+	"time"
+)
+
+// GetIPRangesWithFreshness returns the same ranges as GetIPRanges, and
+// whether they are fresh: fetched by a successful refresh (or loaded from
+// the cache file) no longer than MaxAge ago, including the last good
+// prefixes a failed source contributes with PartialFallback. Without
+// MaxAge, ranges are fresh once any refresh has succeeded. Pinned ranges
+// alone are never fresh.
+func (s *WedosIPRange) GetIPRangesWithFreshness(r *http.Request) ([]netip.Prefix, bool) {
+	s = s.selectSet(r)
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.ranges, s.freshAt(s.now())
+}
+
+// freshAt reports whether the ranges are fresh at now. The caller must
+// hold s.lock.
+func (s *WedosIPRange) freshAt(now time.Time) bool {
+	if s.lastRefresh.IsZero() {
+		return false
+	}
+	return s.MaxAge == 0 || ageAt(now, s.freshAsOf()) <= time.Duration(s.MaxAge)
+}
+
+// freshAsOf returns when the ranges were fetched: at the last refresh, or
+// for one serving the last good prefixes of failed sources, when the
+// oldest of those was. The caller must hold s.lock.
+func (s *WedosIPRange) freshAsOf() time.Time {
+	if s.partial != nil && s.partial.Since.Before(s.lastRefresh) {
+		return s.partial.Since
+	}
+	return s.lastRefresh
+}
+
+// freshnessRatio is 1 - min(1, age/MaxAge) for the ranges at now, so it
+// decays from 1 right after a refresh to 0 past MaxAge. Without MaxAge it
+// is 1 once fresh. Ranges never refreshed have 0. The caller must hold
+// s.lock.
+func (s *WedosIPRange) freshnessRatio(now time.Time) float64 {
+	if s.lastRefresh.IsZero() {
+		return 0
+	}
+	if s.MaxAge == 0 {
+		return 1
+	}
+	return 1 - min(1, float64(ageAt(now, s.freshAsOf()))/float64(s.MaxAge))
+}
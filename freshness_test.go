@@ -0,0 +1,116 @@
+package caddy_wedos_ip
+
+import (
+	"errors"
+	"expvar"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestGetIPRangesWithFreshness(t *testing.T) {
+	r := &WedosIPRange{MaxAge: caddy.Duration(time.Hour), lock: new(sync.RWMutex), applyLock: new(sync.Mutex)}
+
+	if _, fresh := r.GetIPRangesWithFreshness(nil); fresh {
+		t.Error("expected ranges never refreshed to be stale")
+	}
+
+	r.setRanges(parsePrefixes(t, "192.0.2.0/24"), time.Now().Add(-time.Minute))
+	ranges, fresh := r.GetIPRangesWithFreshness(nil)
+	if !fresh || len(ranges) != 1 {
+		t.Errorf("expected 1 fresh range, got %v (fresh=%v)", ranges, fresh)
+	}
+
+	r.setRanges(parsePrefixes(t, "192.0.2.0/24"), time.Now().Add(-2*time.Hour))
+	ranges, fresh = r.GetIPRangesWithFreshness(nil)
+	if fresh || len(ranges) != 1 {
+		t.Errorf("expected the range to be kept but stale, got %v (fresh=%v)", ranges, fresh)
+	}
+
+	r.MaxAge = 0
+	if _, fresh := r.GetIPRangesWithFreshness(nil); !fresh {
+		t.Error("expected ranges to stay fresh without max_age")
+	}
+}
+
+func TestFreshnessRatio(t *testing.T) {
+	now := time.Now()
+	r := &WedosIPRange{URL: "https://example.com/ips.txt", MaxAge: caddy.Duration(time.Hour), lock: new(sync.RWMutex), applyLock: new(sync.Mutex), logger: zap.NewNop()}
+	r.clock = func() time.Time { return now }
+
+	r.recordRefresh(errors.New("unreachable"))
+	if got := testutil.ToFloat64(wedosMetrics.freshness.WithLabelValues(r.source())); got != 0 {
+		t.Errorf("expected 0 before any refresh, got %v", got)
+	}
+
+	for _, tc := range []struct {
+		age  time.Duration
+		want float64
+	}{
+		{0, 1},
+		{15 * time.Minute, 0.75},
+		{time.Hour, 0},
+		{3 * time.Hour, 0},
+	} {
+		r.setRanges(parsePrefixes(t, "192.0.2.0/24"), now.Add(-tc.age))
+		// Failed ticks update the gauge too.
+		r.recordRefresh(errors.New("unreachable"))
+		if got := testutil.ToFloat64(wedosMetrics.freshness.WithLabelValues(r.source())); got != tc.want {
+			t.Errorf("age %v: expected ratio %v, got %v", tc.age, tc.want, got)
+		}
+	}
+
+	r.MaxAge = 0
+	r.recordRefresh(nil)
+	if got := testutil.ToFloat64(wedosMetrics.freshness.WithLabelValues(r.source())); got != 1 {
+		t.Errorf("expected 1 without max_age, got %v", got)
+	}
+}
+
+func TestFreshnessPerSource(t *testing.T) {
+	now := time.Now()
+	fresh := newTestRange("https://a.example.com/ips.txt")
+	stale := newTestRange("https://b.example.com/ips.txt")
+	for _, s := range []*WedosIPRange{fresh, stale} {
+		s.MaxAge = caddy.Duration(time.Hour)
+		s.clock = func() time.Time { return now }
+	}
+	fresh.setRanges(parsePrefixes(t, "192.0.2.0/24"), now)
+	stale.setRanges(parsePrefixes(t, "198.51.100.0/24"), now.Add(-2*time.Hour))
+	fresh.recordRefresh(nil)
+	// The module refreshing last doesn't overwrite the other's gauge.
+	stale.recordRefresh(errors.New("unreachable"))
+	if got := testutil.ToFloat64(wedosMetrics.freshness.WithLabelValues(fresh.source())); got != 1 {
+		t.Errorf("expected %s fresh, got %v", fresh.source(), got)
+	}
+	if got := testutil.ToFloat64(wedosMetrics.freshness.WithLabelValues(stale.source())); got != 0 {
+		t.Errorf("expected %s stale, got %v", stale.source(), got)
+	}
+
+	// A reload overlaps two instances of a source; the old one leaving
+	// keeps its expvar and gauge.
+	reloaded := newTestRange(fresh.URL)
+	reloaded.setRanges(parsePrefixes(t, "192.0.2.0/24", "203.0.113.0/24"), now)
+	withInstances(t)
+	registerInstance(fresh)
+	registerInstance(reloaded)
+	unregisterInstance(fresh)
+	v, ok := wedosExpvarSources.Get(fresh.source()).(expvar.Func)
+	if !ok {
+		t.Fatalf("expected an expvar for %s", fresh.source())
+	}
+	if got := v.Value().(moduleVars).Count; got != 2 {
+		t.Errorf("expected the expvar of the newer instance, got count %d", got)
+	}
+	unregisterInstance(reloaded)
+	if wedosExpvarSources.Get(fresh.source()) != nil {
+		t.Error("expected the expvar dropped with the last instance")
+	}
+	if wedosMetrics.freshness.DeleteLabelValues(fresh.source()) {
+		t.Errorf("expected the gauge of %s dropped with the last instance", fresh.source())
+	}
+}
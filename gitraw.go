@@ -0,0 +1,38 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// defaultGitRef is used by git_raw if no ref is given.
+const defaultGitRef = "main"
+
+// gitRefPattern matches branch and tag names and commit hashes.
+var gitRefPattern = regexp.MustCompile(`^[A-Za-z0-9._/-]+$`)
+
+// gitRawURL substitutes ref for {ref} in the raw file URL template and
+// validates the result, e.g.
+// https://raw.githubusercontent.com/org/repo/{ref}/ips.txt.
+func gitRawURL(template, ref string) (string, error) {
+	if !strings.Contains(template, "{ref}") {
+		return "", fmt.Errorf("git_raw: URL %q has no {ref} placeholder", template)
+	}
+	if ref == "" {
+		ref = defaultGitRef
+	}
+	if !gitRefPattern.MatchString(ref) || strings.Contains(ref, "..") {
+		return "", fmt.Errorf("git_raw: invalid ref %q", ref)
+	}
+	raw := strings.ReplaceAll(template, "{ref}", ref)
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("git_raw: %v", err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return "", fmt.Errorf("git_raw: %q is not an absolute http(s) URL", raw)
+	}
+	return raw, nil
+}
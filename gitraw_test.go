@@ -0,0 +1,55 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestGitRawURL(t *testing.T) {
+	tests := []struct {
+		template, ref string
+		want          string
+		ok            bool
+	}{
+		{"https://raw.example.com/org/repo/{ref}/ips.txt", "", "https://raw.example.com/org/repo/main/ips.txt", true},
+		{"https://raw.example.com/org/repo/{ref}/ips.txt", "3f2a9c1d", "https://raw.example.com/org/repo/3f2a9c1d/ips.txt", true},
+		{"https://raw.example.com/org/repo/{ref}/ips.txt", "release/1.0", "https://raw.example.com/org/repo/release/1.0/ips.txt", true},
+		{"https://raw.example.com/org/repo/main/ips.txt", "v1", "", false},
+		{"https://raw.example.com/{ref}/ips.txt", "../../etc", "", false},
+		{"https://raw.example.com/{ref}/ips.txt", "a b", "", false},
+		{"/relative/{ref}/ips.txt", "v1", "", false},
+	}
+	for _, tt := range tests {
+		got, err := gitRawURL(tt.template, tt.ref)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("gitRawURL(%q, %q) = %q, %v", tt.template, tt.ref, got, err)
+		}
+	}
+}
+
+func TestGitRawSource(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/org/repo/raw/3f2a9c1/ips.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{GitRaw: srv.URL + "/org/repo/raw/{ref}/ips.txt", GitRef: "3f2a9c1", RequireOnStart: true}
+	if err := r.Provision(ctx); err != nil {
+		t.Fatalf("provision error: %v", err)
+	}
+	defer r.Cleanup()
+	if len(r.GetIPRanges(nil)) != 1 {
+		t.Errorf("expected the pinned file to be fetched")
+	}
+}
@@ -0,0 +1,103 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Default minimum prefix lengths. Anything broader would trust a large
+// part of the internet and is never a legitimate proxy range.
+const (
+	defaultMinPrefixLenV4 = 8
+	defaultMinPrefixLenV6 = 16
+)
+
+// dropTooBroad drops prefixes shorter than the configured minimum prefix
+// length for their family, such as 0.0.0.0/0 or ::/0.
+func (s *WedosIPRange) dropTooBroad(prefixes []netip.Prefix) []netip.Prefix {
+	kept := prefixes[:0]
+	for _, p := range prefixes {
+		minLen := s.MinPrefixLenV6
+		if p.Addr().Is4() {
+			minLen = s.MinPrefixLenV4
+		}
+		if p.Bits() < minLen {
+			s.logger.Error("dropping overly broad prefix from WEDOS IP list",
+				zap.Stringer("prefix", p),
+				zap.Int("min_prefix_len", minLen))
+			recordSkipped(skipTooBroad, 1)
+			s.pdebug.dropped(p, skipTooBroad)
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
+
+// guardStored runs prefixes read from the cache file or StorageKey through
+// the guards collectPrefixes applies to a fetched list, except those that
+// need its labels (region) or the network (verify_asn). Exclude is applied
+// with them by setRanges.
+func (s *WedosIPRange) guardStored(prefixes []netip.Prefix) ([]netip.Prefix, error) {
+	prefixes, err := s.filterFamily(prefixes)
+	if err != nil {
+		return nil, err
+	}
+	n := len(prefixes)
+	prefixes = s.dropTooBroad(prefixes)
+	if err := s.checkVerified("min_prefix_len", n, len(prefixes)); err != nil {
+		return nil, err
+	}
+	if err := s.checkMinPrefixes(prefixes); err != nil {
+		return nil, err
+	}
+	if err := s.checkRequired(prefixes); err != nil {
+		return nil, err
+	}
+	if err := s.checkMaxMemory(prefixes); err != nil {
+		return nil, err
+	}
+	return prefixes, nil
+}
+
+// checkMinPrefixes rejects a list with fewer than MinPrefixes prefixes,
+// which usually means a truncated download that still parsed.
+func (s *WedosIPRange) checkMinPrefixes(prefixes []netip.Prefix) error {
+	if len(prefixes) >= s.MinPrefixes {
+		return nil
+	}
+	s.logger.Error("WEDOS IP list has fewer prefixes than expected, keeping the previous ranges",
+		zap.Int("count", len(prefixes)),
+		zap.Int("min_prefixes", s.MinPrefixes))
+	return fmt.Errorf("got %d prefixes, expected at least %d", len(prefixes), s.MinPrefixes)
+}
+
+// checkRequired rejects a list missing any of the required prefixes, that
+// is not containing each of them itself or within a broader prefix.
+func (s *WedosIPRange) checkRequired(prefixes []netip.Prefix) error {
+	var missing []string
+	for _, req := range s.required {
+		if !coveredBy(req, prefixes) {
+			missing = append(missing, req.String())
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	s.logger.Error("WEDOS IP list is missing required prefixes, keeping the previous ranges",
+		zap.Strings("missing", missing))
+	return fmt.Errorf("missing required prefixes: %s", strings.Join(missing, ", "))
+}
+
+// coveredBy reports whether p is one of prefixes or within one of them.
+func coveredBy(p netip.Prefix, prefixes []netip.Prefix) bool {
+	for _, q := range prefixes {
+		if q.Bits() <= p.Bits() && q.Contains(p.Addr()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestDropTooBroad(t *testing.T) {
+	s := WedosIPRange{MinPrefixLenV4: defaultMinPrefixLenV4, MinPrefixLenV6: defaultMinPrefixLenV6, logger: zap.NewNop()}
+	in := parsePrefixes(t, "0.0.0.0/0", "10.0.0.0/8", "11.0.0.0/7", "192.0.2.0/24", "::/0", "2000::/3", "2001:db8::/16", "2001:db8::/32")
+
+	got := s.dropTooBroad(in)
+	want := parsePrefixes(t, "10.0.0.0/8", "192.0.2.0/24", "2001:db8::/16", "2001:db8::/32")
+	if !slices.Equal(got, want) {
+		t.Errorf("dropTooBroad() = %v, want %v", got, want)
+	}
+}
+
+func TestMinPrefixesKeepsPreviousRanges(t *testing.T) {
+	body := "192.0.2.0/24 198.51.100.0/24 203.0.113.0/24"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	s := WedosIPRange{
+		URL:            srv.URL,
+		MinPrefixes:    3,
+		MinPrefixLenV4: defaultMinPrefixLenV4,
+		MinPrefixLenV6: defaultMinPrefixLenV6,
+		ctx:            caddy.Context{Context: context.Background()},
+		lock:           new(sync.RWMutex),
+		applyLock:      new(sync.Mutex),
+		subsLock:       new(sync.Mutex),
+		logger:         zap.NewNop(),
+	}
+	s.client = s.newClient()
+
+	if err := s.refresh(); err != nil {
+		t.Fatalf("refresh error: %v", err)
+	}
+
+	// A truncated list that still parses is not applied.
+	body = "192.0.2.0/24"
+	if err := s.refresh(); err == nil {
+		t.Errorf("expected an error for a list below min_prefixes")
+	}
+	if got := len(s.GetIPRanges(nil)); got != 3 {
+		t.Errorf("expected the previous 3 ranges to be kept, got %d", got)
+	}
+}
+
+func TestRequiredKeepsPreviousRanges(t *testing.T) {
+	s := newTestRange(sequenceServer(t,
+		"192.0.2.0/24 198.51.100.0/24",
+		"192.0.0.0/16 203.0.113.0/24",
+		"198.51.100.0/24 203.0.113.0/24",
+	).URL)
+	required, err := parseCIDRList("required", []string{"192.0.2.0/25"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.required = required
+	core, logs := observer.New(zap.ErrorLevel)
+	s.logger = zap.New(core)
+
+	if err := s.refresh(); err != nil {
+		t.Fatalf("refresh error: %v", err)
+	}
+	// A broader prefix covers the required one.
+	if err := s.refresh(); err != nil {
+		t.Fatalf("refresh error: %v", err)
+	}
+
+	err = s.refresh()
+	if err == nil || !strings.Contains(err.Error(), "192.0.2.0/25") {
+		t.Errorf("expected the missing prefix to be reported, got %v", err)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.0.0/16", "203.0.113.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected the previous ranges to be kept, got %v", got)
+	}
+	if logs.FilterMessageSnippet("missing required").Len() != 1 {
+		t.Errorf("expected the missing prefixes to be logged at error level")
+	}
+}
@@ -0,0 +1,49 @@
+package caddy_wedos_ip
+
+import (
+	"bytes"
+	"context"
+	"net/netip"
+	"os/exec"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultOnUpdateTimeout bounds on_update_command if not configured.
+	defaultOnUpdateTimeout = 30 * time.Second
+	// maxHookOutput bounds how much command output is logged.
+	maxHookOutput = 4096
+)
+
+// runUpdateCommand runs OnUpdateCommand with the ranges on stdin, one CIDR
+// per line. Errors are logged and never affect the refresh.
+func (s *WedosIPRange) runUpdateCommand(prefixes []netip.Prefix) {
+	timeout := time.Duration(s.OnUpdateTimeout)
+	if timeout <= 0 {
+		timeout = defaultOnUpdateTimeout
+	}
+	ctx, cancel := context.WithTimeout(s.ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.OnUpdateCommand[0], s.OnUpdateCommand[1:]...)
+	cmd.Stdin = bytes.NewReader(formatPrefixList(prefixes))
+	// Don't wait forever on output pipes held open by leftover children.
+	cmd.WaitDelay = time.Second
+	out, err := cmd.CombinedOutput()
+	if len(out) > maxHookOutput {
+		out = out[:maxHookOutput]
+	}
+
+	if err != nil {
+		s.logger.Warn("on_update_command failed",
+			zap.Strings("command", s.OnUpdateCommand),
+			zap.ByteString("output", out),
+			zap.Error(err))
+		return
+	}
+	s.logger.Info("on_update_command finished",
+		zap.Strings("command", s.OnUpdateCommand),
+		zap.ByteString("output", out))
+}
@@ -0,0 +1,48 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRunUpdateCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	out := filepath.Join(t.TempDir(), "ranges.txt")
+	core, logs := observer.New(zap.InfoLevel)
+	s := WedosIPRange{
+		OnUpdateCommand: []string{"sh", "-c", `cat > "$0"; echo done`, out},
+		ctx:             caddy.Context{Context: context.Background()},
+		logger:          zap.New(core),
+	}
+
+	s.runUpdateCommand(parsePrefixes(t, "198.51.100.0/24", "192.0.2.0/24"))
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("reading command output: %v", err)
+	}
+	if want := "192.0.2.0/24\n198.51.100.0/24\n"; string(got) != want {
+		t.Errorf("command stdin = %q, want %q", got, want)
+	}
+	if logs.FilterMessage("on_update_command finished").Len() != 1 {
+		t.Errorf("expected a success log, got %v", logs.All())
+	}
+
+	s.OnUpdateCommand = []string{"sh", "-c", "exec sleep 5"}
+	s.OnUpdateTimeout = caddy.Duration(50 * time.Millisecond)
+	s.runUpdateCommand(nil)
+	if logs.FilterMessage("on_update_command failed").Len() != 1 {
+		t.Errorf("expected a failure log for a timed out command, got %v", logs.All())
+	}
+}
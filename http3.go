@@ -0,0 +1,106 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"go.uber.org/zap"
+)
+
+// h3Fallback sends https requests over HTTP/3 and retries them over the
+// TCP transport, which negotiates HTTP/2, when HTTP/3 fails.
+type h3Fallback struct {
+	h3     http.RoundTripper
+	tcp    http.RoundTripper
+	logger *zap.Logger
+}
+
+func (f *h3Fallback) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A body that can't be replayed must not be spent on a failed attempt.
+	if req.URL.Scheme != "https" || req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return f.tcp.RoundTrip(req)
+	}
+	resp, err := f.h3.RoundTrip(req)
+	if err == nil || req.Context().Err() != nil {
+		return resp, err
+	}
+	f.logger.Debug("HTTP/3 fetch failed, falling back to TCP",
+		zap.String("url", req.URL.Redacted()),
+		zap.Error(err))
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	return f.tcp.RoundTrip(retry)
+}
+
+// newH3Transport returns the HTTP/3 transport for HTTP3, kept in s.h3 so
+// Cleanup can close its UDP socket.
+func (s *WedosIPRange) newH3Transport() *http3.Transport {
+	s.h3 = &http3.Transport{
+		TLSClientConfig: s.tlsConfig(),
+		QUICConfig:      &quic.Config{HandshakeIdleTimeout: time.Duration(s.ConnectTimeout)},
+	}
+	if s.resolver != nil {
+		s.h3.Dial = s.dialQUIC
+	}
+	return s.h3
+}
+
+// dialQUIC dials addr resolving its host with s.resolver, like the TCP
+// transport does, instead of the default resolver http3.Transport uses.
+// Each connection gets its own UDP socket, closed with it.
+func (s *WedosIPRange) dialQUIC(ctx context.Context, addr string, tlsConf *tls.Config, conf *quic.Config) (*quic.Conn, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", portStr)
+	}
+	ips, err := s.resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	// Each address in turn, reporting the first error, as net.Dialer does.
+	var first error
+	for _, ip := range ips {
+		conn, err := quic.DialAddrEarly(ctx, netip.AddrPortFrom(ip.Unmap(), uint16(port)).String(), tlsConf, conf)
+		if err == nil {
+			return conn, nil
+		}
+		if first == nil {
+			first = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if first == nil {
+		first = fmt.Errorf("no addresses for %s", host)
+	}
+	return nil, first
+}
+
+// checkHTTP3 rejects options HTTP/3 fetches can't honor.
+func (s *WedosIPRange) checkHTTP3() error {
+	if !s.HTTP3 {
+		return nil
+	}
+	if s.Proxy != "" || s.UnixSocket != "" {
+		return fmt.Errorf("http3 cannot be combined with proxy or unix_socket")
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"go.uber.org/zap"
+)
+
+func TestHTTP3(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.Proto, r.URL.Path)
+	})
+	// The TLS server provides a certificate, and the TCP endpoint to fall
+	// back to.
+	srv := httptest.NewTLSServer(handler)
+	defer srv.Close()
+	tcp := srv.Client().Transport.(*http.Transport)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h3srv := &http3.Server{Handler: handler, TLSConfig: http3.ConfigureTLSConfig(srv.TLS.Clone())}
+	go h3srv.Serve(conn)
+	defer h3srv.Close()
+
+	h3 := &http3.Transport{
+		TLSClientConfig: tcp.TLSClientConfig.Clone(),
+		QUICConfig:      &quic.Config{HandshakeIdleTimeout: 500 * time.Millisecond},
+	}
+	defer h3.Close()
+	client := &http.Client{Transport: &h3Fallback{h3: h3, tcp: tcp, logger: zap.NewNop()}}
+
+	get := func(url string) string {
+		t.Helper()
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	if got := get("https://" + conn.LocalAddr().String() + "/ips.txt"); got != "HTTP/3.0 /ips.txt" {
+		t.Errorf("expected an HTTP/3 fetch, got %q", got)
+	}
+	// Nothing listens on UDP at the TLS server's port: TCP is used instead.
+	if got := get(srv.URL + "/ips.txt"); !strings.HasPrefix(got, "HTTP/1.1") && !strings.HasPrefix(got, "HTTP/2") {
+		t.Errorf("expected a fallback over TCP, got %q", got)
+	}
+}
+
+func TestCheckHTTP3(t *testing.T) {
+	for _, s := range []WedosIPRange{
+		{HTTP3: true, Proxy: "http://proxy.example:3128"},
+		{HTTP3: true, UnixSocket: "/run/ips.sock"},
+	} {
+		if err := s.checkHTTP3(); err == nil {
+			t.Errorf("expected %+v to be rejected", s)
+		}
+	}
+}
+
+func TestHTTP3Resolver(t *testing.T) {
+	s := newTestRange("https://ips.wedos.test/ips.txt")
+	s.HTTP3 = true
+	s.resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, errors.New("resolver unavailable")
+		},
+	}
+	h3 := s.newH3Transport()
+	defer h3.Close()
+	if h3.Dial == nil {
+		t.Fatal("expected a dial function using the resolver")
+	}
+	if _, err := h3.Dial(context.Background(), "ips.wedos.test:443", &tls.Config{}, &quic.Config{}); err == nil || !strings.Contains(err.Error(), "resolver unavailable") {
+		t.Errorf("expected the dial to use the configured resolver, got %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// checkHTTPS rejects every configured URL that is not https, for
+// RequireHTTPS. A DNS TXT source is rejected too, as it is not fetched
+// over TLS.
+func (s *WedosIPRange) checkHTTPS() error {
+	if s.DNSTXT != "" {
+		return fmt.Errorf("require_https: dns_txt is not fetched over TLS")
+	}
+	for _, opt := range s.urlOptions() {
+		if *opt.raw == "" {
+			continue
+		}
+		u, err := url.Parse(*opt.raw)
+		if err != nil {
+			return fmt.Errorf("%s: %v", opt.name, err)
+		}
+		if u.Scheme != "https" {
+			return fmt.Errorf("require_https: %s %q is not https", opt.name, *opt.raw)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestRequireHTTPS(t *testing.T) {
+	tests := []struct {
+		r       WedosIPRange
+		wantErr string
+	}{
+		{r: WedosIPRange{}},
+		{r: WedosIPRange{URL: "https://example.com/ips.txt", Mirrors: []string{"https://mirror.example.com/ips.txt"}}},
+		{r: WedosIPRange{URL: "http://example.com/ips.txt"}, wantErr: `url "http://example.com/ips.txt"`},
+		{r: WedosIPRange{URLv4: "https://example.com/v4", URLv6: "http://example.com/v6"}, wantErr: "url_v6"},
+		{r: WedosIPRange{URL: "https://example.com/ips.txt", Mirrors: []string{"http://mirror.internal/ips.txt"}}, wantErr: "mirror"},
+		{r: WedosIPRange{URL: "https://example.com/ips.txt", SignatureURL: "http://example.com/ips.txt.sig"}, wantErr: "signature_url"},
+		{r: WedosIPRange{DNSTXT: "ips.example.com"}, wantErr: "dns_txt"},
+	}
+
+	for _, tt := range tests {
+		tt.r.RequireHTTPS = true
+		err := tt.r.checkHTTPS()
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%+v: unexpected error: %v", tt.r, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%+v: expected an error containing %q, got %v", tt.r, tt.wantErr, err)
+		}
+	}
+}
+
+func TestProvisionRequireHTTPS(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{URL: "http://example.com/ips.txt", RequireHTTPS: true}
+	if err := r.Provision(ctx); err == nil {
+		t.Error("expected a plain http url to be rejected")
+	}
+}
@@ -0,0 +1,101 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+
+	"golang.org/x/net/idna"
+)
+
+// hostProfile validates and maps hosts like idna.Lookup, but allows the
+// underscores found in internal service names, as Go's resolver does.
+var hostProfile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.StrictDomainName(false),
+	idna.VerifyDNSLength(true),
+)
+
+// normalizeURL validates the host of raw and converts an internationalized
+// domain name to its ASCII (punycode) form, so a malformed host fails at
+// provisioning instead of at the first fetch. IP literals are left as is.
+func normalizeURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	host := u.Hostname()
+	if host == "" {
+		return "", fmt.Errorf("%q has no host", raw)
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		return raw, nil
+	}
+	ascii, err := hostProfile.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("invalid host %q: %v", host, err)
+	}
+	if ascii == host {
+		return raw, nil
+	}
+	if port := u.Port(); port != "" {
+		u.Host = net.JoinHostPort(ascii, port)
+	} else {
+		u.Host = ascii
+	}
+	return u.String(), nil
+}
+
+// urlOption is a configured URL and the name of its option, for errors.
+type urlOption struct {
+	name string
+	raw  *string
+}
+
+// urlOptions returns every URL configured for fetching or pushing.
+func (s *WedosIPRange) urlOptions() []urlOption {
+	opts := []urlOption{
+		{"url", &s.URL},
+		{"url_v4", &s.URLv4},
+		{"url_v6", &s.URLv6},
+		{"signature_url", &s.SignatureURL},
+		{"sse_url", &s.SSEURL},
+	}
+	for i := range s.Mirrors {
+		opts = append(opts, urlOption{"mirror", &s.Mirrors[i]})
+	}
+	return opts
+}
+
+// normalizeURLs applies normalizeURL to every configured URL, and to the
+// keys of SourceFormats so they still match the URLs they refer to.
+func (s *WedosIPRange) normalizeURLs() error {
+	for _, opt := range s.urlOptions() {
+		if *opt.raw == "" {
+			continue
+		}
+		normalized, err := normalizeURL(*opt.raw)
+		if err != nil {
+			return fmt.Errorf("%s: %v", opt.name, err)
+		}
+		*opt.raw = normalized
+	}
+	if len(s.SourceFormats) == 0 {
+		return nil
+	}
+	formats := make(map[string]string, len(s.SourceFormats))
+	for raw, format := range s.SourceFormats {
+		normalized, err := normalizeURL(raw)
+		if err != nil {
+			return fmt.Errorf("source_formats: %v", err)
+		}
+		if other, ok := formats[normalized]; ok && other != format {
+			return fmt.Errorf("source_formats: conflicting formats %q and %q for %s", other, format, normalized)
+		}
+		formats[normalized] = format
+	}
+	s.SourceFormats = formats
+	return nil
+}
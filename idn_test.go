@@ -0,0 +1,52 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	for raw, want := range map[string]string{
+		"https://ipv4.wedos.com/ips.txt":    "https://ipv4.wedos.com/ips.txt",
+		"https://Příklad.cz/ips.txt":        "https://xn--pklad-zsa96e.cz/ips.txt",
+		"https://příklad.cz:8443/ips.txt":   "https://xn--pklad-zsa96e.cz:8443/ips.txt",
+		"http://ip_source.internal/ips":     "http://ip_source.internal/ips",
+		"http://127.0.0.1:8080/ips.txt":     "http://127.0.0.1:8080/ips.txt",
+		"http://[2001:db8::1]:8080/ips.txt": "http://[2001:db8::1]:8080/ips.txt",
+	} {
+		got, err := normalizeURL(raw)
+		if err != nil {
+			t.Errorf("normalizeURL(%q) error: %v", raw, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("normalizeURL(%q) = %q, want %q", raw, got, want)
+		}
+	}
+
+	for _, raw := range []string{
+		"https://-wedos.com/ips.txt",
+		"https://ipv4..wedos.com/ips.txt",
+		"https://xn--a.com/ips.txt",
+		"/ips.txt",
+		"https://exa mple.com/",
+	} {
+		if _, err := normalizeURL(raw); err == nil {
+			t.Errorf("normalizeURL(%q): expected error", raw)
+		}
+	}
+}
+
+func TestProvisionInvalidHost(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{Mirrors: []string{"https://mirror..example.com/ips.txt"}}
+	err := r.Provision(ctx)
+	if err == nil || !strings.Contains(err.Error(), `invalid host "mirror..example.com"`) {
+		t.Errorf("expected an invalid host error, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// mockWedos serves an ips.txt whose body and status can be changed while
+// the test runs.
+type mockWedos struct {
+	mu     sync.Mutex
+	body   string
+	status int
+}
+
+func (m *mockWedos) set(status int, body string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status, m.body = status, body
+}
+
+func (m *mockWedos) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r.URL.Path != "/ips.txt" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(m.status)
+	w.Write([]byte(m.body))
+}
+
+func TestIntegration(t *testing.T) {
+	mock := &mockWedos{status: http.StatusOK, body: "192.0.2.0/24 198.51.100.0/24\n2001:db8::/32\n"}
+	srv := httptest.NewServer(mock)
+	defer srv.Close()
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := &WedosIPRange{
+		URL:            srv.URL + "/ips.txt",
+		Interval:       caddy.Duration(time.Hour),
+		RequireOnStart: true,
+	}
+	if err := r.Provision(ctx); err != nil {
+		t.Fatalf("provision error: %v", err)
+	}
+	defer r.Cleanup()
+
+	// refresh runs one cycle of the refresh loop.
+	refresh := func() error {
+		err := r.refresh()
+		r.recordRefresh(err)
+		return err
+	}
+
+	want := parsePrefixes(t, "192.0.2.0/24", "198.51.100.0/24", "2001:db8::/32")
+	if got := r.GetIPRanges(nil); !slices.Equal(got, want) {
+		t.Fatalf("after the initial fetch: got %v, want %v", got, want)
+	}
+
+	// A changed list is picked up on the next refresh.
+	mock.set(http.StatusOK, "203.0.113.0/24\n2001:db8::/32\n")
+	if err := refresh(); err != nil {
+		t.Fatalf("refresh error: %v", err)
+	}
+	want = parsePrefixes(t, "203.0.113.0/24", "2001:db8::/32")
+	if got := r.GetIPRanges(nil); !slices.Equal(got, want) {
+		t.Fatalf("after a change: got %v, want %v", got, want)
+	}
+
+	// A server error keeps the ranges of the last successful refresh.
+	mock.set(http.StatusInternalServerError, "oops")
+	if err := refresh(); err == nil {
+		t.Fatal("expected the refresh to fail")
+	}
+	if got := r.GetIPRanges(nil); !slices.Equal(got, want) {
+		t.Errorf("after a server error: got %v, want %v", got, want)
+	}
+	st := r.status()
+	if st.ConsecutiveFailures != 1 || st.LastError == "" {
+		t.Errorf("expected the failure to be reported, got %+v", st)
+	}
+
+	// So does a body that does not parse.
+	mock.set(http.StatusOK, "not-a-prefix\n")
+	if err := refresh(); err == nil {
+		t.Fatal("expected the refresh to fail")
+	}
+	if got := r.GetIPRanges(nil); !slices.Equal(got, want) {
+		t.Errorf("after an invalid body: got %v, want %v", got, want)
+	}
+}
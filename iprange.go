@@ -0,0 +1,93 @@
+package caddy_wedos_ip
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// formatRange is whitespace-separated CIDRs, bare addresses or inclusive
+// start-end address ranges such as "192.0.2.0-192.0.2.255".
+const formatRange = "range"
+
+// parseRangeList parses a list of format range. Each start-end pair is
+// converted into the minimal set of prefixes covering exactly the range.
+func parseRangeList(r io.Reader) ([]netip.Prefix, error) {
+	scanner := newScanner(r)
+	scanner.Split(bufio.ScanWords)
+
+	var prefixes []netip.Prefix
+	for n := 1; scanner.Scan(); n++ {
+		tok := scanner.Text()
+		from, to, ok := strings.Cut(tok, "-")
+		if !ok {
+			prefix, err := caddyhttp.CIDRExpressionToPrefix(stripZone(tok))
+			if err != nil {
+				return nil, fmt.Errorf("token %d %q: %w", n, tok, err)
+			}
+			prefixes = append(prefixes, prefix)
+			continue
+		}
+		start, err := netip.ParseAddr(stripZone(from))
+		if err != nil {
+			return nil, fmt.Errorf("token %d %q: %w", n, tok, err)
+		}
+		end, err := netip.ParseAddr(stripZone(to))
+		if err != nil {
+			return nil, fmt.Errorf("token %d %q: %w", n, tok, err)
+		}
+		covering, err := rangeToPrefixes(start, end)
+		if err != nil {
+			return nil, fmt.Errorf("token %d %q: %w", n, tok, err)
+		}
+		prefixes = append(prefixes, covering...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, scanErr(err)
+	}
+	return prefixes, nil
+}
+
+// rangeToPrefixes returns the fewest prefixes covering exactly the
+// addresses from start to end, inclusive, in address order. Each step
+// takes the largest prefix that starts at start and ends no later than end.
+func rangeToPrefixes(start, end netip.Addr) ([]netip.Prefix, error) {
+	start, end = start.Unmap(), end.Unmap()
+	if start.Is4() != end.Is4() {
+		return nil, fmt.Errorf("range %s-%s mixes address families", start, end)
+	}
+	if end.Less(start) {
+		return nil, fmt.Errorf("range %s-%s ends before it starts", start, end)
+	}
+	var prefixes []netip.Prefix
+	for {
+		bits := 0
+		for ; bits < start.BitLen(); bits++ {
+			p := netip.PrefixFrom(start, bits)
+			if p.Masked().Addr() == start && !end.Less(lastAddr(p)) {
+				break
+			}
+		}
+		p := netip.PrefixFrom(start, bits)
+		prefixes = append(prefixes, p)
+		last := lastAddr(p)
+		if last == end {
+			return prefixes, nil
+		}
+		start = last.Next()
+	}
+}
+
+// lastAddr returns the highest address of p, which must be masked.
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
@@ -0,0 +1,71 @@
+package caddy_wedos_ip
+
+import (
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRangeToPrefixes(t *testing.T) {
+	for _, tc := range []struct {
+		start, end string
+		want       []string
+	}{
+		{"192.0.2.0", "192.0.2.255", []string{"192.0.2.0/24"}},
+		{"192.0.2.7", "192.0.2.7", []string{"192.0.2.7/32"}},
+		{"192.0.2.1", "192.0.2.6", []string{"192.0.2.1/32", "192.0.2.2/31", "192.0.2.4/31", "192.0.2.6/32"}},
+		{"192.0.2.255", "192.0.3.0", []string{"192.0.2.255/32", "192.0.3.0/32"}},
+		{"10.0.0.0", "10.0.1.127", []string{"10.0.0.0/24", "10.0.1.0/25"}},
+		{"0.0.0.0", "255.255.255.255", []string{"0.0.0.0/0"}},
+		{"255.255.255.254", "255.255.255.255", []string{"255.255.255.254/31"}},
+		{"0.0.0.1", "255.255.255.254", nil},
+		{"2001:db8::", "2001:db8::ffff", []string{"2001:db8::/112"}},
+		{"2001:db8::1", "2001:db8::2", []string{"2001:db8::1/128", "2001:db8::2/128"}},
+		{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", []string{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff/128"}},
+		{"::ffff:192.0.2.0", "::ffff:192.0.2.127", []string{"192.0.2.0/25"}},
+	} {
+		got, err := rangeToPrefixes(netip.MustParseAddr(tc.start), netip.MustParseAddr(tc.end))
+		if err != nil {
+			t.Errorf("%s-%s: %v", tc.start, tc.end, err)
+			continue
+		}
+		if tc.want == nil {
+			// 0.0.0.1-255.255.255.254 needs one prefix per bit on each side.
+			if len(got) != 62 || got[0] != netip.MustParsePrefix("0.0.0.1/32") || got[61] != netip.MustParsePrefix("255.255.255.254/32") {
+				t.Errorf("%s-%s: unexpected %d prefixes %v", tc.start, tc.end, len(got), got)
+			}
+			continue
+		}
+		if want := parsePrefixes(t, tc.want...); !slices.Equal(got, want) {
+			t.Errorf("%s-%s: got %v, want %v", tc.start, tc.end, got, want)
+		}
+	}
+}
+
+func TestRangeToPrefixesInvalid(t *testing.T) {
+	for _, tc := range [][2]string{
+		{"192.0.2.10", "192.0.2.9"},
+		{"192.0.2.0", "2001:db8::"},
+	} {
+		if _, err := rangeToPrefixes(netip.MustParseAddr(tc[0]), netip.MustParseAddr(tc[1])); err == nil {
+			t.Errorf("%s-%s: expected an error", tc[0], tc[1])
+		}
+	}
+}
+
+func TestParseRangeList(t *testing.T) {
+	got, err := parseFormat(formatRange, strings.NewReader("198.51.100.0/24\n192.0.2.0-192.0.2.2 203.0.113.9\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := parsePrefixes(t, "198.51.100.0/24", "192.0.2.0/31", "192.0.2.2/32", "203.0.113.9/32")
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	_, err = parseRangeList(strings.NewReader("192.0.2.0/24 192.0.2.9-nope"))
+	if err == nil || !strings.Contains(err.Error(), `token 2 "192.0.2.9-nope"`) {
+		t.Errorf("expected an error naming token 2, got %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package caddy_wedos_ip
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// jsonStep is one step of a compiled JSONPath: a field of an object, an
+// index into an array, or every element of an array.
+type jsonStep struct {
+	field string
+	index int
+	each  bool
+}
+
+// Fields holding the CIDR of an object reached by JSONPath, tried in order.
+// They cover common provider schemas, e.g. AWS's ip_prefix and GCP's
+// ipv4Prefix.
+var cidrFields = []string{"cidr", "prefix", "ip_prefix", "ipv6_prefix", "ipv4Prefix", "ipv6Prefix", "network", "subnet"}
+
+// compileJSONPath parses a dotted path with bracket indexes, where "[]"
+// selects every element of an array, e.g. "data.prefixes[].cidr" or
+// "[0].ranges".
+func compileJSONPath(expr string) ([]jsonStep, error) {
+	if expr == "" {
+		return nil, fmt.Errorf("empty path")
+	}
+	var steps []jsonStep
+	for i, part := range strings.Split(expr, ".") {
+		field, rest, bracket := strings.Cut(part, "[")
+		if field == "" && (i > 0 || !bracket) {
+			return nil, fmt.Errorf("empty field in %q", expr)
+		}
+		if field != "" {
+			steps = append(steps, jsonStep{field: field})
+		}
+		for bracket {
+			idx, after, ok := strings.Cut(rest, "]")
+			if !ok || after != "" && after[0] != '[' {
+				return nil, fmt.Errorf("malformed brackets in %q", part)
+			}
+			if idx == "" {
+				steps = append(steps, jsonStep{each: true})
+			} else if n, err := strconv.Atoi(idx); err == nil && n >= 0 {
+				steps = append(steps, jsonStep{index: n})
+			} else {
+				return nil, fmt.Errorf("invalid index %q in %q", idx, part)
+			}
+			bracket = after != ""
+			if bracket {
+				rest = after[1:]
+			}
+		}
+	}
+	return steps, nil
+}
+
+// parseJSONPath parses a JSON document whose CIDRs are found at path:
+// strings, arrays of strings, or objects holding one of cidrFields.
+func parseJSONPath(path []jsonStep, r io.Reader) ([]netip.Prefix, error) {
+	var doc any
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decoding JSON: %w", err)
+	}
+
+	vals := []any{doc}
+	for _, step := range path {
+		var next []any
+		for _, v := range vals {
+			switch {
+			case step.field != "":
+				obj, ok := v.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("json_path: expected an object for %q, got %T", step.field, v)
+				}
+				if f, ok := obj[step.field]; ok {
+					next = append(next, f)
+				}
+			default:
+				list, ok := v.([]any)
+				if !ok {
+					return nil, fmt.Errorf("json_path: expected an array, got %T", v)
+				}
+				if step.each {
+					next = append(next, list...)
+				} else if step.index < len(list) {
+					next = append(next, list[step.index])
+				}
+			}
+		}
+		vals = next
+	}
+
+	var prefixes []netip.Prefix
+	n := 0
+	var add func(v any) error
+	add = func(v any) error {
+		switch v := v.(type) {
+		case string:
+			n++
+			prefix, err := caddyhttp.CIDRExpressionToPrefix(stripZone(strings.TrimSpace(v)))
+			if err != nil {
+				return fmt.Errorf("entry %d %q: %w", n, v, err)
+			}
+			prefixes = append(prefixes, prefix)
+		case []any:
+			for _, item := range v {
+				if err := add(item); err != nil {
+					return err
+				}
+			}
+		case map[string]any:
+			for _, field := range cidrFields {
+				if f, ok := v[field]; ok {
+					return add(f)
+				}
+			}
+			return fmt.Errorf("entry %d: object has none of the fields %s", n+1, strings.Join(cidrFields, ", "))
+		default:
+			return fmt.Errorf("entry %d: expected a string, got %T", n+1, v)
+		}
+		return nil
+	}
+	for _, v := range vals {
+		if err := add(v); err != nil {
+			return nil, err
+		}
+	}
+	return prefixes, nil
+}
+
+// provisionJSONPath compiles JSONPath.
+func (s *WedosIPRange) provisionJSONPath() error {
+	if s.JSONPath == "" {
+		return nil
+	}
+	switch s.Format {
+	case "", formatAuto, formatJSON:
+	default:
+		return fmt.Errorf("json_path requires format json or auto, got %q", s.Format)
+	}
+	path, err := compileJSONPath(s.JSONPath)
+	if err != nil {
+		return fmt.Errorf("invalid json_path %q: %v", s.JSONPath, err)
+	}
+	s.jsonPath = path
+	return nil
+}
@@ -0,0 +1,80 @@
+package caddy_wedos_ip
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCompileJSONPath(t *testing.T) {
+	for _, expr := range []string{"data.prefixes[].cidr", "[]", "[0].ranges", "a[1][]"} {
+		if _, err := compileJSONPath(expr); err != nil {
+			t.Errorf("compileJSONPath(%q): %v", expr, err)
+		}
+	}
+	for _, expr := range []string{"", "a..b", ".a", "a.", "a[", "a[x]", "a[-1]", "a[]b", "a.[]"} {
+		if _, err := compileJSONPath(expr); err == nil {
+			t.Errorf("compileJSONPath(%q): expected an error", expr)
+		}
+	}
+}
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		path, doc string
+		want      []string
+	}{
+		{"data.prefixes[].cidr", `{"data": {"prefixes": [{"cidr": "192.0.2.0/24"}, {"cidr": "2001:db8::/32"}]}}`, []string{"192.0.2.0/24", "2001:db8::/32"}},
+		{"data.prefixes", `{"data": {"prefixes": ["192.0.2.0/24", "198.51.100.1"]}}`, []string{"192.0.2.0/24", "198.51.100.1/32"}},
+		{"prefixes", `{"prefixes": [{"ip_prefix": "192.0.2.0/24"}, {"ipv6_prefix": "2001:db8::/32"}]}`, []string{"192.0.2.0/24", "2001:db8::/32"}},
+		{"[1].nets", `[{"nets": ["192.0.2.0/24"]}, {"nets": ["198.51.100.0/24"]}]`, []string{"198.51.100.0/24"}},
+		{"missing", `{"data": []}`, nil},
+	}
+	for _, tt := range tests {
+		path, err := compileJSONPath(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := parseJSONPath(path, strings.NewReader(tt.doc))
+		if err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+			continue
+		}
+		if want := parsePrefixes(t, tt.want...); !slices.Equal(got, want) {
+			t.Errorf("%s: expected %v, got %v", tt.path, want, got)
+		}
+	}
+
+	for _, tt := range []struct{ path, doc string }{
+		{"data", `{"data": [{"name": "x"}]}`},
+		{"data.x", `{"data": ["192.0.2.0/24"]}`},
+		{"data", `{"data": [1]}`},
+		{"data", `{"data": ["bogus"]}`},
+	} {
+		path, _ := compileJSONPath(tt.path)
+		if _, err := parseJSONPath(path, strings.NewReader(tt.doc)); err == nil {
+			t.Errorf("%s on %s: expected an error", tt.path, tt.doc)
+		}
+	}
+}
+
+func TestJSONPathFetch(t *testing.T) {
+	srv := sequenceServer(t, `{"data": {"prefixes": [{"cidr": "192.0.2.0/24"}]}}`)
+	s := newTestRange(srv.URL)
+	s.Format = formatJSON
+	s.JSONPath = "data.prefixes[].cidr"
+	if err := s.provisionJSONPath(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	bad := &WedosIPRange{Format: formatText, JSONPath: "data"}
+	if err := bad.provisionJSONPath(); err == nil {
+		t.Error("expected json_path to require a JSON format")
+	}
+}
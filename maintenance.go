@@ -0,0 +1,68 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// pause suspends refreshes, freezing the current ranges.
+func (s *WedosIPRange) pause() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.pausedSince.IsZero() {
+		s.pausedSince = s.now()
+	}
+}
+
+// resume lets the next scheduled refresh run again.
+func (s *WedosIPRange) resume() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.pausedSince = time.Time{}
+}
+
+// paused reports whether refreshes are suspended. If so, it logs it, so a
+// pause shows in the logs once per skipped refresh.
+func (s *WedosIPRange) paused() bool {
+	s.lock.RLock()
+	since := s.pausedSince
+	s.lock.RUnlock()
+	if since.IsZero() {
+		return false
+	}
+	s.logger.Info("WEDOS IP refreshes paused for maintenance, keeping the current ranges",
+		zap.Time("paused_since", since))
+	return true
+}
+
+// handlePause suspends (POST /wedos/pause) or resumes (POST /wedos/resume)
+// the refreshes of every provisioned module.
+func (adminWedos) handlePause(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+	if err := authorizeMutation(r); err != nil {
+		return err
+	}
+
+	instancesLock.Lock()
+	defer instancesLock.Unlock()
+	for _, s := range instances {
+		if r.URL.Path == "/wedos/resume" {
+			s.resume()
+			s.logger.Info("WEDOS IP refreshes resumed")
+		} else {
+			s.pause()
+			s.logger.Warn("WEDOS IP refreshes paused for maintenance")
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,80 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestMaintenance(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte("198.51.100.0/24"))
+	}))
+	defer srv.Close()
+
+	cached := parsePrefixes(t, "192.0.2.0/24")
+	path := writeCache(t, cacheEntry{Source: srv.URL, Updated: time.Now(), Prefixes: cached})
+	core, logs := observer.New(zap.InfoLevel)
+	s, err := New(Options{
+		Config: WedosIPRange{URL: srv.URL, CacheFile: path, Maintenance: true, Interval: caddy.Duration(20 * time.Millisecond)},
+		Logger: zap.New(core),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	// Paused from the start: the cached ranges stay frozen and each skipped
+	// refresh is logged.
+	waitFor(t, func() bool { return logs.FilterMessageSnippet("paused for maintenance").Len() >= 3 })
+	if n := hits.Load(); n != 0 {
+		t.Errorf("expected no fetch while paused, got %d", n)
+	}
+	if got := s.GetIPRanges(nil); !slices.Equal(got, cached) {
+		t.Errorf("expected the cached %v, got %v", cached, got)
+	}
+	if s.status().PausedSince.IsZero() {
+		t.Error("expected the pause in the status")
+	}
+
+	post := func(path string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		if err := (adminWedos{}).handlePause(rec, httptest.NewRequest(http.MethodPost, path, nil)); err != nil {
+			t.Fatalf("handler error: %v", err)
+		}
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("expected 204, got %d", rec.Code)
+		}
+	}
+	post("/wedos/resume")
+	waitFor(t, func() bool { return hits.Load() > 0 })
+	if !s.status().PausedSince.IsZero() {
+		t.Error("expected no pause in the status after resuming")
+	}
+
+	post("/wedos/pause")
+	paused := hits.Load()
+	time.Sleep(100 * time.Millisecond)
+	if n := hits.Load(); n > paused+1 {
+		t.Errorf("expected refreshes to stop when paused, got %d more", n-paused)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/wedos/pause", nil)
+	if err := (adminWedos{}).handlePause(httptest.NewRecorder(), req); err == nil {
+		t.Errorf("expected GET to be rejected")
+	}
+}
@@ -0,0 +1,41 @@
+package caddy_wedos_ip
+
+import (
+	"net/netip"
+	"slices"
+)
+
+// containingPrefixes returns the prefixes of ranges that contain addr,
+// broadest first. ranges must be normalized (see normalizePrefixes), so
+// each candidate prefix length is a single binary search instead of a scan
+// of the whole set.
+func containingPrefixes(ranges []netip.Prefix, addr netip.Addr) []netip.Prefix {
+	var out []netip.Prefix
+	for bits := 0; bits <= addr.BitLen(); bits++ {
+		candidate, err := addr.Prefix(bits)
+		if err != nil {
+			break
+		}
+		if _, found := slices.BinarySearchFunc(ranges, candidate, comparePrefixes); found {
+			out = append(out, candidate)
+		}
+	}
+	return out
+}
+
+// nearestPrefixes returns the prefixes of ranges of the same family as
+// addr that sort immediately before and after it, either of which is
+// invalid if there is none. It is meant for an addr that no prefix
+// contains. ranges must be normalized.
+func nearestPrefixes(ranges []netip.Prefix, addr netip.Addr) (before, after netip.Prefix) {
+	i, _ := slices.BinarySearchFunc(ranges, addr, func(p netip.Prefix, a netip.Addr) int {
+		return p.Addr().Compare(a)
+	})
+	if i > 0 && ranges[i-1].Addr().Is4() == addr.Is4() {
+		before = ranges[i-1]
+	}
+	if i < len(ranges) && ranges[i].Addr().Is4() == addr.Is4() {
+		after = ranges[i]
+	}
+	return before, after
+}
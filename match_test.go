@@ -0,0 +1,61 @@
+package caddy_wedos_ip
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestContainingPrefixes(t *testing.T) {
+	ranges := normalizePrefixes(parsePrefixes(t,
+		"10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24", "10.2.0.0/16", "192.0.2.0/24", "2001:db8::/32", "2001:db8:1::/48"))
+
+	tests := []struct {
+		addr string
+		want []netip.Prefix
+	}{
+		{"10.1.2.3", parsePrefixes(t, "10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24")},
+		{"10.3.0.1", parsePrefixes(t, "10.0.0.0/8")},
+		{"192.0.2.255", parsePrefixes(t, "192.0.2.0/24")},
+		{"2001:db8:1::1", parsePrefixes(t, "2001:db8::/32", "2001:db8:1::/48")},
+		{"198.51.100.1", nil},
+		{"2001:db9::1", nil},
+	}
+	for _, tt := range tests {
+		got := containingPrefixes(ranges, netip.MustParseAddr(tt.addr))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("containingPrefixes(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestNearestPrefixes(t *testing.T) {
+	ranges := normalizePrefixes(parsePrefixes(t, "192.0.2.0/24", "203.0.113.0/24", "2001:db8::/32"))
+
+	tests := []struct {
+		addr          string
+		before, after string
+	}{
+		{"198.51.100.1", "192.0.2.0/24", "203.0.113.0/24"},
+		{"10.0.0.1", "", "192.0.2.0/24"},
+		// The IPv6 prefix sorts after every IPv4 one but is not offered.
+		{"203.0.114.1", "203.0.113.0/24", ""},
+		{"2001:db9::1", "2001:db8::/32", ""},
+	}
+	for _, tt := range tests {
+		before, after := nearestPrefixes(ranges, netip.MustParseAddr(tt.addr))
+		if got := prefixString(before); got != tt.before {
+			t.Errorf("nearestPrefixes(%s) before = %q, want %q", tt.addr, got, tt.before)
+		}
+		if got := prefixString(after); got != tt.after {
+			t.Errorf("nearestPrefixes(%s) after = %q, want %q", tt.addr, got, tt.after)
+		}
+	}
+}
+
+func prefixString(p netip.Prefix) string {
+	if !p.IsValid() {
+		return ""
+	}
+	return p.String()
+}
@@ -0,0 +1,34 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"net/netip"
+	"unsafe"
+
+	"go.uber.org/zap"
+)
+
+// prefixSize is the size of one netip.Prefix in memory.
+const prefixSize = int64(unsafe.Sizeof(netip.Prefix{}))
+
+// rangesMemory estimates the memory taken by a set of n prefixes.
+func rangesMemory(n int) int64 {
+	return int64(n) * prefixSize
+}
+
+// checkMaxMemory rejects a list whose set, with the pinned ranges, is
+// estimated to take more than MaxMemory bytes.
+func (s *WedosIPRange) checkMaxMemory(prefixes []netip.Prefix) error {
+	if s.MaxMemory <= 0 {
+		return nil
+	}
+	estimate := rangesMemory(len(prefixes) + len(s.pinned))
+	if estimate <= s.MaxMemory {
+		return nil
+	}
+	s.logger.Error("WEDOS IP list exceeds max_memory, keeping the previous ranges",
+		zap.Int("count", len(prefixes)),
+		zap.Int64("estimate", estimate),
+		zap.Int64("max_memory", s.MaxMemory))
+	return fmt.Errorf("%d prefixes take an estimated %d bytes, more than max_memory %d", len(prefixes), estimate, s.MaxMemory)
+}
@@ -0,0 +1,33 @@
+package caddy_wedos_ip
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestMaxMemory(t *testing.T) {
+	srv := sequenceServer(t, "192.0.2.0/24", "192.0.2.0/24 198.51.100.0/24 203.0.113.0/24")
+
+	core, logs := observer.New(zap.ErrorLevel)
+	s := newTestRange(srv.URL)
+	s.logger = zap.New(core)
+	s.MaxMemory = 2 * prefixSize
+
+	if err := s.refresh(); err != nil {
+		t.Fatalf("first refresh: %v", err)
+	}
+	if err := s.refresh(); err == nil {
+		t.Fatal("expected a list over max_memory to be rejected")
+	}
+	if got := s.GetIPRanges(nil); len(got) != 1 {
+		t.Errorf("expected the previous ranges to be kept, got %v", got)
+	}
+	if n := logs.FilterMessage("WEDOS IP list exceeds max_memory, keeping the previous ranges").Len(); n != 1 {
+		t.Errorf("expected one error log, got %d", n)
+	}
+	if got := s.status().MemoryBytes; got != prefixSize {
+		t.Errorf("expected a status estimate of %d bytes, got %d", prefixSize, got)
+	}
+}
@@ -0,0 +1,43 @@
+package caddy_wedos_ip
+
+import (
+	"net/netip"
+
+	"go.uber.org/zap"
+)
+
+// Values of MergePolicy.
+const (
+	mergeUnion       = "union"
+	mergePrimaryWins = "primary-wins"
+)
+
+// mergeSources merges the prefixes of the primary source (the URL lists)
+// with those of a secondary one (the DNSTXT records). With primary-wins, a
+// secondary prefix overlapping any primary prefix is dropped, so the
+// primary's version of a range is kept.
+func (s *WedosIPRange) mergeSources(primary, secondary []netip.Prefix) []netip.Prefix {
+	if s.MergePolicy != mergePrimaryWins || len(primary) == 0 {
+		return append(secondary, primary...)
+	}
+	kept := make([]netip.Prefix, 0, len(secondary))
+	for _, p := range secondary {
+		if !overlapsAny(p, primary) {
+			kept = append(kept, p)
+		}
+	}
+	if dropped := len(secondary) - len(kept); dropped > 0 {
+		s.logger.Debug("dropped secondary prefixes overlapping the primary source", zap.Int("count", dropped))
+	}
+	return append(kept, primary...)
+}
+
+// overlapsAny reports whether p overlaps any of prefixes.
+func overlapsAny(p netip.Prefix, prefixes []netip.Prefix) bool {
+	for _, q := range prefixes {
+		if p.Overlaps(q) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+func TestMergePolicy(t *testing.T) {
+	stubTXT(t, map[string][]string{"_ips.example.com": {"192.0.2.0/28 198.51.100.0/24 203.0.113.0/24"}})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("192.0.2.0/24 203.0.113.128/25"))
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		policy string
+		want   []string
+	}{
+		{"", []string{"192.0.2.0/28", "198.51.100.0/24", "203.0.113.0/24", "192.0.2.0/24", "203.0.113.128/25"}},
+		{mergePrimaryWins, []string{"198.51.100.0/24", "192.0.2.0/24", "203.0.113.128/25"}},
+	} {
+		s := WedosIPRange{
+			URL:         srv.URL,
+			DNSTXT:      "_ips.example.com",
+			MergePolicy: tc.policy,
+			ctx:         caddy.Context{Context: context.Background()},
+			logger:      zap.NewNop(),
+		}
+		s.client = s.newClient()
+		got, err := s.fetchSources()
+		if err != nil {
+			t.Fatalf("%q: fetch error: %v", tc.policy, err)
+		}
+		if want := parsePrefixes(t, tc.want...); !slices.Equal(got, want) {
+			t.Errorf("%q: fetchSources() = %v, want %v", tc.policy, got, want)
+		}
+	}
+}
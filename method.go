@@ -0,0 +1,54 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// provisionMethod validates Method and Body. A body is only sent with
+// POST and must be JSON; HEAD probes can't tell whether a POST query would
+// return something new, so they are only supported with GET.
+func (s *WedosIPRange) provisionMethod() error {
+	s.Method = strings.ToUpper(s.Method)
+	switch s.Method {
+	case "", http.MethodGet, http.MethodPost:
+	default:
+		return fmt.Errorf("method must be GET or POST, got %q", s.Method)
+	}
+	if s.Body != "" {
+		if s.Method != http.MethodPost {
+			return fmt.Errorf("body requires method POST")
+		}
+		if !json.Valid([]byte(s.Body)) {
+			return fmt.Errorf("body is not valid JSON")
+		}
+	}
+	if s.Method == http.MethodPost && s.HeadProbe {
+		return fmt.Errorf("head_probe is only supported with method GET")
+	}
+	return nil
+}
+
+// newFetchRequest returns the request fetching the list from api, a POST
+// with Body if so configured.
+func (s *WedosIPRange) newFetchRequest(ctx context.Context, api string) (*http.Request, error) {
+	if s.Method != http.MethodPost {
+		return http.NewRequestWithContext(ctx, http.MethodGet, api, nil)
+	}
+	var body io.Reader
+	if s.Body != "" {
+		body = strings.NewReader(s.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, api, body)
+	if err != nil {
+		return nil, err
+	}
+	if s.Body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
@@ -0,0 +1,59 @@
+package caddy_wedos_ip
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestPostBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || string(body) != `{"product":"cdn"}` {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`["192.0.2.0/24", "2001:db8::/32"]`))
+	}))
+	defer srv.Close()
+
+	s := newTestRange(srv.URL)
+	s.Method = "post"
+	s.Body = `{"product":"cdn"}`
+	if err := s.provisionMethod(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.refresh(); err != nil {
+		t.Fatalf("refresh error: %v", err)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24", "2001:db8::/32"); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestProvisionMethod(t *testing.T) {
+	for _, s := range []WedosIPRange{
+		{},
+		{Method: "get"},
+		{Method: "POST"},
+		{Method: "POST", Body: `{"product":"cdn"}`},
+	} {
+		if err := s.provisionMethod(); err != nil {
+			t.Errorf("%+v: unexpected error: %v", s, err)
+		}
+	}
+	for _, s := range []WedosIPRange{
+		{Method: "PUT"},
+		{Body: `{"product":"cdn"}`},
+		{Method: "GET", Body: `{"product":"cdn"}`},
+		{Method: "POST", Body: `{"product":`},
+		{Method: "POST", HeadProbe: true},
+	} {
+		if err := s.provisionMethod(); err == nil {
+			t.Errorf("%+v: expected an error", s)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package caddy_wedos_ip
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons for skipping a fetched entry, as the reason label of
+// wedos_ip_entries_skipped_total.
+const (
+	skipTooBroad = "too_broad"
+	skipExcluded = "excluded"
+	skipRegion   = "region"
+	skipFamily   = "family"
+)
+
+var wedosMetrics = struct {
+	once           sync.Once
+	entriesSkipped *prometheus.CounterVec
+	refreshes      *prometheus.CounterVec
+	emptyResponses prometheus.Counter
+	freshness      *prometheus.GaugeVec
+}{}
+
+func initMetrics() {
+	wedosMetrics.once.Do(func() {
+		wedosMetrics.entriesSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "wedos_ip_entries_skipped_total",
+			Help: "Fetched WEDOS IP list entries that were dropped, by reason.",
+		}, []string{"reason"})
+		wedosMetrics.refreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "wedos_ip_refreshes_total",
+			Help: "Refreshes of the WEDOS IP ranges, by result.",
+		}, []string{"result"})
+		wedosMetrics.emptyResponses = prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "wedos_ip_empty_response_total",
+			Help: "Successful responses of WEDOS IP list sources that held no prefixes.",
+		})
+		wedosMetrics.freshness = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "wedos_ip_freshness_ratio",
+			Help: "Freshness of the WEDOS IP ranges, decaying from 1 when refreshed to 0 at max_age, by source.",
+		}, []string{"source"})
+	})
+}
+
+// registerMetrics registers the module's metrics with the metrics registry
+// of ctx. Every module in the config shares the same collectors, so
+// registering them again is not an error; another collector with one of
+// their names is.
+func registerMetrics(ctx caddy.Context) error {
+	initMetrics()
+	registry := ctx.GetMetricsRegistry()
+	if registry == nil {
+		return nil
+	}
+	for _, c := range []prometheus.Collector{wedosMetrics.entriesSkipped, wedosMetrics.refreshes, wedosMetrics.emptyResponses, wedosMetrics.freshness} {
+		if err := registry.Register(c); err != nil &&
+			!errors.Is(err, prometheus.AlreadyRegisteredError{ExistingCollector: c, NewCollector: c}) {
+			return fmt.Errorf("registering metrics: %v", err)
+		}
+	}
+	return nil
+}
+
+// recordSkipped counts n entries dropped for reason.
+func recordSkipped(reason string, n int) {
+	if n == 0 {
+		return
+	}
+	initMetrics()
+	wedosMetrics.entriesSkipped.WithLabelValues(reason).Add(float64(n))
+}
+
+// Results of a refresh, as the result label of wedos_ip_refreshes_total.
+const (
+	resultSuccess  = "success"
+	resultDNSError = "dns_error"
+	resultEmpty    = "empty"
+	resultError    = "error"
+	// A status tolerated by tolerate_status.
+	resultTolerated = "tolerated"
+	// Applied with the last good prefixes of failed sources.
+	resultPartial = "partial"
+)
+
+// recordRefreshResult counts a refresh that failed with an error of class,
+// or succeeded if class is empty.
+func recordRefreshResult(class string) {
+	result := resultError
+	switch class {
+	case "":
+		result = resultSuccess
+	case errClassDNS:
+		result = resultDNSError
+	case errClassEmpty:
+		result = resultEmpty
+	case errClassPartial:
+		result = resultPartial
+	}
+	initMetrics()
+	wedosMetrics.refreshes.WithLabelValues(result).Inc()
+}
+
+// recordToleratedRefresh counts a refresh that failed with a status within
+// its tolerate_status window.
+func recordToleratedRefresh() {
+	initMetrics()
+	wedosMetrics.refreshes.WithLabelValues(resultTolerated).Inc()
+}
+
+// recordEmptyResponse counts a successful response without prefixes.
+func recordEmptyResponse() {
+	initMetrics()
+	wedosMetrics.emptyResponses.Inc()
+}
+
+// recordFreshness sets the freshness gauge of source to ratio.
+func recordFreshness(source string, ratio float64) {
+	initMetrics()
+	wedosMetrics.freshness.WithLabelValues(source).Set(ratio)
+}
+
+// forgetFreshness drops the freshness gauge of source.
+func forgetFreshness(source string) {
+	initMetrics()
+	wedosMetrics.freshness.DeleteLabelValues(source)
+}
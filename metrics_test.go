@@ -0,0 +1,59 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestEntriesSkippedMetric(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+	if err := registerMetrics(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Registering again, as every provisioned module does, is fine.
+	if err := registerMetrics(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	counter := wedosMetrics.entriesSkipped.WithLabelValues(skipTooBroad)
+	before := testutil.ToFloat64(counter)
+
+	s := WedosIPRange{MinPrefixLenV4: defaultMinPrefixLenV4, MinPrefixLenV6: defaultMinPrefixLenV6, logger: zap.NewNop()}
+	s.dropTooBroad(parsePrefixes(t, "0.0.0.0/0", "192.0.2.0/24", "::/0"))
+
+	if got := testutil.ToFloat64(counter) - before; got != 2 {
+		t.Errorf("expected 2 entries counted as too_broad, got %v", got)
+	}
+
+	n, err := testutil.GatherAndCount(ctx.GetMetricsRegistry(), "wedos_ip_entries_skipped_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Error("expected the counter to be exported by the registry")
+	}
+}
+
+func TestRegisterMetricsConflict(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+	// Another collector under one of the module's names.
+	ctx.GetMetricsRegistry().MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "wedos_ip_refreshes_total",
+		Help: "Not the module's.",
+	}))
+	if err := registerMetrics(ctx); err == nil {
+		t.Error("expected a conflicting collector to be reported")
+	}
+	s := WedosIPRange{URL: "https://example.com/ips.txt"}
+	if err := s.Provision(ctx); err == nil {
+		s.Cleanup()
+		t.Error("expected Provision to fail")
+	}
+}
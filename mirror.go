@@ -0,0 +1,128 @@
+package caddy_wedos_ip
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func init() {
+	caddy.RegisterModule(WedosList{})
+	httpcaddyfile.RegisterHandlerDirective("wedos_list", parseWedosList)
+	httpcaddyfile.RegisterDirectiveOrder("wedos_list", httpcaddyfile.Before, "respond")
+}
+
+// WedosList is an HTTP handler that serves the list last fetched by a
+// wedos module in its normalized text form, one CIDR per line, so other
+// hosts of the network can fetch it from this Caddy instead of from
+// WEDOS. It answers conditional requests against the content hash.
+type WedosList struct {
+	// Source selects the module by its source, as reported by
+	// /wedos/status. It may be omitted if only one module is provisioned,
+	// and is required with Sets, whose lists are never served.
+	Source string `json:"source,omitempty"`
+}
+
+// CaddyModule returns the Caddy module information.
+func (WedosList) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.wedos_list",
+		New: func() caddy.Module { return new(WedosList) },
+	}
+}
+
+// ServeHTTP implements caddyhttp.MiddlewareHandler. It never calls next.
+func (l WedosList) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		return caddyhttp.Error(http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+	}
+	s, err := l.module()
+	if err != nil {
+		return caddyhttp.Error(http.StatusServiceUnavailable, err)
+	}
+
+	s.lock.RLock()
+	fetched, refreshed := s.fetched, s.lastRefresh
+	interval := max(time.Duration(s.Interval), s.adaptedInterval)
+	s.lock.RUnlock()
+	if refreshed.IsZero() {
+		return caddyhttp.Error(http.StatusServiceUnavailable, fmt.Errorf("WEDOS IP ranges of %s not loaded yet", s.source()))
+	}
+
+	// Cacheable until this module refreshes next.
+	maxAge := max(0, refreshed.Add(interval).Sub(s.now()))
+	h := w.Header()
+	h.Set("Content-Type", "text/plain; charset=utf-8")
+	h.Set("ETag", strconv.Quote(contentHash(fetched)))
+	h.Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+	http.ServeContent(w, r, "", refreshed, bytes.NewReader(formatPrefixList(fetched)))
+	return nil
+}
+
+// module returns the provisioned module l serves the list of.
+func (l WedosList) module() (*WedosIPRange, error) {
+	return findModule(l.Source)
+}
+
+// findModule returns the provisioned module with the given source, or the
+// only one if source is empty. Named sets are skipped. Of several modules
+// with the same source, as while a config reload overlaps the old instance
+// with the new one, the one provisioned last is used. It doesn't lock, see
+// moduleIndex.
+func findModule(source string) (*WedosIPRange, error) {
+	var index map[string]*WedosIPRange
+	if p := moduleIndex.Load(); p != nil {
+		index = *p
+	}
+	if source != "" {
+		if s := index[source]; s != nil {
+			return s, nil
+		}
+		return nil, fmt.Errorf("no wedos module with source %s", source)
+	}
+	switch len(index) {
+	case 0:
+		return nil, fmt.Errorf("no wedos module provisioned")
+	case 1:
+		for _, s := range index {
+			return s, nil
+		}
+	}
+	return nil, errAmbiguousModule
+}
+
+// errAmbiguousModule is returned by findModule without a source if modules
+// with different sources are provisioned.
+var errAmbiguousModule = errors.New("several wedos modules provisioned, set source")
+
+// UnmarshalCaddyfile implements caddyfile.Unmarshaler.
+//
+//	wedos_list [source]
+func (l *WedosList) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next() // consume directive name
+	if d.NextArg() {
+		l.Source = d.Val()
+	}
+	if d.NextArg() {
+		return d.ArgErr()
+	}
+	if d.NextBlock(0) {
+		return d.Errf("unrecognized wedos_list option %q", d.Val())
+	}
+	return nil
+}
+
+func parseWedosList(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	l := new(WedosList)
+	err := l.UnmarshalCaddyfile(h.Dispenser)
+	return l, err
+}
@@ -0,0 +1,125 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestWedosList(t *testing.T) {
+	srv := sequenceServer(t, "2001:0db8::/32\n192.0.2.0/24 192.0.2.0/24\n")
+	s, err := New(Options{Config: WedosIPRange{
+		URL:            srv.URL,
+		RequireOnStart: true,
+		Interval:       caddy.Duration(time.Hour),
+		Pinned:         []string{"203.0.113.0/24"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	l := WedosList{Source: srv.URL}
+	rec := httptest.NewRecorder()
+	if err := l.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ips.txt", nil), nil); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	// The fetched list, normalized and without the pinned ranges.
+	if got, want := rec.Body.String(), "192.0.2.0/24\n2001:db8::/32\n"; got != want {
+		t.Errorf("expected body %q, got %q", want, got)
+	}
+	etag := rec.Header().Get("ETag")
+	if want := strconv.Quote(contentHash(parsePrefixes(t, "192.0.2.0/24", "2001:db8::/32"))); etag != want {
+		t.Errorf("expected ETag %s, got %s", want, etag)
+	}
+	if cc := rec.Header().Get("Cache-Control"); !strings.HasPrefix(cc, "public, max-age=") || cc == "public, max-age=0" {
+		t.Errorf("unexpected Cache-Control %q", cc)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/ips.txt", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	if err := l.ServeHTTP(rec, req, nil); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", rec.Code)
+	}
+
+	err = l.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/ips.txt", nil), nil)
+	if herr, ok := err.(caddyhttp.HandlerError); !ok || herr.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected a 405 handler error, got %v", err)
+	}
+	err = WedosList{Source: "https://unknown.example"}.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), nil)
+	if herr, ok := err.(caddyhttp.HandlerError); !ok || herr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected a 503 handler error, got %v", err)
+	}
+}
+
+func TestWedosListUnmarshal(t *testing.T) {
+	var l WedosList
+	if err := l.UnmarshalCaddyfile(caddyfile.NewTestDispenser("wedos_list https://ips.wedos.global/ips.txt")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if l.Source != "https://ips.wedos.global/ips.txt" {
+		t.Errorf("incorrect source: got %q", l.Source)
+	}
+	if err := l.UnmarshalCaddyfile(caddyfile.NewTestDispenser("wedos_list a b")); err == nil {
+		t.Errorf("expected an error for two arguments")
+	}
+}
+
+func TestWedosListInstances(t *testing.T) {
+	const url = "https://example.com/ips.txt"
+	old := &WedosIPRange{URL: url, lock: new(sync.RWMutex)}
+	set := &WedosIPRange{URL: "https://example.com/set.txt", lock: new(sync.RWMutex), setChild: true}
+	reloaded := &WedosIPRange{URL: url, lock: new(sync.RWMutex)}
+	withInstances(t, old, set, reloaded)
+
+	// The set is skipped and the module provisioned last wins over the
+	// instance it replaces.
+	s, err := WedosList{}.module()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != reloaded {
+		t.Errorf("expected the newest instance")
+	}
+	if _, err := (WedosList{Source: set.URL}).module(); err == nil {
+		t.Errorf("expected sets not to be served")
+	}
+
+	other := &WedosIPRange{URL: "https://example.com/other.txt", lock: new(sync.RWMutex)}
+	registerInstance(other)
+	if _, err := (WedosList{}).module(); err == nil {
+		t.Errorf("expected an error for several sources")
+	}
+}
+
+// withInstances replaces the provisioned modules with list for the rest of
+// the test, hiding those other tests left registered.
+func withInstances(t *testing.T, list ...*WedosIPRange) {
+	instancesLock.Lock()
+	saved := instances
+	instances = list
+	indexInstances()
+	instancesLock.Unlock()
+	t.Cleanup(func() {
+		instancesLock.Lock()
+		instances = saved
+		indexInstances()
+		instancesLock.Unlock()
+	})
+}
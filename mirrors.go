@@ -0,0 +1,138 @@
+package caddy_wedos_ip
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Defaults of the source_health option.
+const (
+	defaultSourceMaxFailures = 3
+	defaultSourceCooldown    = 10 * time.Minute
+)
+
+// sourceHealth tracks one of URL and Mirrors. Guarded by lock and only
+// written by the refresh goroutine.
+type sourceHealth struct {
+	failures      int
+	disabledUntil time.Time
+}
+
+// sourceStatus reports the health of one source in the admin API.
+type sourceStatus struct {
+	URL                 string    `json:"url"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	DisabledUntil       time.Time `json:"disabled_until,omitzero"`
+}
+
+// fetchMirrors fetches URL, falling back to each of Mirrors in order.
+// A source failing SourceMaxFailures times in a row is skipped until
+// SourceCooldown has passed, then probed again. If every source is
+// disabled, all of them are tried anyway.
+func (s *WedosIPRange) fetchMirrors() ([]netip.Prefix, string, error) {
+	urls := append([]string{s.URL}, s.Mirrors...)
+	now := s.now()
+
+	var enabled, disabled []string
+	s.lock.RLock()
+	for _, u := range urls {
+		if h := s.health[u]; h != nil && now.Before(h.disabledUntil) {
+			disabled = append(disabled, u)
+		} else {
+			enabled = append(enabled, u)
+		}
+	}
+	s.lock.RUnlock()
+	if len(enabled) == 0 {
+		enabled = disabled
+	}
+
+	var errs []error
+	s.pendingSource = ""
+	for _, u := range enabled {
+		s.pendingValidators = headValidators{}
+		if s.headProbing(u) && s.probeUnchanged(u) {
+			s.recordSource(u, nil)
+			return nil, s.etags[u], errNotModified
+		}
+		prefixes, etag, err := s.fetchConditional(u, s.etags[u])
+		if err == nil || errors.Is(err, errNotModified) {
+			s.recordSource(u, nil)
+			s.pendingSource = u
+			return prefixes, etag, err
+		}
+		s.recordSource(u, err)
+		errs = append(errs, fmt.Errorf("%s: %w", u, err))
+	}
+	return nil, "", errors.Join(errs...)
+}
+
+// commitValidators keeps the validators of the list being applied for the
+// source that served it. A list not fetched by fetchMirrors, such as a
+// pushed one, has none, and those kept describe older lists, so they are
+// dropped. The caller must hold lock.
+func (s *WedosIPRange) commitValidators() {
+	if s.pendingSource == "" {
+		s.etags, s.validators = nil, nil
+		return
+	}
+	if s.etags == nil {
+		s.etags = make(map[string]string)
+	}
+	if s.validators == nil {
+		s.validators = make(map[string]headValidators)
+	}
+	s.etags[s.pendingSource] = s.pendingETag
+	s.validators[s.pendingSource] = s.pendingValidators
+}
+
+// recordSource updates the health of the source u after a fetch.
+func (s *WedosIPRange) recordSource(u string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	h := s.health[u]
+	if err == nil {
+		if h != nil && h.failures >= s.SourceMaxFailures {
+			s.logger.Info("WEDOS IP list source recovered", zap.String("url", u))
+		}
+		delete(s.health, u)
+		return
+	}
+	if h == nil {
+		if s.health == nil {
+			s.health = make(map[string]*sourceHealth)
+		}
+		h = new(sourceHealth)
+		s.health[u] = h
+	}
+	h.failures++
+	if h.failures >= s.SourceMaxFailures {
+		h.disabledUntil = s.now().Add(time.Duration(s.SourceCooldown))
+		s.logger.Warn("disabling failing WEDOS IP list source",
+			zap.String("url", u),
+			zap.Int("consecutive_failures", h.failures),
+			zap.Time("until", h.disabledUntil))
+	}
+}
+
+// sourceStatuses returns the health of URL and Mirrors. The caller must
+// hold lock.
+func (s *WedosIPRange) sourceStatuses() []sourceStatus {
+	if len(s.Mirrors) == 0 {
+		return nil
+	}
+	var out []sourceStatus
+	for _, u := range append([]string{s.URL}, s.Mirrors...) {
+		st := sourceStatus{URL: u}
+		if h := s.health[u]; h != nil {
+			st.ConsecutiveFailures = h.failures
+			st.DisabledUntil = h.disabledUntil
+		}
+		out = append(out, st)
+	}
+	return out
+}
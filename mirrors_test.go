@@ -0,0 +1,147 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+func TestMirrorsHealth(t *testing.T) {
+	var primaryHits atomic.Int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryHits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer mirror.Close()
+
+	s := WedosIPRange{
+		URL:               primary.URL,
+		Mirrors:           []string{mirror.URL},
+		SourceMaxFailures: 2,
+		SourceCooldown:    caddy.Duration(time.Hour),
+		MinPrefixLenV4:    defaultMinPrefixLenV4,
+		MinPrefixLenV6:    defaultMinPrefixLenV6,
+		ctx:               caddy.Context{Context: context.Background()},
+		lock:              new(sync.RWMutex),
+		applyLock:         new(sync.Mutex),
+		subsLock:          new(sync.Mutex),
+		logger:            zap.NewNop(),
+	}
+	s.client = s.newClient()
+
+	for i := 0; i < 4; i++ {
+		if err := s.refresh(); err != nil {
+			t.Fatalf("refresh %d: %v", i+1, err)
+		}
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected the mirror's ranges %v, got %v", want, got)
+	}
+	// Disabled after two failures, the primary is skipped afterwards.
+	if n := primaryHits.Load(); n != 2 {
+		t.Errorf("expected the primary to be tried twice, got %d", n)
+	}
+
+	st := s.status()
+	if len(st.Sources) != 2 || st.Sources[0].ConsecutiveFailures != 2 || st.Sources[0].DisabledUntil.IsZero() {
+		t.Errorf("unexpected source status: %+v", st.Sources)
+	}
+	if st.Sources[1].ConsecutiveFailures != 0 || !st.Sources[1].DisabledUntil.IsZero() {
+		t.Errorf("expected the mirror to be healthy: %+v", st.Sources[1])
+	}
+
+	// After the cooldown the primary is probed again.
+	s.lock.Lock()
+	s.health[primary.URL].disabledUntil = time.Now()
+	s.lock.Unlock()
+	s.refresh()
+	if n := primaryHits.Load(); n != 3 {
+		t.Errorf("expected a probe of the primary after the cooldown, got %d hits", n)
+	}
+}
+
+func TestMirrorsAllFailing(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	s := WedosIPRange{
+		URL:               srv.URL + "/a",
+		Mirrors:           []string{srv.URL + "/b"},
+		SourceMaxFailures: 1,
+		SourceCooldown:    caddy.Duration(time.Hour),
+		ctx:               caddy.Context{Context: context.Background()},
+		lock:              new(sync.RWMutex),
+		logger:            zap.NewNop(),
+	}
+	s.client = s.newClient()
+
+	// With every source disabled, all are still tried.
+	for i := 0; i < 2; i++ {
+		if _, err := s.fetchSources(); err == nil {
+			t.Fatalf("expected an error")
+		}
+	}
+	if got := s.health[srv.URL+"/a"].failures; got != 2 {
+		t.Errorf("expected the disabled primary to be retried, got %d failures", got)
+	}
+}
+
+func TestMirrorsETagPerSource(t *testing.T) {
+	var primaryDown atomic.Bool
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if primaryDown.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("ETag", `"shared"`)
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer primary.Close()
+	var sent []string
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == `"shared"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"shared"`)
+		w.Write([]byte("198.51.100.0/24"))
+	}))
+	defer mirror.Close()
+
+	s := newTestRange(primary.URL)
+	s.Mirrors = []string{mirror.URL}
+	s.SourceMaxFailures = defaultSourceMaxFailures
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The primary's ETag is not sent to the mirror, which would take it
+	// for its own and answer 304.
+	primaryDown.Store(true)
+	for range 2 {
+		if err := s.refresh(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"", `"shared"`}; !slices.Equal(sent, want) {
+		t.Errorf("expected the mirror to get %q, got %q", want, sent)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "198.51.100.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected the mirror's ranges %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,200 @@
+package caddy_wedos_ip
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// rangeOverride is a temporary change to the ranges set through the admin
+// API, kept apart from the fetched list so it survives refreshes.
+type rangeOverride struct {
+	add, remove []netip.Prefix
+	// Zero when the override lasts until cleared.
+	expires time.Time
+	timer   *time.Timer
+}
+
+// overrideStatus reports the active override in the status endpoint.
+type overrideStatus struct {
+	Add     []string  `json:"add,omitempty"`
+	Remove  []string  `json:"remove,omitempty"`
+	Expires time.Time `json:"expires,omitzero"`
+}
+
+// overrideRequest is the body of PUT /wedos/override.
+type overrideRequest struct {
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+	// TTL, if set, reverts the override after this long.
+	TTL string `json:"ttl"`
+}
+
+// withOverride adds and then removes the prefixes of the active override,
+// so it wins over the fetched, pinned and excluded ranges.
+func (s *WedosIPRange) withOverride(prefixes []netip.Prefix) []netip.Prefix {
+	s.lock.RLock()
+	o := s.override
+	s.lock.RUnlock()
+	if o == nil {
+		return prefixes
+	}
+	out := append(slices.Clip(prefixes), o.add...)
+	for _, e := range o.remove {
+		var next []netip.Prefix
+		for _, p := range out {
+			next = append(next, subtractPrefix(p.Masked(), e)...)
+		}
+		out = next
+	}
+	return out
+}
+
+// setOverride replaces the active override and applies it right away.
+// With a positive ttl it reverts by itself.
+func (s *WedosIPRange) setOverride(add, remove []netip.Prefix, ttl time.Duration) {
+	o := &rangeOverride{add: add, remove: remove}
+	if ttl > 0 {
+		o.expires = s.now().Add(ttl)
+		o.timer = time.AfterFunc(ttl, func() { s.expireOverride(o) })
+	}
+	s.lock.Lock()
+	prev := s.override
+	s.override = o
+	s.lock.Unlock()
+	if prev != nil && prev.timer != nil {
+		prev.timer.Stop()
+	}
+	s.reapplyRanges()
+	s.logger.Warn("temporary override of WEDOS IP ranges set",
+		zap.Stringers("add", add),
+		zap.Stringers("remove", remove),
+		zap.Duration("ttl", ttl))
+}
+
+// clearOverride drops the active override, if any.
+func (s *WedosIPRange) clearOverride() {
+	s.lock.Lock()
+	prev := s.override
+	s.override = nil
+	s.lock.Unlock()
+	if prev == nil {
+		return
+	}
+	if prev.timer != nil {
+		prev.timer.Stop()
+	}
+	s.reapplyRanges()
+	s.logger.Warn("temporary override of WEDOS IP ranges cleared")
+}
+
+// expireOverride drops o when its TTL elapses, unless it was replaced.
+func (s *WedosIPRange) expireOverride(o *rangeOverride) {
+	s.lock.Lock()
+	if s.override != o {
+		s.lock.Unlock()
+		return
+	}
+	s.override = nil
+	s.lock.Unlock()
+	s.reapplyRanges()
+	s.logger.Warn("temporary override of WEDOS IP ranges expired")
+}
+
+// stopOverride stops the expiry timer of the active override, on cleanup.
+func (s *WedosIPRange) stopOverride() {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.override != nil && s.override.timer != nil {
+		s.override.timer.Stop()
+	}
+}
+
+// overrideStatus returns the active override for the status endpoint, nil
+// without one. s.lock must be held.
+func (s *WedosIPRange) overrideStatus() *overrideStatus {
+	if s.override == nil {
+		return nil
+	}
+	st := &overrideStatus{Expires: s.override.expires}
+	for _, p := range s.override.add {
+		st.Add = append(st.Add, p.String())
+	}
+	for _, p := range s.override.remove {
+		st.Remove = append(st.Remove, p.String())
+	}
+	return st
+}
+
+// handleOverride sets (PUT) or clears (DELETE) a temporary override of
+// the ranges of every provisioned module, a break-glass tool for incident
+// response.
+func (adminWedos) handleOverride(w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case http.MethodDelete:
+		if err := authorizeMutation(r); err != nil {
+			return err
+		}
+		instancesLock.Lock()
+		defer instancesLock.Unlock()
+		for _, s := range instances {
+			s.clearOverride()
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	case http.MethodPut:
+	default:
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+	if err := authorizeMutation(r); err != nil {
+		return err
+	}
+
+	var body overrideRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("decoding request body: %v", err),
+		}
+	}
+	if len(body.Add) == 0 && len(body.Remove) == 0 {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("add or remove must list at least one prefix"),
+		}
+	}
+	add, err := parseCIDRList("add", body.Add)
+	if err != nil {
+		return caddy.APIError{HTTPStatus: http.StatusBadRequest, Err: err}
+	}
+	remove, err := parseCIDRList("remove", body.Remove)
+	if err != nil {
+		return caddy.APIError{HTTPStatus: http.StatusBadRequest, Err: err}
+	}
+	var ttl time.Duration
+	if body.TTL != "" {
+		if ttl, err = caddy.ParseDuration(body.TTL); err != nil || ttl <= 0 {
+			return caddy.APIError{
+				HTTPStatus: http.StatusBadRequest,
+				Err:        fmt.Errorf("invalid ttl %q", body.TTL),
+			}
+		}
+	}
+
+	instancesLock.Lock()
+	defer instancesLock.Unlock()
+	for _, s := range instances {
+		s.setOverride(add, remove, ttl)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
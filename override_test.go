@@ -0,0 +1,126 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAdminOverride(t *testing.T) {
+	s := newTestRange(sequenceServer(t, "192.0.2.0/24 198.51.100.0/24").URL)
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	registerInstance(s)
+	defer unregisterInstance(s)
+
+	for _, body := range []string{`{}`, `{"add":["bogus"]}`, `{"remove":["192.0.2.0/24"],"ttl":"-1s"}`, `nope`} {
+		req := httptest.NewRequest(http.MethodPut, "/wedos/override", strings.NewReader(body))
+		if err := (adminWedos{}).handleOverride(httptest.NewRecorder(), req); err == nil {
+			t.Errorf("expected %s to be rejected", body)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/wedos/override",
+		strings.NewReader(`{"add":["203.0.113.7"],"remove":["198.51.100.0/25"]}`))
+	if err := (adminWedos{}).handleOverride(rec, req); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rec.Code)
+	}
+	want := parsePrefixes(t, "192.0.2.0/24", "198.51.100.128/25", "203.0.113.7/32")
+	if got := s.GetIPRanges(nil); !slices.Equal(got, want) {
+		t.Errorf("expected the override applied %v, got %v", want, got)
+	}
+	if st := s.status().Override; st == nil || !slices.Equal(st.Add, []string{"203.0.113.7/32"}) || !st.Expires.IsZero() {
+		t.Errorf("unexpected override status %+v", st)
+	}
+
+	// The override survives a refresh.
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.GetIPRanges(nil); !slices.Equal(got, want) {
+		t.Errorf("expected the override kept across a refresh %v, got %v", want, got)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/wedos/override", nil)
+	if err := (adminWedos{}).handleOverride(httptest.NewRecorder(), req); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24", "198.51.100.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected the fetched ranges %v after clearing, got %v", want, got)
+	}
+	if st := s.status().Override; st != nil {
+		t.Errorf("expected no override, got %+v", st)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/wedos/override", nil)
+	if err := (adminWedos{}).handleOverride(httptest.NewRecorder(), req); err == nil {
+		t.Errorf("expected GET to be rejected")
+	}
+}
+
+func TestOverrideExpires(t *testing.T) {
+	s := newTestRange(sequenceServer(t, "192.0.2.0/24").URL)
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.setOverride(nil, parsePrefixes(t, "192.0.2.0/24"), 20*time.Millisecond)
+	if got := s.GetIPRanges(nil); len(got) != 0 {
+		t.Errorf("expected the range removed, got %v", got)
+	}
+	if st := s.status().Override; st == nil || st.Expires.IsZero() {
+		t.Errorf("expected an expiry in the status, got %+v", st)
+	}
+	waitFor(t, func() bool { return len(s.GetIPRanges(nil)) == 1 })
+	if st := s.status().Override; st != nil {
+		t.Errorf("expected the override gone, got %+v", st)
+	}
+}
+
+func TestOverrideDuringRefresh(t *testing.T) {
+	// Every fetch lists a new address, so a refresh undone by an override
+	// recomposing a stale copy of the fetched ranges shows.
+	var n atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "192.0.2.0/24 203.0.113.%d/32", n.Add(1))
+	}))
+	defer srv.Close()
+	s := newTestRange(srv.URL)
+	add := parsePrefixes(t, "198.51.100.0/24")
+
+	var done atomic.Bool
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for !done.Load() {
+			s.setOverride(add, nil, 0)
+			s.clearOverride()
+		}
+	}()
+	for range 20 {
+		if err := s.refresh(); err != nil {
+			t.Error(err)
+			break
+		}
+	}
+	done.Store(true)
+	wg.Wait()
+
+	last := netip.PrefixFrom(netip.AddrFrom4([4]byte{203, 0, 113, byte(n.Load())}), 32)
+	if got := s.GetIPRanges(nil); !slices.Contains(got, last) {
+		t.Errorf("expected the latest fetch %v applied, got %v", last, got)
+	}
+}
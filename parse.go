@@ -0,0 +1,179 @@
+package caddy_wedos_ip
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// parseRanges parses whitespace-separated CIDRs (or bare addresses) from r.
+// IPv6 zone identifiers are stripped, as they are meaningless for prefix
+// matching. Errors name the 1-based index and text of the offending token.
+func parseRanges(r io.Reader) ([]netip.Prefix, error) {
+	scanner := newScanner(r)
+	// WEDOS ips.txt can be space-separated, so scan tokens instead of lines.
+	scanner.Split(bufio.ScanWords)
+
+	var prefixes []netip.Prefix
+	for n := 1; scanner.Scan(); n++ {
+		tok := scanner.Text()
+		prefix, err := caddyhttp.CIDRExpressionToPrefix(stripZone(tok))
+		if err != nil {
+			return nil, fmt.Errorf("token %d %q: %w", n, tok, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, scanErr(err)
+	}
+	return prefixes, nil
+}
+
+// parseLabeledRanges parses one CIDR (or bare address) per line, each
+// optionally followed by a label such as "192.0.2.0/24 datacenter-prague".
+// Labels are ignored and blank lines are skipped. Errors name the 1-based
+// line number and the offending text.
+func parseLabeledRanges(r io.Reader) ([]netip.Prefix, error) {
+	entries, err := parseLabeledEntries(r)
+	if err != nil {
+		return nil, err
+	}
+	prefixes := make([]netip.Prefix, len(entries))
+	for i, e := range entries {
+		prefixes[i] = e.prefix
+	}
+	return prefixes, nil
+}
+
+// labeledEntry is a prefix of a labeled list with the fields following it.
+type labeledEntry struct {
+	prefix netip.Prefix
+	labels []string
+}
+
+// parseLabeledEntries parses a labeled list like parseLabeledRanges, but
+// keeps the labels of each prefix.
+func parseLabeledEntries(r io.Reader) ([]labeledEntry, error) {
+	scanner := newScanner(r)
+	scanner.Split(bufio.ScanLines)
+
+	var entries []labeledEntry
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		prefix, err := caddyhttp.CIDRExpressionToPrefix(stripZone(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d %q: %w", n, fields[0], err)
+		}
+		entries = append(entries, labeledEntry{prefix: prefix, labels: fields[1:]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, scanErr(err)
+	}
+	return entries, nil
+}
+
+// parseFormat parses r with the parser registered for format. Without a
+// format, or with "auto" where nothing else picked one, r is parsed as text.
+func parseFormat(format string, r io.Reader) ([]netip.Prefix, error) {
+	if format == "" || format == formatAuto {
+		format = formatText
+	}
+	p, ok := lookupRangeParser(format)
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	return p.Parse(r)
+}
+
+// stripZone removes an IPv6 zone identifier, e.g. "fe80::1%eth0/64"
+// becomes "fe80::1/64".
+func stripZone(tok string) string {
+	pct := strings.IndexByte(tok, '%')
+	if pct < 0 {
+		return tok
+	}
+	if slash := strings.IndexByte(tok[pct:], '/'); slash >= 0 {
+		return tok[:pct] + tok[pct+slash:]
+	}
+	return tok[:pct]
+}
+
+// List formats accepted by the format option.
+const (
+	formatAuto = "auto"
+	formatText = "text"
+	formatJSON = "json"
+	// formatLabeled is one CIDR per line, optionally followed by a label.
+	formatLabeled = "labeled"
+)
+
+// detectFormat picks the list format for a response: an explicit format
+// wins, otherwise a .json URL path or a JSON Content-Type selects JSON and
+// anything else is parsed as text.
+func detectFormat(format string, resp *http.Response) string {
+	if format != "" && format != formatAuto {
+		return format
+	}
+	if resp.Request != nil && strings.HasSuffix(resp.Request.URL.Path, ".json") {
+		return formatJSON
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		return formatJSON
+	}
+	return formatText
+}
+
+// parseJSONRanges parses a JSON array of CIDR strings, or an object whose
+// array-valued fields hold CIDR strings, e.g. {"ipv4": [...], "ipv6": [...]}.
+// Object fields are read in key order; other fields are ignored.
+func parseJSONRanges(r io.Reader) ([]netip.Prefix, error) {
+	var doc any
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decoding JSON: %w", err)
+	}
+
+	var lists [][]any
+	switch v := doc.(type) {
+	case []any:
+		lists = append(lists, v)
+	case map[string]any:
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			if list, ok := v[key].([]any); ok {
+				lists = append(lists, list)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("expected a JSON array or object, got %T", doc)
+	}
+
+	var prefixes []netip.Prefix
+	n := 0
+	for _, list := range lists {
+		for _, item := range list {
+			n++
+			str, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("entry %d: expected a string, got %T", n, item)
+			}
+			prefix, err := caddyhttp.CIDRExpressionToPrefix(stripZone(strings.TrimSpace(str)))
+			if err != nil {
+				return nil, fmt.Errorf("entry %d %q: %w", n, str, err)
+			}
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes, nil
+}
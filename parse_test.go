@@ -0,0 +1,171 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestParseRanges(t *testing.T) {
+	got, err := parseRanges(strings.NewReader("192.0.2.0/24 198.51.100.1\n2001:db8::/32\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := parsePrefixes(t, "192.0.2.0/24", "198.51.100.1/32", "2001:db8::/32")
+	if !slices.Equal(got, want) {
+		t.Errorf("parseRanges() = %v, want %v", got, want)
+	}
+}
+
+func TestParseRangesErrorContext(t *testing.T) {
+	_, err := parseRanges(strings.NewReader("192.0.2.0/24\n198.51.100.0/24 1.2.3.999/24\n"))
+	if err == nil {
+		t.Fatal("expected an error for an invalid token")
+	}
+	if want := `token 3 "1.2.3.999/24"`; !strings.Contains(err.Error(), want) {
+		t.Errorf("error %q does not contain %q", err, want)
+	}
+}
+
+func TestParseRangesZone(t *testing.T) {
+	got, err := parseRanges(strings.NewReader("fe80::1%eth0/64 fe80::2%25 2001:db8::/32"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := parsePrefixes(t, "fe80::1/64", "fe80::2/128", "2001:db8::/32")
+	if !slices.Equal(got, want) {
+		t.Errorf("parseRanges() = %v, want %v", got, want)
+	}
+}
+
+func TestParseLabeledRanges(t *testing.T) {
+	body := "192.0.2.0/24 datacenter-prague\n\n198.51.100.1\n2001:db8::/32   office ipv6 \n"
+	got, err := parseLabeledRanges(strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := parsePrefixes(t, "192.0.2.0/24", "198.51.100.1/32", "2001:db8::/32")
+	if !slices.Equal(got, want) {
+		t.Errorf("parseLabeledRanges() = %v, want %v", got, want)
+	}
+
+	_, err = parseLabeledRanges(strings.NewReader("192.0.2.0/24 a\ndatacenter-brno 198.51.100.0/24\n"))
+	if want := `line 2 "datacenter-brno"`; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("error %v does not contain %q", err, want)
+	}
+
+	// The text format reads every token as a prefix, so labels fail it.
+	if _, err := parseFormat(formatText, strings.NewReader(body)); err == nil {
+		t.Errorf("expected labels to be rejected by the text format")
+	}
+}
+
+func TestParseJSONRanges(t *testing.T) {
+	for _, body := range []string{
+		`["192.0.2.0/24", "2001:db8::/32"]`,
+		`{"ipv6": ["2001:db8::/32"], "ipv4": ["192.0.2.0/24"], "updated": "2025-01-01"}`,
+	} {
+		got, err := parseJSONRanges(strings.NewReader(body))
+		if err != nil {
+			t.Errorf("parseJSONRanges(%s) error: %v", body, err)
+			continue
+		}
+		want := parsePrefixes(t, "192.0.2.0/24", "2001:db8::/32")
+		if !slices.Equal(got, want) {
+			t.Errorf("parseJSONRanges(%s) = %v, want %v", body, got, want)
+		}
+	}
+
+	for _, body := range []string{`"192.0.2.0/24"`, `[1]`, `["bogus"]`, `[`} {
+		if _, err := parseJSONRanges(strings.NewReader(body)); err == nil {
+			t.Errorf("parseJSONRanges(%s): expected error", body)
+		}
+	}
+}
+
+func TestFormatDetection(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ips.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(`["192.0.2.0/24"]`))
+	})
+	mux.HandleFunc("/ips.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("192.0.2.0/24\n"))
+	})
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`{"prefixes": ["192.0.2.0/24"]}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		path, format string
+		wantErr      bool
+	}{
+		{path: "/ips.json"},
+		{path: "/ips.txt"},
+		{path: "/api"},
+		{path: "/ips.txt", format: formatJSON, wantErr: true},
+		{path: "/api", format: formatText, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		s := WedosIPRange{Format: tt.format, client: srv.Client(), ctx: caddy.Context{Context: context.Background()}}
+		got, err := s.fetch(srv.URL + tt.path)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("fetch(%s) with format %q: expected error", tt.path, tt.format)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("fetch(%s) error: %v", tt.path, err)
+			continue
+		}
+		if len(got) != 1 || got[0].String() != "192.0.2.0/24" {
+			t.Errorf("fetch(%s) = %v", tt.path, got)
+		}
+	}
+}
+
+func FuzzParseRanges(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		"192.0.2.0/24 198.51.100.0/24\n2001:db8::/32",
+		"192.0.2.1\t\r\n  2001:db8::1",
+		"fe80::1%eth0/64 fe80::1%25eth0",
+		"# comment\n192.0.2.0/24",
+		"192.0.2.0/24,198.51.100.0/24",
+		"192.0.2.0/33 ::/129 192.0.2.0/-1 192.0.2.0/",
+		"192.0.2.300/24 ::ffff:192.0.2.1/120",
+		"192.0.2.0/2",
+		"\x00\xff\xfe",
+		strings.Repeat("1", 70_000),
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, in string) {
+		prefixes, err := parseRanges(strings.NewReader(in))
+		if err != nil {
+			if prefixes != nil {
+				t.Errorf("got prefixes %v with error %v", prefixes, err)
+			}
+			return
+		}
+		if n := len(strings.Fields(in)); len(prefixes) != n {
+			t.Errorf("got %d prefixes from %d tokens", len(prefixes), n)
+		}
+		for _, p := range prefixes {
+			if !p.IsValid() {
+				t.Errorf("got invalid prefix %v from %q", p, in)
+			}
+		}
+	})
+}
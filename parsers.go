@@ -0,0 +1,58 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"io"
+	"net/netip"
+	"sync"
+)
+
+// RangeParser parses a fetched list into prefixes. Parsers are selected
+// by name with the format option.
+type RangeParser interface {
+	Parse(r io.Reader) ([]netip.Prefix, error)
+}
+
+// RangeParserFunc adapts a function to a RangeParser.
+type RangeParserFunc func(r io.Reader) ([]netip.Prefix, error)
+
+// Parse calls f(r).
+func (f RangeParserFunc) Parse(r io.Reader) ([]netip.Prefix, error) {
+	return f(r)
+}
+
+var (
+	rangeParsers = map[string]RangeParser{
+		formatText:    RangeParserFunc(parseRanges),
+		formatJSON:    RangeParserFunc(parseJSONRanges),
+		formatLabeled: RangeParserFunc(parseLabeledRanges),
+		formatRange:   RangeParserFunc(parseRangeList),
+	}
+	rangeParsersLock sync.RWMutex
+)
+
+// RegisterRangeParser makes p available as format name. It is meant to be
+// called from init functions, and panics if name is empty, "auto" or
+// already registered, like caddy.RegisterModule.
+func RegisterRangeParser(name string, p RangeParser) {
+	if name == "" || name == formatAuto {
+		panic(fmt.Sprintf("range parser name %q is reserved", name))
+	}
+	if p == nil {
+		panic("range parser must not be nil")
+	}
+	rangeParsersLock.Lock()
+	defer rangeParsersLock.Unlock()
+	if _, ok := rangeParsers[name]; ok {
+		panic(fmt.Sprintf("range parser already registered: %s", name))
+	}
+	rangeParsers[name] = p
+}
+
+// lookupRangeParser returns the parser registered as name.
+func lookupRangeParser(name string) (RangeParser, bool) {
+	rangeParsersLock.RLock()
+	defer rangeParsersLock.RUnlock()
+	p, ok := rangeParsers[name]
+	return p, ok
+}
@@ -0,0 +1,66 @@
+package caddy_wedos_ip
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// parseCSVRanges parses "prefix,comment" lines, as an example of a
+// proprietary format.
+func parseCSVRanges(r io.Reader) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		field, _, _ := strings.Cut(scanner.Text(), ",")
+		p, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, p)
+	}
+	return prefixes, scanner.Err()
+}
+
+func TestRegisterRangeParser(t *testing.T) {
+	RegisterRangeParser("test_csv", RangeParserFunc(parseCSVRanges))
+	defer func() {
+		rangeParsersLock.Lock()
+		delete(rangeParsers, "test_csv")
+		rangeParsersLock.Unlock()
+	}()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("192.0.2.0/24,prague\n2001:db8::/32,brno\n"))
+	}))
+	defer srv.Close()
+
+	s := newTestRange(srv.URL)
+	s.Format = "test_csv"
+	if err := s.refresh(); err != nil {
+		t.Fatalf("refresh error: %v", err)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24", "2001:db8::/32"); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, name := range []string{"", formatAuto, formatText, "test_csv"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterRangeParser(%q): expected a panic", name)
+				}
+			}()
+			RegisterRangeParser(name, RangeParserFunc(parseCSVRanges))
+		}()
+	}
+
+	if _, err := parseFormat("bogus", strings.NewReader("")); err == nil {
+		t.Error("expected an unregistered format to be rejected")
+	}
+}
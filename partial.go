@@ -0,0 +1,164 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// goodSource holds the last prefixes a source was fetched with, and when.
+// Their labels and expiries are kept too, so Region, Tiers and EntryTTL
+// treat them as when they were fetched.
+type goodSource struct {
+	prefixes []netip.Prefix
+	labels   map[netip.Prefix][]string
+	expiries map[netip.Prefix]time.Time
+	fetched  time.Time
+}
+
+// partialError reports a refresh applied with the last good prefixes of
+// failed sources, see PartialFallback. It doesn't fail the refresh, but is
+// recorded like an error of class errClassPartial. Err, the error of the
+// first failed source, is not unwrapped, so tolerate_status and the other
+// classes don't hide the degraded set.
+type partialError struct {
+	Sources []string
+	Err     error
+	// Since is when the oldest of the prefixes used instead was fetched.
+	Since time.Time
+}
+
+func (e *partialError) Error() string {
+	return fmt.Sprintf("serving the last good prefixes of %s: %v", strings.Join(e.Sources, ", "), e.Err)
+}
+
+// partialSources tracks the sources of one multi-source fetch. With
+// PartialFallback, a failed source contributes its last good prefixes, so
+// a transient failure doesn't shrink the merged set, as long as another
+// source succeeded and the prefixes are no older than MaxAge, or
+// CacheMaxAge without one.
+type partialSources struct {
+	s         *WedosIPRange
+	sources   int
+	fallbacks int
+	firstErr  error
+	degraded  []string
+	since     time.Time
+}
+
+// fallbackMaxAge returns how old the last good prefixes of a failed source
+// may be to stand in for it, zero for no limit.
+func (s *WedosIPRange) fallbackMaxAge() time.Duration {
+	if s.MaxAge > 0 {
+		return time.Duration(s.MaxAge)
+	}
+	return time.Duration(s.CacheMaxAge)
+}
+
+// done returns the prefixes source name contributes given the result of
+// its fetch, recording them as its last good ones on success.
+func (ps *partialSources) done(name string, prefixes []netip.Prefix, err error) ([]netip.Prefix, error) {
+	s := ps.s
+	ps.sources++
+	if err == nil {
+		if s.PartialFallback {
+			if s.lastGood == nil {
+				s.lastGood = make(map[string]goodSource)
+			}
+			s.lastGood[name] = s.goodSource(prefixes)
+		}
+		return prefixes, nil
+	}
+	last, ok := s.lastGood[name]
+	if !s.PartialFallback || !ok {
+		return nil, err
+	}
+	age := ageAt(s.now(), last.fetched)
+	if maxAge := s.fallbackMaxAge(); maxAge > 0 && age > maxAge {
+		return nil, fmt.Errorf("%w; its last good prefixes are %v old", err, age.Round(time.Second))
+	}
+	ps.fallbacks++
+	if ps.firstErr == nil {
+		ps.firstErr = err
+	}
+	ps.degraded = append(ps.degraded, redactURL(name))
+	if ps.since.IsZero() || last.fetched.Before(ps.since) {
+		ps.since = last.fetched
+	}
+	s.logger.Warn("WEDOS IP source failed, using its last good prefixes",
+		zap.String("source", redactURL(name)),
+		zap.Int("count", len(last.prefixes)),
+		zap.Duration("age", age),
+		zap.Error(err))
+	s.restoreGood(last)
+	return slices.Clone(last.prefixes), nil
+}
+
+// goodSource returns prefixes, just fetched, with their labels and
+// expiries as recorded by parseSourceList.
+func (s *WedosIPRange) goodSource(prefixes []netip.Prefix) goodSource {
+	good := goodSource{prefixes: slices.Clone(prefixes), fetched: s.now()}
+	for _, p := range prefixes {
+		if labels, ok := s.labels[p]; ok {
+			if good.labels == nil {
+				good.labels = make(map[netip.Prefix][]string)
+			}
+			good.labels[p] = slices.Clone(labels)
+		}
+		if expires, ok := s.pendingExpiries[p]; ok {
+			if good.expiries == nil {
+				good.expiries = make(map[netip.Prefix]time.Time)
+			}
+			good.expiries[p] = expires
+		}
+	}
+	return good
+}
+
+// restoreGood adds the labels and expiries of the last good prefixes of a
+// failed source to those of the running refresh cycle.
+func (s *WedosIPRange) restoreGood(good goodSource) {
+	if len(good.labels) > 0 && s.labels == nil {
+		s.labels = make(map[netip.Prefix][]string)
+	}
+	for p, labels := range good.labels {
+		s.labels[p] = append(s.labels[p], labels...)
+	}
+	if len(good.expiries) > 0 && s.pendingExpiries == nil {
+		s.pendingExpiries = make(map[netip.Prefix]time.Time)
+	}
+	for p, expires := range good.expiries {
+		s.notePendingExpiry(p, expires)
+	}
+}
+
+// err returns the error of the first failed source if every source fell
+// back: nothing was fetched, so the cycle fails as without fallbacks.
+func (ps *partialSources) err() error {
+	if ps.fallbacks > 0 && ps.fallbacks == ps.sources {
+		return ps.firstErr
+	}
+	return nil
+}
+
+// partial returns the partialError of a fetch some sources of fell back,
+// or nil.
+func (ps *partialSources) partial() *partialError {
+	if ps.fallbacks == 0 {
+		return nil
+	}
+	return &partialError{Sources: ps.degraded, Err: ps.firstErr, Since: ps.since}
+}
+
+// degradedSources returns the sources of the applied list that fell back
+// to their last good prefixes. The caller must hold s.lock.
+func (s *WedosIPRange) degradedSources() []string {
+	if s.partial == nil {
+		return nil
+	}
+	return s.partial.Sources
+}
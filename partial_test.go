@@ -0,0 +1,172 @@
+package caddy_wedos_ip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestPartialFallback(t *testing.T) {
+	var fail4, fail6 atomic.Bool
+	mux := http.NewServeMux()
+	serve := func(fail *atomic.Bool, body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if fail.Load() {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Write([]byte(body))
+		}
+	}
+	mux.HandleFunc("/ips4.txt", serve(&fail4, "192.0.2.0/24"))
+	mux.HandleFunc("/ips6.txt", serve(&fail6, "2001:db8::/32"))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for _, fallback := range []bool{false, true} {
+		fail4.Store(false)
+		fail6.Store(false)
+		s := newTestRange("")
+		s.URLv4 = srv.URL + "/ips4.txt"
+		s.URLv6 = srv.URL + "/ips6.txt"
+		s.PartialFallback = fallback
+		if err := s.refresh(); err != nil {
+			t.Fatal(err)
+		}
+		want := parsePrefixes(t, "192.0.2.0/24", "2001:db8::/32")
+
+		fail6.Store(true)
+		err := s.refresh()
+		if !fallback {
+			if err == nil {
+				t.Error("expected a failed source to fail the refresh without partial_fallback")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("expected the last good IPv6 prefixes to be used, got %v", err)
+		}
+		if got := s.GetIPRanges(nil); !slices.Equal(got, want) {
+			t.Errorf("expected the merged set to stay %v, got %v", want, got)
+		}
+		// The degraded refresh is recorded like a failure.
+		s.recordRefresh(nil)
+		st := s.status()
+		if st.ConsecutiveFailures != 1 || st.LastErrorClass != errClassPartial {
+			t.Errorf("expected a partial failure recorded, got %d failures of class %q", st.ConsecutiveFailures, st.LastErrorClass)
+		}
+		if !slices.Equal(st.DegradedSources, []string{s.URLv6}) {
+			t.Errorf("expected the IPv6 source degraded, got %v", st.DegradedSources)
+		}
+
+		// With every source failing, nothing was fetched.
+		fail4.Store(true)
+		if err := s.refresh(); err == nil {
+			t.Error("expected the refresh to fail when every source fails")
+		}
+	}
+}
+
+func TestPartialFallbackMaxAge(t *testing.T) {
+	var fail6 atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ips4.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("192.0.2.0/24"))
+	})
+	mux.HandleFunc("/ips6.txt", func(w http.ResponseWriter, r *http.Request) {
+		if fail6.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("2001:db8::/32"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	now := time.Now()
+	s := newTestRange("")
+	s.clock = func() time.Time { return now }
+	s.URLv4 = srv.URL + "/ips4.txt"
+	s.URLv6 = srv.URL + "/ips6.txt"
+	s.PartialFallback = true
+	s.MaxAge = caddy.Duration(time.Hour)
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	fail6.Store(true)
+	now = now.Add(30 * time.Minute)
+	if err := s.refresh(); err != nil {
+		t.Fatalf("expected the last good IPv6 prefixes to be used, got %v", err)
+	}
+	s.lock.RLock()
+	ratio := s.freshnessRatio(now)
+	s.lock.RUnlock()
+	if ratio > 0.51 {
+		t.Errorf("expected the freshness to follow the fallback's age, got %v", ratio)
+	}
+
+	// Past max_age the fallback no longer stands in for the source.
+	now = now.Add(time.Hour)
+	if err := s.refresh(); err == nil {
+		t.Error("expected the refresh to fail once the last good prefixes are older than max_age")
+	}
+}
+
+func TestPartialFallbackLabels(t *testing.T) {
+	var fail6 atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ips4.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("192.0.2.0/24 eu direct"))
+	})
+	mux.HandleFunc("/ips6.txt", func(w http.ResponseWriter, r *http.Request) {
+		if fail6.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("2001:db8::/32 eu proxy ttl=1h"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	s := newTestRange("")
+	s.URLv4 = srv.URL + "/ips4.txt"
+	s.URLv6 = srv.URL + "/ips6.txt"
+	s.Format = formatLabeled
+	s.Region = []string{"eu"}
+	s.Tiers = true
+	s.EntryTTL = true
+	s.PartialFallback = true
+	if err := s.checkEntryTTL(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	s.lock.RLock()
+	expires := s.expiries[netip.MustParsePrefix("2001:db8::/32")]
+	s.lock.RUnlock()
+
+	// The last good IPv6 prefix keeps its region, tier and expiry.
+	fail6.Store(true)
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24", "2001:db8::/32"); !slices.Equal(got, want) {
+		t.Errorf("expected %v kept in the region, got %v", want, got)
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if want := parsePrefixes(t, "2001:db8::/32"); !slices.Equal(s.proxyRanges, want) {
+		t.Errorf("expected the proxy tier %v, got %v", want, s.proxyRanges)
+	}
+	if got := s.expiries[netip.MustParsePrefix("2001:db8::/32")]; expires.IsZero() || !got.Equal(expires) {
+		t.Errorf("expected the expiry %v kept, got %v", expires, got)
+	}
+}
@@ -0,0 +1,72 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// privateRanges are the ranges added by IncludePrivate: RFC 1918 private,
+// loopback and link-local IPv4, and unique local, loopback and link-local
+// IPv6.
+const privateRanges = "10.0.0.0/8 172.16.0.0/12 192.168.0.0/16 127.0.0.0/8 169.254.0.0/16 fc00::/7 ::1/128 fe80::/10"
+
+// parseCIDRList parses the CIDRs of a list option such as Pinned, named
+// option in errors.
+func parseCIDRList(option string, exprs []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, expr := range exprs {
+		prefix, err := caddyhttp.CIDRExpressionToPrefix(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", option, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// provisionPinned parses Pinned and RangesJSON, adding privateRanges with
+// IncludePrivate.
+func (s *WedosIPRange) provisionPinned() error {
+	pinned, err := parseCIDRList("pinned", s.Pinned)
+	if err != nil {
+		return err
+	}
+	extra, err := parseCIDRList("ranges_json", s.RangesJSON)
+	if err != nil {
+		return err
+	}
+	if s.IncludePrivate {
+		private, err := parseCIDRList("include_private", strings.Fields(privateRanges))
+		if err != nil {
+			return err
+		}
+		extra = append(extra, private...)
+	}
+	for _, p := range extra {
+		if !slices.Contains(pinned, p) {
+			pinned = append(pinned, p)
+		}
+	}
+	s.pinned = pinned
+	return nil
+}
+
+// withPinned returns prefixes with the pinned ranges appended, so that
+// they are trusted whatever the upstream list contains. Pinned ranges
+// already present are not duplicated.
+func (s *WedosIPRange) withPinned(prefixes []netip.Prefix) []netip.Prefix {
+	if len(s.pinned) == 0 {
+		return prefixes
+	}
+	out := slices.Clip(prefixes)
+	for _, p := range s.pinned {
+		if !slices.Contains(prefixes, p) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
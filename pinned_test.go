@@ -0,0 +1,117 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func TestPinned(t *testing.T) {
+	body := "198.51.100.0/24"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{
+		URL:      srv.URL,
+		Interval: caddy.Duration(time.Hour),
+		Pinned:   []string{"203.0.113.0/24", "198.51.100.0/24"},
+	}
+	if err := r.Provision(ctx); err != nil {
+		t.Fatalf("provision error: %v", err)
+	}
+	defer r.Cleanup()
+
+	// Pinned ranges are trusted before the first fetch completes.
+	if _, ok := r.IsTrusted(netip.MustParseAddr("203.0.113.1")); !ok {
+		t.Errorf("pinned range not trusted before the first fetch")
+	}
+
+	waitFor(t, func() bool { return !r.status().LastRefresh.IsZero() })
+	expected := parsePrefixes(t, "198.51.100.0/24", "203.0.113.0/24")
+	if got := r.GetIPRanges(nil); !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// An upstream list without the pinned ranges cannot remove them.
+	body = "192.0.2.0/24"
+	if err := r.refresh(); err != nil {
+		t.Fatalf("refresh error: %v", err)
+	}
+	expected = parsePrefixes(t, "192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/24")
+	if got := r.GetIPRanges(nil); !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	if st := r.status(); !slices.Equal(st.Pinned, r.Pinned) {
+		t.Errorf("status does not list pinned ranges: %v", st.Pinned)
+	}
+}
+
+func TestIncludePrivate(t *testing.T) {
+	r := WedosIPRange{Pinned: []string{"10.0.0.0/8", "203.0.113.0/24"}, IncludePrivate: true}
+	if err := r.provisionPinned(); err != nil {
+		t.Fatal(err)
+	}
+	// The pinned 10.0.0.0/8 is not duplicated.
+	want := parsePrefixes(t, "10.0.0.0/8", "203.0.113.0/24", "172.16.0.0/12", "192.168.0.0/16", "127.0.0.0/8", "169.254.0.0/16", "fc00::/7", "::1/128", "fe80::/10")
+	if !slices.Equal(r.pinned, want) {
+		t.Errorf("expected %v, got %v", want, r.pinned)
+	}
+	for _, addr := range []string{"10.1.2.3", "172.31.255.255", "192.168.1.1", "127.0.0.1", "169.254.169.254", "fd00::1", "::1", "fe80::1"} {
+		if !slices.ContainsFunc(r.pinned, func(p netip.Prefix) bool { return p.Contains(netip.MustParseAddr(addr)) }) {
+			t.Errorf("expected %s to be covered", addr)
+		}
+	}
+	if slices.ContainsFunc(r.pinned, func(p netip.Prefix) bool { return p.Contains(netip.MustParseAddr("172.32.0.1")) }) {
+		t.Error("expected 172.32.0.1 not to be covered")
+	}
+}
+
+func TestPinnedInvalid(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{Pinned: []string{"not-a-cidr"}}
+	if err := r.Provision(ctx); err == nil {
+		t.Errorf("expected an error for an invalid pinned range")
+	}
+}
+
+func TestRangesJSON(t *testing.T) {
+	var fromJSON WedosIPRange
+	if err := json.Unmarshal([]byte(`{"pinned": ["203.0.113.0/24"], "ranges_json": ["198.51.100.0/24", "203.0.113.0/24"]}`), &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	var fromCaddyfile WedosIPRange
+	if err := fromCaddyfile.UnmarshalCaddyfile(caddyfile.NewTestDispenser("wedos {\n\tpinned 203.0.113.0/24 198.51.100.0/24\n}")); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []*WedosIPRange{&fromJSON, &fromCaddyfile} {
+		if err := r.provisionPinned(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Both paths pin the same ranges, once each.
+	if !slices.Equal(fromJSON.pinned, fromCaddyfile.pinned) {
+		t.Errorf("expected %v from JSON, got %v", fromCaddyfile.pinned, fromJSON.pinned)
+	}
+
+	r := WedosIPRange{RangesJSON: []string{"not-a-cidr"}}
+	if err := r.provisionPinned(); err == nil || !strings.Contains(err.Error(), "ranges_json") {
+		t.Errorf("expected an error naming ranges_json, got %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+package caddy_wedos_ip
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(WedosVars{})
+	httpcaddyfile.RegisterHandlerDirective("wedos_vars", parseWedosVars)
+	httpcaddyfile.RegisterDirectiveOrder("wedos_vars", httpcaddyfile.Before, "map")
+}
+
+// WedosVars is an HTTP handler that sets the {http.wedos.ranges_count},
+// {http.wedos.last_refresh} and {http.wedos.version} placeholders for the
+// rest of the route, e.g. for response headers or access logs. They report
+// the state of the module selected by Source, as under "sources" in the
+// wedos_ip_ranges expvar. Without Source while modules with several
+// sources are provisioned, they report the process-wide state at the top
+// of the expvar, and a warning is logged.
+type WedosVars struct {
+	// DebugHeader adds an X-Wedos-Ranges response header with the range
+	// count, the age of the last refresh and the last refresh error.
+	// Debug only: it discloses internal state to every client.
+	DebugHeader bool `json:"debug_header,omitempty"`
+	// VersionHeader adds an X-Wedos-Version response header with the
+	// content hash of the ranges, which changes only when the set does,
+	// so downstreams caching trust decisions know when to drop them.
+	VersionHeader bool `json:"version_header,omitempty"`
+	// Source selects the module the placeholders and headers report, like
+	// WedosList.Source. It may be omitted if only one module is
+	// provisioned.
+	Source string `json:"source,omitempty"`
+
+	logger *zap.Logger
+	// Whether the module lookup failing was logged, so it is only once.
+	warned *atomic.Bool
+}
+
+// CaddyModule returns the Caddy module information.
+func (WedosVars) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.wedos_vars",
+		New: func() caddy.Module { return new(WedosVars) },
+	}
+}
+
+// Provision warns if the debug header is enabled.
+func (v *WedosVars) Provision(ctx caddy.Context) error {
+	v.logger = ctx.Logger()
+	v.warned = new(atomic.Bool)
+	if v.DebugHeader {
+		ctx.Logger().Warn("debug_header is enabled: WEDOS range state is disclosed to every client; do not use in production")
+	}
+	return nil
+}
+
+// ServeHTTP implements caddyhttp.MiddlewareHandler.
+func (v WedosVars) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	state := sync.OnceValue(v.state)
+	repl := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+	repl.Map(func(key string) (any, bool) {
+		switch key {
+		case "http.wedos.ranges_count":
+			return state().Count, true
+		case "http.wedos.last_refresh":
+			return state().LastRefresh, true
+		case "http.wedos.version":
+			return state().Hash, true
+		}
+		return nil, false
+	})
+	if v.DebugHeader {
+		w.Header().Set("X-Wedos-Ranges", debugHeaderValue(state(), time.Now()))
+	}
+	if v.VersionHeader {
+		if hash := state().Hash; hash != "" {
+			w.Header().Set("X-Wedos-Version", hash)
+		}
+	}
+	return next.ServeHTTP(w, r)
+}
+
+// state returns the state of the module selected by Source, zero if there
+// is none, or the process-wide one if Source is needed to choose.
+func (v WedosVars) state() moduleVars {
+	s, err := findModule(v.Source)
+	if err == nil {
+		return s.vars()
+	}
+	if v.warned != nil && v.warned.CompareAndSwap(false, true) {
+		v.logger.Warn("wedos_vars cannot select a module, set source", zap.Error(err))
+	}
+	if errors.Is(err, errAmbiguousModule) {
+		return globalVars()
+	}
+	return moduleVars{}
+}
+
+// debugHeaderValue formats the X-Wedos-Ranges header, e.g.
+// `12; age=30` or `12; age=3600; error="unexpected response status 503"`.
+func debugHeaderValue(vars moduleVars, now time.Time) string {
+	value := strconv.Itoa(vars.Count)
+	if last, err := time.Parse(time.RFC3339, vars.LastRefresh); err == nil {
+		value += "; age=" + strconv.Itoa(int(ageAt(now, last).Seconds()))
+	}
+	if vars.LastError != "" {
+		value += "; error=" + strconv.Quote(vars.LastError)
+	}
+	return value
+}
+
+// UnmarshalCaddyfile implements caddyfile.Unmarshaler.
+//
+//	wedos_vars {
+//	   debug_header
+//	   version_header
+//	   source <url>
+//	}
+func (v *WedosVars) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next() // consume directive name
+	if d.NextArg() {
+		return d.ArgErr()
+	}
+	for d.NextBlock(0) {
+		switch d.Val() {
+		case "debug_header":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			v.DebugHeader = true
+		case "version_header":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			v.VersionHeader = true
+		case "source":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			v.Source = d.Val()
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+		default:
+			return d.Errf("unrecognized wedos_vars option %q", d.Val())
+		}
+	}
+	return nil
+}
+
+func parseWedosVars(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	v := new(WedosVars)
+	err := v.UnmarshalCaddyfile(h.Dispenser)
+	return v, err
+}
@@ -0,0 +1,166 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestWedosVarsPlaceholders(t *testing.T) {
+	refreshed := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	s := newTestRange("https://example.com/ips.txt")
+	s.setRanges(parsePrefixes(t, "192.0.2.0/24", "198.51.100.0/24"), refreshed)
+	// Refreshed later, but not the module selected.
+	other := newTestRange("https://example.com/other.txt")
+	other.setRanges(parsePrefixes(t, "203.0.113.0/24"), time.Now())
+	withInstances(t, s, other)
+
+	repl := caddy.NewReplacer()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), caddy.ReplacerCtxKey, repl))
+
+	var count, last string
+	next := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		count = repl.ReplaceAll("{http.wedos.ranges_count}", "")
+		last = repl.ReplaceAll("{http.wedos.last_refresh}", "")
+		return nil
+	})
+	if err := (WedosVars{Source: s.URL}).ServeHTTP(httptest.NewRecorder(), req, next); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if count != "2" {
+		t.Errorf("expected ranges_count 2, got %q", count)
+	}
+	if last != "2025-06-01T12:00:00Z" {
+		t.Errorf("unexpected last_refresh %q", last)
+	}
+}
+
+func TestWedosVarsUnmarshal(t *testing.T) {
+	var v WedosVars
+	if err := v.UnmarshalCaddyfile(caddyfile.NewTestDispenser("wedos_vars")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := v.UnmarshalCaddyfile(caddyfile.NewTestDispenser("wedos_vars extra")); err == nil {
+		t.Errorf("expected an error for an argument")
+	}
+	if err := v.UnmarshalCaddyfile(caddyfile.NewTestDispenser("wedos_vars {\n\tsource https://ips.wedos.global/ips.txt\n}")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if v.Source != "https://ips.wedos.global/ips.txt" {
+		t.Errorf("incorrect source: got %q", v.Source)
+	}
+	if err := v.UnmarshalCaddyfile(caddyfile.NewTestDispenser("wedos_vars {\n\tsource\n}")); err == nil {
+		t.Errorf("expected an error for source without an argument")
+	}
+}
+
+func TestWedosVarsDebugHeader(t *testing.T) {
+	var v WedosVars
+	if err := v.UnmarshalCaddyfile(caddyfile.NewTestDispenser("wedos_vars {\n\tdebug_header\n}")); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if !v.DebugHeader {
+		t.Fatalf("expected debug_header to be enabled")
+	}
+
+	now := time.Now()
+	vars := moduleVars{
+		Count:       7,
+		LastRefresh: now.Add(-90 * time.Second).UTC().Format(time.RFC3339),
+		LastError:   "unexpected response status 503 Service Unavailable",
+	}
+	if got, want := debugHeaderValue(vars, now), `7; age=90; error="unexpected response status 503 Service Unavailable"`; got != want {
+		t.Errorf("debugHeaderValue() = %q, want %q", got, want)
+	}
+
+	s := newTestRange("https://example.com/ips.txt")
+	s.setRanges(parsePrefixes(t, "192.0.2.0/24"), now)
+	withInstances(t, s)
+
+	repl := caddy.NewReplacer()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), caddy.ReplacerCtxKey, repl))
+	rec := httptest.NewRecorder()
+	next := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error { return nil })
+	if err := v.ServeHTTP(rec, req, next); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if got := rec.Header().Get("X-Wedos-Ranges"); !strings.HasPrefix(got, "1; age=") {
+		t.Errorf("expected an X-Wedos-Ranges header for the module, got %q", got)
+	}
+
+	rec = httptest.NewRecorder()
+	if err := (WedosVars{}).ServeHTTP(rec, req, next); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if rec.Header().Get("X-Wedos-Ranges") != "" {
+		t.Errorf("expected no debug header by default")
+	}
+}
+
+func TestWedosVarsVersionHeader(t *testing.T) {
+	var v WedosVars
+	if err := v.UnmarshalCaddyfile(caddyfile.NewTestDispenser("wedos_vars {\n\tversion_header\n}")); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+	if !v.VersionHeader {
+		t.Fatalf("expected version_header to be enabled")
+	}
+
+	s := newTestRange("https://example.com/ips.txt")
+	s.setRanges(parsePrefixes(t, "192.0.2.0/24"), time.Now())
+	want := contentHash(s.GetIPRanges(nil))
+	// Another module refreshed later doesn't change the version of s.
+	other := newTestRange("https://example.com/other.txt")
+	other.setRanges(parsePrefixes(t, "198.51.100.0/24"), time.Now())
+	withInstances(t, s, other)
+	v.Source = s.URL
+
+	repl := caddy.NewReplacer()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), caddy.ReplacerCtxKey, repl))
+	rec := httptest.NewRecorder()
+	var version string
+	next := caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		version = repl.ReplaceAll("{http.wedos.version}", "")
+		return nil
+	})
+	if err := v.ServeHTTP(rec, req, next); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if got := rec.Header().Get("X-Wedos-Version"); got != want {
+		t.Errorf("expected X-Wedos-Version %q, got %q", want, got)
+	}
+	if version != want {
+		t.Errorf("expected version placeholder %q, got %q", want, version)
+	}
+
+	// Ambiguous without source: the process-wide state, with a warning.
+	core, logs := observer.New(zap.WarnLevel)
+	v.Source = ""
+	v.logger = zap.New(core)
+	v.warned = new(atomic.Bool)
+	for range 2 {
+		rec = httptest.NewRecorder()
+		if err := v.ServeHTTP(rec, req, next); err != nil {
+			t.Fatalf("handler error: %v", err)
+		}
+	}
+	if got, want := rec.Header().Get("X-Wedos-Version"), wedosExpvarHash.Value(); got != want {
+		t.Errorf("expected the process-wide X-Wedos-Version %q without source, got %q", want, got)
+	}
+	if n := logs.FilterMessageSnippet("set source").Len(); n != 1 {
+		t.Errorf("expected one warning about the missing source, got %d", n)
+	}
+}
@@ -0,0 +1,61 @@
+package caddy_wedos_ip
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"net/netip"
+	"slices"
+)
+
+// prefixLRU is a small LRU of parsed lists keyed by the SHA-256 of the
+// body and its format, so an upstream oscillating between a few versions
+// is not parsed again and again. It is only used by the refresh goroutine.
+type prefixLRU struct {
+	size  int
+	order *list.List // of *prefixLRUEntry, most recent first
+	items map[[sha256.Size]byte]*list.Element
+}
+
+type prefixLRUEntry struct {
+	key      [sha256.Size]byte
+	prefixes []netip.Prefix
+}
+
+func newPrefixLRU(size int) *prefixLRU {
+	return &prefixLRU{size: size, order: list.New(), items: make(map[[sha256.Size]byte]*list.Element)}
+}
+
+func prefixLRUKey(format string, body []byte) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write([]byte(format))
+	h.Write([]byte{0})
+	h.Write(body)
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+	return key
+}
+
+// get returns a copy of the cached prefixes for key.
+func (c *prefixLRU) get(key [sha256.Size]byte) ([]netip.Prefix, bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return slices.Clone(el.Value.(*prefixLRUEntry).prefixes), true
+}
+
+// add stores a copy of prefixes, evicting the least recently used entry
+// if the cache is full.
+func (c *prefixLRU) add(key [sha256.Size]byte, prefixes []netip.Prefix) {
+	if el, ok := c.items[key]; ok {
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&prefixLRUEntry{key: key, prefixes: slices.Clone(prefixes)})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*prefixLRUEntry).key)
+	}
+}
@@ -0,0 +1,63 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestPrefixLRU(t *testing.T) {
+	c := newPrefixLRU(2)
+	a, b, d := prefixLRUKey(formatText, []byte("a")), prefixLRUKey(formatText, []byte("b")), prefixLRUKey(formatText, []byte("d"))
+	c.add(a, parsePrefixes(t, "192.0.2.0/24"))
+	c.add(b, parsePrefixes(t, "198.51.100.0/24"))
+	c.get(a) // a is now the most recent
+	c.add(d, parsePrefixes(t, "203.0.113.0/24"))
+
+	if _, ok := c.get(b); ok {
+		t.Errorf("expected the least recently used entry to be evicted")
+	}
+	got, ok := c.get(a)
+	if !ok || !slices.Equal(got, parsePrefixes(t, "192.0.2.0/24")) {
+		t.Errorf("unexpected entry for a: %v %v", got, ok)
+	}
+
+	// Callers may modify the returned slice.
+	got[0] = parsePrefixes(t, "10.0.0.0/8")[0]
+	if again, _ := c.get(a); again[0] == got[0] {
+		t.Errorf("cache entry was modified through a returned slice")
+	}
+
+	if prefixLRUKey(formatText, []byte("a")) == prefixLRUKey(formatJSON, []byte("a")) {
+		t.Errorf("expected the format to be part of the key")
+	}
+}
+
+func TestPrefixLRUFetch(t *testing.T) {
+	body := "192.0.2.0/24"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	s := WedosIPRange{ctx: caddy.Context{Context: context.Background()}, parsed: newPrefixLRU(2)}
+	s.client = s.newClient()
+
+	for _, b := range []string{"192.0.2.0/24", "198.51.100.0/24", "192.0.2.0/24"} {
+		body = b
+		got, err := s.fetch(srv.URL)
+		if err != nil {
+			t.Fatalf("fetch error: %v", err)
+		}
+		if len(got) != 1 || got[0].String() != b {
+			t.Errorf("expected %s, got %v", b, got)
+		}
+	}
+	if n := s.parsed.order.Len(); n != 2 {
+		t.Errorf("expected 2 cached bodies, got %d", n)
+	}
+}
@@ -0,0 +1,235 @@
+package caddy_wedos_ip
+
+import (
+	"net/netip"
+	"slices"
+	"sync"
+)
+
+// PrefixSet is an immutable snapshot of the ranges indexed for longest
+// match lookups: the masked addresses of each prefix length present, sorted,
+// so Lookup binary searches one slice per length instead of scanning the
+// set. The zero value and nil are empty sets.
+//
+// Besides lookups it offers the set operations of a go4.org/netipx IPSet:
+// they compare the addresses covered, not the prefixes listed, and return
+// new sets.
+type PrefixSet struct {
+	prefixes []netip.Prefix
+	v4, v6   []prefixLength
+	// ranges returns the aggregated prefixes, computed on first use.
+	ranges func() []netip.Prefix
+}
+
+// prefixLength holds the sorted, masked addresses of the prefixes of one
+// length.
+type prefixLength struct {
+	bits  int
+	addrs []netip.Addr
+}
+
+// newPrefixSet indexes prefixes, which must be normalized (see
+// normalizePrefixes) and are shared, not copied.
+func newPrefixSet(prefixes []netip.Prefix) *PrefixSet {
+	set := &PrefixSet{prefixes: prefixes}
+	set.ranges = sync.OnceValue(func() []netip.Prefix { return aggregatePrefixes(prefixes) })
+	var v4, v6 map[int][]netip.Addr
+	for _, p := range prefixes {
+		m := &v6
+		if p.Addr().Is4() {
+			m = &v4
+		}
+		if *m == nil {
+			*m = make(map[int][]netip.Addr)
+		}
+		// Sorted by address already, since prefixes is.
+		(*m)[p.Bits()] = append((*m)[p.Bits()], p.Addr())
+	}
+	set.v4, set.v6 = byLength(v4), byLength(v6)
+	return set
+}
+
+// byLength returns the lengths of m, longest first.
+func byLength(m map[int][]netip.Addr) []prefixLength {
+	out := make([]prefixLength, 0, len(m))
+	for bits, addrs := range m {
+		out = append(out, prefixLength{bits: bits, addrs: addrs})
+	}
+	slices.SortFunc(out, func(a, b prefixLength) int { return b.bits - a.bits })
+	return out
+}
+
+// Lookup returns the most specific prefix of the set containing addr, if
+// any, with one binary search per prefix length in the set.
+func (set *PrefixSet) Lookup(addr netip.Addr) (netip.Prefix, bool) {
+	if set == nil {
+		return netip.Prefix{}, false
+	}
+	addr = addr.Unmap()
+	lengths := set.v6
+	if addr.Is4() {
+		lengths = set.v4
+	}
+	for _, l := range lengths {
+		p, err := addr.Prefix(l.bits)
+		if err != nil {
+			continue
+		}
+		if _, found := slices.BinarySearchFunc(l.addrs, p.Addr(), netip.Addr.Compare); found {
+			return p, true
+		}
+	}
+	return netip.Prefix{}, false
+}
+
+// Prefixes returns the prefixes of the set, sorted like those of
+// GetIPRanges. The slice is shared and must not be modified.
+func (set *PrefixSet) Prefixes() []netip.Prefix {
+	if set == nil {
+		return nil
+	}
+	return set.prefixes
+}
+
+// Len returns the number of prefixes in the set.
+func (set *PrefixSet) Len() int {
+	return len(set.Prefixes())
+}
+
+// Ranges returns the smallest list of prefixes covering the addresses of
+// the set, sorted, like the Prefixes of a netipx IPSet. It is computed
+// once per set; the slice is shared and must not be modified.
+func (set *PrefixSet) Ranges() []netip.Prefix {
+	if set == nil || set.ranges == nil {
+		return aggregatePrefixes(set.Prefixes())
+	}
+	return set.ranges()
+}
+
+// Contains reports whether addr is in the set.
+func (set *PrefixSet) Contains(addr netip.Addr) bool {
+	_, ok := set.Lookup(addr)
+	return ok
+}
+
+// rangeAt returns the index of the first range of ranges starting at or
+// after addr.
+func rangeAt(ranges []netip.Prefix, addr netip.Addr) int {
+	i, _ := slices.BinarySearchFunc(ranges, addr, func(p netip.Prefix, a netip.Addr) int {
+		return p.Addr().Compare(a)
+	})
+	return i
+}
+
+// ContainsPrefix reports whether every address of p is in the set, even
+// when p is covered by several of its prefixes.
+func (set *PrefixSet) ContainsPrefix(p netip.Prefix) bool {
+	if !p.IsValid() {
+		return false
+	}
+	p = p.Masked()
+	ranges := set.Ranges()
+	// Ranges don't overlap: only the last one starting at or before p can
+	// contain it.
+	i := rangeAt(ranges, p.Addr())
+	if i < len(ranges) && ranges[i].Addr() == p.Addr() {
+		i++
+	}
+	return i > 0 && ranges[i-1].Bits() <= p.Bits() && ranges[i-1].Contains(p.Addr())
+}
+
+// OverlapsPrefix reports whether any address of p is in the set.
+func (set *PrefixSet) OverlapsPrefix(p netip.Prefix) bool {
+	if !p.IsValid() {
+		return false
+	}
+	p = p.Masked()
+	ranges := set.Ranges()
+	i := rangeAt(ranges, p.Addr())
+	return i > 0 && ranges[i-1].Overlaps(p) || i < len(ranges) && ranges[i].Overlaps(p)
+}
+
+// Overlaps reports whether the sets have any address in common.
+func (set *PrefixSet) Overlaps(other *PrefixSet) bool {
+	for _, p := range other.Ranges() {
+		if set.OverlapsPrefix(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Equal reports whether the sets contain the same addresses, however their
+// prefixes are split.
+func (set *PrefixSet) Equal(other *PrefixSet) bool {
+	return slices.Equal(set.Ranges(), other.Ranges())
+}
+
+// Union returns the addresses in either set.
+func (set *PrefixSet) Union(other *PrefixSet) *PrefixSet {
+	return newPrefixSet(aggregatePrefixes(slices.Concat(set.Ranges(), other.Ranges())))
+}
+
+// Intersect returns the addresses in both sets.
+func (set *PrefixSet) Intersect(other *PrefixSet) *PrefixSet {
+	a, b := set.Ranges(), other.Ranges()
+	var out []netip.Prefix
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		// Overlapping prefixes nest: the longer one is the intersection.
+		if a[i].Overlaps(b[j]) {
+			out = append(out, maxBits(a[i], b[j]))
+		}
+		if lastAddr(a[i]).Less(lastAddr(b[j])) {
+			i++
+		} else {
+			j++
+		}
+	}
+	return newPrefixSet(aggregatePrefixes(out))
+}
+
+// maxBits returns the longer of two nested prefixes.
+func maxBits(p, q netip.Prefix) netip.Prefix {
+	if p.Bits() >= q.Bits() {
+		return p
+	}
+	return q
+}
+
+// Difference returns the addresses of set that are not in other.
+func (set *PrefixSet) Difference(other *PrefixSet) *PrefixSet {
+	a, b := set.Ranges(), other.Ranges()
+	var out []netip.Prefix
+	j := 0
+	for _, p := range a {
+		for j < len(b) && lastAddr(b[j]).Less(p.Addr()) {
+			j++
+		}
+		parts := []netip.Prefix{p}
+		for k := j; k < len(b) && b[k].Addr().Compare(lastAddr(p)) <= 0; k++ {
+			var rest []netip.Prefix
+			for _, part := range parts {
+				rest = append(rest, subtractPrefix(part, b[k])...)
+			}
+			parts = rest
+		}
+		out = append(out, parts...)
+	}
+	return newPrefixSet(aggregatePrefixes(out))
+}
+
+// PrefixSet returns the current ranges as a PrefixSet, built once per
+// refresh. Holding it across refreshes keeps seeing the same ranges.
+func (s *WedosIPRange) PrefixSet() *PrefixSet {
+	s = s.fetcher()
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.set
+}
+
+// Lookup returns the most specific current range containing addr, if any,
+// in O(log n) per prefix length present. It is IsTrusted under the name
+// of PrefixSet's method.
+func (s *WedosIPRange) Lookup(addr netip.Addr) (netip.Prefix, bool) {
+	return s.PrefixSet().Lookup(addr)
+}
@@ -0,0 +1,160 @@
+package caddy_wedos_ip
+
+import (
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestPrefixSetLookup(t *testing.T) {
+	set := newPrefixSet(normalizePrefixes(parsePrefixes(t,
+		"10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24", "192.0.2.7/32", "2001:db8::/32", "2001:db8:1::/48")))
+	for _, tc := range []struct{ addr, want string }{
+		{"10.1.2.3", "10.1.2.0/24"},
+		{"10.1.3.3", "10.1.0.0/16"},
+		{"10.2.0.1", "10.0.0.0/8"},
+		{"::ffff:10.1.2.3", "10.1.2.0/24"},
+		{"192.0.2.7", "192.0.2.7/32"},
+		{"2001:db8:1::1", "2001:db8:1::/48"},
+		{"2001:db8:2::1", "2001:db8::/32"},
+		{"192.0.2.8", ""},
+		{"11.0.0.1", ""},
+	} {
+		p, ok := set.Lookup(netip.MustParseAddr(tc.addr))
+		if tc.want == "" {
+			if ok {
+				t.Errorf("%s: expected no match, got %s", tc.addr, p)
+			}
+		} else if !ok || p.String() != tc.want {
+			t.Errorf("%s: expected %s, got %s (%v)", tc.addr, tc.want, p, ok)
+		}
+	}
+	if set.Len() != 6 {
+		t.Errorf("expected 6 prefixes, got %d", set.Len())
+	}
+
+	var empty *PrefixSet
+	if _, ok := empty.Lookup(netip.MustParseAddr("10.0.0.1")); ok || empty.Len() != 0 {
+		t.Error("expected the nil set to be empty")
+	}
+}
+
+func TestPrefixSetMatchesContaining(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	var prefixes []netip.Prefix
+	for range 500 {
+		addr := netip.AddrFrom4([4]byte{10, byte(r.IntN(4)), byte(r.IntN(256)), byte(r.IntN(256))})
+		prefixes = append(prefixes, netip.PrefixFrom(addr, 8+r.IntN(25)))
+	}
+	ranges := normalizePrefixes(prefixes)
+	set := newPrefixSet(ranges)
+	for range 2000 {
+		addr := netip.AddrFrom4([4]byte{10, byte(r.IntN(5)), byte(r.IntN(256)), byte(r.IntN(256))})
+		containing := containingPrefixes(ranges, addr)
+		p, ok := set.Lookup(addr)
+		if ok != (len(containing) > 0) || ok && p != containing[len(containing)-1] {
+			t.Fatalf("%s: Lookup returned %s (%v), containing %v", addr, p, ok, containing)
+		}
+	}
+}
+
+func TestPrefixSetPublished(t *testing.T) {
+	srv := sequenceServer(t, "192.0.2.0/24", "198.51.100.0/24")
+	s := newTestRange(srv.URL)
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	first := s.PrefixSet()
+	if _, ok := s.Lookup(netip.MustParseAddr("192.0.2.1")); !ok {
+		t.Fatal("expected 192.0.2.1 to match")
+	}
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	// A held set keeps the ranges it was built from.
+	if _, ok := first.Lookup(netip.MustParseAddr("192.0.2.1")); !ok {
+		t.Error("expected the earlier set to be unchanged")
+	}
+	if _, ok := s.Lookup(netip.MustParseAddr("198.51.100.1")); !ok {
+		t.Error("expected the new set to match 198.51.100.1")
+	}
+}
+
+func TestPrefixSetOperations(t *testing.T) {
+	a := newPrefixSet(normalizePrefixes(parsePrefixes(t,
+		"10.0.0.0/25", "10.0.0.128/25", "10.0.0.16/28", "192.0.2.0/24", "2001:db8::/32")))
+	b := newPrefixSet(normalizePrefixes(parsePrefixes(t, "10.0.0.0/24", "192.0.2.64/26", "198.51.100.0/24")))
+
+	if got, want := a.Ranges(), parsePrefixes(t, "10.0.0.0/24", "192.0.2.0/24", "2001:db8::/32"); !slices.Equal(got, want) {
+		t.Errorf("Ranges() = %v, want %v", got, want)
+	}
+	if !a.ContainsPrefix(netip.MustParsePrefix("10.0.0.64/26")) || a.ContainsPrefix(netip.MustParsePrefix("10.0.0.0/23")) {
+		t.Error("ContainsPrefix crossed the merged halves incorrectly")
+	}
+	if !a.Contains(netip.MustParseAddr("2001:db8::1")) || a.Contains(netip.MustParseAddr("10.0.1.0")) {
+		t.Error("unexpected Contains result")
+	}
+	if !a.OverlapsPrefix(netip.MustParsePrefix("10.0.0.0/16")) || a.OverlapsPrefix(netip.MustParsePrefix("10.0.1.0/24")) {
+		t.Error("unexpected OverlapsPrefix result")
+	}
+	if !a.Overlaps(b) || a.Overlaps(newPrefixSet(parsePrefixes(t, "198.51.100.0/24"))) {
+		t.Error("unexpected Overlaps result")
+	}
+	if !a.Equal(newPrefixSet(parsePrefixes(t, "10.0.0.0/24", "192.0.2.0/24", "2001:db8::/32"))) || a.Equal(b) {
+		t.Error("unexpected Equal result")
+	}
+
+	for _, tc := range []struct {
+		name      string
+		got, want *PrefixSet
+	}{
+		{"union", a.Union(b), newPrefixSet(parsePrefixes(t, "10.0.0.0/24", "192.0.2.0/24", "198.51.100.0/24", "2001:db8::/32"))},
+		{"intersect", a.Intersect(b), newPrefixSet(parsePrefixes(t, "10.0.0.0/24", "192.0.2.64/26"))},
+		{"difference", a.Difference(b), newPrefixSet(parsePrefixes(t, "192.0.2.0/26", "192.0.2.128/25", "2001:db8::/32"))},
+	} {
+		if !slices.Equal(tc.got.Prefixes(), tc.want.Prefixes()) {
+			t.Errorf("%s: got %v, want %v", tc.name, tc.got.Prefixes(), tc.want.Prefixes())
+		}
+	}
+
+	var empty *PrefixSet
+	if empty.Contains(netip.MustParseAddr("10.0.0.1")) || empty.Overlaps(a) || !empty.Equal(&PrefixSet{}) {
+		t.Error("expected the nil set to be empty")
+	}
+	if !a.Union(empty).Equal(a) || a.Intersect(empty).Len() != 0 || !a.Difference(empty).Equal(a) {
+		t.Error("unexpected operation with the nil set")
+	}
+}
+
+func TestPrefixSetOperationsMatchAddresses(t *testing.T) {
+	r := rand.New(rand.NewPCG(3, 4))
+	random := func() *PrefixSet {
+		var prefixes []netip.Prefix
+		for range 8 {
+			addr := netip.AddrFrom4([4]byte{10, 0, byte(r.IntN(4)), byte(r.IntN(256))})
+			prefixes = append(prefixes, netip.PrefixFrom(addr, 22+r.IntN(11)))
+		}
+		return newPrefixSet(normalizePrefixes(prefixes))
+	}
+	for range 200 {
+		a, b := random(), random()
+		union, inter, diff := a.Union(b), a.Intersect(b), a.Difference(b)
+		for i := range 1024 {
+			addr := netip.AddrFrom4([4]byte{10, 0, byte(i >> 8), byte(i)})
+			inA, inB := a.Contains(addr), b.Contains(addr)
+			if union.Contains(addr) != (inA || inB) || inter.Contains(addr) != (inA && inB) || diff.Contains(addr) != (inA && !inB) {
+				t.Fatalf("%s: wrong result for %v and %v", addr, a.Prefixes(), b.Prefixes())
+			}
+		}
+		if a.Overlaps(b) != (inter.Len() > 0) {
+			t.Fatalf("Overlaps disagrees with Intersect for %v and %v", a.Prefixes(), b.Prefixes())
+		}
+		for _, p := range b.Prefixes() {
+			rest := newPrefixSet([]netip.Prefix{p}).Difference(a)
+			if a.ContainsPrefix(p) != (rest.Len() == 0) || a.OverlapsPrefix(p) != !rest.Equal(newPrefixSet([]netip.Prefix{p})) {
+				t.Fatalf("%s: ContainsPrefix or OverlapsPrefix is wrong for %v", p, a.Prefixes())
+			}
+		}
+	}
+}
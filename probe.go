@@ -0,0 +1,66 @@
+package caddy_wedos_ip
+
+import (
+	"io"
+	"net/http"
+)
+
+// headValidators are the HEAD response headers compared by head_probe.
+type headValidators struct {
+	URL           string
+	ETag          string
+	LastModified  string
+	ContentLength int64
+}
+
+// empty reports whether the server sent no usable validators. A
+// Content-Length alone is not one: a changed list can keep its length.
+func (v headValidators) empty() bool {
+	return v.ETag == "" && v.LastModified == ""
+}
+
+// probe sends a HEAD request for u and returns its validators.
+func (s *WedosIPRange) probe(u string) (headValidators, error) {
+	ctx, cancel := s.getContext()
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(uncharged(ctx), http.MethodHead, u, nil)
+	if err != nil {
+		return headValidators{}, err
+	}
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return headValidators{}, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return headValidators{}, nil
+	}
+	return headValidators{
+		URL:           u,
+		ETag:          resp.Header.Get("ETag"),
+		LastModified:  resp.Header.Get("Last-Modified"),
+		ContentLength: resp.ContentLength,
+	}, nil
+}
+
+// probeUnchanged sends a HEAD request for u and reports whether its
+// validators match those u last served an applied list with. They are kept
+// as pending until the list fetched next is applied. Probe failures
+// report a change, so the GET decides.
+func (s *WedosIPRange) probeUnchanged(u string) bool {
+	v, err := s.probe(u)
+	if err != nil || v.empty() {
+		s.pendingValidators = headValidators{}
+		return false
+	}
+	if v == s.validators[u] {
+		return true
+	}
+	s.pendingValidators = v
+	return false
+}
@@ -0,0 +1,89 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+func TestHeadProbe(t *testing.T) {
+	var gets atomic.Int32
+	modified := "Mon, 02 Jun 2025 10:00:00 GMT"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// No ETag and no 304 support, only Last-Modified.
+		w.Header().Set("Last-Modified", modified)
+		if r.Method == http.MethodGet {
+			gets.Add(1)
+		}
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+
+	s := WedosIPRange{
+		URL:            srv.URL,
+		HeadProbe:      true,
+		MinPrefixLenV4: defaultMinPrefixLenV4,
+		MinPrefixLenV6: defaultMinPrefixLenV6,
+		ctx:            caddy.Context{Context: context.Background()},
+		lock:           new(sync.RWMutex),
+		applyLock:      new(sync.Mutex),
+		subsLock:       new(sync.Mutex),
+		logger:         zap.NewNop(),
+	}
+	s.client = s.newClient()
+
+	for i := 0; i < 3; i++ {
+		if err := s.refresh(); err != nil {
+			t.Fatalf("refresh %d: %v", i+1, err)
+		}
+	}
+	if n := gets.Load(); n != 1 {
+		t.Errorf("expected unchanged validators to skip the GET, got %d GETs", n)
+	}
+
+	modified = "Tue, 03 Jun 2025 10:00:00 GMT"
+	if err := s.refresh(); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if n := gets.Load(); n != 2 {
+		t.Errorf("expected a changed Last-Modified to trigger a GET, got %d GETs", n)
+	}
+	if len(s.GetIPRanges(nil)) != 1 {
+		t.Errorf("expected the ranges to be applied")
+	}
+}
+
+func TestHeadProbeContentLengthOnly(t *testing.T) {
+	var gets atomic.Int32
+	bodies := []string{"192.0.2.0/24", "198.51.100.0/24"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Same length, different content, and no ETag or Last-Modified.
+		body := bodies[min(int(gets.Load()), len(bodies)-1)]
+		if r.Method == http.MethodGet {
+			gets.Add(1)
+		}
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	s := newTestRange(srv.URL)
+	s.HeadProbe = true
+	for i := 0; i < 2; i++ {
+		if err := s.refresh(); err != nil {
+			t.Fatalf("refresh %d: %v", i+1, err)
+		}
+	}
+	if n := gets.Load(); n != 2 {
+		t.Errorf("expected a Content-Length alone not to skip the GET, got %d GETs", n)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "198.51.100.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected the changed list %v, got %v", want, got)
+	}
+}
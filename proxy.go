@@ -0,0 +1,61 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// checkProxy validates the Proxy and NoProxy options.
+func (s *WedosIPRange) checkProxy() error {
+	if s.Proxy != "" {
+		u, err := url.Parse(s.Proxy)
+		if err != nil {
+			return fmt.Errorf("proxy: %v", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("proxy: unsupported scheme %q", u.Scheme)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("proxy: missing host in %q", s.Proxy)
+		}
+	}
+	for _, entry := range s.NoProxy {
+		if entry == "" || strings.ContainsAny(entry, ", \t") {
+			return fmt.Errorf("no_proxy: invalid entry %q", entry)
+		}
+		if strings.Contains(entry, "/") {
+			if _, err := netip.ParsePrefix(entry); err != nil {
+				return fmt.Errorf("no_proxy: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// proxyFunc returns the transport's Proxy function. Without a Proxy the
+// proxy comes from the environment as usual, but NoProxy still replaces
+// NO_PROXY. Entries follow NO_PROXY semantics: host names match the host
+// and its subdomains, and CIDRs match IP literal hosts.
+func (s *WedosIPRange) proxyFunc() func(*http.Request) (*url.URL, error) {
+	if s.Proxy == "" && len(s.NoProxy) == 0 {
+		return http.ProxyFromEnvironment
+	}
+	cfg := httpproxy.FromEnvironment()
+	if s.Proxy != "" {
+		cfg.HTTPProxy, cfg.HTTPSProxy = s.Proxy, s.Proxy
+	}
+	if len(s.NoProxy) > 0 {
+		cfg.NoProxy = strings.Join(s.NoProxy, ",")
+	}
+	proxy := cfg.ProxyFunc()
+	return func(r *http.Request) (*url.URL, error) {
+		return proxy(r.URL)
+	}
+}
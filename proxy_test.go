@@ -0,0 +1,51 @@
+package caddy_wedos_ip
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestProxyFunc(t *testing.T) {
+	s := WedosIPRange{
+		Proxy:   "http://proxy.example.net:3128",
+		NoProxy: []string{"internal.example.com", "10.0.0.0/8"},
+	}
+	if err := s.checkProxy(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	proxy := s.proxyFunc()
+
+	tests := []struct {
+		url    string
+		direct bool
+	}{
+		{"https://ips.wedos.global/ips.txt", false},
+		{"https://internal.example.com/ips.txt", true},
+		{"https://mirror.internal.example.com/ips.txt", true},
+		{"http://10.1.2.3/ips.txt", true},
+		{"http://192.0.2.1/ips.txt", false},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, tt.url, nil)
+		u, err := proxy(req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.url, err)
+		}
+		if direct := u == nil; direct != tt.direct {
+			t.Errorf("%s: expected direct=%v, got proxy %v", tt.url, tt.direct, u)
+		}
+	}
+}
+
+func TestProxyValidation(t *testing.T) {
+	for _, s := range []WedosIPRange{
+		{Proxy: "ftp://proxy.example.net"},
+		{Proxy: "http://"},
+		{NoProxy: []string{"10.0.0.0/33"}},
+		{NoProxy: []string{"a.example.com,b.example.com"}},
+	} {
+		if err := s.checkProxy(); err == nil {
+			t.Errorf("expected an error for proxy %q no_proxy %v", s.Proxy, s.NoProxy)
+		}
+	}
+}
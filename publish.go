@@ -0,0 +1,65 @@
+package caddy_wedos_ip
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// formatPublished renders ranges in the publish_file format: a header
+// comment with the update time and source, then one sorted CIDR per line.
+func formatPublished(prefixes []netip.Prefix, source string, updated time.Time) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# updated=%s source=%s\n", updated.UTC().Format(time.RFC3339), source)
+	buf.Write(formatPrefixList(prefixes))
+	return buf.Bytes()
+}
+
+// formatPrefixList renders ranges in their canonical serialization: masked,
+// deduplicated, sorted with comparePrefixes (IPv4 before IPv6, then by
+// address bytes, then by prefix length) and one "addr/bits\n" line each.
+// It is used for hashing, the cache file and publish_file alike, so equal
+// sets always serialize identically, whatever order they were fetched in.
+func formatPrefixList(prefixes []netip.Prefix) []byte {
+	var buf bytes.Buffer
+	for _, p := range normalizePrefixes(prefixes) {
+		buf.WriteString(p.String())
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// contentHash returns the hex SHA-256 of the canonical serialization of
+// prefixes.
+func contentHash(prefixes []netip.Prefix) string {
+	sum := sha256.Sum256(formatPrefixList(prefixes))
+	return hex.EncodeToString(sum[:])
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place, so readers never observe a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
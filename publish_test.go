@@ -0,0 +1,84 @@
+package caddy_wedos_ip
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPublishFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wedos.txt")
+	updated := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	prefixes := parsePrefixes(t, "2001:db8::/32", "198.51.100.0/24", "192.0.2.0/24")
+
+	if err := writeFileAtomic(path, formatPublished(prefixes, "https://example.com/ips.txt", updated)); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+	want := "# updated=2025-01-02T03:04:05Z source=https://example.com/ips.txt\n" +
+		"192.0.2.0/24\n" +
+		"198.51.100.0/24\n" +
+		"2001:db8::/32\n"
+	if string(got) != want {
+		t.Errorf("unexpected file contents:\n%s\nwant:\n%s", got, want)
+	}
+
+	// The input slice must not be reordered.
+	if prefixes[0].String() != "2001:db8::/32" {
+		t.Errorf("input slice was modified: %v", prefixes)
+	}
+}
+
+func TestContentHashOrderIndependent(t *testing.T) {
+	a := parsePrefixes(t, "2001:db8::/32", "192.0.2.0/24", "198.51.100.0/24", "10.0.0.0/8")
+	b := parsePrefixes(t, "10.0.0.0/8", "198.51.100.0/24", "2001:db8::/32", "192.0.2.0/24", "192.0.2.0/24")
+	if contentHash(a) != contentHash(b) {
+		t.Errorf("hashes differ for the same set in a different order")
+	}
+	if got, want := string(formatPrefixList(b)), "10.0.0.0/8\n192.0.2.0/24\n198.51.100.0/24\n2001:db8::/32\n"; got != want {
+		t.Errorf("formatPrefixList() = %q, want %q", got, want)
+	}
+	if contentHash(a[:3]) == contentHash(a) {
+		t.Errorf("hashes match for different sets")
+	}
+}
+
+func TestEquivalentIPv6Forms(t *testing.T) {
+	forms := []string{
+		"2001:db8::/32",
+		"2001:0db8:0000::/32",
+		"2001:DB8::/32",
+		"2001:db8:0:0:0:0:0:0/32",
+		"2001:db8::0.0.0.0/32",
+		"2001:db8::1/32",
+	}
+	want := contentHash(parsePrefixes(t, "2001:db8::/32"))
+	for _, form := range forms {
+		got, err := parseRanges(strings.NewReader(form))
+		if err != nil {
+			t.Fatalf("%s: %v", form, err)
+		}
+		if h := contentHash(got); h != want {
+			t.Errorf("%s: hash differs from the canonical form", form)
+		}
+	}
+
+	// Every form of the list dedups to the one prefix once applied.
+	srv := sequenceServer(t, strings.Join(forms, "\n"))
+	s := newTestRange(srv.URL)
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.GetIPRanges(nil); len(got) != 1 || got[0].String() != "2001:db8::/32" {
+		t.Errorf("expected only 2001:db8::/32, got %v", got)
+	}
+	if got := s.status().Hash; got != want {
+		t.Errorf("expected the canonical hash, got %s", got)
+	}
+}
@@ -0,0 +1,316 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// defaultQuarantineMaxChange is the QuarantineMaxChange used when it is
+// not set.
+const defaultQuarantineMaxChange = 25
+
+// errQuarantined fails a refresh whose list was held for review.
+var errQuarantined = errors.New("list quarantined for review")
+
+// quarantinedList is a fetched list held back by QuarantineFile, as
+// written to the file and served by /wedos/quarantine.
+type quarantinedList struct {
+	URL      string    `json:"url"`
+	Detected time.Time `json:"detected"`
+	Reasons  []string  `json:"reasons"`
+	Hash     string    `json:"hash"`
+	Previous int       `json:"previous"`
+	Count    int       `json:"count"`
+	Added    []string  `json:"added,omitempty"`
+	Removed  []string  `json:"removed,omitempty"`
+	Prefixes []string  `json:"prefixes"`
+}
+
+// checkQuarantineOptions validates QuarantineMaxChange and defaults it.
+func (s *WedosIPRange) checkQuarantineOptions() error {
+	if s.QuarantineMaxChange < 0 {
+		return fmt.Errorf("quarantine_max_change must not be negative")
+	}
+	if s.QuarantineFile == "" {
+		if s.QuarantineMaxChange > 0 {
+			return fmt.Errorf("quarantine_max_change requires quarantine_file")
+		}
+		return nil
+	}
+	if s.QuarantineMaxChange == 0 {
+		s.QuarantineMaxChange = defaultQuarantineMaxChange
+	}
+	return nil
+}
+
+// anomalies returns why next looks suspicious as a successor of prev: too
+// many prefixes added or removed, a jump in their count, or prefixes
+// broader than ones already trusted. maxChange is a percentage of prev.
+func anomalies(prev, next []netip.Prefix, maxChange int) []string {
+	if len(prev) == 0 {
+		return nil
+	}
+	added, removed := diffPrefixes(prev, next)
+	var reasons []string
+	if changed := len(added) + len(removed); changed*100 > maxChange*len(prev) {
+		reasons = append(reasons, fmt.Sprintf("%d of %d prefixes changed, more than %d%%", changed, len(prev), maxChange))
+	}
+	if (len(next)-len(prev))*100 > maxChange*len(prev) {
+		reasons = append(reasons, fmt.Sprintf("prefix count grew from %d to %d", len(prev), len(next)))
+	}
+	var supernets []string
+	for _, a := range added {
+		for _, p := range prev {
+			if a.Bits() < p.Bits() && a.Contains(p.Addr()) {
+				supernets = append(supernets, a.String())
+				break
+			}
+		}
+	}
+	if len(supernets) > 0 {
+		reasons = append(reasons, "new supernets of trusted prefixes: "+strings.Join(supernets, ", "))
+	}
+	return reasons
+}
+
+// checkQuarantine holds back the fetched list candidate if it looks
+// anomalous next to the current one, writing it to QuarantineFile and
+// returning errQuarantined so the previous ranges stay. A list approved
+// through the admin API passes, a rejected one is refused again, and a
+// normal one supersedes whatever was quarantined. Only called by the
+// refresh goroutine.
+func (s *WedosIPRange) checkQuarantine(candidate []netip.Prefix) error {
+	s.lock.RLock()
+	prev := s.fetched
+	held, approved, rejected := s.quarantined, s.quarantineApproved, s.quarantineRejected
+	s.lock.RUnlock()
+
+	hash := contentHash(candidate)
+	reasons := anomalies(prev, candidate, s.QuarantineMaxChange)
+	if len(reasons) == 0 || hash == approved {
+		if hash == approved {
+			s.logger.Warn("applying approved quarantined WEDOS IP list", zap.String("hash", hash))
+		}
+		s.releaseQuarantine()
+		return nil
+	}
+	if hash == rejected {
+		return fmt.Errorf("%w: the list was rejected", errQuarantined)
+	}
+	if held != nil && held.Hash == hash {
+		return fmt.Errorf("%w: %s", errQuarantined, strings.Join(reasons, "; "))
+	}
+
+	added, removed := diffPrefixes(prev, candidate)
+	q := &quarantinedList{
+		URL:      s.source(),
+		Detected: s.now(),
+		Reasons:  reasons,
+		Hash:     hash,
+		Previous: len(prev),
+		Count:    len(candidate),
+		Added:    prefixStrings(added),
+		Removed:  prefixStrings(removed),
+		Prefixes: prefixStrings(candidate),
+	}
+	data, err := json.MarshalIndent(q, "", "\t")
+	if err == nil {
+		err = writeFileAtomic(s.QuarantineFile, append(data, '\n'))
+	}
+	if err != nil {
+		s.logger.Error("writing quarantine_file failed", zap.String("path", s.QuarantineFile), zap.Error(err))
+	}
+	s.lock.Lock()
+	s.quarantined = q
+	s.quarantineApproved = ""
+	s.lock.Unlock()
+	s.logger.Warn("WEDOS IP list quarantined for review, keeping the previous ranges",
+		zap.Strings("reasons", reasons),
+		zap.String("hash", hash),
+		zap.Int("added", len(added)),
+		zap.Int("removed", len(removed)),
+		zap.String("path", s.QuarantineFile))
+	return fmt.Errorf("%w: %s", errQuarantined, strings.Join(reasons, "; "))
+}
+
+// releaseQuarantine forgets the quarantined, approved and rejected lists
+// once a list is applied, removing QuarantineFile.
+func (s *WedosIPRange) releaseQuarantine() {
+	s.lock.Lock()
+	held := s.quarantined
+	s.quarantined = nil
+	s.quarantineApproved = ""
+	s.quarantineRejected = ""
+	s.lock.Unlock()
+	if held != nil {
+		s.removeQuarantineFile()
+	}
+}
+
+// removeQuarantineFile removes QuarantineFile, logging a failure.
+func (s *WedosIPRange) removeQuarantineFile() {
+	if err := os.Remove(s.QuarantineFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.logger.Warn("removing quarantine_file failed", zap.String("path", s.QuarantineFile), zap.Error(err))
+	}
+}
+
+// errQuarantineChanged is returned for an approval or rejection of a list
+// that is no longer the one quarantined.
+var errQuarantineChanged = errors.New("the quarantined list changed")
+
+// approveQuarantine marks the quarantined list as approved if its hash is
+// hash, and refreshes, applying it if upstream still serves it.
+func (s *WedosIPRange) approveQuarantine(ctx context.Context, hash string) error {
+	s.lock.Lock()
+	q := s.quarantined
+	if q == nil || q.Hash != hash {
+		s.lock.Unlock()
+		return errQuarantineChanged
+	}
+	s.quarantineApproved = q.Hash
+	s.lock.Unlock()
+	s.logger.Warn("quarantined WEDOS IP list approved", zap.String("hash", q.Hash))
+	return s.forceRefresh(ctx)
+}
+
+// rejectQuarantine drops the quarantined list if its hash is hash and
+// refuses it if fetched again, keeping the current ranges.
+func (s *WedosIPRange) rejectQuarantine(hash string) error {
+	s.lock.Lock()
+	q := s.quarantined
+	if q == nil || q.Hash != hash {
+		s.lock.Unlock()
+		return errQuarantineChanged
+	}
+	s.quarantined = nil
+	s.quarantineRejected = q.Hash
+	s.lock.Unlock()
+	s.removeQuarantineFile()
+	s.logger.Warn("quarantined WEDOS IP list rejected", zap.String("hash", q.Hash))
+	return nil
+}
+
+// prefixStrings formats prefixes for JSON.
+func prefixStrings(prefixes []netip.Prefix) []string {
+	out := make([]string, 0, len(prefixes))
+	for _, p := range prefixes {
+		out = append(out, p.String())
+	}
+	return out
+}
+
+// quarantineRequest is the body of POST /wedos/quarantine/approve and
+// /wedos/quarantine/reject: the url and hash of the reviewed list, as
+// listed by GET /wedos/quarantine.
+type quarantineRequest struct {
+	URL  string `json:"url"`
+	Hash string `json:"hash"`
+}
+
+// handleQuarantine lists the quarantined lists (GET /wedos/quarantine),
+// or approves (POST /wedos/quarantine/approve) or rejects (POST
+// /wedos/quarantine/reject) the reviewed one, named by its url and hash.
+func (adminWedos) handleQuarantine(w http.ResponseWriter, r *http.Request) error {
+	instancesLock.Lock()
+	targets := append([]*WedosIPRange(nil), instances...)
+	instancesLock.Unlock()
+
+	if r.URL.Path == "/wedos/quarantine" {
+		if r.Method != http.MethodGet {
+			return caddy.APIError{
+				HTTPStatus: http.StatusMethodNotAllowed,
+				Err:        fmt.Errorf("method not allowed"),
+			}
+		}
+		results := make([]quarantinedList, 0)
+		for _, s := range targets {
+			s.lock.RLock()
+			if s.quarantined != nil {
+				results = append(results, *s.quarantined)
+			}
+			s.lock.RUnlock()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(results); err != nil {
+			return caddy.APIError{
+				HTTPStatus: http.StatusInternalServerError,
+				Err:        err,
+			}
+		}
+		return nil
+	}
+
+	if r.Method != http.MethodPost {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed"),
+		}
+	}
+	if err := authorizeMutation(r); err != nil {
+		return err
+	}
+	var body quarantineRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("decoding request body: %v", err),
+		}
+	}
+	if body.URL == "" || body.Hash == "" {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("the url and hash of the reviewed list are required"),
+		}
+	}
+	var held []*WedosIPRange
+	for _, s := range targets {
+		s.lock.RLock()
+		if q := s.quarantined; q != nil && q.URL == body.URL && q.Hash == body.Hash {
+			held = append(held, s)
+		}
+		s.lock.RUnlock()
+	}
+	if len(held) == 0 {
+		return caddy.APIError{
+			HTTPStatus: http.StatusConflict,
+			Err:        fmt.Errorf("%w: no list of %s with hash %s is quarantined", errQuarantineChanged, body.URL, body.Hash),
+		}
+	}
+
+	var failed []string
+	for _, s := range held {
+		var err error
+		if r.URL.Path == "/wedos/quarantine/reject" {
+			err = s.rejectQuarantine(body.Hash)
+		} else {
+			err = s.approveQuarantine(r.Context(), body.Hash)
+		}
+		if errors.Is(err, errQuarantineChanged) {
+			return caddy.APIError{
+				HTTPStatus: http.StatusConflict,
+				Err:        fmt.Errorf("%w: %s no longer holds %s", err, body.URL, body.Hash),
+			}
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", s.source(), err))
+		}
+	}
+	if len(failed) > 0 {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadGateway,
+			Err:        fmt.Errorf("applying the approved list failed: %s", strings.Join(failed, "; ")),
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,165 @@
+package caddy_wedos_ip
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestAnomalies(t *testing.T) {
+	prev := parsePrefixes(t, "192.0.2.0/26", "192.0.2.64/26", "198.51.100.0/24", "203.0.113.0/24")
+	for _, tc := range []struct {
+		name string
+		next []netip.Prefix
+		want int
+	}{
+		{"unchanged", prev, 0},
+		{"one added", append(slices.Clone(prev), netip.MustParsePrefix("2001:db8::/32")), 0},
+		{"half removed", prev[:2], 1},
+		{"count spike", append(slices.Clone(prev), parsePrefixes(t, "2001:db8::/32", "2001:db8:1::/48")...), 2},
+		{"supernet", append(slices.Clone(prev), netip.MustParsePrefix("192.0.2.0/24")), 1},
+	} {
+		if got := anomalies(prev, tc.next, 25); len(got) != tc.want {
+			t.Errorf("%s: expected %d reasons, got %q", tc.name, tc.want, got)
+		}
+	}
+	if got := anomalies(nil, prev, 25); got != nil {
+		t.Errorf("expected the first list to pass, got %q", got)
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	const list = "192.0.2.0/26\n192.0.2.64/26\n198.51.100.0/24\n203.0.113.0/24\n"
+	var body atomic.Value
+	body.Store(list)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body.Load().(string)))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "quarantine.json")
+	s, err := New(Options{Config: WedosIPRange{
+		URL:            srv.URL,
+		RequireOnStart: true,
+		Interval:       caddy.Duration(time.Hour),
+		QuarantineFile: path,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	quarantined := func() []quarantinedList {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		if err := (adminWedos{}).handleQuarantine(rec, httptest.NewRequest(http.MethodGet, "/wedos/quarantine", nil)); err != nil {
+			t.Fatalf("handler error: %v", err)
+		}
+		var lists []quarantinedList
+		if err := json.NewDecoder(rec.Body).Decode(&lists); err != nil {
+			t.Fatal(err)
+		}
+		return lists
+	}
+	post := func(path string, q quarantinedList) error {
+		data, _ := json.Marshal(quarantineRequest{URL: q.URL, Hash: q.Hash})
+		return (adminWedos{}).handleQuarantine(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data)))
+	}
+	conflict := func(err error) bool {
+		apiErr, ok := err.(caddy.APIError)
+		return ok && apiErr.HTTPStatus == http.StatusConflict
+	}
+
+	body.Store(list + "192.0.2.0/24\n")
+	if err := s.forceRefresh(context.Background()); !errors.Is(err, errQuarantined) {
+		t.Fatalf("expected the list to be quarantined, got %v", err)
+	}
+	if n := len(s.GetIPRanges(nil)); n != 4 {
+		t.Errorf("expected the previous 4 ranges kept, got %d", n)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected the quarantine file: %v", err)
+	}
+	lists := quarantined()
+	if len(lists) != 1 || !slices.Equal(lists[0].Added, []string{"192.0.2.0/24"}) {
+		t.Fatalf("expected the quarantined list with its supernet, got %+v", lists)
+	}
+	reviewed := lists[0]
+	if err := post("/wedos/quarantine/approve", quarantinedList{URL: reviewed.URL}); err == nil {
+		t.Error("expected an approval without a hash to be refused")
+	}
+
+	// A rejected list is refused again without quarantining it.
+	if err := post("/wedos/quarantine/reject", reviewed); err != nil {
+		t.Fatalf("reject: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the quarantine file removed, got %v", err)
+	}
+	if err := s.forceRefresh(context.Background()); !errors.Is(err, errQuarantined) {
+		t.Errorf("expected the rejected list refused, got %v", err)
+	}
+	if lists := quarantined(); len(lists) != 0 {
+		t.Errorf("expected nothing quarantined, got %+v", lists)
+	}
+	if err := post("/wedos/quarantine/approve", reviewed); !conflict(err) {
+		t.Errorf("expected a 409 API error, got %v", err)
+	}
+
+	// Another list quarantined after the review can't be approved with
+	// the hash of the reviewed one.
+	body.Store(list + "192.0.0.0/22\n")
+	if err := s.forceRefresh(context.Background()); !errors.Is(err, errQuarantined) {
+		t.Fatalf("expected the list to be quarantined, got %v", err)
+	}
+	if err := post("/wedos/quarantine/approve", reviewed); !conflict(err) {
+		t.Errorf("expected a 409 API error for a stale hash, got %v", err)
+	}
+	if slices.Contains(s.GetIPRanges(nil), netip.MustParsePrefix("192.0.0.0/22")) {
+		t.Error("expected the list approved under a stale hash not applied")
+	}
+
+	// An approved list is applied.
+	if err := post("/wedos/quarantine/approve", quarantined()[0]); err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+	if !slices.Contains(s.GetIPRanges(nil), netip.MustParsePrefix("192.0.0.0/22")) {
+		t.Errorf("expected the approved list applied, got %v", s.GetIPRanges(nil))
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the quarantine file removed, got %v", err)
+	}
+}
+
+func TestQuarantineStored(t *testing.T) {
+	s := newTestRange("http://192.0.2.1/ips.txt")
+	s.QuarantineFile = filepath.Join(t.TempDir(), "quarantine.json")
+	s.QuarantineMaxChange = defaultQuarantineMaxChange
+	prev := parsePrefixes(t, "192.0.2.0/26", "192.0.2.64/26", "198.51.100.0/24", "203.0.113.0/24")
+	s.setRanges(prev, time.Now())
+
+	// A list adopted from storage or the cache file is held like a
+	// fetched one.
+	e := cacheEntry{Updated: time.Now(), Prefixes: append(slices.Clone(prev), netip.MustParsePrefix("192.0.2.0/24"))}
+	if err := s.applyStored(e); !errors.Is(err, errQuarantined) {
+		t.Fatalf("expected the stored list to be quarantined, got %v", err)
+	}
+	if got := s.GetIPRanges(nil); !slices.Equal(got, prev) {
+		t.Errorf("expected the previous ranges kept, got %v", got)
+	}
+}
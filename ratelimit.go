@@ -0,0 +1,65 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// hostLimiter is an http.RoundTripper that lets at most one request per
+// interval, in bursts of up to burst, through to each host. A request
+// waits for its turn until its context is done, unless it is uncharged.
+type hostLimiter struct {
+	base     http.RoundTripper
+	interval time.Duration
+	burst    int
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+func newHostLimiter(base http.RoundTripper, interval time.Duration, burst int) *hostLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &hostLimiter{
+		base:     base,
+		interval: interval,
+		burst:    burst,
+		limiters: make(map[string]*rate.Limiter),
+	}
+}
+
+func (l *hostLimiter) limiter(host string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lim, ok := l.limiters[host]
+	if !ok {
+		lim = rate.NewLimiter(rate.Every(l.interval), l.burst)
+		l.limiters[host] = lim
+	}
+	return lim
+}
+
+// RoundTrip implements http.RoundTripper.
+func (l *hostLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Context().Value(unchargedKey{}) == nil {
+		if err := l.limiter(req.URL.Host).Wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	return l.base.RoundTrip(req)
+}
+
+type unchargedKey struct{}
+
+// uncharged marks ctx as that of a request accompanying a fetch, which
+// hostLimiter lets through without taking a token: a HEAD probe, the
+// signature, a warmup or a retry. A small RateLimit thus bounds how often
+// the list is fetched, and its companions can't starve it.
+func uncharged(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unchargedKey{}, true)
+}
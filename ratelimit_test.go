@@ -0,0 +1,95 @@
+package caddy_wedos_ip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestRateLimit(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+
+	s := newTestRange(srv.URL)
+	s.RateLimit = caddy.Duration(time.Hour)
+	s.RateBurst = 2
+	s.Timeout = caddy.Duration(50 * time.Millisecond)
+	s.client = s.newClient()
+
+	for i := 0; i < 2; i++ {
+		if err := s.refresh(); err != nil {
+			t.Fatalf("refresh %d within the burst: %v", i+1, err)
+		}
+	}
+	// The third request waits for a token and runs out of time.
+	if err := s.refresh(); err == nil {
+		t.Error("expected the refresh over the limit to fail")
+	}
+	if got := hits.Load(); got != 2 {
+		t.Errorf("expected 2 requests to reach the server, got %d", got)
+	}
+
+	// Another host has its own bucket.
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("198.51.100.0/24"))
+	}))
+	defer other.Close()
+	s.URL = other.URL
+	if err := s.refresh(); err != nil {
+		t.Errorf("expected a request to another host to pass: %v", err)
+	}
+}
+
+func TestRateLimitSpacing(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+
+	s := newTestRange(srv.URL)
+	s.RateLimit = caddy.Duration(50 * time.Millisecond)
+	s.client = s.newClient()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := s.refresh(); err != nil {
+			t.Fatalf("refresh %d: %v", i+1, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("expected the refreshes to be spaced out, took %v", elapsed)
+	}
+}
+
+func TestRateLimitCompanions(t *testing.T) {
+	var fails atomic.Int32
+	fails.Store(1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Method == http.MethodGet && fails.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+
+	// The HEAD probe and the retry of the failed GET take no token.
+	s := newTestRange(srv.URL)
+	s.RateLimit = caddy.Duration(time.Hour)
+	s.HeadProbe = true
+	s.PerCycleRetries = 1
+	s.Timeout = caddy.Duration(time.Second)
+	s.client = s.newClient()
+	if err := s.refresh(); err != nil {
+		t.Fatalf("expected the companions of the fetch not to be limited: %v", err)
+	}
+}
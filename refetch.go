@@ -0,0 +1,63 @@
+package caddy_wedos_ip
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// defaultRefetchDelay is the pause before RefetchOnParseError fetches a
+// list again unless RefetchDelay says otherwise.
+const defaultRefetchDelay = 2 * time.Second
+
+// parseFailure marks an error parsing a fetched list, as opposed to
+// fetching or checking it.
+type parseFailure struct {
+	err error
+}
+
+func (e *parseFailure) Error() string { return e.err.Error() }
+
+func (e *parseFailure) Unwrap() error { return e.err }
+
+// isParseFailure reports whether err is a failure to parse a list.
+func isParseFailure(err error) bool {
+	var pf *parseFailure
+	return errors.As(err, &pf)
+}
+
+// provisionRefetch validates RefetchOnParseError.
+func (s *WedosIPRange) provisionRefetch() error {
+	if s.RefetchDelay < 0 {
+		return fmt.Errorf("refetch_on_parse_error delay must not be negative")
+	}
+	if s.RefetchOnParseError && s.RefetchDelay == 0 {
+		s.RefetchDelay = caddy.Duration(defaultRefetchDelay)
+	}
+	return nil
+}
+
+// tickRefresh runs the refresh of a timer tick. With RefetchOnParseError,
+// a list that fails to parse is fetched once more RefetchDelay later
+// before the cycle gives up, since a mirror caught mid-write serves a
+// complete list moments later.
+func (s *WedosIPRange) tickRefresh() error {
+	err := s.refresh()
+	if !s.RefetchOnParseError || !isParseFailure(err) {
+		return err
+	}
+	s.logger.Info("WEDOS IP list failed to parse, fetching it again",
+		zap.Duration("delay", time.Duration(s.RefetchDelay)),
+		zap.Error(err))
+	timer := time.NewTimer(time.Duration(s.RefetchDelay))
+	select {
+	case <-timer.C:
+	case <-s.ctx.Done():
+		timer.Stop()
+		return err
+	}
+	return s.refresh()
+}
@@ -0,0 +1,51 @@
+package caddy_wedos_ip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestRefetchOnParseError(t *testing.T) {
+	// A mirror caught mid-write serves a list cut off mid-token.
+	srv := sequenceServer(t, "192.0.2.0/24 198.51.1", "192.0.2.0/24 198.51.100.0/24")
+	s := newTestRange(srv.URL)
+	s.RefetchOnParseError = true
+	s.RefetchDelay = caddy.Duration(time.Millisecond)
+	if err := s.tickRefresh(); err != nil {
+		t.Fatalf("expected the refetch to succeed, got %v", err)
+	}
+	if n := len(s.GetIPRanges(nil)); n != 2 {
+		t.Errorf("expected the complete list applied, got %d prefixes", n)
+	}
+
+	// Without the option, the cycle fails right away.
+	srv = sequenceServer(t, "192.0.2.0/24 198.51.1", "192.0.2.0/24 198.51.100.0/24")
+	s = newTestRange(srv.URL)
+	if err := s.tickRefresh(); !isParseFailure(err) {
+		t.Errorf("expected a parse failure, got %v", err)
+	}
+}
+
+func TestRefetchSkipsOtherErrors(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	s := newTestRange(srv.URL)
+	s.RefetchOnParseError = true
+	s.RefetchDelay = caddy.Duration(time.Millisecond)
+	if err := s.tickRefresh(); err == nil || isParseFailure(err) {
+		t.Errorf("expected the status error, got %v", err)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("expected a single fetch, got %d", n)
+	}
+}
@@ -0,0 +1,53 @@
+package caddy_wedos_ip
+
+import (
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// refreshSlots caps the refresh cycles fetching at once across all modules
+// of the process, to bound the pressure on a shared egress. Nil, the
+// default, means no limit. Set from the WEDOS_MAX_CONCURRENT_REFRESHES
+// environment variable or SetMaxConcurrentRefreshes.
+var refreshSlots atomic.Pointer[semaphore.Weighted]
+
+func init() {
+	SetMaxConcurrentRefreshes(maxConcurrentRefreshes())
+}
+
+// maxConcurrentRefreshes returns the cap set by the
+// WEDOS_MAX_CONCURRENT_REFRESHES environment variable, 0 for none.
+func maxConcurrentRefreshes() int {
+	if n, err := strconv.Atoi(os.Getenv("WEDOS_MAX_CONCURRENT_REFRESHES")); err == nil && n > 0 {
+		return n
+	}
+	return 0
+}
+
+// SetMaxConcurrentRefreshes caps the refresh cycles fetching at once across
+// all modules of the process at n, overriding the
+// WEDOS_MAX_CONCURRENT_REFRESHES environment variable. Zero or less removes
+// the cap. Cycles already waiting for a slot keep the previous cap.
+func SetMaxConcurrentRefreshes(n int) {
+	if n <= 0 {
+		refreshSlots.Store(nil)
+		return
+	}
+	refreshSlots.Store(semaphore.NewWeighted(int64(n)))
+}
+
+// acquireRefreshSlot waits for a slot in refreshSlots, if capped, and
+// returns the function releasing it.
+func (s *WedosIPRange) acquireRefreshSlot() (func(), error) {
+	sem := refreshSlots.Load()
+	if sem == nil {
+		return func() {}, nil
+	}
+	if err := sem.Acquire(s.ctx, 1); err != nil {
+		return nil, err
+	}
+	return func() { sem.Release(1) }, nil
+}
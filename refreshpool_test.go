@@ -0,0 +1,57 @@
+package caddy_wedos_ip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMaxConcurrentRefreshes(t *testing.T) {
+	SetMaxConcurrentRefreshes(2)
+	t.Cleanup(func() { SetMaxConcurrentRefreshes(0) })
+
+	var active, peak atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+
+	var wg sync.WaitGroup
+	for range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := newTestRange(srv.URL)
+			if err := s.refresh(); err != nil {
+				t.Errorf("refresh error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if p := peak.Load(); p > 2 {
+		t.Errorf("expected at most 2 concurrent refreshes, got %d", p)
+	}
+}
+
+func TestMaxConcurrentRefreshesEnv(t *testing.T) {
+	t.Setenv("WEDOS_MAX_CONCURRENT_REFRESHES", "3")
+	if n := maxConcurrentRefreshes(); n != 3 {
+		t.Errorf("expected 3, got %d", n)
+	}
+	t.Setenv("WEDOS_MAX_CONCURRENT_REFRESHES", "")
+	if n := maxConcurrentRefreshes(); n != 0 {
+		t.Errorf("expected no cap by default, got %d", n)
+	}
+}
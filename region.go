@@ -0,0 +1,78 @@
+package caddy_wedos_ip
+
+import (
+	"io"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// parseSourceList parses a list of format. With Region or Tiers, a labeled
+// list is parsed keeping its labels in s.labels, for filterRegion and
+// recordTiers; with EntryTTL, the expiries of its entries are recorded.
+func (s *WedosIPRange) parseSourceList(format string, r io.Reader) ([]netip.Prefix, error) {
+	r = s.scanSized(r)
+	if s.pdebug != nil {
+		return s.debugParseList(format, r)
+	}
+	return s.parseRegionList(format, r)
+}
+
+// parseRegionList does the work of parseSourceList.
+func (s *WedosIPRange) parseRegionList(format string, r io.Reader) ([]netip.Prefix, error) {
+	if format == formatJSON && s.jsonPath != nil {
+		return parseJSONPath(s.jsonPath, r)
+	}
+	if len(s.Region) == 0 && !s.EntryTTL && !s.Tiers || format != formatLabeled {
+		return parseFormat(format, r)
+	}
+	entries, err := parseLabeledEntries(r)
+	if err != nil {
+		return nil, err
+	}
+	if s.EntryTTL {
+		if err := s.recordEntryTTLs(entries); err != nil {
+			return nil, err
+		}
+	}
+	if s.labels == nil {
+		s.labels = make(map[netip.Prefix][]string)
+	}
+	prefixes := make([]netip.Prefix, len(entries))
+	for i, e := range entries {
+		prefixes[i] = e.prefix
+		s.labels[e.prefix] = append(s.labels[e.prefix], e.labels...)
+	}
+	return prefixes, nil
+}
+
+// filterRegion keeps the prefixes labeled with one of Region, compared
+// case-insensitively. Without Region all prefixes are kept.
+func (s *WedosIPRange) filterRegion(prefixes []netip.Prefix) []netip.Prefix {
+	if len(s.Region) == 0 {
+		return prefixes
+	}
+	kept := prefixes[:0]
+	for _, p := range prefixes {
+		if slices.ContainsFunc(s.labels[p], s.inRegion) {
+			kept = append(kept, p)
+		} else {
+			s.pdebug.dropped(p, skipRegion)
+		}
+	}
+	if dropped := len(prefixes) - len(kept); dropped > 0 {
+		s.logger.Debug("dropped prefixes outside the configured region",
+			zap.Strings("region", s.Region),
+			zap.Int("dropped", dropped))
+		recordSkipped(skipRegion, dropped)
+	}
+	return kept
+}
+
+func (s *WedosIPRange) inRegion(label string) bool {
+	return slices.ContainsFunc(s.Region, func(region string) bool {
+		return strings.EqualFold(region, label)
+	})
+}
@@ -0,0 +1,48 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestRegionFilter(t *testing.T) {
+	list := "192.0.2.0/24 eu\n198.51.100.0/24 us\n203.0.113.0/24 EU prague\n2001:db8::/32 asia\n"
+	for _, tc := range []struct {
+		region []string
+		want   []string
+	}{
+		{nil, []string{"192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/24", "2001:db8::/32"}},
+		{[]string{"eu"}, []string{"192.0.2.0/24", "203.0.113.0/24"}},
+		{[]string{"us", "asia"}, []string{"198.51.100.0/24", "2001:db8::/32"}},
+		{[]string{"prague"}, []string{"203.0.113.0/24"}},
+	} {
+		s := newTestRange(sequenceServer(t, list).URL)
+		s.Format = formatLabeled
+		s.Region = tc.region
+		if err := s.refresh(); err != nil {
+			t.Fatalf("region %v: refresh error: %v", tc.region, err)
+		}
+		if got, want := s.GetIPRanges(nil), parsePrefixes(t, tc.want...); !slices.Equal(got, want) {
+			t.Errorf("region %v: got %v, want %v", tc.region, got, want)
+		}
+	}
+}
+
+func TestRegionProvision(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	for _, r := range []WedosIPRange{
+		{Region: []string{"eu"}},
+		{Region: []string{"eu"}, Format: formatText},
+		{Region: []string{"eu"}, Format: formatLabeled, ParseCacheSize: 4},
+	} {
+		if err := r.Provision(ctx); err == nil {
+			t.Errorf("%+v: expected an error", r)
+			r.Cleanup()
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package caddy_wedos_ip
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Results of a refresh cycle in the ReportFile.
+const (
+	reportSuccess = "success"
+	reportError   = "error"
+)
+
+// refreshReport is the content of ReportFile, describing the latest
+// refresh cycle.
+type refreshReport struct {
+	Time     time.Time `json:"time"`
+	Result   string    `json:"result"`
+	Count    int       `json:"count"`
+	Error    string    `json:"error,omitempty"`
+	Source   string    `json:"source"`
+	Duration string    `json:"duration"`
+	Hash     string    `json:"hash"`
+}
+
+// writeReport atomically rewrites ReportFile with the outcome of the
+// refresh cycle that started at refreshStarted. Count is that of the
+// ranges in use, which a failed refresh keeps. Only called by the refresh
+// goroutine.
+func (s *WedosIPRange) writeReport(res RefreshResult) {
+	s.lock.RLock()
+	r := refreshReport{
+		Time:     res.Time,
+		Result:   reportSuccess,
+		Count:    len(s.ranges),
+		Source:   s.source(),
+		Duration: res.Time.Sub(s.refreshStarted).String(),
+		Hash:     contentHash(s.ranges),
+	}
+	s.lock.RUnlock()
+	if res.Err != nil {
+		r.Result = reportError
+		r.Error = res.Err.Error()
+	}
+	data, err := json.Marshal(r)
+	if err == nil {
+		err = writeFileAtomic(s.ReportFile, append(data, '\n'))
+	}
+	if err != nil {
+		s.logger.Warn("writing report_file failed", zap.String("path", s.ReportFile), zap.Error(err))
+	}
+}
@@ -0,0 +1,61 @@
+package caddy_wedos_ip
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReportFile(t *testing.T) {
+	var fail atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("192.0.2.0/24 2001:db8::/32"))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	s := newTestRange(srv.URL)
+	s.ReportFile = path
+	read := func() refreshReport {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r refreshReport
+		if err := json.Unmarshal(data, &r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	r := read()
+	want := contentHash(parsePrefixes(t, "192.0.2.0/24", "2001:db8::/32"))
+	if r.Result != reportSuccess || r.Count != 2 || r.Hash != want || r.Source != srv.URL || r.Error != "" {
+		t.Errorf("unexpected report after a success: %+v", r)
+	}
+	if r.Time.IsZero() || r.Duration == "" {
+		t.Errorf("expected the time and duration reported, got %+v", r)
+	}
+
+	// A failed refresh reports the error with the ranges still in use.
+	fail.Store(true)
+	if err := s.refresh(); err == nil {
+		t.Fatal("expected the refresh to fail")
+	}
+	r = read()
+	if r.Result != reportError || r.Error == "" || r.Count != 2 || r.Hash != want {
+		t.Errorf("unexpected report after a failure: %+v", r)
+	}
+}
@@ -0,0 +1,51 @@
+package caddy_wedos_ip
+
+import (
+	"errors"
+	"net/netip"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// perCycleRetryDelay separates the attempts of a fetch retried within a
+// refresh cycle.
+const perCycleRetryDelay = 250 * time.Millisecond
+
+// retryFetch calls fetch, retrying it up to PerCycleRetries times while it
+// fails transiently, telling it whether the attempt is a retry. Waiting for
+// the next attempt is cut short by the end of the cycle budget, see
+// MaxCycleDuration.
+func (s *WedosIPRange) retryFetch(api string, fetch func(retry bool) ([]netip.Prefix, string, error)) ([]netip.Prefix, string, error) {
+	for attempt := 0; ; attempt++ {
+		prefixes, etag, err := fetch(attempt > 0)
+		if err == nil || attempt >= s.PerCycleRetries || !retryableError(err) {
+			return prefixes, etag, err
+		}
+		s.logger.Debug("retrying WEDOS IP list fetch",
+			zap.String("url", redactURL(api)),
+			zap.Int("attempt", attempt+1),
+			zap.Error(err))
+		timer := time.NewTimer(perCycleRetryDelay)
+		select {
+		case <-timer.C:
+		case <-s.baseContext().Done():
+			timer.Stop()
+			return prefixes, etag, err
+		}
+	}
+}
+
+// retryableError reports whether err is likely a momentary upstream blip:
+// a 5xx status, or a timeout or connection failure.
+func retryableError(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+	switch classifyError(err) {
+	case errClassTimeout, errClassConnection:
+		return true
+	}
+	return false
+}
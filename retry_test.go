@@ -0,0 +1,179 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+// flakyServer answers status to the first failures requests, and the list
+// afterwards.
+func flakyServer(t *testing.T, status int, failures int32) (*httptest.Server, *atomic.Int32) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func TestPerCycleRetries(t *testing.T) {
+	srv, hits := flakyServer(t, http.StatusBadGateway, 2)
+	s := newTestRange(srv.URL)
+	s.PerCycleRetries = 2
+	if err := s.refresh(); err != nil {
+		t.Fatalf("expected the retries to succeed, got %v", err)
+	}
+	if n := hits.Load(); n != 3 {
+		t.Errorf("expected 3 attempts, got %d", n)
+	}
+	if got := s.GetIPRanges(nil); len(got) != 1 {
+		t.Errorf("expected the list to be applied, got %v", got)
+	}
+}
+
+func TestPerCycleRetriesExhausted(t *testing.T) {
+	srv, hits := flakyServer(t, http.StatusServiceUnavailable, 10)
+	s := newTestRange(srv.URL)
+	s.PerCycleRetries = 1
+	var statusErr *StatusError
+	if err := s.refresh(); !errors.As(err, &statusErr) {
+		t.Fatalf("expected a status error, got %v", err)
+	}
+	if n := hits.Load(); n != 2 {
+		t.Errorf("expected 2 attempts, got %d", n)
+	}
+}
+
+func TestPerCycleRetriesSkipsClientErrors(t *testing.T) {
+	srv, hits := flakyServer(t, http.StatusNotFound, 10)
+	s := newTestRange(srv.URL)
+	s.PerCycleRetries = 3
+	if err := s.refresh(); err == nil {
+		t.Fatal("expected the refresh to fail")
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("expected a 404 not to be retried, got %d attempts", n)
+	}
+}
+
+func TestPerCycleRetriesRespectBudget(t *testing.T) {
+	srv, hits := flakyServer(t, http.StatusServiceUnavailable, 10)
+	s := newTestRange(srv.URL)
+	s.PerCycleRetries = 5
+	ctx, cancel := context.WithTimeout(context.Background(), perCycleRetryDelay/2)
+	defer cancel()
+	s.cycleCtx = ctx
+
+	start := time.Now()
+	if err := s.refresh(); err == nil {
+		t.Fatal("expected the refresh to fail")
+	}
+	if elapsed := time.Since(start); elapsed >= perCycleRetryDelay {
+		t.Errorf("expected the wait to end with the cycle budget, took %v", elapsed)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("expected 1 attempt, got %d", n)
+	}
+}
+
+func TestRetryableError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{&StatusError{StatusCode: 502}, true},
+		{&StatusError{StatusCode: 500}, true},
+		{&StatusError{StatusCode: 429}, false},
+		{context.DeadlineExceeded, true},
+		{errTruncatedResponse, true},
+		{errors.New("parse error"), false},
+		{errNotModified, false},
+	} {
+		if got := retryableError(tc.err); got != tc.want {
+			t.Errorf("retryableError(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+// hangingServer never answers the first hangs requests, and serves the
+// list afterwards.
+func hangingServer(t *testing.T, hangs int32) *httptest.Server {
+	var hits atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) <= hangs {
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+			return
+		}
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	t.Cleanup(func() {
+		close(release)
+		srv.Close()
+	})
+	return srv
+}
+
+func TestPerTryTimeout(t *testing.T) {
+	s := newTestRange(hangingServer(t, 1).URL)
+	s.PerCycleRetries = 1
+	s.Timeout = caddy.Duration(100 * time.Millisecond)
+	s.MaxCycleDuration = caddy.Duration(2 * time.Second)
+
+	start := time.Now()
+	if err := s.refresh(); err != nil {
+		t.Fatalf("expected the retry to succeed, got %v", err)
+	}
+	// The hung attempt gave up after its own timeout, not the cycle's.
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("expected the cycle to finish well within its budget, took %v", d)
+	}
+	if got := s.GetIPRanges(nil); len(got) != 1 {
+		t.Errorf("expected the list to be applied, got %v", got)
+	}
+}
+
+func TestCycleTimeoutEndsRetries(t *testing.T) {
+	s := newTestRange(hangingServer(t, 100).URL)
+	s.PerCycleRetries = 100
+	s.Timeout = caddy.Duration(100 * time.Millisecond)
+	s.MaxCycleDuration = caddy.Duration(400 * time.Millisecond)
+
+	start := time.Now()
+	if err := s.refresh(); !errors.Is(err, errCycleBudget) {
+		t.Fatalf("expected the cycle budget to run out, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("expected the cycle to end at its budget, took %v", d)
+	}
+}
+
+func TestUnmarshalTimeoutAliases(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`
+	wedos {
+		per_try_timeout 5s
+		cycle_timeout 30s
+	}`)
+	var r WedosIPRange
+	if err := r.UnmarshalCaddyfile(d); err != nil {
+		t.Fatal(err)
+	}
+	if r.Timeout != caddy.Duration(5*time.Second) || r.MaxCycleDuration != caddy.Duration(30*time.Second) {
+		t.Errorf("incorrect timeouts: timeout %v, max_cycle_duration %v", r.Timeout, r.MaxCycleDuration)
+	}
+}
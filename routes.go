@@ -0,0 +1,158 @@
+package caddy_wedos_ip
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Route flags of the Linux routing table.
+const (
+	rtfUp     = 0x0001
+	rtfReject = 0x0200
+)
+
+// systemRoutes returns the destinations of the host's usable routes. It is
+// a variable so tests can stub the routing table.
+var systemRoutes = readProcRoutes
+
+// checkRouteSupport rejects CheckRoutes where the routing table can't be
+// read.
+func (s *WedosIPRange) checkRouteSupport() error {
+	if s.CheckRoutes && runtime.GOOS != "linux" {
+		return fmt.Errorf("check_routes is not supported on %s", runtime.GOOS)
+	}
+	return nil
+}
+
+// checkRoutes logs the prefixes no route of the host covers, even in part.
+// It only reads the routing table.
+func (s *WedosIPRange) checkRoutes(prefixes []netip.Prefix) {
+	routes, err := systemRoutes()
+	if err != nil {
+		s.logger.Warn("reading the routing table failed", zap.Error(err))
+		return
+	}
+	unroutable := unroutablePrefixes(prefixes, routes)
+	if len(unroutable) == 0 {
+		return
+	}
+	s.logger.Warn("WEDOS IP ranges not routable from this host, check the network configuration",
+		zap.Int("count", len(unroutable)),
+		zap.Stringers("prefixes", unroutable))
+}
+
+// unroutablePrefixes returns the prefixes overlapping none of routes.
+func unroutablePrefixes(prefixes, routes []netip.Prefix) []netip.Prefix {
+	var out []netip.Prefix
+	for _, p := range prefixes {
+		routable := false
+		for _, r := range routes {
+			if r.Overlaps(p) {
+				routable = true
+				break
+			}
+		}
+		if !routable {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// readProcRoutes reads the IPv4 and IPv6 routing tables from /proc. A
+// missing IPv6 table means IPv6 is disabled and yields no IPv6 routes.
+func readProcRoutes() ([]netip.Prefix, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	routes, err := parseProcRoute(f)
+	if err != nil {
+		return nil, fmt.Errorf("/proc/net/route: %w", err)
+	}
+
+	f6, err := os.Open("/proc/net/ipv6_route")
+	if os.IsNotExist(err) {
+		return routes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f6.Close()
+	routes6, err := parseProcIPv6Route(f6)
+	if err != nil {
+		return nil, fmt.Errorf("/proc/net/ipv6_route: %w", err)
+	}
+	return append(routes, routes6...), nil
+}
+
+// parseProcRoute parses /proc/net/route: a header line, then one route per
+// line with the destination, flags and mask as hexadecimal fields 1, 3 and
+// 7, the addresses in host byte order.
+func parseProcRoute(r io.Reader) ([]netip.Prefix, error) {
+	var routes []netip.Prefix
+	sc := bufio.NewScanner(r)
+	sc.Scan() // Skip the header.
+	for n := 2; sc.Scan(); n++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 8 {
+			return nil, fmt.Errorf("line %d: expected at least 8 fields, got %d", n, len(fields))
+		}
+		dst, err1 := strconv.ParseUint(fields[1], 16, 32)
+		flags, err2 := strconv.ParseUint(fields[3], 16, 32)
+		mask, err3 := strconv.ParseUint(fields[7], 16, 32)
+		if err1 != nil || err2 != nil || err3 != nil {
+			return nil, fmt.Errorf("line %d: malformed route %q", n, sc.Text())
+		}
+		if flags&rtfUp == 0 || flags&rtfReject != 0 {
+			continue
+		}
+		var addr, bits [4]byte
+		binary.NativeEndian.PutUint32(addr[:], uint32(dst))
+		binary.NativeEndian.PutUint32(bits[:], uint32(mask))
+		ones := 0
+		for _, b := range bits {
+			for ; b&0x80 != 0; b <<= 1 {
+				ones++
+			}
+		}
+		routes = append(routes, netip.PrefixFrom(netip.AddrFrom4(addr), ones).Masked())
+	}
+	return routes, sc.Err()
+}
+
+// parseProcIPv6Route parses /proc/net/ipv6_route: one route per line, with
+// the destination, its prefix length and the flags as hexadecimal fields
+// 0, 1 and 8.
+func parseProcIPv6Route(r io.Reader) ([]netip.Prefix, error) {
+	var routes []netip.Prefix
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 9 {
+			return nil, fmt.Errorf("line %d: expected at least 9 fields, got %d", n, len(fields))
+		}
+		dst, err1 := hex.DecodeString(fields[0])
+		ones, err2 := strconv.ParseUint(fields[1], 16, 8)
+		flags, err3 := strconv.ParseUint(fields[8], 16, 32)
+		if err1 != nil || err2 != nil || err3 != nil || len(dst) != 16 || ones > 128 {
+			return nil, fmt.Errorf("line %d: malformed route %q", n, sc.Text())
+		}
+		if flags&rtfUp == 0 || flags&rtfReject != 0 {
+			continue
+		}
+		routes = append(routes, netip.PrefixFrom(netip.AddrFrom16([16]byte(dst)), int(ones)).Masked())
+	}
+	return routes, sc.Err()
+}
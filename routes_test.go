@@ -0,0 +1,77 @@
+package caddy_wedos_ip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// procHex formats an IPv4 address or mask the way /proc/net/route does.
+func procHex(addr string) string {
+	b := netip.MustParseAddr(addr).As4()
+	return fmt.Sprintf("%08X", binary.NativeEndian.Uint32(b[:]))
+}
+
+func TestParseProcRoute(t *testing.T) {
+	table := "Iface\tDestination\tGateway\tFlags\tRefCnt\tUse\tMetric\tMask\tMTU\tWindow\tIRTT\n" +
+		"eth0\t" + procHex("192.0.2.0") + "\t00000000\t0001\t0\t0\t0\t" + procHex("255.255.255.0") + "\t0\t0\t0\n" +
+		"eth0\t" + procHex("198.51.100.0") + "\t00000000\t0000\t0\t0\t0\t" + procHex("255.255.255.0") + "\t0\t0\t0\n" +
+		"eth0\t" + procHex("203.0.113.0") + "\t00000000\t0201\t0\t0\t0\t" + procHex("255.255.255.128") + "\t0\t0\t0\n" +
+		"eth1\t" + procHex("10.0.0.0") + "\t00000000\t0003\t0\t0\t0\t" + procHex("255.0.0.0") + "\t0\t0\t0\n"
+	routes, err := parseProcRoute(strings.NewReader(table))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The route that is down and the reject route are skipped.
+	if want := parsePrefixes(t, "192.0.2.0/24", "10.0.0.0/8"); !slices.Equal(routes, want) {
+		t.Errorf("expected %v, got %v", want, routes)
+	}
+
+	if _, err := parseProcRoute(strings.NewReader("header\neth0 zz\n")); err == nil {
+		t.Error("expected an error for a malformed line")
+	}
+}
+
+func TestParseProcIPv6Route(t *testing.T) {
+	table := "20010db8000000000000000000000000 20 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001 eth0\n" +
+		"00000000000000000000000000000000 00 00000000000000000000000000000000 00 00000000000000000000000000000000 ffffffff 00000001 00000000 00200200 lo\n"
+	routes, err := parseProcIPv6Route(strings.NewReader(table))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := parsePrefixes(t, "2001:db8::/32"); !slices.Equal(routes, want) {
+		t.Errorf("expected %v, got %v", want, routes)
+	}
+}
+
+func TestCheckRoutes(t *testing.T) {
+	prev := systemRoutes
+	t.Cleanup(func() { systemRoutes = prev })
+	systemRoutes = func() ([]netip.Prefix, error) {
+		return parsePrefixes(t, "192.0.2.0/23", "198.51.100.128/25"), nil
+	}
+
+	srv := sequenceServer(t, "192.0.2.0/24 198.51.100.0/24 203.0.113.0/24")
+	s := newTestRange(srv.URL)
+	s.CheckRoutes = true
+	core, logs := observer.New(zap.WarnLevel)
+	s.logger = zap.New(core)
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := logs.FilterMessageSnippet("not routable").All()
+	if len(entries) != 1 {
+		t.Fatalf("expected one warning, got %d", len(entries))
+	}
+	// 198.51.100.0/24 is routable in part.
+	if got := fmt.Sprint(entries[0].ContextMap()["prefixes"]); got != "[203.0.113.0/24]" {
+		t.Errorf("expected only 203.0.113.0/24 logged, got %s", got)
+	}
+}
@@ -0,0 +1,51 @@
+package caddy_wedos_ip
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// defaultScanBufferSize is the longest line or token of a list without
+// ScanBufferSize, well above the 64KiB bufio default.
+const defaultScanBufferSize = 1 << 20
+
+// scanSizedReader carries the ScanBufferSize of a module to the scanners
+// of the parsers and transforms, which only get a reader.
+type scanSizedReader struct {
+	io.Reader
+	size int
+}
+
+// scanSized wraps r for newScanner to use the module's ScanBufferSize.
+func (s *WedosIPRange) scanSized(r io.Reader) io.Reader {
+	if s.ScanBufferSize <= 0 {
+		return r
+	}
+	if sr, ok := r.(*scanSizedReader); ok {
+		r = sr.Reader
+	}
+	return &scanSizedReader{Reader: r, size: int(s.ScanBufferSize)}
+}
+
+// newScanner returns a scanner of r whose buffer grows up to the size r
+// carries, or defaultScanBufferSize.
+func newScanner(r io.Reader) *bufio.Scanner {
+	size := defaultScanBufferSize
+	if sr, ok := r.(*scanSizedReader); ok {
+		size = sr.size
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, min(size, 4096)), size)
+	return sc
+}
+
+// scanErr points a line or token too long for the scanner buffer at
+// scan_buffer_size.
+func scanErr(err error) error {
+	if errors.Is(err, bufio.ErrTooLong) {
+		return fmt.Errorf("%w, raise scan_buffer_size", err)
+	}
+	return err
+}
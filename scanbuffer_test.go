@@ -0,0 +1,35 @@
+package caddy_wedos_ip
+
+import (
+	"bufio"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestScanBufferSize(t *testing.T) {
+	// One 3MB line: a prefix and a giant label, past the default buffer.
+	list := "192.0.2.0/24 " + strings.Repeat("x", 3<<20) + "\n198.51.100.0/24\n"
+
+	s := newTestRange(sequenceServer(t, list).URL)
+	s.Format = formatLabeled
+	err := s.refresh()
+	if !errors.Is(err, bufio.ErrTooLong) || !strings.Contains(err.Error(), "scan_buffer_size") {
+		t.Fatalf("expected a too long error pointing at scan_buffer_size, got %v", err)
+	}
+
+	s = newTestRange(sequenceServer(t, list).URL)
+	s.Format = formatLabeled
+	s.Transform = []string{"strip-comments"}
+	s.ScanBufferSize = 4 << 20
+	if err := s.provisionTransforms(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24", "198.51.100.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
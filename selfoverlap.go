@@ -0,0 +1,67 @@
+package caddy_wedos_ip
+
+import (
+	"net"
+	"net/netip"
+
+	"go.uber.org/zap"
+)
+
+// localAddrs returns the addresses of the host's network interfaces. It
+// is a variable so tests can stub the interfaces.
+var localAddrs = readInterfaceAddrs
+
+// readInterfaceAddrs lists the addresses of every network interface.
+func readInterfaceAddrs() ([]netip.Addr, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	var out []netip.Addr
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if addr, ok := netip.AddrFromSlice(ipNet.IP); ok {
+			out = append(out, addr.Unmap())
+		}
+	}
+	return out, nil
+}
+
+// provisionSelfOverlap reads the local addresses for WarnSelfOverlap. A
+// failure only disables the check, which is a diagnostic.
+func (s *WedosIPRange) provisionSelfOverlap() {
+	if !s.WarnSelfOverlap {
+		return
+	}
+	addrs, err := localAddrs()
+	if err != nil {
+		s.logger.Warn("reading the local interface addresses failed, warn_self_overlap disabled", zap.Error(err))
+		return
+	}
+	s.selfAddrs = addrs
+}
+
+// checkSelfOverlap logs the fetched prefixes containing an address of
+// this host, which would make it trust itself as a proxy.
+func (s *WedosIPRange) checkSelfOverlap(prefixes []netip.Prefix) {
+	var overlapping []netip.Prefix
+	var addrs []netip.Addr
+	for _, p := range prefixes {
+		for _, a := range s.selfAddrs {
+			if p.Contains(a) {
+				overlapping = append(overlapping, p)
+				addrs = append(addrs, a)
+				break
+			}
+		}
+	}
+	if len(overlapping) == 0 {
+		return
+	}
+	s.logger.Warn("WEDOS IP ranges contain addresses of this host, check for an overly broad list",
+		zap.Stringers("prefixes", overlapping),
+		zap.Stringers("local_addrs", addrs))
+}
@@ -0,0 +1,55 @@
+package caddy_wedos_ip
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestWarnSelfOverlap(t *testing.T) {
+	prev := localAddrs
+	t.Cleanup(func() { localAddrs = prev })
+	localAddrs = func() ([]netip.Addr, error) {
+		return []netip.Addr{netip.MustParseAddr("127.0.0.1"), netip.MustParseAddr("198.51.100.7")}, nil
+	}
+
+	srv := sequenceServer(t, "192.0.2.0/24 198.51.100.0/24 2001:db8::/32")
+	s := newTestRange(srv.URL)
+	s.WarnSelfOverlap = true
+	core, logs := observer.New(zap.WarnLevel)
+	s.logger = zap.New(core)
+	s.provisionSelfOverlap()
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := logs.FilterMessageSnippet("addresses of this host").All()
+	if len(entries) != 1 {
+		t.Fatalf("expected one warning, got %d", len(entries))
+	}
+	if got := fmt.Sprint(entries[0].ContextMap()["prefixes"]); got != "[198.51.100.0/24]" {
+		t.Errorf("expected only 198.51.100.0/24 logged, got %s", got)
+	}
+}
+
+func TestWarnSelfOverlapUnreadable(t *testing.T) {
+	prev := localAddrs
+	t.Cleanup(func() { localAddrs = prev })
+	localAddrs = func() ([]netip.Addr, error) { return nil, errors.New("no interfaces") }
+
+	s := newTestRange("http://127.0.0.1")
+	s.WarnSelfOverlap = true
+	core, logs := observer.New(zap.WarnLevel)
+	s.logger = zap.New(core)
+	s.provisionSelfOverlap()
+	if logs.FilterMessageSnippet("warn_self_overlap disabled").Len() != 1 {
+		t.Error("expected the check to be disabled with a warning")
+	}
+	if s.selfAddrs != nil {
+		t.Errorf("expected no local addresses, got %v", s.selfAddrs)
+	}
+}
@@ -0,0 +1,73 @@
+package caddy_wedos_ip
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// SelfTestResult reports the fetch run by SelfTest.
+type SelfTestResult struct {
+	// Source describes where the ranges were read from.
+	Source string `json:"source"`
+	// Count is the number of applied ranges, IPv4 and IPv6 the number of
+	// each family.
+	Count int `json:"count"`
+	IPv4  int `json:"ipv4"`
+	IPv6  int `json:"ipv6"`
+	// Duration is how long provisioning and the fetch took.
+	Duration time.Duration `json:"duration"`
+}
+
+// SelfTest provisions the module from its JSON config, as found under
+// "http.ip_sources.wedos" in a Caddy config, runs a single fetch and
+// reports the result, without starting a Caddy server. It is meant for
+// scripts and CI pipelines validating a config and the connectivity to
+// its source before deploying it.
+//
+// Unknown fields are rejected. Every option writing outside the module or
+// waiting for outside events is ignored, so a self-test has no side
+// effects: cache_file, storage_key, publish_file, report_file,
+// quarantine_file, notify_url, on_update_command, sse_url and
+// trigger_file. A failed fetch is not retried.
+func SelfTest(ctx context.Context, config []byte) (SelfTestResult, error) {
+	var s WedosIPRange
+	dec := json.NewDecoder(bytes.NewReader(config))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return SelfTestResult{}, fmt.Errorf("decoding config: %v", err)
+	}
+	s.CacheFile = ""
+	s.CacheFallbackAfter = 0
+	s.StorageKey = ""
+	s.PublishFile = ""
+	s.ReportFile = ""
+	s.QuarantineFile = ""
+	s.QuarantineMaxChange = 0
+	s.NotifyURL = ""
+	s.OnUpdateCommand = nil
+	s.SSEURL = ""
+	s.TriggerFile = ""
+	s.RequireOnStart = true
+	s.StartupRetries = 0
+
+	cctx, cancel := caddy.NewContext(caddy.Context{Context: ctx})
+	defer cancel()
+
+	start := time.Now()
+	err := s.Provision(cctx)
+	result := SelfTestResult{Source: s.source(), Duration: time.Since(start)}
+	if err != nil {
+		return result, err
+	}
+	defer s.Cleanup()
+
+	result.Count = len(s.GetIPRanges(nil))
+	result.IPv4 = len(s.GetIPRangesByFamily(false))
+	result.IPv6 = len(s.GetIPRangesByFamily(true))
+	return result, nil
+}
@@ -0,0 +1,58 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	srv := sequenceServer(t, "192.0.2.0/24 198.51.100.0/24 2001:db8::/32")
+	cache := filepath.Join(t.TempDir(), "cache.txt")
+	var notified atomic.Int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notified.Add(1)
+	}))
+	defer hook.Close()
+
+	config := fmt.Sprintf(`{"url": %q, "cache_file": %q, "cache_fallback_after": 2, "storage_key": "wedos/ips", "notify_url": %q, "quarantine_file": %q, "trigger_file": %q}`,
+		srv.URL, cache, hook.URL, cache+".quarantine", cache+".trigger")
+	res, err := SelfTest(context.Background(), []byte(config))
+	if err != nil {
+		t.Fatalf("SelfTest error: %v", err)
+	}
+	if res.Count != 3 || res.IPv4 != 2 || res.IPv6 != 1 {
+		t.Errorf("unexpected result %+v", res)
+	}
+	if res.Source != srv.URL || res.Duration <= 0 {
+		t.Errorf("unexpected source or duration in %+v", res)
+	}
+	if matches, _ := filepath.Glob(cache + "*"); len(matches) > 0 {
+		t.Errorf("expected no cache file to be written, found %v", matches)
+	}
+	if n := notified.Load(); n != 0 {
+		t.Errorf("expected no notification, got %d", n)
+	}
+}
+
+func TestSelfTestErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	for _, config := range []string{
+		`{"url": `,
+		`{"url": "https://example.com/ips.txt", "intervall": "1h"}`,
+		`{"url": "https://example.com/ips.txt", "min_prefixes": -1}`,
+		fmt.Sprintf(`{"url": %q}`, srv.URL),
+	} {
+		if _, err := SelfTest(context.Background(), []byte(config)); err == nil {
+			t.Errorf("%s: expected an error", config)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package caddy_wedos_ip
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// errOlderSerial is returned for a list whose serial is lower than the
+// applied one, such as a regressed copy on a stale mirror.
+var errOlderSerial = errors.New("serial is older than the applied one")
+
+// serialFilter passes a list through as it is read, dropping the first line
+// starting with marker and parsing the rest of that line as the list's
+// serial.
+type serialFilter struct {
+	r      *bufio.Reader
+	marker string
+	line   []byte
+	err    error
+	serial uint64
+	found  bool
+}
+
+func newSerialFilter(r io.Reader, marker string) *serialFilter {
+	return &serialFilter{r: bufio.NewReader(r), marker: marker}
+}
+
+func (f *serialFilter) Read(p []byte) (int, error) {
+	for len(f.line) == 0 {
+		if f.err != nil {
+			return 0, f.err
+		}
+		f.line, f.err = f.r.ReadBytes('\n')
+		if f.found {
+			continue
+		}
+		if val, ok := strings.CutPrefix(strings.TrimSpace(string(f.line)), f.marker); ok {
+			n, err := strconv.ParseUint(strings.TrimSpace(val), 10, 64)
+			if err != nil {
+				f.line, f.err = nil, fmt.Errorf("invalid serial %q: %v", strings.TrimSpace(val), err)
+				continue
+			}
+			f.serial, f.found, f.line = n, true, nil
+		}
+	}
+	n := copy(p, f.line)
+	f.line = f.line[n:]
+	return n, nil
+}
+
+// result returns the serial once the list was read to the end.
+func (f *serialFilter) result() (uint64, error) {
+	if !f.found {
+		return 0, fmt.Errorf("no serial line starting with %q", f.marker)
+	}
+	return f.serial, nil
+}
+
+// extractSerial finds the line of data starting with marker, parses the
+// rest of it as the list's serial and returns data without that line.
+func extractSerial(data []byte, marker string) (uint64, []byte, error) {
+	f := newSerialFilter(bytes.NewReader(data), marker)
+	rest, err := io.ReadAll(f)
+	if err != nil {
+		return 0, nil, err
+	}
+	serial, err := f.result()
+	if err != nil {
+		return 0, nil, err
+	}
+	return serial, rest, nil
+}
+
+// checkSerial rejects a list read through f if it has no serial or one
+// lower than the applied serial. The serial is applied with the list;
+// until then it is kept in pendingSerial.
+func (s *WedosIPRange) checkSerial(f *serialFilter) error {
+	serial, err := f.result()
+	if err != nil {
+		return err
+	}
+	if serial < s.serial {
+		return fmt.Errorf("%w: got %d, applied %d", errOlderSerial, serial, s.serial)
+	}
+	s.pendingSerial = serial
+	return nil
+}
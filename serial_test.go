@@ -0,0 +1,81 @@
+package caddy_wedos_ip
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestExtractSerial(t *testing.T) {
+	serial, rest, err := extractSerial([]byte("# serial 2025010101\n192.0.2.0/24\n198.51.100.0/24\n"), "# serial")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if serial != 2025010101 {
+		t.Errorf("expected serial 2025010101, got %d", serial)
+	}
+	if string(rest) != "192.0.2.0/24\n198.51.100.0/24\n" {
+		t.Errorf("expected the serial line to be removed, got %q", rest)
+	}
+
+	for _, body := range []string{"192.0.2.0/24\n", "# serial soon\n192.0.2.0/24\n"} {
+		if _, _, err := extractSerial([]byte(body), "# serial"); err == nil {
+			t.Errorf("extractSerial(%q): expected error", body)
+		}
+	}
+}
+
+func TestSerialRejectsOlder(t *testing.T) {
+	s := newTestRange(sequenceServer(t,
+		"# serial 2\n192.0.2.0/24\n",
+		"# serial 1\n198.51.100.0/24\n",
+		"# serial 2\n203.0.113.0/24\n",
+	).URL)
+	s.Serial = "# serial"
+
+	if err := s.refresh(); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if err := s.refresh(); !errors.Is(err, errOlderSerial) {
+		t.Fatalf("expected an older serial to be rejected, got %v", err)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected the applied ranges to be kept, got %v", got)
+	}
+	// The same serial is accepted.
+	if err := s.refresh(); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if got := s.status().Serial; got != 2 {
+		t.Errorf("expected serial 2, got %d", got)
+	}
+}
+
+func TestSerialFailsOverStaleMirror(t *testing.T) {
+	stale := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("# serial 4\n192.0.2.0/24\n"))
+	}))
+	defer stale.Close()
+	current := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("# serial 6\n198.51.100.0/24\n"))
+	}))
+	defer current.Close()
+
+	s := newTestRange(stale.URL)
+	s.Serial = "# serial"
+	s.Mirrors = []string{current.URL}
+	s.SourceMaxFailures = defaultSourceMaxFailures
+	s.serial = 5
+
+	if err := s.refresh(); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "198.51.100.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected the mirror with the newer serial to be applied, got %v", got)
+	}
+	if s.serial != 6 {
+		t.Errorf("expected serial 6, got %d", s.serial)
+	}
+}
@@ -0,0 +1,84 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// provisionSets provisions the named range sets and checks that every
+// host mapping refers to one of them.
+func (s *WedosIPRange) provisionSets() error {
+	for name, set := range s.Sets {
+		if set == nil {
+			return fmt.Errorf("set %q: empty configuration", name)
+		}
+		if len(set.Sets) > 0 || len(set.HostSets) > 0 || len(set.SNISets) > 0 {
+			return fmt.Errorf("set %q: sets cannot be nested", name)
+		}
+		set.setChild = true
+		if err := set.Provision(s.ctx); err != nil {
+			return fmt.Errorf("set %q: %v", name, err)
+		}
+	}
+	for pattern, name := range s.HostSets {
+		if _, ok := s.Sets[name]; !ok {
+			return fmt.Errorf("host %q: unknown set %q", pattern, name)
+		}
+	}
+	for pattern, name := range s.SNISets {
+		if _, ok := s.Sets[name]; !ok {
+			return fmt.Errorf("sni %q: unknown set %q", pattern, name)
+		}
+	}
+	return nil
+}
+
+// selectSet returns the range set for the request, or s (its fetcher if
+// Shared) if no mapping matches. A mapping of the TLS server name (SNI) in
+// SNISets wins over one in HostSets, which is matched against the server
+// name too if there is one, and only otherwise against the Host header, so
+// a TLS client can't send a Host selecting a set its handshake didn't.
+// Within each, an exact name wins over wildcards, and a longer wildcard
+// such as "*.a.example.com" wins over "*.example.com".
+func (s *WedosIPRange) selectSet(r *http.Request) *WedosIPRange {
+	s = s.fetcher()
+	if r == nil || (len(s.HostSets) == 0 && len(s.SNISets) == 0) {
+		return s
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if r.TLS != nil && r.TLS.ServerName != "" {
+		if name, ok := matchSet(s.SNISets, r.TLS.ServerName); ok {
+			return s.Sets[name]
+		}
+		host = r.TLS.ServerName
+	}
+	if name, ok := matchSet(s.HostSets, host); ok {
+		return s.Sets[name]
+	}
+	return s
+}
+
+// matchSet returns the set name mapped to host, exact names first, then
+// the longest matching wildcard.
+func matchSet(sets map[string]string, host string) (string, bool) {
+	if len(sets) == 0 {
+		return "", false
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if name, ok := sets[host]; ok {
+		return name, true
+	}
+	for i := strings.IndexByte(host, '.'); i >= 0; i = strings.IndexByte(host, '.') {
+		host = host[i+1:]
+		if name, ok := sets["*."+host]; ok {
+			return name, true
+		}
+	}
+	return "", false
+}
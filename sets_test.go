@@ -0,0 +1,165 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func TestUnmarshalSets(t *testing.T) {
+	input := `
+	wedos {
+		url https://default.example.com/ips.txt
+		set tenant {
+			url https://tenant.example.com/ips.txt
+			interval 10m
+		}
+		host tenant tenant.example.com *.Tenant.example.com
+		timeout 5s
+	}`
+
+	r := WedosIPRange{}
+	if err := r.UnmarshalCaddyfile(caddyfile.NewTestDispenser(input)); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+
+	set := r.Sets["tenant"]
+	if set == nil || set.URL != "https://tenant.example.com/ips.txt" {
+		t.Fatalf("unexpected sets: %+v", r.Sets)
+	}
+	if set.Timeout != 0 || r.Timeout == 0 {
+		t.Errorf("options after the set block applied to the wrong module")
+	}
+	if r.HostSets["tenant.example.com"] != "tenant" || r.HostSets["*.tenant.example.com"] != "tenant" {
+		t.Errorf("unexpected host mapping: %v", r.HostSets)
+	}
+}
+
+func TestHostSets(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/default", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("192.0.2.0/24")) })
+	mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("198.51.100.0/24")) })
+	mux.HandleFunc("/b", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("203.0.113.0/24")) })
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{
+		URL:            srv.URL + "/default",
+		RequireOnStart: true,
+		Sets: map[string]*WedosIPRange{
+			"a": {URL: srv.URL + "/a", RequireOnStart: true},
+			"b": {URL: srv.URL + "/b", RequireOnStart: true},
+		},
+		HostSets: map[string]string{
+			"a.example.com":   "a",
+			"*.example.com":   "b",
+			"*.a.example.com": "a",
+		},
+	}
+	if err := r.Provision(ctx); err != nil {
+		t.Fatalf("error provisioning: %v", err)
+	}
+	defer r.Cleanup()
+
+	tests := map[string]string{
+		"a.example.com":      "198.51.100.0/24",
+		"A.Example.com:8443": "198.51.100.0/24",
+		"x.a.example.com":    "198.51.100.0/24",
+		"b.example.com":      "203.0.113.0/24",
+		"example.com":        "192.0.2.0/24",
+		"other.test":         "192.0.2.0/24",
+	}
+	for host, want := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = host
+		got := r.GetIPRanges(req)
+		if len(got) != 1 || got[0].String() != want {
+			t.Errorf("GetIPRanges(host %q) = %v, want %s", host, got, want)
+		}
+	}
+
+	if got := r.GetIPRanges(nil); len(got) != 1 || got[0].String() != "192.0.2.0/24" {
+		t.Errorf("GetIPRanges(nil) = %v", got)
+	}
+}
+
+func TestHostSetsUnknownSet(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{HostSets: map[string]string{"example.com": "missing"}}
+	if err := r.Provision(ctx); err == nil {
+		t.Errorf("expected provisioning to fail for an unknown set")
+	}
+}
+
+func TestSNISets(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/default", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("192.0.2.0/24")) })
+	mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("198.51.100.0/24")) })
+	mux.HandleFunc("/b", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("203.0.113.0/24")) })
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{
+		URL:            srv.URL + "/default",
+		RequireOnStart: true,
+		Sets: map[string]*WedosIPRange{
+			"a": {URL: srv.URL + "/a", RequireOnStart: true},
+			"b": {URL: srv.URL + "/b", RequireOnStart: true},
+		},
+		SNISets:  map[string]string{"*.a.example.com": "a"},
+		HostSets: map[string]string{"x.a.example.com": "b", "plain.example.com": "b"},
+	}
+	if err := r.Provision(ctx); err != nil {
+		t.Fatalf("error provisioning: %v", err)
+	}
+	defer r.Cleanup()
+
+	tests := []struct {
+		sni, host string
+		want      string
+	}{
+		// SNI wins over the Host header.
+		{"x.a.example.com", "x.a.example.com", "198.51.100.0/24"},
+		// Without a matching SNI, host mappings match the SNI, and the
+		// Host header only without one.
+		{"plain.example.com", "plain.example.com", "203.0.113.0/24"},
+		{"other.test", "plain.example.com", "192.0.2.0/24"},
+		{"", "x.a.example.com", "203.0.113.0/24"},
+		// Neither matches: the module's own ranges.
+		{"other.test", "other.test", "192.0.2.0/24"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = tt.host
+		if tt.sni != "" {
+			req.TLS = &tls.ConnectionState{ServerName: tt.sni}
+		}
+		got := r.GetIPRanges(req)
+		if len(got) != 1 || got[0].String() != tt.want {
+			t.Errorf("sni %q host %q: got %v, want %s", tt.sni, tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestSNIUnknownSet(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{URL: "http://127.0.0.1:1/ips.txt", SNISets: map[string]string{"example.com": "missing"}}
+	if err := r.Provision(ctx); err == nil {
+		t.Errorf("expected an error for an unknown set")
+	}
+}
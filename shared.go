@@ -0,0 +1,135 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/certmagic"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// sharedFetchers holds the fetchers of Shared modules, keyed by the hash
+// of their config and reference-counted across modules and config
+// reloads.
+var sharedFetchers = caddy.NewUsagePool()
+
+// sharedFetcher is the module doing the fetching for every Shared module
+// with its config. It runs on its own context, so it outlives the config
+// that created it as long as another one uses it.
+type sharedFetcher struct {
+	*WedosIPRange
+}
+
+// Destruct stops the fetcher once its last user is cleaned up.
+func (f sharedFetcher) Destruct() error {
+	f.stop()
+	return f.Cleanup()
+}
+
+// sharedKey returns the hash of the config of s, which Shared modules
+// must have identical to share a fetcher.
+func (s *WedosIPRange) sharedKey() (string, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// provisionShared makes s use the fetcher of the Shared modules with the
+// same config, starting it if s is the first.
+func (s *WedosIPRange) provisionShared(ctx caddy.Context) error {
+	if len(s.Sets) > 0 || len(s.HostSets) > 0 || len(s.SNISets) > 0 {
+		return fmt.Errorf("shared cannot be combined with sets")
+	}
+	key, err := s.sharedKey()
+	if err != nil {
+		return err
+	}
+	val, _, err := sharedFetchers.LoadOrNew(key, func() (caddy.Destructor, error) {
+		f := *s
+		// Not those of ctx: the fetcher may outlive its config, whose logs
+		// are closed and storage cleaned up when it is unloaded. The
+		// metrics are package-wide, registered by each user's Provision.
+		f.logger = zap.New(defaultLogCore{}).Named(string(s.CaddyModule().ID))
+		if s.StorageKey != "" {
+			f.storage = defaultStorage{}
+		}
+		fctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+		if err := f.setup(fctx); err != nil {
+			cancel()
+			return nil, err
+		}
+		f.stop = cancel
+		if err := f.start(); err != nil {
+			cancel()
+			f.Cleanup()
+			return nil, err
+		}
+		return sharedFetcher{&f}, nil
+	})
+	if err != nil {
+		return err
+	}
+	s.shared = val.(sharedFetcher).WedosIPRange
+	s.sharedKeyHash = key
+	return nil
+}
+
+// defaultLogCore writes through Caddy's default logger as of each entry,
+// so a shared fetcher logs to the running config's default log.
+type defaultLogCore struct {
+	fields []zapcore.Field
+}
+
+func (c defaultLogCore) core() zapcore.Core {
+	return caddy.Log().Core().With(c.fields)
+}
+
+func (c defaultLogCore) Enabled(level zapcore.Level) bool {
+	return caddy.Log().Core().Enabled(level)
+}
+
+func (c defaultLogCore) With(fields []zapcore.Field) zapcore.Core {
+	return defaultLogCore{fields: append(slices.Clip(c.fields), fields...)}
+}
+
+func (c defaultLogCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return c.core().Check(ent, ce)
+}
+
+func (c defaultLogCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.core().Write(ent, fields)
+}
+
+func (c defaultLogCore) Sync() error {
+	return caddy.Log().Core().Sync()
+}
+
+// defaultStorage keeps StorageKey in the storage of the running config,
+// which Caddy makes certmagic.Default.Storage on each load.
+type defaultStorage struct{}
+
+func (defaultStorage) Load(ctx context.Context, key string) ([]byte, error) {
+	return certmagic.Default.Storage.Load(ctx, key)
+}
+
+func (defaultStorage) Store(ctx context.Context, key string, value []byte) error {
+	return certmagic.Default.Storage.Store(ctx, key, value)
+}
+
+// fetcher returns the module holding the ranges of s: its shared fetcher,
+// or s itself.
+func (s *WedosIPRange) fetcher() *WedosIPRange {
+	if s.shared != nil {
+		return s.shared
+	}
+	return s
+}
@@ -0,0 +1,111 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/certmagic"
+)
+
+func TestSharedFetcher(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+	config := WedosIPRange{URL: srv.URL, Shared: true, RequireOnStart: true, Interval: caddy.Duration(time.Hour)}
+
+	a, b := config, config
+	if err := a.Provision(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Provision(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("expected identical configs to share one fetch, got %d", n)
+	}
+	ra, rb := a.GetIPRanges(nil), b.GetIPRanges(nil)
+	if len(ra) != 1 || &ra[0] != &rb[0] {
+		t.Errorf("expected both modules to return the shared snapshot, got %v and %v", ra, rb)
+	}
+
+	// A different config gets its own fetcher.
+	c := config
+	c.MinPrefixes = 1
+	if err := c.Provision(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	if n := hits.Load(); n != 2 {
+		t.Errorf("expected a different config to fetch on its own, got %d fetches", n)
+	}
+
+	key := a.sharedKeyHash
+	a.Cleanup()
+	if refs, ok := sharedFetchers.References(key); !ok || refs != 1 {
+		t.Errorf("expected the fetcher to stay for its remaining user, got %d %v", refs, ok)
+	}
+	if got := b.GetIPRanges(nil); len(got) != 1 {
+		t.Errorf("expected the remaining module to keep its ranges, got %v", got)
+	}
+	fetcher := b.shared
+	b.Cleanup()
+	if _, ok := sharedFetchers.References(key); ok {
+		t.Error("expected the fetcher to be removed with its last user")
+	}
+	if fetcher.ctx.Err() == nil {
+		t.Error("expected the fetcher to be stopped with its last user")
+	}
+}
+
+func TestSharedRejectsSets(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+	s := WedosIPRange{URL: "https://example.com/ips.txt", Shared: true, HostSets: map[string]string{"a.example.com": "a"}}
+	if err := s.Provision(ctx); err == nil {
+		t.Error("expected shared to be rejected with sets")
+	}
+}
+
+func TestSharedStorage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+
+	storage := &certmagic.FileStorage{Path: t.TempDir()}
+	prev := certmagic.Default.Storage
+	certmagic.Default.Storage = storage
+	defer func() { certmagic.Default.Storage = prev }()
+
+	// A context without a config, like the fetcher's own.
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+	s := WedosIPRange{URL: srv.URL, Shared: true, StorageKey: "wedos/shared", RequireOnStart: true, Interval: caddy.Duration(time.Hour)}
+	if err := s.Provision(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Cleanup()
+
+	data, err := storage.Load(context.Background(), "wedos/shared")
+	if err != nil {
+		t.Fatalf("expected the fetcher to write storage_key to the running config's storage: %v", err)
+	}
+	e, err := parseCacheEntry(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Prefixes) != 1 {
+		t.Errorf("expected the fetched range stored, got %v", e.Prefixes)
+	}
+}
@@ -0,0 +1,52 @@
+package caddy_wedos_ip
+
+import (
+	"net/netip"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// withShrinkGrace returns a fetched list with the prefixes the upstream
+// removed since the applied one added back, each until ShrinkGrace after
+// its removal, when reapExpired drops it. A prefix listed again is kept
+// for good. Only called by the refresh goroutine.
+func (s *WedosIPRange) withShrinkGrace(prefixes []netip.Prefix) []netip.Prefix {
+	s.lock.RLock()
+	prev := s.fetched
+	s.lock.RUnlock()
+
+	listed := make(map[netip.Prefix]bool, len(prefixes))
+	for _, p := range prefixes {
+		listed[p] = true
+	}
+	if s.pendingExpiries == nil {
+		s.pendingExpiries = make(map[netip.Prefix]time.Time)
+	}
+	until := s.now().Add(time.Duration(s.ShrinkGrace))
+	var removed []netip.Prefix
+	out := slices.Clip(prefixes)
+	for _, p := range prev {
+		if listed[p] {
+			continue
+		}
+		listed[p] = true
+		// Removed earlier and still in its grace window, or an entry_ttl
+		// entry that expires sooner.
+		expires, ok := s.expiries[p]
+		if !ok {
+			expires = until
+			removed = append(removed, p)
+		}
+		s.pendingExpiries[p] = expires
+		out = append(out, p)
+	}
+	if len(removed) > 0 {
+		s.logger.Warn("WEDOS IP prefixes removed upstream, still trusted during shrink_grace",
+			zap.Int("count", len(removed)),
+			zap.Stringers("prefixes", removed),
+			zap.Time("until", until))
+	}
+	return out
+}
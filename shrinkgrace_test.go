@@ -0,0 +1,76 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestShrinkGrace(t *testing.T) {
+	var body atomic.Value
+	body.Store("192.0.2.0/24 198.51.100.0/24 203.0.113.0/24")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body.Load().(string)))
+	}))
+	defer srv.Close()
+
+	core, logs := observer.New(zap.WarnLevel)
+	s, err := New(Options{
+		Config: WedosIPRange{
+			URL:            srv.URL,
+			ShrinkGrace:    caddy.Duration(300 * time.Millisecond),
+			RequireOnStart: true,
+			Interval:       caddy.Duration(time.Hour),
+		},
+		Logger: zap.New(core),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	// The shrunk list keeps the removed prefixes for the grace window.
+	body.Store("192.0.2.0/24 203.0.113.0/24")
+	if err := s.forceRefresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	all := parsePrefixes(t, "192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/24")
+	if got := s.GetIPRanges(nil); !slices.Equal(got, all) {
+		t.Errorf("expected %v during the grace window, got %v", all, got)
+	}
+	if logs.FilterMessageSnippet("shrink_grace").Len() != 1 {
+		t.Error("expected the pending removal to be logged")
+	}
+
+	// Another refresh neither extends the window nor logs it again, and a
+	// prefix listed again is kept for good.
+	body.Store("192.0.2.0/24")
+	if err := s.forceRefresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	body.Store("192.0.2.0/24 203.0.113.0/24")
+	if err := s.forceRefresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := logs.FilterMessageSnippet("shrink_grace").Len(); n != 2 {
+		t.Errorf("expected each removal to be logged once, got %d logs", n)
+	}
+
+	want := parsePrefixes(t, "192.0.2.0/24", "203.0.113.0/24")
+	waitFor(t, func() bool { return slices.Equal(s.GetIPRanges(nil), want) })
+	time.Sleep(400 * time.Millisecond)
+	if got := s.GetIPRanges(nil); !slices.Equal(got, want) {
+		t.Errorf("expected %v to stay after the window, got %v", want, got)
+	}
+}
@@ -0,0 +1,80 @@
+package caddy_wedos_ip
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// maxSignatureSize bounds the signature download.
+const maxSignatureSize = 4096
+
+// errBadSignature is returned if the list does not match its signature.
+var errBadSignature = errors.New("signature verification failed")
+
+// loadPublicKey reads a PEM-encoded ("PUBLIC KEY") Ed25519 public key.
+func loadPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("public_key: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("public_key: %s does not contain a PEM public key", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("public_key: %v", err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public_key: %s is a %T, not an Ed25519 key", path, key)
+	}
+	return pub, nil
+}
+
+// verifySignature fetches the detached signature from SignatureURL and
+// checks it against body. The signature may be raw or base64-encoded.
+func (s *WedosIPRange) verifySignature(body []byte) error {
+	ctx, cancel := s.getContext()
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(uncharged(ctx), http.MethodGet, s.SignatureURL, nil)
+	if err != nil {
+		return err
+	}
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetching signature: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("fetching signature: %w", &StatusError{StatusCode: resp.StatusCode, Status: resp.Status})
+	}
+	sig, err := io.ReadAll(io.LimitReader(resp.Body, maxSignatureSize))
+	if err != nil {
+		return fmt.Errorf("fetching signature: %w", err)
+	}
+
+	if len(sig) != ed25519.SignatureSize {
+		decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+		if err != nil {
+			return fmt.Errorf("%w: malformed signature", errBadSignature)
+		}
+		sig = decoded
+	}
+	if !ed25519.Verify(s.publicKey, body, sig) {
+		return errBadSignature
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func writePublicKey(t *testing.T, pub any) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "wedos.pub")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSignatureVerification(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	list := []byte("192.0.2.0/24\n")
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, list))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ips.txt":
+			w.Write(list)
+		case "/ips.txt.sig":
+			w.Write([]byte(sig + "\n"))
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{
+		URL:            srv.URL + "/ips.txt",
+		SignatureURL:   srv.URL + "/ips.txt.sig",
+		PublicKey:      writePublicKey(t, pub),
+		RequireOnStart: true,
+	}
+	if err := r.Provision(ctx); err != nil {
+		t.Fatalf("provision error: %v", err)
+	}
+	defer r.Cleanup()
+	if len(r.GetIPRanges(nil)) != 1 {
+		t.Errorf("expected the signed list to be applied")
+	}
+
+	// A tampered list is rejected.
+	list = []byte("0.0.0.0/0\n")
+	if _, err := r.fetch(r.URL); !errors.Is(err, errBadSignature) {
+		t.Errorf("expected a signature error, got %v", err)
+	}
+}
+
+func TestPublicKeyValidation(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	notKey := filepath.Join(t.TempDir(), "garbage.pub")
+	os.WriteFile(notKey, []byte("not a key"), 0o644)
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	key := writePublicKey(t, pub)
+
+	for _, r := range []WedosIPRange{
+		{SignatureURL: "https://example.com/ips.txt.sig"},
+		{SignatureURL: "https://example.com/ips.txt.sig", PublicKey: notKey},
+		{SignatureURL: "https://example.com/ips.txt.sig", PublicKey: filepath.Join(t.TempDir(), "missing.pub")},
+		// Unsigned TXT prefixes would be merged into the signed list.
+		{URL: "https://example.com/ips.txt", DNSTXT: "_ips.example.com", SignatureURL: "https://example.com/ips.txt.sig", PublicKey: key},
+	} {
+		if err := r.Provision(ctx); err == nil {
+			t.Errorf("expected an error for public_key %q", r.PublicKey)
+		}
+	}
+}
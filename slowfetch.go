@@ -0,0 +1,88 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// slowFetchCycles is how many scheduled refreshes in a row must take at
+// least the interval before it is reported as too short.
+const slowFetchCycles = 3
+
+// defaultAdaptIntervalFactor is the multiple of the observed refresh
+// duration AdaptInterval waits unless AdaptIntervalFactor says otherwise.
+const defaultAdaptIntervalFactor = 2
+
+// checkAdaptInterval validates AdaptIntervalFactor and defaults it.
+func (s *WedosIPRange) checkAdaptInterval() error {
+	if s.AdaptIntervalFactor < 0 {
+		return fmt.Errorf("adapt_interval factor must not be negative")
+	}
+	if s.AdaptInterval && s.AdaptIntervalFactor == 0 {
+		s.AdaptIntervalFactor = defaultAdaptIntervalFactor
+	}
+	return nil
+}
+
+// trackRefreshDuration notes how long a scheduled refresh took. Once
+// slowFetchCycles of them in a row took at least Interval, refreshes run
+// back to back, so it warns that the interval is too short and, with
+// AdaptInterval, stretches the effective interval to AdaptIntervalFactor
+// times the duration until a refresh is quick again. Only called by the
+// refresh goroutine.
+func (s *WedosIPRange) trackRefreshDuration(d time.Duration) {
+	if s.schedule != nil {
+		return
+	}
+	s.lock.RLock()
+	interval, adapted := time.Duration(s.Interval), s.adaptedInterval
+	s.lock.RUnlock()
+	if d < interval {
+		s.slowRefreshes = 0
+		if adapted > 0 {
+			s.setAdaptedInterval(0)
+			s.logger.Info("WEDOS IP refreshes are quick again, restoring the configured interval",
+				zap.Duration("interval", interval),
+				zap.Duration("refresh_duration", d))
+		}
+		return
+	}
+	s.slowRefreshes++
+	if s.slowRefreshes < slowFetchCycles {
+		return
+	}
+	if s.slowRefreshes == slowFetchCycles {
+		s.logger.Warn("WEDOS IP refreshes take longer than the interval, consider raising it",
+			zap.Duration("interval", interval),
+			zap.Duration("refresh_duration", d),
+			zap.Int("cycles", s.slowRefreshes))
+	}
+	if s.AdaptInterval {
+		next := d * time.Duration(s.AdaptIntervalFactor)
+		s.setAdaptedInterval(next)
+		if adapted == 0 {
+			s.logger.Warn("adapting the WEDOS IP refresh interval to the refresh duration",
+				zap.Duration("interval", interval),
+				zap.Duration("effective_interval", next))
+		}
+	}
+}
+
+// setAdaptedInterval sets the interval stretched by AdaptInterval, zero
+// for the configured one.
+func (s *WedosIPRange) setAdaptedInterval(d time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.adaptedInterval = d
+}
+
+// effectiveInterval returns the interval stretched by AdaptInterval for
+// the status endpoint, empty unless adapted. s.lock must be held.
+func (s *WedosIPRange) effectiveInterval() string {
+	if s.adaptedInterval == 0 {
+		return ""
+	}
+	return s.adaptedInterval.String()
+}
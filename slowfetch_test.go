@@ -0,0 +1,58 @@
+package caddy_wedos_ip
+
+import (
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestTrackRefreshDuration(t *testing.T) {
+	s := newTestRange("http://127.0.0.1")
+	s.Interval = caddy.Duration(time.Minute)
+	core, logs := observer.New(zap.WarnLevel)
+	s.logger = zap.New(core)
+
+	for range slowFetchCycles - 1 {
+		s.trackRefreshDuration(2 * time.Minute)
+	}
+	// A quick refresh in between restarts the count.
+	s.trackRefreshDuration(time.Second)
+	for range slowFetchCycles - 1 {
+		s.trackRefreshDuration(2 * time.Minute)
+	}
+	if n := logs.FilterMessageSnippet("longer than the interval").Len(); n != 0 {
+		t.Fatalf("expected no warning yet, got %d", n)
+	}
+	s.trackRefreshDuration(2 * time.Minute)
+	s.trackRefreshDuration(2 * time.Minute)
+	if n := logs.FilterMessageSnippet("longer than the interval").Len(); n != 1 {
+		t.Errorf("expected one warning, got %d", n)
+	}
+	if d := s.nextDelay(); d != time.Minute {
+		t.Errorf("expected the configured interval without adapt_interval, got %v", d)
+	}
+}
+
+func TestAdaptInterval(t *testing.T) {
+	s := newTestRange("http://127.0.0.1")
+	s.Interval = caddy.Duration(time.Minute)
+	s.AdaptInterval = true
+	s.AdaptIntervalFactor = 2
+	for range slowFetchCycles {
+		s.trackRefreshDuration(90 * time.Second)
+	}
+	if d := s.nextDelay(); d != 3*time.Minute {
+		t.Errorf("expected the interval adapted to 3m, got %v", d)
+	}
+	if got := s.status().EffectiveInterval; got != "3m0s" {
+		t.Errorf("expected effective_interval 3m0s, got %q", got)
+	}
+
+	s.trackRefreshDuration(time.Second)
+	if d := s.nextDelay(); d != time.Minute {
+		t.Errorf("expected the configured interval restored, got %v", d)
+	}
+}
@@ -0,0 +1,71 @@
+package caddy_wedos_ip
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Values of the source option.
+const (
+	sourceURL   = "url"
+	sourceStdin = "stdin"
+	sourceFile  = "file"
+	sourceEnv   = "env"
+)
+
+// stdin is read at most once per process, since it can't be re-read
+// when the config is reloaded.
+var (
+	stdin     io.Reader = os.Stdin
+	stdinOnce sync.Once
+	stdinData []byte
+	stdinErr  error
+)
+
+// readStdinRanges parses the ranges piped into the process.
+func (s *WedosIPRange) readStdinRanges() ([]netip.Prefix, error) {
+	stdinOnce.Do(func() {
+		stdinData, stdinErr = io.ReadAll(stdin)
+	})
+	if stdinErr != nil {
+		return nil, stdinErr
+	}
+	list, err := s.transformed(stripBOM(bytes.NewReader(stdinData)))
+	if err != nil {
+		return nil, err
+	}
+	return s.parseSourceList(s.Format, list)
+}
+
+// readFileRanges parses the ranges in File. The format is chosen by the
+// format option, or by a .json extension.
+func (s *WedosIPRange) readFileRanges() ([]netip.Prefix, error) {
+	data, err := os.ReadFile(s.File)
+	if err != nil {
+		return nil, err
+	}
+	format := s.Format
+	if (format == "" || format == formatAuto) && strings.HasSuffix(s.File, ".json") {
+		format = formatJSON
+	}
+	list, err := s.transformed(stripBOM(bytes.NewReader(data)))
+	if err != nil {
+		return nil, err
+	}
+	return s.parseSourceList(format, list)
+}
+
+// readEnvRanges parses the space or newline separated CIDRs in the Env
+// variable.
+func (s *WedosIPRange) readEnvRanges() ([]netip.Prefix, error) {
+	val := strings.TrimSpace(os.Getenv(s.Env))
+	if val == "" {
+		return nil, fmt.Errorf("environment variable %s is not set or empty", s.Env)
+	}
+	return parseCIDRList(s.Env, strings.Fields(val))
+}
@@ -0,0 +1,73 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestSourceStdin(t *testing.T) {
+	stdin = strings.NewReader("192.0.2.0/24\n2001:db8::/32\n")
+	stdinOnce = sync.Once{}
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	want := parsePrefixes(t, "192.0.2.0/24", "2001:db8::/32")
+
+	// A reload provisions the module again; stdin must not be re-read.
+	for i := 0; i < 2; i++ {
+		r := WedosIPRange{Source: sourceStdin}
+		if err := r.Provision(ctx); err != nil {
+			t.Fatalf("error provisioning: %v", err)
+		}
+		if got := r.GetIPRanges(nil); !slices.Equal(got, want) {
+			t.Errorf("provision %d: GetIPRanges() = %v, want %v", i+1, got, want)
+		}
+		r.Cleanup()
+	}
+}
+
+func TestSourceEnv(t *testing.T) {
+	t.Setenv("WEDOS_TEST_RANGES", "192.0.2.0/24 198.51.100.0/24\n2001:db8::/32\n")
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{Env: "WEDOS_TEST_RANGES"}
+	if err := r.Provision(ctx); err != nil {
+		t.Fatalf("error provisioning: %v", err)
+	}
+	defer r.Cleanup()
+	if r.Source != sourceEnv {
+		t.Errorf("expected env to select the env source, got %q", r.Source)
+	}
+	want := parsePrefixes(t, "192.0.2.0/24", "198.51.100.0/24", "2001:db8::/32")
+	if got := r.GetIPRanges(nil); !slices.Equal(got, want) {
+		t.Errorf("GetIPRanges() = %v, want %v", got, want)
+	}
+}
+
+func TestSourceEnvInvalid(t *testing.T) {
+	t.Setenv("WEDOS_TEST_EMPTY", "  \n")
+	t.Setenv("WEDOS_TEST_BAD", "192.0.2.0/24 not-a-cidr")
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	for _, r := range []WedosIPRange{
+		{Env: "WEDOS_TEST_UNSET"},
+		{Env: "WEDOS_TEST_EMPTY"},
+		{Env: "WEDOS_TEST_BAD"},
+		{Source: sourceEnv},
+	} {
+		if err := r.Provision(ctx); err == nil {
+			t.Errorf("expected env %q to be rejected", r.Env)
+			r.Cleanup()
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"slices"
+)
+
+// provisionSourceFormats checks the formats in SourceFormats, and that each
+// is keyed by a configured URL, after normalizeURLs.
+func (s *WedosIPRange) provisionSourceFormats() error {
+	urls := append([]string{s.URL, s.URLv4, s.URLv6}, s.Mirrors...)
+	for u, format := range s.SourceFormats {
+		if format != formatAuto {
+			if _, ok := lookupRangeParser(format); !ok {
+				return fmt.Errorf("unknown format %q for %s", format, u)
+			}
+		}
+		if len(s.Region) > 0 && format != formatLabeled {
+			return fmt.Errorf("region requires format labeled, %s has %q", u, format)
+		}
+		if u == "" || !slices.Contains(urls, u) {
+			return fmt.Errorf("source_formats: %s is not a configured url or mirror", u)
+		}
+	}
+	return nil
+}
+
+// sourceFormat returns the format of the list at api: its entry in
+// SourceFormats, falling back to Format.
+func (s *WedosIPRange) sourceFormat(api string) string {
+	if format, ok := s.SourceFormats[api]; ok {
+		return format
+	}
+	return s.Format
+}
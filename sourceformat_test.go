@@ -0,0 +1,105 @@
+package caddy_wedos_ip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func TestSourceFormats(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	// Served as text/plain without a .json path, so only the per-source
+	// format selects the JSON parser.
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(`{"ipv4": ["192.0.2.0/24"], "ipv6": ["2001:db8::/32"]}`))
+	}))
+	defer mirror.Close()
+
+	s := newTestRange(primary.URL)
+	s.Format = formatText
+	s.Mirrors = []string{mirror.URL}
+	s.SourceFormats = map[string]string{mirror.URL: formatJSON}
+	if err := s.provisionSourceFormats(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.refresh(); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24", "2001:db8::/32"); !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got := s.sourceFormat(primary.URL); got != formatText {
+		t.Errorf("expected the primary to fall back to format text, got %q", got)
+	}
+}
+
+func TestSourceFormatsInvalid(t *testing.T) {
+	s := WedosIPRange{URL: "https://a.example.com/", SourceFormats: map[string]string{"https://a.example.com/": "yaml"}}
+	if err := s.provisionSourceFormats(); err == nil {
+		t.Error("expected an unknown per-source format to be rejected")
+	}
+	s = WedosIPRange{
+		URL:           "https://a.example.com/",
+		Region:        []string{"eu"},
+		SourceFormats: map[string]string{"https://a.example.com/": formatJSON},
+	}
+	if err := s.provisionSourceFormats(); err == nil {
+		t.Error("expected region to require labeled per-source formats")
+	}
+	s = WedosIPRange{
+		URL:           "https://a.example.com/",
+		SourceFormats: map[string]string{"https://b.example.com/": formatJSON},
+	}
+	if err := s.provisionSourceFormats(); err == nil {
+		t.Error("expected a per-source format for an unknown URL to be rejected")
+	}
+}
+
+func TestSourceFormatsNormalized(t *testing.T) {
+	s := WedosIPRange{
+		URL:           "https://IPS.Example.com/ips.txt",
+		Mirrors:       []string{"https://bücher.example/ips.json"},
+		SourceFormats: map[string]string{"https://bücher.example/ips.json": formatJSON, "https://IPS.Example.com/ips.txt": formatText},
+	}
+	if err := s.normalizeURLs(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.provisionSourceFormats(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.sourceFormat(s.Mirrors[0]); got != formatJSON {
+		t.Errorf("expected the IDN mirror to keep format json, got %q", got)
+	}
+	if got := s.sourceFormat(s.URL); got != formatText {
+		t.Errorf("expected the mixed-case url to keep format text, got %q", got)
+	}
+}
+
+func TestUnmarshalRepeatedURL(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`
+	wedos {
+		url https://a.example.com/ips.txt
+		url https://b.example.com/ips json
+		url https://c.example.com/ips labeled
+	}`)
+	var r WedosIPRange
+	if err := r.UnmarshalCaddyfile(d); err != nil {
+		t.Fatal(err)
+	}
+	if r.URL != "https://a.example.com/ips.txt" {
+		t.Errorf("incorrect url: %q", r.URL)
+	}
+	if !slices.Equal(r.Mirrors, []string{"https://b.example.com/ips", "https://c.example.com/ips"}) {
+		t.Errorf("expected repeated url lines to add mirrors, got %v", r.Mirrors)
+	}
+	if len(r.SourceFormats) != 2 || r.SourceFormats["https://b.example.com/ips"] != formatJSON || r.SourceFormats["https://c.example.com/ips"] != formatLabeled {
+		t.Errorf("incorrect source formats: %v", r.SourceFormats)
+	}
+}
@@ -0,0 +1,171 @@
+package caddy_wedos_ip
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// maxSSEEvent bounds the data of one pushed event, a whole list.
+const maxSSEEvent = 8 << 20
+
+// Reconnect delays of the push channel, doubled after each failed attempt.
+const (
+	sseMinBackoff = time.Second
+	sseMaxBackoff = time.Minute
+)
+
+// checkSSE validates SSEURL, which needs a source that can be polled when
+// the push channel is down. A pushed event replaces the whole list, so
+// only a single url is supported: it would skip the merge of several.
+func (s *WedosIPRange) checkSSE() error {
+	if s.SSEURL == "" {
+		return nil
+	}
+	if s.Source == sourceStdin || s.Source == sourceEnv || s.Source == sourceFile {
+		return fmt.Errorf("sse_url requires the url source")
+	}
+	if s.URLv4 != "" || s.URLv6 != "" || s.DNSTXT != "" {
+		return fmt.Errorf("sse_url is only supported with a single url")
+	}
+	if !strings.HasPrefix(s.SSEURL, "http://") && !strings.HasPrefix(s.SSEURL, "https://") {
+		return fmt.Errorf("invalid sse_url %q: must be http or https", s.SSEURL)
+	}
+	return nil
+}
+
+// streamSSE keeps the push channel at SSEURL open until the module stops,
+// hands each pushed list to the refresh loop and reconnects with backoff.
+// While it is connected, the interval refreshes are skipped.
+func (s *WedosIPRange) streamSSE() {
+	backoff := sseMinBackoff
+	for {
+		connected, err := s.readSSE()
+		s.pushConnected.Store(false)
+		if s.ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = sseMinBackoff
+			// Updates may have been missed while reconnecting.
+			s.signalFileChanged()
+		}
+		s.logger.Warn("WEDOS push channel unavailable, polling until it reconnects",
+			zap.String("sse_url", redactURL(s.SSEURL)),
+			zap.Duration("retry_in", backoff),
+			zap.Error(err))
+
+		select {
+		case <-time.After(backoff):
+		case <-s.ctx.Done():
+			return
+		}
+		backoff = min(2*backoff, sseMaxBackoff)
+	}
+}
+
+// readSSE runs one connection to the push channel, and reports whether it
+// was established.
+func (s *WedosIPRange) readSSE() (bool, error) {
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodGet, s.SSEURL, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return false, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != "text/event-stream" {
+		return false, fmt.Errorf("unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	s.pushConnected.Store(true)
+	s.logger.Info("connected to WEDOS push channel", zap.String("sse_url", redactURL(s.SSEURL)))
+	err = parseSSE(resp.Body, s.push)
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	return true, err
+}
+
+// pushing reports whether the push channel is connected.
+func (s *WedosIPRange) pushing() bool {
+	return s.pushConnected != nil && s.pushConnected.Load()
+}
+
+// push hands a pushed list to the refresh loop, replacing one it hasn't
+// applied yet.
+func (s *WedosIPRange) push(data []byte) {
+	select {
+	case <-s.pushed:
+	default:
+	}
+	s.pushed <- data
+}
+
+// parseSSE reads a Server-Sent Events stream and calls fn with the data of
+// each "message" or "update" event, until the stream ends. Comments, such
+// as keep-alives, and other events are skipped.
+func parseSSE(r io.Reader, fn func([]byte)) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), maxSSEEvent)
+	var data bytes.Buffer
+	event, hasData := "", false
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			if hasData && (event == "" || event == "message" || event == "update") {
+				fn(bytes.Clone(data.Bytes()))
+			}
+			data.Reset()
+			event, hasData = "", false
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "":
+			// A comment.
+		case "event":
+			event = value
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			if data.Len()+len(value) > maxSSEEvent {
+				return fmt.Errorf("pushed event larger than %d bytes", maxSSEEvent)
+			}
+			data.WriteString(value)
+			hasData = true
+		}
+	}
+	return sc.Err()
+}
+
+// pushedRanges parses a pushed list like one fetched from URL, through
+// parseList so that its signature, serial and encoding are checked the
+// same way. The next poll fetches in full, since its validators describe
+// an older list.
+func (s *WedosIPRange) pushedRanges(data []byte) ([]netip.Prefix, error) {
+	s.pendingETag = ""
+	s.pendingSource = ""
+	s.pendingValidators = headValidators{}
+	return s.parseList(s.Format, bytes.NewReader(data))
+}
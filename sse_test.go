@@ -0,0 +1,146 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestParseSSE(t *testing.T) {
+	stream := ": keep-alive\n\n" +
+		"data: 192.0.2.0/24\ndata: 198.51.100.0/24\n\n" +
+		"event: ping\ndata: ignored\n\n" +
+		"event: update\nid: 7\ndata:203.0.113.0/24\n\n" +
+		"data: incomplete"
+	var got []string
+	if err := parseSSE(strings.NewReader(stream), func(data []byte) { got = append(got, string(data)) }); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"192.0.2.0/24\n198.51.100.0/24", "203.0.113.0/24"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestSSEPush(t *testing.T) {
+	var polls atomic.Int32
+	poll := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls.Add(1)
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer poll.Close()
+
+	events := make(chan string)
+	push := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "text/event-stream" {
+			t.Errorf("expected Accept text/event-stream, got %q", r.Header.Get("Accept"))
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				fmt.Fprintf(w, "data: %s\n\n", ev)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+	defer push.Close()
+
+	s, err := New(Options{Config: WedosIPRange{
+		URL:            poll.URL,
+		SSEURL:         push.URL,
+		RequireOnStart: true,
+		Interval:       caddy.Duration(time.Hour),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	waitFor(t, s.pushing)
+	events <- "198.51.100.0/24"
+	waitFor(t, func() bool {
+		_, ok := s.Lookup(netip.MustParseAddr("198.51.100.1"))
+		return ok
+	})
+	if _, ok := s.Lookup(netip.MustParseAddr("192.0.2.1")); ok {
+		t.Error("expected the pushed list to replace the polled one")
+	}
+
+	// The drop is followed by a poll.
+	before := polls.Load()
+	close(events)
+	waitFor(t, func() bool { return polls.Load() > before })
+	waitFor(t, func() bool {
+		_, ok := s.Lookup(netip.MustParseAddr("192.0.2.1"))
+		return ok
+	})
+}
+
+func TestCheckSSE(t *testing.T) {
+	s := &WedosIPRange{SSEURL: "https://mirror.example.com/events", Source: sourceStdin}
+	if err := s.checkSSE(); err == nil {
+		t.Error("expected sse_url with source stdin to be rejected")
+	}
+	for _, s := range []*WedosIPRange{
+		{SSEURL: "https://mirror.example.com/events", URLv4: "https://mirror.example.com/ips4.txt"},
+		{SSEURL: "https://mirror.example.com/events", URL: "https://mirror.example.com/ips.txt", DNSTXT: "_ips.example.com"},
+	} {
+		if err := s.checkSSE(); err == nil {
+			t.Errorf("%+v: expected sse_url with several sources to be rejected", s)
+		}
+	}
+	s = &WedosIPRange{SSEURL: "wss://mirror.example.com/events"}
+	if err := s.checkSSE(); err == nil {
+		t.Error("expected a WebSocket URL to be rejected")
+	}
+}
+
+func TestPushedRangesChecked(t *testing.T) {
+	s := &WedosIPRange{Serial: "# serial "}
+	s.serial = 5
+	if _, err := s.pushedRanges([]byte("# serial 4\n192.0.2.0/24\n")); err == nil {
+		t.Error("expected a pushed list with an older serial to be rejected")
+	}
+	if _, err := s.pushedRanges([]byte("192.0.2.0/24\n")); err == nil {
+		t.Error("expected a pushed list without a serial to be rejected")
+	}
+	got, err := s.pushedRanges([]byte("# serial 6\n192.0.2.0/24\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != netip.MustParsePrefix("192.0.2.0/24") {
+		t.Errorf("unexpected ranges %v", got)
+	}
+}
+
+func TestSSEURLNormalized(t *testing.T) {
+	s := &WedosIPRange{SSEURL: "http://mirror.example.com/events", RequireHTTPS: true}
+	if err := s.checkHTTPS(); err == nil {
+		t.Error("expected an http sse_url to be rejected with require_https")
+	}
+	s = &WedosIPRange{SSEURL: "https://bücher.example/events"}
+	if err := s.normalizeURLs(); err != nil {
+		t.Fatal(err)
+	}
+	if s.SSEURL != "https://xn--bcher-kva.example/events" {
+		t.Errorf("expected the sse_url host in punycode, got %q", s.SSEURL)
+	}
+}
@@ -0,0 +1,98 @@
+package caddy_wedos_ip
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// defaultStartupStabilityDelay is the pause between the startup fetches
+// of VerifyStartupStability unless StartupStabilityDelay says otherwise.
+const defaultStartupStabilityDelay = 5 * time.Second
+
+// maxStabilityFetches bounds the fetches of one verifyStartupStability
+// call, the first one included.
+const maxStabilityFetches = 5
+
+// errNotSettled is returned by verifyStartupStability if the startup
+// fetches kept disagreeing.
+var errNotSettled = errors.New("WEDOS IP list did not settle across startup fetches")
+
+// provisionStartupStability validates VerifyStartupStability.
+func (s *WedosIPRange) provisionStartupStability() error {
+	if s.StartupStabilityDelay < 0 {
+		return fmt.Errorf("verify_startup_stability delay must not be negative")
+	}
+	if s.VerifyStartupStability && s.StartupStabilityDelay == 0 {
+		s.StartupStabilityDelay = caddy.Duration(defaultStartupStabilityDelay)
+	}
+	s.unsettled = s.VerifyStartupStability
+	return nil
+}
+
+// verifyStartupStability fetches the list again StartupStabilityDelay after
+// the first fetch, and again while two fetches in a row disagree, so a
+// mirror caught regenerating its list can't be applied half-written. It
+// returns the list once it settled. After maxStabilityFetches, or once the
+// next fetch would overrun MaxCycleDuration, it fails the cycle instead,
+// so a list that changes on every fetch doesn't hold the refresh goroutine;
+// the next cycle starts over.
+func (s *WedosIPRange) verifyStartupStability(fetched []netip.Prefix) ([]netip.Prefix, error) {
+	delay := time.Duration(s.StartupStabilityDelay)
+	budget := time.Duration(s.MaxCycleDuration)
+	for fetches := 1; ; fetches++ {
+		if fetches >= maxStabilityFetches {
+			return nil, fmt.Errorf("%w after %d fetches", errNotSettled, fetches)
+		}
+		if budget > 0 && ageAt(s.now(), s.refreshStarted)+delay > budget {
+			return nil, fmt.Errorf("%w: %w after %d fetches", errCycleBudget, errNotSettled, fetches)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-s.ctx.Done():
+			timer.Stop()
+			return nil, s.ctx.Err()
+		}
+
+		again, err := s.getPrefixes()
+		if errors.Is(err, errNotModified) {
+			// The list went back to the cached one.
+			s.lock.RLock()
+			again, err = slices.Clone(s.fetched), nil
+			s.lock.RUnlock()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if contentHash(normalizePrefixes(fetched)) == contentHash(normalizePrefixes(again)) {
+			s.markStartupStable()
+			return again, nil
+		}
+		s.logger.Warn("WEDOS IP list changed between startup fetches, waiting for it to settle",
+			zap.Int("previous_count", len(fetched)),
+			zap.Int("count", len(again)),
+			zap.Duration("delay", delay))
+		fetched = again
+	}
+}
+
+// isStartupStable reports whether the startup fetches agreed.
+func (s *WedosIPRange) isStartupStable() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return !s.unsettled
+}
+
+// markStartupStable records that the startup fetches agreed.
+func (s *WedosIPRange) markStartupStable() {
+	s.lock.Lock()
+	s.unsettled = false
+	s.lock.Unlock()
+	s.logger.Info("WEDOS IP list stable across startup fetches")
+}
@@ -0,0 +1,84 @@
+package caddy_wedos_ip
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestVerifyStartupStability(t *testing.T) {
+	// Caught mid-regeneration: the first list is half-written.
+	srv := sequenceServer(t, "192.0.2.0/24", "192.0.2.0/24 198.51.100.0/24", "192.0.2.0/24 198.51.100.0/24", "203.0.113.0/24")
+	s := newTestRange(srv.URL)
+	s.VerifyStartupStability = true
+	s.StartupStabilityDelay = caddy.Duration(time.Millisecond)
+	if err := s.provisionStartupStability(); err != nil {
+		t.Fatal(err)
+	}
+	core, logs := observer.New(zap.WarnLevel)
+	s.logger = zap.New(core)
+	if s.status().Healthy {
+		t.Fatal("expected the module unhealthy before its first fetch")
+	}
+
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24", "198.51.100.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected the settled list %v, got %v", want, got)
+	}
+	if logs.FilterMessageSnippet("waiting for it to settle").Len() != 1 {
+		t.Errorf("expected the disagreement to be logged once, got %v", logs.All())
+	}
+	if !s.status().Healthy {
+		t.Error("expected the module healthy once the list settled")
+	}
+
+	// Later refreshes apply as usual.
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "203.0.113.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestVerifyStartupStabilityBounded(t *testing.T) {
+	var n atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "192.0.2.%d/32", n.Add(1))
+	}))
+	defer srv.Close()
+
+	s := newTestRange(srv.URL)
+	s.VerifyStartupStability = true
+	s.StartupStabilityDelay = caddy.Duration(time.Millisecond)
+	if err := s.provisionStartupStability(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.refresh(); !errors.Is(err, errNotSettled) {
+		t.Fatalf("expected errNotSettled, got %v", err)
+	}
+	if got := n.Load(); got != maxStabilityFetches {
+		t.Errorf("expected %d fetches, got %d", maxStabilityFetches, got)
+	}
+	if len(s.GetIPRanges(nil)) != 0 || s.isStartupStable() {
+		t.Error("expected nothing applied and the module still unsettled")
+	}
+
+	// The cycle budget also ends the wait.
+	s.StartupStabilityDelay = caddy.Duration(time.Hour)
+	s.MaxCycleDuration = caddy.Duration(time.Minute)
+	if err := s.refresh(); !errors.Is(err, errCycleBudget) || !errors.Is(err, errNotSettled) {
+		t.Errorf("expected the cycle budget to fail the cycle, got %v", err)
+	}
+}
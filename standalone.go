@@ -0,0 +1,79 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/certmagic"
+	"go.uber.org/zap"
+)
+
+// Options configures a WedosIPRange created with New, for programs that
+// embed the fetcher without running Caddy.
+type Options struct {
+	// Config holds the module options, as in a Caddy config. Only its
+	// exported fields are used; Sets are not supported.
+	Config WedosIPRange
+	// Logger receives the module's logs. Defaults to a no-op logger.
+	Logger *zap.Logger
+	// Client, if set, is used for every fetch instead of a client built
+	// from the timeout, proxy and TLS options.
+	Client *http.Client
+	// Storage holds Config.StorageKey. Defaults to Caddy's default file
+	// storage.
+	Storage certmagic.Storage
+}
+
+// New validates opts and returns a module ready to be started with Start,
+// running the same refresh loop as in Caddy. Its metrics are collected but
+// not registered with any registry.
+func New(opts Options) (*WedosIPRange, error) {
+	if len(opts.Config.Sets) > 0 || len(opts.Config.HostSets) > 0 {
+		return nil, fmt.Errorf("sets are only supported within Caddy")
+	}
+	s := opts.Config
+	s.logger = opts.Logger
+	if s.logger == nil {
+		s.logger = zap.NewNop()
+	}
+	s.client = opts.Client
+	s.storage = opts.Storage
+	if s.StorageKey != "" && s.storage == nil {
+		s.storage = caddy.DefaultStorage
+	}
+	initMetrics()
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	if err := s.setup(ctx); err != nil {
+		cancel()
+		return nil, err
+	}
+	s.stop = cancel
+	return &s, nil
+}
+
+// Start loads the initial ranges, from the cache file or storage if
+// configured and, with RequireOnStart, by a first fetch whose error it
+// returns, and starts refreshing them in the background until ctx is done
+// or Stop is called.
+// It is only valid on a module created with New.
+func (s *WedosIPRange) Start(ctx context.Context) error {
+	if s.stop == nil {
+		return fmt.Errorf("Start requires a module created with New")
+	}
+	context.AfterFunc(ctx, s.stop)
+	if err := s.start(); err != nil {
+		s.stop()
+		return err
+	}
+	return nil
+}
+
+// Stop stops the refresh loop started by Start, writes the final state to
+// the cache file and closes the Subscribe channels.
+func (s *WedosIPRange) Stop() {
+	s.stop()
+	s.Cleanup()
+}
@@ -0,0 +1,89 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// countingTransport counts the requests made through it.
+type countingTransport struct {
+	n atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.n.Add(1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestNewStartStop(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+
+	transport := new(countingTransport)
+	s, err := New(Options{
+		Config: WedosIPRange{URL: srv.URL, RequireOnStart: true, Interval: caddy.Duration(20 * time.Millisecond)},
+		Client: &http.Client{Transport: transport},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.GetIPRanges(nil); len(got) != 0 {
+		t.Errorf("expected no ranges before Start, got %v", got)
+	}
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	// The injected client is used, and the loop keeps refreshing.
+	waitFor(t, func() bool { return transport.n.Load() >= 3 })
+
+	s.Stop()
+	stopped := transport.n.Load()
+	time.Sleep(100 * time.Millisecond)
+	if n := transport.n.Load(); n > stopped+1 {
+		t.Errorf("expected refreshes to stop, got %d more", n-stopped)
+	}
+}
+
+func TestStartStopsWithContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+
+	s, err := New(Options{Config: WedosIPRange{URL: srv.URL, RequireOnStart: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := s.Start(ctx); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	cancel()
+	waitFor(t, func() bool { return s.ctx.Err() != nil })
+}
+
+func TestNewInvalid(t *testing.T) {
+	if _, err := New(Options{Config: WedosIPRange{Format: "yaml"}}); err == nil {
+		t.Error("expected an invalid config to be rejected")
+	}
+	if _, err := New(Options{Config: WedosIPRange{HostSets: map[string]string{"example.com": "a"}}}); err == nil {
+		t.Error("expected sets to be rejected")
+	}
+	var s WedosIPRange
+	if err := s.Start(context.Background()); err == nil {
+		t.Error("expected Start to require New")
+	}
+}
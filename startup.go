@@ -0,0 +1,74 @@
+package caddy_wedos_ip
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/semaphore"
+)
+
+// defaultMaxInitialFetches limits concurrent initial fetches unless the
+// WEDOS_MAX_INITIAL_FETCHES environment variable says otherwise.
+const defaultMaxInitialFetches = 4
+
+// initialFetches is shared by all modules in the process, so a reload that
+// provisions many of them at once does not hit the upstream all at once.
+var initialFetches = semaphore.NewWeighted(maxInitialFetches())
+
+func maxInitialFetches() int64 {
+	if n, err := strconv.ParseInt(os.Getenv("WEDOS_MAX_INITIAL_FETCHES"), 10, 64); err == nil && n > 0 {
+		return n
+	}
+	return defaultMaxInitialFetches
+}
+
+// defaultStartupRetryDelay is the pause between startup retries unless
+// startup_retry_delay says otherwise.
+const defaultStartupRetryDelay = 2 * time.Second
+
+// initialRefresh runs the first refresh once a slot in initialFetches is
+// free. Later refreshes are spread out by their intervals and not limited.
+// A failed first refresh is retried up to StartupRetries times,
+// StartupRetryDelay apart, as long as the next attempt starts within
+// StartupTimeout.
+func (s *WedosIPRange) initialRefresh() error {
+	var deadline time.Time
+	if s.StartupTimeout > 0 {
+		deadline = s.now().Add(time.Duration(s.StartupTimeout))
+	}
+	delay := time.Duration(s.StartupRetryDelay)
+	if delay == 0 {
+		delay = defaultStartupRetryDelay
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := s.initialAttempt()
+		if err == nil || attempt >= s.StartupRetries || s.ctx.Err() != nil {
+			return err
+		}
+		if !deadline.IsZero() && s.now().Add(delay).After(deadline) {
+			return err
+		}
+		s.logger.Info("initial fetch of WEDOS IP ranges failed, retrying",
+			zap.Error(err),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("delay", delay))
+		select {
+		case <-time.After(delay):
+		case <-s.ctx.Done():
+			return err
+		}
+	}
+}
+
+// initialAttempt runs one attempt of the first refresh, holding a slot in
+// initialFetches only while it runs.
+func (s *WedosIPRange) initialAttempt() error {
+	if err := initialFetches.Acquire(s.ctx, 1); err != nil {
+		return err
+	}
+	defer initialFetches.Release(1)
+	return s.refresh()
+}
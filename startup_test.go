@@ -0,0 +1,136 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"golang.org/x/sync/semaphore"
+)
+
+func TestInitialFetchesLimited(t *testing.T) {
+	orig := initialFetches
+	initialFetches = semaphore.NewWeighted(2)
+	defer func() { initialFetches = orig }()
+
+	var active, peak, total atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		total.Add(1)
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := &WedosIPRange{URL: srv.URL, RequireOnStart: true}
+			if err := r.Provision(ctx); err != nil {
+				t.Errorf("provision error: %v", err)
+				return
+			}
+			r.Cleanup()
+		}()
+	}
+	wg.Wait()
+
+	if total.Load() != 6 {
+		t.Errorf("expected 6 fetches, got %d", total.Load())
+	}
+	if p := peak.Load(); p > 2 {
+		t.Errorf("expected at most 2 concurrent initial fetches, got %d", p)
+	}
+}
+
+func TestMaxInitialFetchesEnv(t *testing.T) {
+	t.Setenv("WEDOS_MAX_INITIAL_FETCHES", "9")
+	if n := maxInitialFetches(); n != 9 {
+		t.Errorf("expected 9, got %d", n)
+	}
+	t.Setenv("WEDOS_MAX_INITIAL_FETCHES", "zero")
+	if n := maxInitialFetches(); n != defaultMaxInitialFetches {
+		t.Errorf("expected the default for an invalid value, got %d", n)
+	}
+}
+
+func TestStartupRetries(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := &WedosIPRange{
+		URL:               srv.URL,
+		Interval:          caddy.Duration(time.Hour),
+		RequireOnStart:    true,
+		StartupRetries:    2,
+		StartupRetryDelay: caddy.Duration(10 * time.Millisecond),
+	}
+	if err := r.Provision(ctx); err != nil {
+		t.Fatalf("provision error: %v", err)
+	}
+	defer r.Cleanup()
+	if got := hits.Load(); got != 3 {
+		t.Errorf("expected 3 attempts, got %d", got)
+	}
+	if got := len(r.GetIPRanges(nil)); got != 1 {
+		t.Errorf("expected 1 range, got %d", got)
+	}
+}
+
+func TestStartupTimeout(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := &WedosIPRange{
+		URL:               srv.URL,
+		Interval:          caddy.Duration(time.Hour),
+		RequireOnStart:    true,
+		StartupRetries:    100,
+		StartupRetryDelay: caddy.Duration(20 * time.Millisecond),
+		StartupTimeout:    caddy.Duration(70 * time.Millisecond),
+	}
+	start := time.Now()
+	if err := r.Provision(ctx); err == nil {
+		t.Fatal("expected provisioning to fail")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("startup_timeout did not bound the retries: took %v", elapsed)
+	}
+	if got := hits.Load(); got < 2 || got > 4 {
+		t.Errorf("expected 2 to 4 attempts within the timeout, got %d", got)
+	}
+}
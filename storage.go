@@ -0,0 +1,130 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/netip"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// keyValueStorage is the part of certmagic.Storage used for StorageKey.
+type keyValueStorage interface {
+	Load(ctx context.Context, key string) ([]byte, error)
+	Store(ctx context.Context, key string, value []byte) error
+}
+
+// readStorage returns the entry kept under StorageKey. A missing key is
+// reported as fs.ErrNotExist.
+func (s *WedosIPRange) readStorage() (cacheEntry, error) {
+	data, err := s.storage.Load(s.ctx, s.StorageKey)
+	if err != nil {
+		return cacheEntry{}, err
+	}
+	if data, err = decodeCache(data); err != nil {
+		return cacheEntry{}, err
+	}
+	e, err := parseCacheEntry(data)
+	if err != nil {
+		return cacheEntry{}, err
+	}
+	if e.Source != s.source() {
+		return cacheEntry{}, fmt.Errorf("written for a different source %q", e.Source)
+	}
+	return e, nil
+}
+
+// loadStorage seeds the ranges from StorageKey and reports whether it did.
+// It returns false without logging when the key doesn't exist yet.
+func (s *WedosIPRange) loadStorage() bool {
+	e, err := s.readStorage()
+	if errors.Is(err, fs.ErrNotExist) {
+		s.logger.Info("storage_key not found, fetching WEDOS IP ranges", zap.String("key", s.StorageKey))
+		return false
+	}
+	if err != nil {
+		s.logger.Warn("loading storage_key failed", zap.String("key", s.StorageKey), zap.Error(err))
+		return false
+	}
+	if err := s.applyStored(e); err != nil {
+		s.logger.Warn("storage_key not applied", zap.String("key", s.StorageKey), zap.Error(err))
+		return false
+	}
+	s.logger.Info("loaded WEDOS IP ranges from storage",
+		zap.String("key", s.StorageKey),
+		zap.Int("count", len(e.Prefixes)),
+		zap.Time("updated", e.Updated))
+	return true
+}
+
+// adoptStorage applies the entry under StorageKey if another node stored
+// it after our last successful refresh, so a node that can't reach the
+// source still follows the cluster.
+func (s *WedosIPRange) adoptStorage() {
+	e, err := s.readStorage()
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			s.logger.Warn("loading storage_key failed", zap.String("key", s.StorageKey), zap.Error(err))
+		}
+		return
+	}
+	s.lock.RLock()
+	last := s.lastRefresh
+	s.lock.RUnlock()
+	if !e.Updated.After(last) {
+		return
+	}
+	if err := s.applyStored(e); err != nil {
+		s.logger.Warn("storage_key not adopted", zap.String("key", s.StorageKey), zap.Error(err))
+		return
+	}
+	s.logger.Info("adopted WEDOS IP ranges from storage",
+		zap.String("key", s.StorageKey),
+		zap.Int("count", len(e.Prefixes)),
+		zap.Time("updated", e.Updated))
+}
+
+// applyStored applies an entry read from the cache file or StorageKey.
+// It passes the guards of a fetched list first, see guardStored, and with
+// Serial must not be older than the applied list. With QuarantineFile, an
+// entry that looks anomalous next to the current ranges is held for review
+// like a fetched list and not applied.
+func (s *WedosIPRange) applyStored(e cacheEntry) error {
+	s.lock.RLock()
+	applied := s.serial
+	s.lock.RUnlock()
+	if e.Serial < applied {
+		return fmt.Errorf("%w: got %d, applied %d", errOlderSerial, e.Serial, applied)
+	}
+	prefixes, err := s.guardStored(e.Prefixes)
+	if err != nil {
+		return err
+	}
+	if s.QuarantineFile != "" {
+		if err := s.checkQuarantine(prefixes); err != nil {
+			return err
+		}
+	}
+	// Anchored to the monotonic clock, so max_age holds across clock steps.
+	s.setRanges(prefixes, anchorTime(s.now(), e.Updated))
+	s.lock.Lock()
+	// Written for URL, see etagOfURL.
+	s.etags = nil
+	if e.ETag != "" {
+		s.etags = map[string]string{s.URL: e.ETag}
+	}
+	s.serial = e.Serial
+	s.lock.Unlock()
+	return nil
+}
+
+// saveStorage writes the applied ranges under StorageKey.
+func (s *WedosIPRange) saveStorage(prefixes []netip.Prefix, updated time.Time) {
+	e := cacheEntry{Source: s.source(), ETag: s.etagOfURL(), Serial: s.serial, Updated: updated, Prefixes: prefixes}
+	if err := s.storage.Store(s.ctx, s.StorageKey, formatCache(e)); err != nil {
+		s.logger.Warn("writing storage_key failed", zap.String("key", s.StorageKey), zap.Error(err))
+	}
+}
@@ -0,0 +1,147 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/certmagic"
+)
+
+// newStored returns a module for url keeping its ranges in storage.
+func newStored(t *testing.T, url string, storage certmagic.Storage) *WedosIPRange {
+	t.Helper()
+	s, err := New(Options{
+		Config:  WedosIPRange{URL: url, StorageKey: "wedos/ranges", Interval: caddy.Duration(time.Hour)},
+		Storage: storage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestStorageLoadsSynchronously(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	storage := &certmagic.FileStorage{Path: t.TempDir()}
+	s := newStored(t, srv.URL, storage)
+	want := parsePrefixes(t, "192.0.2.0/24")
+	e := cacheEntry{Source: s.source(), Updated: time.Now(), Prefixes: want}
+	if err := storage.Store(context.Background(), "wedos/ranges", formatCache(e)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	if got := s.GetIPRanges(nil); !slices.Equal(got, want) {
+		t.Errorf("expected %v from storage right after Start, got %v", want, got)
+	}
+	// The background loop still fetches.
+	waitFor(t, func() bool { return hits.Load() > 0 })
+}
+
+func TestStorageMissingKeyFetches(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("198.51.100.0/24"))
+	}))
+	defer srv.Close()
+
+	storage := &certmagic.FileStorage{Path: t.TempDir()}
+	s := newStored(t, srv.URL, storage)
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	want := parsePrefixes(t, "198.51.100.0/24")
+	if got := s.GetIPRanges(nil); !slices.Equal(got, want) {
+		t.Errorf("expected %v fetched during Start, got %v", want, got)
+	}
+	data, err := storage.Load(context.Background(), "wedos/ranges")
+	if err != nil {
+		t.Fatalf("expected the fetched ranges to be stored: %v", err)
+	}
+	e, err := parseCache(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(e.Prefixes, want) || e.Source != s.source() {
+		t.Errorf("unexpected stored entry %+v", e)
+	}
+}
+
+func TestStorageAdoptsNewerOnFailure(t *testing.T) {
+	var fail atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+
+	storage := &certmagic.FileStorage{Path: t.TempDir()}
+	s := newStored(t, srv.URL, storage)
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	// An older entry is ignored.
+	fail.Store(true)
+	stale := parsePrefixes(t, "203.0.113.0/24")
+	e := cacheEntry{Source: s.source(), Updated: time.Now().Add(-time.Hour), Prefixes: stale}
+	if err := storage.Store(context.Background(), "wedos/ranges", formatCache(e)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.refresh(); err == nil {
+		t.Fatal("expected the fetch to fail")
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected %v kept over an older stored set, got %v", want, got)
+	}
+
+	// Another node stored a newer set.
+	e.Updated = time.Now().Add(time.Minute)
+	if err := storage.Store(context.Background(), "wedos/ranges", formatCache(e)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.refresh(); err == nil {
+		t.Fatal("expected the fetch to fail")
+	}
+	if got := s.GetIPRanges(nil); !slices.Equal(got, stale) {
+		t.Errorf("expected the newer stored %v, got %v", stale, got)
+	}
+}
+
+func TestStoredOlderSerial(t *testing.T) {
+	s := newTestRange("https://example.com/ips.txt")
+	if err := s.applyStored(cacheEntry{Serial: 7, Updated: time.Now(), Prefixes: parsePrefixes(t, "192.0.2.0/24")}); err != nil {
+		t.Fatal(err)
+	}
+	err := s.applyStored(cacheEntry{Serial: 6, Updated: time.Now(), Prefixes: parsePrefixes(t, "198.51.100.0/24")})
+	if !errors.Is(err, errOlderSerial) {
+		t.Errorf("expected errOlderSerial, got %v", err)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24"); !slices.Equal(got, want) {
+		t.Errorf("expected %v kept, got %v", want, got)
+	}
+	if s.serial != 7 {
+		t.Errorf("expected serial 7 kept, got %d", s.serial)
+	}
+}
@@ -0,0 +1,83 @@
+package caddy_wedos_ip
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/netip"
+)
+
+// parseList parses a fetched list of format as it is read from body, so
+// that the body is never held in memory as a whole. Only two options need
+// it in full: public_key, since Ed25519 signs the message rather than a
+// digest of it, and parse_cache_size, which must know the body's hash
+// before it can skip parsing it.
+func (s *WedosIPRange) parseList(format string, body io.Reader) ([]netip.Prefix, error) {
+	var data []byte
+	if s.publicKey != nil || s.parsed != nil {
+		var err error
+		data, err = io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		if s.publicKey != nil {
+			if err := s.verifySignature(data); err != nil {
+				return nil, err
+			}
+		}
+		body = bytes.NewReader(data)
+	}
+
+	// The signature covers the body as served, so unwrap it afterwards.
+	body, err := s.unwrapBody(body)
+	if err != nil {
+		return nil, err
+	}
+	body = stripBOM(body)
+
+	var serial *serialFilter
+	if s.Serial != "" {
+		serial = newSerialFilter(body, s.Serial)
+		body = serial
+	}
+
+	var key [sha256.Size]byte
+	if s.parsed != nil {
+		key = prefixLRUKey(format, data)
+		if prefixes, ok := s.parsed.get(key); ok {
+			if err := s.finishSerial(serial); err != nil {
+				return nil, err
+			}
+			return prefixes, nil
+		}
+	}
+
+	body, err = s.transformed(body)
+	if err != nil {
+		return nil, err
+	}
+	prefixes, err := s.parseSourceList(format, body)
+	if err != nil {
+		return nil, &parseFailure{err}
+	}
+	if err := s.finishSerial(serial); err != nil {
+		return nil, err
+	}
+	if s.parsed != nil {
+		s.parsed.add(key, prefixes)
+	}
+	return prefixes, nil
+}
+
+// finishSerial reads the rest of a list read through serial, if not nil,
+// and checks its serial. A parser may stop before the end of the list,
+// e.g. after a JSON value, and the serial line may still follow.
+func (s *WedosIPRange) finishSerial(serial *serialFilter) error {
+	if serial == nil {
+		return nil
+	}
+	if _, err := io.Copy(io.Discard, serial); err != nil {
+		return err
+	}
+	return s.checkSerial(serial)
+}
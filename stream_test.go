@@ -0,0 +1,86 @@
+package caddy_wedos_ip
+
+import (
+	"io"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+// generatedList produces a list of size bytes, mostly blank lines, without
+// holding it in memory. At the end it records how much heap is live.
+type generatedList struct {
+	head, line []byte
+	left       int
+	heapAtEOF  uint64
+}
+
+func newGeneratedList(head string, size int) *generatedList {
+	return &generatedList{
+		head: []byte(head),
+		line: []byte("                                                                \n"),
+		left: size,
+	}
+}
+
+func (g *generatedList) Read(p []byte) (int, error) {
+	if len(g.head) > 0 {
+		n := copy(p, g.head)
+		g.head = g.head[n:]
+		return n, nil
+	}
+	if g.left <= 0 {
+		if g.heapAtEOF == 0 {
+			runtime.GC()
+			var m runtime.MemStats
+			runtime.ReadMemStats(&m)
+			g.heapAtEOF = m.HeapAlloc
+		}
+		return 0, io.EOF
+	}
+	n := 0
+	for n+len(g.line) <= len(p) && g.left > 0 {
+		n += copy(p[n:], g.line)
+		g.left -= len(g.line)
+	}
+	if n == 0 {
+		n = copy(p, g.line[:min(len(p), len(g.line))])
+		g.left -= n
+	}
+	return n, nil
+}
+
+func TestParseListStreams(t *testing.T) {
+	const size = 16 << 20
+
+	for _, marker := range []string{"", "# serial"} {
+		s := newTestRange("")
+		s.Serial = marker
+		head := "192.0.2.0/24\n"
+		if marker != "" {
+			head = marker + " 7\n" + head
+		}
+		g := newGeneratedList(head, size)
+
+		runtime.GC()
+		var before runtime.MemStats
+		runtime.ReadMemStats(&before)
+
+		prefixes, err := s.parseList(formatText, g)
+		if err != nil {
+			t.Fatalf("serial %q: parse error: %v", marker, err)
+		}
+		if want := parsePrefixes(t, "192.0.2.0/24"); !slices.Equal(prefixes, want) {
+			t.Errorf("serial %q: expected %v, got %v", marker, want, prefixes)
+		}
+		if marker != "" && s.pendingSerial != 7 {
+			t.Errorf("expected serial 7, got %d", s.pendingSerial)
+		}
+		if g.heapAtEOF == 0 {
+			t.Fatalf("serial %q: list was not read to the end", marker)
+		}
+		if grown := int64(g.heapAtEOF) - int64(before.HeapAlloc); grown > size/8 {
+			t.Errorf("serial %q: heap grew by %d bytes while parsing a %d byte list", marker, grown, size)
+		}
+	}
+}
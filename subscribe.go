@@ -0,0 +1,63 @@
+package caddy_wedos_ip
+
+import (
+	"time"
+)
+
+// RefreshResult describes the outcome of one refresh cycle.
+type RefreshResult struct {
+	// Time the refresh finished.
+	Time time.Time
+	// Number of prefixes applied; zero if the refresh failed.
+	Count int
+	// Err is non-nil if the refresh failed and the previous ranges were kept.
+	Err error
+}
+
+// Subscribe returns a channel that receives a RefreshResult after each
+// refresh cycle. It must be called after Provision. Sends never block: if
+// the subscriber has not consumed the previous result, the new one is
+// dropped. The channel is closed on Cleanup, of the last module using the
+// fetcher if Shared.
+func (s *WedosIPRange) Subscribe() <-chan RefreshResult {
+	s = s.fetcher()
+	s.subsLock.Lock()
+	defer s.subsLock.Unlock()
+
+	ch := make(chan RefreshResult, 1)
+	if s.subsClosed {
+		close(ch)
+		return ch
+	}
+	s.subs = append(s.subs, ch)
+	return ch
+}
+
+// notify sends res to all subscribers without blocking.
+func (s *WedosIPRange) notify(res RefreshResult) {
+	if s.ReportFile != "" {
+		s.writeReport(res)
+	}
+	s.subsLock.Lock()
+	defer s.subsLock.Unlock()
+
+	for _, ch := range s.subs {
+		select {
+		case ch <- res:
+		default:
+		}
+	}
+}
+
+// closeSubscribers closes all subscriber channels; later calls to
+// Subscribe return an already-closed channel.
+func (s *WedosIPRange) closeSubscribers() {
+	s.subsLock.Lock()
+	defer s.subsLock.Unlock()
+
+	for _, ch := range s.subs {
+		close(ch)
+	}
+	s.subs = nil
+	s.subsClosed = true
+}
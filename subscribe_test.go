@@ -0,0 +1,53 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestSubscribe(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("192.0.2.0/24 2001:db8::/32\n"))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{URL: srv.URL, Interval: caddy.Duration(10 * time.Millisecond)}
+	if err := r.Provision(ctx); err != nil {
+		t.Fatalf("error provisioning: %v", err)
+	}
+
+	first := r.Subscribe()
+	second := r.Subscribe()
+
+	for _, ch := range []<-chan RefreshResult{first, second} {
+		select {
+		case res := <-ch:
+			if res.Err != nil {
+				t.Errorf("unexpected refresh error: %v", res.Err)
+			}
+			if res.Count != 2 {
+				t.Errorf("incorrect count: expected 2, got %d", res.Count)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for refresh result")
+		}
+	}
+
+	if err := r.Cleanup(); err != nil {
+		t.Fatalf("cleanup error: %v", err)
+	}
+	if _, ok := <-first; ok {
+		t.Errorf("expected channel to be closed after cleanup")
+	}
+	if _, ok := <-r.Subscribe(); ok {
+		t.Errorf("expected subscribe after cleanup to return a closed channel")
+	}
+}
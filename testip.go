@@ -0,0 +1,42 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"net/netip"
+
+	"go.uber.org/zap"
+)
+
+// provisionTestIP parses TestIP.
+func (s *WedosIPRange) provisionTestIP() error {
+	if s.TestIP == "" {
+		return nil
+	}
+	addr, err := netip.ParseAddr(s.TestIP)
+	if err != nil {
+		return fmt.Errorf("invalid test_ip %q: %v", s.TestIP, err)
+	}
+	s.testIP = addr
+	return nil
+}
+
+// checkTestIP reports an error if TestIP is set and not covered by the
+// current ranges, meaning the source or its parsing is misconfigured even
+// though the fetch succeeded.
+func (s *WedosIPRange) checkTestIP() error {
+	if !s.testIP.IsValid() {
+		return nil
+	}
+	if _, ok := s.IsTrusted(s.testIP); ok {
+		return nil
+	}
+	return fmt.Errorf("test_ip %s is not in the %d fetched WEDOS IP ranges", s.testIP, len(s.GetIPRanges(nil)))
+}
+
+// warnTestIP logs a checkTestIP failure after an initial fetch that
+// Provision doesn't wait for.
+func (s *WedosIPRange) warnTestIP() {
+	if err := s.checkTestIP(); err != nil {
+		s.logger.Error("WEDOS IP ranges do not cover test_ip, check the source and format", zap.Error(err))
+	}
+}
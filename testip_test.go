@@ -0,0 +1,59 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestTestIP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		ip      string
+		wantErr bool
+	}{
+		{"192.0.2.10", false},
+		{"198.51.100.1", true},
+	} {
+		s, err := New(Options{Config: WedosIPRange{URL: srv.URL, RequireOnStart: true, TestIP: tt.ip, Interval: caddy.Duration(time.Hour)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.Start(context.Background())
+		if (err != nil) != tt.wantErr {
+			t.Errorf("test_ip %s: got error %v, want error %v", tt.ip, err, tt.wantErr)
+		}
+		if err == nil {
+			s.Stop()
+		}
+	}
+
+	// Without require_on_start the miss is only logged.
+	core, logs := observer.New(zap.ErrorLevel)
+	s, err := New(Options{
+		Config: WedosIPRange{URL: srv.URL, TestIP: "198.51.100.1", Interval: caddy.Duration(time.Hour)},
+		Logger: zap.New(core),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	waitFor(t, func() bool { return logs.FilterMessageSnippet("test_ip").Len() == 1 })
+
+	if _, err := New(Options{Config: WedosIPRange{URL: srv.URL, TestIP: "bogus"}}); err == nil {
+		t.Error("expected an invalid test_ip to be rejected")
+	}
+}
@@ -0,0 +1,117 @@
+package caddy_wedos_ip
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// Tier labels of a labeled list read by Tiers.
+const (
+	tierProxy  = "proxy"
+	tierDirect = "direct"
+)
+
+// checkTiers validates Tiers.
+func (s *WedosIPRange) checkTiers() error {
+	if !s.Tiers {
+		return nil
+	}
+	if s.Format != formatLabeled {
+		return fmt.Errorf("tiers requires format labeled")
+	}
+	// The cache holds prefixes without their labels.
+	if s.ParseCacheSize > 0 {
+		return fmt.Errorf("tiers cannot be combined with parse_cache_size")
+	}
+	// Merging a direct prefix with a proxy sibling would promote it.
+	if s.Aggregate {
+		return fmt.Errorf("tiers cannot be combined with aggregate")
+	}
+	return nil
+}
+
+// isProxy reports whether the labels of a prefix put it in the proxy
+// tier. A prefix labeled with both tiers, or with neither, is direct.
+func isProxy(labels []string) bool {
+	label := func(tier string) bool {
+		return slices.ContainsFunc(labels, func(l string) bool {
+			return strings.EqualFold(l, tier)
+		})
+	}
+	return label(tierProxy) && !label(tierDirect)
+}
+
+// recordTiers notes the tier of each prefix of the list fetched in the
+// running refresh cycle, from s.labels. Only called by the refresh
+// goroutine.
+func (s *WedosIPRange) recordTiers(prefixes []netip.Prefix) {
+	s.pendingTiers = make(map[netip.Prefix]bool, len(prefixes))
+	for _, p := range prefixes {
+		s.pendingTiers[p] = isProxy(s.labels[p])
+	}
+}
+
+// commitTiers makes the tiers of the refresh cycle about to be applied
+// current. A prefix of applied the fetch no longer listed, kept by
+// Additive or ShrinkGrace, keeps its previous tier.
+func (s *WedosIPRange) commitTiers(applied []netip.Prefix) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var proxy, direct []netip.Prefix
+	for _, p := range applied {
+		trusted, listed := s.pendingTiers[p]
+		if !listed {
+			trusted = slices.Contains(s.proxy, p)
+		}
+		if trusted {
+			proxy = append(proxy, p)
+		} else {
+			direct = append(direct, p)
+		}
+	}
+	s.proxy, s.direct = proxy, direct
+	s.pendingTiers = nil
+}
+
+// splitTiers returns the ranges of the proxy tier and the others. Only the
+// pinned ranges and those within a prefix labeled "proxy" are trusted as
+// proxies; a range within a direct prefix, or whose tier is unknown, such
+// as those loaded from the cache file or storage before the first fetch,
+// is direct. s.lock must be held.
+func (s *WedosIPRange) splitTiers(ranges []netip.Prefix) (proxy, direct []netip.Prefix) {
+	for _, p := range ranges {
+		if coveredBy(p, s.pinned) || coveredBy(p, s.proxy) && !coveredBy(p, s.direct) {
+			proxy = append(proxy, p)
+		} else {
+			direct = append(direct, p)
+		}
+	}
+	return slices.Clip(proxy), slices.Clip(direct)
+}
+
+// GetProxyRanges returns the current ranges of the proxy tier: those of a
+// list read with Tiers labeled "proxy", and the pinned ranges. Their
+// forwarded headers are meant to be honored. Without Tiers it returns all
+// ranges, like GetIPRanges. The returned slice must not be modified.
+func (s *WedosIPRange) GetProxyRanges() []netip.Prefix {
+	s = s.fetcher()
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if !s.Tiers {
+		return s.ranges
+	}
+	return s.proxyRanges
+}
+
+// GetDirectRanges returns the current ranges of the direct tier: those of
+// a list read with Tiers not labeled "proxy", allowed to connect but not
+// trusted as proxies. Without Tiers it returns nil. The returned slice
+// must not be modified.
+func (s *WedosIPRange) GetDirectRanges() []netip.Prefix {
+	s = s.fetcher()
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.directRanges
+}
@@ -0,0 +1,89 @@
+package caddy_wedos_ip
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestTiers(t *testing.T) {
+	srv := sequenceServer(t,
+		"192.0.2.0/24 proxy\n198.51.100.0/24 direct\n203.0.113.0/24\n2001:db8::/32 eu DIRECT\n",
+		"192.0.2.0/24 proxy\n203.0.113.0/24\n",
+	)
+	s := newTestRange(srv.URL)
+	s.Format = formatLabeled
+	s.Tiers = true
+	s.pinned = parsePrefixes(t, "100.64.0.0/10")
+	// The exclude splits a direct prefix; its parts stay direct.
+	s.exclude = parsePrefixes(t, "198.51.100.0/25")
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	wantProxy := parsePrefixes(t, "100.64.0.0/10", "192.0.2.0/24")
+	if got := s.GetProxyRanges(); !slices.Equal(got, wantProxy) {
+		t.Errorf("expected proxy ranges %v, got %v", wantProxy, got)
+	}
+	wantDirect := parsePrefixes(t, "198.51.100.128/25", "203.0.113.0/24", "2001:db8::/32")
+	if got := s.GetDirectRanges(); !slices.Equal(got, wantDirect) {
+		t.Errorf("expected direct ranges %v, got %v", wantDirect, got)
+	}
+	if n := len(s.GetIPRanges(nil)); n != len(wantProxy)+len(wantDirect) {
+		t.Errorf("expected GetIPRanges to return both tiers, got %d prefixes", n)
+	}
+
+	// A direct prefix kept by shrink_grace after the fetch dropped it
+	// stays direct.
+	s.ShrinkGrace = caddy.Duration(time.Hour)
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.GetDirectRanges(); !slices.Equal(got, wantDirect) {
+		t.Errorf("expected direct ranges %v kept, got %v", wantDirect, got)
+	}
+}
+
+func TestTiersFailClosed(t *testing.T) {
+	srv := sequenceServer(t, "192.0.2.0/24 direct\n198.51.100.0/24 proxy\n")
+	s := newTestRange(srv.URL)
+	s.Format = formatLabeled
+	s.Tiers = true
+	// A pinned range inside a direct prefix stays a proxy.
+	s.pinned = parsePrefixes(t, "192.0.2.0/24")
+
+	// Ranges loaded before the first fetch have no known tier.
+	s.setRanges(parsePrefixes(t, "198.51.100.0/24"), time.Now())
+	want := parsePrefixes(t, "192.0.2.0/24")
+	if got := s.GetProxyRanges(); !slices.Equal(got, want) {
+		t.Errorf("expected only the pinned range in the proxy tier before the first fetch, got %v", got)
+	}
+
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	want = parsePrefixes(t, "192.0.2.0/24", "198.51.100.0/24")
+	if got := s.GetProxyRanges(); !slices.Equal(got, want) {
+		t.Errorf("expected proxy ranges %v, got %v", want, got)
+	}
+	if got := s.GetDirectRanges(); len(got) != 0 {
+		t.Errorf("expected no direct ranges, got %v", got)
+	}
+}
+
+func TestTiersDisabled(t *testing.T) {
+	srv := sequenceServer(t, "192.0.2.0/24 direct\n")
+	s := newTestRange(srv.URL)
+	s.Format = formatLabeled
+	if err := s.refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.GetProxyRanges(); !slices.Equal(got, s.GetIPRanges(nil)) {
+		t.Errorf("expected all ranges in the proxy tier, got %v", got)
+	}
+	if got := s.GetDirectRanges(); got != nil {
+		t.Errorf("expected no direct ranges, got %v", got)
+	}
+}
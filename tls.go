@@ -0,0 +1,69 @@
+package caddy_wedos_ip
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2/modules/caddytls"
+)
+
+// provisionTLS validates TLSMinVersion and TLSCipherSuites against the
+// names Caddy accepts for its own TLS connection policies, and
+// TLSServerName as a host name or IP address.
+func (s *WedosIPRange) provisionTLS() error {
+	if s.TLSMinVersion != "" {
+		version, ok := caddytls.SupportedProtocols[s.TLSMinVersion]
+		if !ok {
+			return fmt.Errorf("tls_min_version: unknown protocol %q (want tls1.2 or tls1.3)", s.TLSMinVersion)
+		}
+		s.tlsMinVersion = version
+	}
+	s.cipherSuites = nil
+	for _, name := range s.TLSCipherSuites {
+		id := caddytls.CipherSuiteID(name)
+		if id == 0 {
+			return fmt.Errorf("tls_cipher_suites: unknown or insecure cipher suite %q", name)
+		}
+		s.cipherSuites = append(s.cipherSuites, id)
+	}
+	s.tlsServerName = ""
+	if s.TLSServerName != "" {
+		name, err := checkServerName(s.TLSServerName)
+		if err != nil {
+			return fmt.Errorf("tls_server_name: %v", err)
+		}
+		s.tlsServerName = name
+	}
+	return nil
+}
+
+// checkServerName validates a TLS server name and converts an
+// internationalized one to its ASCII form. An IP address is accepted:
+// Go sends no SNI for it but verifies the certificate against it.
+func checkServerName(name string) (string, error) {
+	if _, err := netip.ParseAddr(name); err == nil {
+		return name, nil
+	}
+	if strings.ContainsAny(name, ":/ ") {
+		return "", fmt.Errorf("invalid server name %q", name)
+	}
+	ascii, err := hostProfile.ToASCII(name)
+	if err != nil {
+		return "", fmt.Errorf("invalid server name %q: %v", name, err)
+	}
+	return ascii, nil
+}
+
+// tlsConfig returns the client TLS configuration, or nil for Go's defaults.
+func (s *WedosIPRange) tlsConfig() *tls.Config {
+	if s.tlsMinVersion == 0 && len(s.cipherSuites) == 0 && s.tlsServerName == "" {
+		return nil
+	}
+	return &tls.Config{
+		MinVersion:   s.tlsMinVersion,
+		CipherSuites: s.cipherSuites,
+		ServerName:   s.tlsServerName,
+	}
+}
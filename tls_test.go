@@ -0,0 +1,103 @@
+package caddy_wedos_ip
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProvisionTLS(t *testing.T) {
+	s := WedosIPRange{
+		TLSMinVersion:   "tls1.2",
+		TLSCipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"},
+	}
+	if err := s.provisionTLS(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := s.tlsConfig()
+	if cfg.MinVersion != tls.VersionTLS12 || len(cfg.CipherSuites) != 1 || cfg.CipherSuites[0] != tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384 {
+		t.Errorf("unexpected TLS config: %+v", cfg)
+	}
+
+	for _, s := range []WedosIPRange{
+		{TLSMinVersion: "1.2"},
+		{TLSMinVersion: "tls1.0"},
+		{TLSCipherSuites: []string{"TLS_BOGUS"}},
+		{TLSCipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		{TLSServerName: "ips.example.com:443"},
+		{TLSServerName: "bad name"},
+		{TLSServerName: "a..b"},
+	} {
+		if err := s.provisionTLS(); err == nil {
+			t.Errorf("%+v: expected error", s)
+		}
+	}
+
+	if cfg := (&WedosIPRange{}).tlsConfig(); cfg != nil {
+		t.Errorf("expected Go's defaults without TLS options, got %+v", cfg)
+	}
+}
+
+func TestTLSMinVersion(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	srv.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+
+	for version, wantErr := range map[string]bool{"tls1.2": false, "tls1.3": true} {
+		s := newTestRange(srv.URL)
+		s.TLSMinVersion = version
+		if err := s.provisionTLS(); err != nil {
+			t.Fatal(err)
+		}
+		s.client = s.newClient()
+		s.client.Transport.(*http.Transport).TLSClientConfig.RootCAs = srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+		err := s.refresh()
+		if wantErr && err == nil {
+			t.Errorf("%s: expected the TLS 1.2 server to be rejected", version)
+		}
+		if !wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", version, err)
+		}
+	}
+}
+
+func TestTLSServerName(t *testing.T) {
+	var sni string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	srv.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		sni = hello.ServerName
+		return nil, nil
+	}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// The test certificate is valid for example.com, not for example.org.
+	for name, wantErr := range map[string]bool{"example.com": false, "example.org": true} {
+		sni = ""
+		s := newTestRange(srv.URL)
+		s.TLSServerName = name
+		if err := s.provisionTLS(); err != nil {
+			t.Fatal(err)
+		}
+		s.client = s.newClient()
+		s.client.Transport.(*http.Transport).TLSClientConfig.RootCAs = srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+		err := s.refresh()
+		if wantErr && err == nil {
+			t.Errorf("%s: expected the certificate to be rejected", name)
+		}
+		if !wantErr && err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+		if sni != name {
+			t.Errorf("%s: server saw SNI %q", name, sni)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans of this module.
+const tracerName = "github.com/hexband/caddy-wedos-ip"
+
+// startFetchSpan starts the span of one fetch of api. The tracer comes from
+// the span in ctx if there is one, and from the global provider otherwise.
+func startFetchSpan(ctx context.Context, api string) (context.Context, trace.Span) {
+	tracer := otel.Tracer(tracerName)
+	if parent := trace.SpanFromContext(ctx); parent.SpanContext().IsValid() {
+		tracer = parent.TracerProvider().Tracer(tracerName)
+	}
+	return tracer.Start(ctx, "wedos.fetch",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("url.full", redactURL(api))))
+}
+
+// fetchTrace collects the span attributes of a fetch. Its methods do
+// nothing on a nil fetchTrace, so fetchList needs no tracing checks.
+type fetchTrace struct {
+	status int
+	bytes  int64
+}
+
+func (t *fetchTrace) setStatus(code int) {
+	if t != nil {
+		t.status = code
+	}
+}
+
+// countBytes returns r, counting the bytes read from it into t.
+func (t *fetchTrace) countBytes(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &countingReader{r: r, n: &t.bytes}
+}
+
+// end records the outcome of the fetch on span and ends it.
+func (t *fetchTrace) end(span trace.Span, prefixes int, err error) {
+	if t.status != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", t.status))
+	}
+	span.SetAttributes(
+		attribute.Int64("wedos.bytes", t.bytes),
+		attribute.Int("wedos.prefixes", prefixes))
+	if err != nil && !errors.Is(err, errNotModified) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
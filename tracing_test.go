@@ -0,0 +1,101 @@
+package caddy_wedos_ip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans installs a global tracer provider recording ended spans for
+// the duration of the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return rec
+}
+
+func spanAttr(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracingSpan(t *testing.T) {
+	rec := recordSpans(t)
+	body := "192.0.2.0/24\n198.51.100.0/24\n"
+	s := newTestRange(sequenceServer(t, body).URL)
+	s.Tracing = true
+
+	if _, err := s.fetch(s.URL); err != nil {
+		t.Fatalf("fetch error: %v", err)
+	}
+	spans := rec.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "wedos.fetch" {
+		t.Errorf("unexpected span name %q", span.Name())
+	}
+	if got := spanAttr(span, "url.full").AsString(); got != s.URL {
+		t.Errorf("url.full = %q, want %q", got, s.URL)
+	}
+	if got := spanAttr(span, "http.response.status_code").AsInt64(); got != http.StatusOK {
+		t.Errorf("status = %d, want 200", got)
+	}
+	if got := spanAttr(span, "wedos.bytes").AsInt64(); got != int64(len(body)) {
+		t.Errorf("bytes = %d, want %d", got, len(body))
+	}
+	if got := spanAttr(span, "wedos.prefixes").AsInt64(); got != 2 {
+		t.Errorf("prefixes = %d, want 2", got)
+	}
+	if span.Status().Code != codes.Unset {
+		t.Errorf("unexpected span status %v", span.Status())
+	}
+}
+
+func TestTracingSpanError(t *testing.T) {
+	rec := recordSpans(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+	s := newTestRange(srv.URL)
+	s.Tracing = true
+
+	if _, err := s.fetch(s.URL); err == nil {
+		t.Fatalf("expected fetch error")
+	}
+	spans := rec.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	if spans[0].Status().Code != codes.Error {
+		t.Errorf("expected error status, got %v", spans[0].Status())
+	}
+	if got := spanAttr(spans[0], "http.response.status_code").AsInt64(); got != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", got)
+	}
+}
+
+func TestTracingDisabled(t *testing.T) {
+	rec := recordSpans(t)
+	s := newTestRange(sequenceServer(t, "192.0.2.0/24").URL)
+	if _, err := s.fetch(s.URL); err != nil {
+		t.Fatalf("fetch error: %v", err)
+	}
+	if n := len(rec.Ended()); n != 0 {
+		t.Errorf("expected no spans without tracing, got %d", n)
+	}
+}
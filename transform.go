@@ -0,0 +1,168 @@
+package caddy_wedos_ip
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ListTransform rewrites a list before it is parsed, such as to drop a
+// column or filter out entries. Transforms are selected by name with the
+// transform option and applied in order.
+type ListTransform interface {
+	Transform(r io.Reader) (io.Reader, error)
+}
+
+// ListTransformFunc adapts a function to a ListTransform.
+type ListTransformFunc func(r io.Reader) (io.Reader, error)
+
+// Transform calls f(r).
+func (f ListTransformFunc) Transform(r io.Reader) (io.Reader, error) {
+	return f(r)
+}
+
+var (
+	listTransforms = map[string]ListTransform{
+		"first-column":   ListTransformFunc(firstColumn),
+		"strip-comments": ListTransformFunc(stripComments),
+	}
+	listTransformsLock sync.RWMutex
+)
+
+// RegisterListTransform makes t available as transform name. It is meant
+// to be called from init functions, and panics if name is empty or already
+// registered, like caddy.RegisterModule.
+func RegisterListTransform(name string, t ListTransform) {
+	if name == "" {
+		panic("list transform name must not be empty")
+	}
+	if t == nil {
+		panic("list transform must not be nil")
+	}
+	listTransformsLock.Lock()
+	defer listTransformsLock.Unlock()
+	if _, ok := listTransforms[name]; ok {
+		panic(fmt.Sprintf("list transform already registered: %s", name))
+	}
+	listTransforms[name] = t
+}
+
+// lookupListTransform returns the transform registered as name.
+func lookupListTransform(name string) (ListTransform, bool) {
+	listTransformsLock.RLock()
+	defer listTransformsLock.RUnlock()
+	t, ok := listTransforms[name]
+	return t, ok
+}
+
+// provisionTransforms resolves TransformCommand and the Transform names,
+// in the order they are applied.
+func (s *WedosIPRange) provisionTransforms() error {
+	s.transforms = nil
+	if len(s.TransformCommand) > 0 {
+		s.transforms = append(s.transforms, ListTransformFunc(s.runTransformCommand))
+	}
+	for _, name := range s.Transform {
+		t, ok := lookupListTransform(name)
+		if !ok {
+			return fmt.Errorf("unknown transform %q", name)
+		}
+		s.transforms = append(s.transforms, t)
+	}
+	return nil
+}
+
+// transformed returns r passed through the configured transforms.
+func (s *WedosIPRange) transformed(r io.Reader) (io.Reader, error) {
+	for _, t := range s.transforms {
+		var err error
+		r, err = t.Transform(s.scanSized(r))
+		if err != nil {
+			return nil, fmt.Errorf("transform: %w", err)
+		}
+	}
+	return r, nil
+}
+
+// runTransformCommand runs TransformCommand with the list on stdin and
+// returns its standard output, bounded like a fetch by Timeout.
+func (s *WedosIPRange) runTransformCommand(r io.Reader) (io.Reader, error) {
+	ctx, cancel := s.getContext()
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.TransformCommand[0], s.TransformCommand[1:]...)
+	cmd.Stdin = r
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	// Don't wait forever on output pipes held open by leftover children.
+	cmd.WaitDelay = time.Second
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > maxHookOutput {
+			msg = msg[:maxHookOutput]
+		}
+		if msg != "" {
+			return nil, fmt.Errorf("%s: %v: %s", s.TransformCommand[0], err, msg)
+		}
+		return nil, fmt.Errorf("%s: %v", s.TransformCommand[0], err)
+	}
+	return bytes.NewReader(out), nil
+}
+
+// firstColumn keeps the first whitespace-separated field of each line, such
+// as the prefix of "192.0.2.0/24 prague dc1". Blank lines are dropped.
+func firstColumn(r io.Reader) (io.Reader, error) {
+	return newLineFilter(r, func(line string) (string, bool) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return "", false
+		}
+		return fields[0], true
+	}), nil
+}
+
+// stripComments removes everything from a "#" to the end of its line.
+// Lines left blank are dropped.
+func stripComments(r io.Reader) (io.Reader, error) {
+	return newLineFilter(r, func(line string) (string, bool) {
+		line, _, _ = strings.Cut(line, "#")
+		line = strings.TrimSpace(line)
+		return line, line != ""
+	}), nil
+}
+
+// lineFilter rewrites a list line by line as it is read, keeping only the
+// lines fn returns true for.
+type lineFilter struct {
+	scanner *bufio.Scanner
+	fn      func(line string) (string, bool)
+	buf     []byte
+}
+
+func newLineFilter(r io.Reader, fn func(line string) (string, bool)) *lineFilter {
+	return &lineFilter{scanner: newScanner(r), fn: fn}
+}
+
+func (f *lineFilter) Read(p []byte) (int, error) {
+	for len(f.buf) == 0 {
+		if !f.scanner.Scan() {
+			if err := f.scanner.Err(); err != nil {
+				return 0, scanErr(err)
+			}
+			return 0, io.EOF
+		}
+		if line, ok := f.fn(f.scanner.Text()); ok {
+			f.buf = append(f.buf[:0], line...)
+			f.buf = append(f.buf, '\n')
+		}
+	}
+	n := copy(p, f.buf)
+	f.buf = f.buf[n:]
+	return n, nil
+}
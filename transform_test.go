@@ -0,0 +1,118 @@
+package caddy_wedos_ip
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBuiltinTransforms(t *testing.T) {
+	for _, tc := range []struct {
+		name, in, want string
+	}{
+		{"first-column", "192.0.2.0/24 prague dc1\n\n  2001:db8::/32\tbrno\n", "192.0.2.0/24\n2001:db8::/32\n"},
+		{"strip-comments", "# WEDOS ranges\n192.0.2.0/24 # prague\n\n2001:db8::/32\n", "192.0.2.0/24\n2001:db8::/32\n"},
+	} {
+		tr, ok := lookupListTransform(tc.name)
+		if !ok {
+			t.Fatalf("%s is not registered", tc.name)
+		}
+		r, err := tr.Transform(strings.NewReader(tc.in))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+// regionFilter keeps the "prefix region" lines of one region, as an
+// example of a site-specific transform.
+func regionFilter(r io.Reader) (io.Reader, error) {
+	var out strings.Builder
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if prefix, region, _ := strings.Cut(scanner.Text(), " "); region == "cz" {
+			out.WriteString(prefix + "\n")
+		}
+	}
+	return strings.NewReader(out.String()), scanner.Err()
+}
+
+func TestRegisterListTransform(t *testing.T) {
+	RegisterListTransform("test_region", ListTransformFunc(regionFilter))
+	defer func() {
+		listTransformsLock.Lock()
+		delete(listTransforms, "test_region")
+		listTransformsLock.Unlock()
+	}()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("# regions\n192.0.2.0/24 cz\n198.51.100.0/24 sk\n2001:db8::/32 cz # brno\n"))
+	}))
+	defer srv.Close()
+
+	s := newTestRange(srv.URL)
+	s.Transform = []string{"strip-comments", "test_region"}
+	if err := s.provisionTransforms(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.refresh(); err != nil {
+		t.Fatalf("refresh error: %v", err)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24", "2001:db8::/32"); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, name := range []string{"", "first-column", "test_region"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterListTransform(%q): expected a panic", name)
+				}
+			}()
+			RegisterListTransform(name, ListTransformFunc(regionFilter))
+		}()
+	}
+
+	s.Transform = []string{"no-such-transform"}
+	if err := s.provisionTransforms(); err == nil {
+		t.Errorf("expected an unknown transform to be rejected")
+	}
+}
+
+func TestTransformCommand(t *testing.T) {
+	if _, err := exec.LookPath("sed"); err != nil {
+		t.Skip("sed not available")
+	}
+	s := newTestRange(sequenceServer(t, "ip 192.0.2.0/24\nip 2001:db8::/32\n").URL)
+	s.TransformCommand = []string{"sed", "s/^ip //"}
+	s.Transform = []string{"first-column"}
+	if err := s.provisionTransforms(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.refresh(); err != nil {
+		t.Fatalf("refresh error: %v", err)
+	}
+	if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24", "2001:db8::/32"); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	s.TransformCommand = []string{"sh", "-c", "echo broken >&2; exit 3"}
+	if err := s.provisionTransforms(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.refresh(); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("expected the command's failure and stderr, got %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package caddy_wedos_ip
+
+import (
+	"os"
+	"time"
+)
+
+// triggerPollInterval is how often TriggerFile is checked when it cannot
+// be watched.
+const triggerPollInterval = 5 * time.Second
+
+// pollTriggerFile signals fileChanged whenever the mtime of TriggerFile
+// changes, or it appears or disappears, until the module's context is
+// done.
+func (s *WedosIPRange) pollTriggerFile() {
+	last := fileModTime(s.TriggerFile)
+	ticker := time.NewTicker(triggerPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if mtime := fileModTime(s.TriggerFile); !mtime.Equal(last) {
+				last = mtime
+				s.signalFileChanged()
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// fileModTime returns the mtime of path, or the zero time if it cannot be
+// read.
+func fileModTime(path string) time.Time {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
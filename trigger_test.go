@@ -0,0 +1,60 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestTriggerFile(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	defer srv.Close()
+
+	trigger := filepath.Join(t.TempDir(), "refresh")
+	if err := os.WriteFile(trigger, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{URL: srv.URL, TriggerFile: trigger, Interval: caddy.Duration(time.Hour), RequireOnStart: true}
+	if err := r.Provision(ctx); err != nil {
+		t.Fatalf("provision error: %v", err)
+	}
+	defer r.Cleanup()
+	if n := hits.Load(); n != 1 {
+		t.Fatalf("expected 1 fetch at startup, got %d", n)
+	}
+
+	// Touching the file only updates its mtime.
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(trigger, later, later); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return hits.Load() == 2 })
+}
+
+func TestFileModTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "refresh")
+	if !fileModTime(path).IsZero() {
+		t.Error("expected the zero time for a missing file")
+	}
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if fileModTime(path).IsZero() {
+		t.Error("expected the mtime of an existing file")
+	}
+}
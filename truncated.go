@@ -0,0 +1,51 @@
+package caddy_wedos_ip
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// errTruncatedResponse is returned when the body of a response ends before
+// its Content-Length, or before the final chunk. It is a transport failure
+// even if the cut-off body fails to parse first.
+var errTruncatedResponse = errors.New("truncated response")
+
+// truncationReader wraps a response body and records whether it ended
+// early.
+type truncationReader struct {
+	body      io.ReadCloser
+	read      int64
+	want      int64
+	truncated bool
+}
+
+// watchTruncation replaces the body of resp with a truncationReader.
+func watchTruncation(resp *http.Response) *truncationReader {
+	t := &truncationReader{body: resp.Body, want: resp.ContentLength}
+	resp.Body = t
+	return t
+}
+
+func (t *truncationReader) Read(p []byte) (int, error) {
+	n, err := t.body.Read(p)
+	t.read += int64(n)
+	if errors.Is(err, io.ErrUnexpectedEOF) || err == io.EOF && t.want >= 0 && t.read < t.want {
+		t.truncated = true
+		return n, t.err()
+	}
+	return n, err
+}
+
+func (t *truncationReader) Close() error {
+	return t.body.Close()
+}
+
+// err describes the truncation.
+func (t *truncationReader) err() error {
+	if t.want < 0 {
+		return fmt.Errorf("%w after %d bytes", errTruncatedResponse, t.read)
+	}
+	return fmt.Errorf("%w: read %d of %d bytes", errTruncatedResponse, t.read, t.want)
+}
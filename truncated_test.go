@@ -0,0 +1,66 @@
+package caddy_wedos_ip
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// truncatingServer announces a Content-Length longer than body and closes
+// the connection after writing body.
+func truncatingServer(t *testing.T, body string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n%s", len(body)+20, body)
+		buf.Flush()
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestTruncatedResponse(t *testing.T) {
+	// Cut off mid-CIDR, which alone would be reported as a parse error.
+	srv := truncatingServer(t, "192.0.2.0/24 198.51.100.")
+
+	core, logs := observer.New(zap.WarnLevel)
+	s := newTestRange(srv.URL)
+	s.logger = zap.New(core)
+	s.setRanges(parsePrefixes(t, "203.0.113.0/24"), s.now())
+
+	err := s.refresh()
+	if !errors.Is(err, errTruncatedResponse) {
+		t.Fatalf("expected a truncated response error, got %v", err)
+	}
+	if class := classifyError(err); class != errClassConnection {
+		t.Errorf("expected error class connection, got %q", class)
+	}
+	if got := s.GetIPRanges(nil); len(got) != 1 || got[0] != parsePrefixes(t, "203.0.113.0/24")[0] {
+		t.Errorf("expected the previous ranges to be kept, got %v", got)
+	}
+	if n := logs.FilterMessage("truncated response").Len(); n != 1 {
+		t.Errorf("expected one truncated response log, got %d", n)
+	}
+}
+
+func TestTruncatedAtTokenBoundary(t *testing.T) {
+	// The partial body parses, but must not be applied.
+	srv := truncatingServer(t, "192.0.2.0/24")
+
+	s := newTestRange(srv.URL)
+	if err := s.refresh(); !errors.Is(err, errTruncatedResponse) {
+		t.Fatalf("expected a truncated response error, got %v", err)
+	}
+	if got := s.GetIPRanges(nil); len(got) != 0 {
+		t.Errorf("expected no ranges, got %v", got)
+	}
+}
@@ -0,0 +1,64 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// PrefixVerifier checks fetched prefixes against an external source of
+// truth, such as RIR or routing data, when verify_asn is configured.
+type PrefixVerifier interface {
+	// VerifyPrefix reports whether prefix is announced by asn. An error
+	// aborts the refresh and keeps the previous ranges.
+	VerifyPrefix(ctx context.Context, asn uint32, prefix netip.Prefix) (bool, error)
+}
+
+// noopVerifier accepts every prefix.
+type noopVerifier struct{}
+
+func (noopVerifier) VerifyPrefix(context.Context, uint32, netip.Prefix) (bool, error) {
+	return true, nil
+}
+
+var (
+	verifier     PrefixVerifier = noopVerifier{}
+	verifierLock sync.RWMutex
+)
+
+// RegisterPrefixVerifier sets the verifier consulted for verify_asn.
+// Passing nil restores the default, which accepts every prefix.
+func RegisterPrefixVerifier(v PrefixVerifier) {
+	verifierLock.Lock()
+	defer verifierLock.Unlock()
+	if v == nil {
+		v = noopVerifier{}
+	}
+	verifier = v
+}
+
+// verifyPrefixes drops prefixes the registered verifier rejects.
+func (s *WedosIPRange) verifyPrefixes(prefixes []netip.Prefix) ([]netip.Prefix, error) {
+	verifierLock.RLock()
+	v := verifier
+	verifierLock.RUnlock()
+
+	kept := prefixes[:0]
+	for _, prefix := range prefixes {
+		ok, err := v.VerifyPrefix(s.baseContext(), s.VerifyASN, prefix)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			s.logger.Warn("dropping prefix that failed ASN verification",
+				zap.Stringer("prefix", prefix),
+				zap.Uint32("asn", s.VerifyASN))
+			s.pdebug.dropped(prefix, "asn")
+			continue
+		}
+		kept = append(kept, prefix)
+	}
+	return kept, nil
+}
@@ -0,0 +1,55 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+type asnVerifier struct {
+	announced netip.Prefix
+	err       error
+}
+
+func (v asnVerifier) VerifyPrefix(_ context.Context, asn uint32, prefix netip.Prefix) (bool, error) {
+	if v.err != nil {
+		return false, v.err
+	}
+	return asn == 64500 && v.announced.Overlaps(prefix) && v.announced.Bits() <= prefix.Bits(), nil
+}
+
+func TestVerifyPrefixes(t *testing.T) {
+	defer RegisterPrefixVerifier(nil)
+
+	s := WedosIPRange{VerifyASN: 64500, ctx: caddy.Context{Context: context.Background()}, logger: zap.NewNop()}
+	in := parsePrefixes(t, "192.0.2.0/25", "198.51.100.0/24", "192.0.2.128/25")
+
+	RegisterPrefixVerifier(asnVerifier{announced: netip.MustParsePrefix("192.0.2.0/24")})
+	got, err := s.verifyPrefixes(slices.Clone(in))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := parsePrefixes(t, "192.0.2.0/25", "192.0.2.128/25")
+	if !slices.Equal(got, want) {
+		t.Errorf("verifyPrefixes() = %v, want %v", got, want)
+	}
+
+	RegisterPrefixVerifier(asnVerifier{err: errors.New("lookup failed")})
+	if _, err := s.verifyPrefixes(slices.Clone(in)); err == nil {
+		t.Errorf("expected verifier error to be returned")
+	}
+
+	RegisterPrefixVerifier(nil)
+	got, err = s.verifyPrefixes(slices.Clone(in))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(got, in) {
+		t.Errorf("default verifier dropped prefixes: %v", got)
+	}
+}
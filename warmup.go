@@ -0,0 +1,46 @@
+package caddy_wedos_ip
+
+import (
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// warmup sends a HEAD request to every configured URL so that the first
+// real fetch reuses an established (and TLS-negotiated) pooled connection.
+// Failures are logged and otherwise ignored; the fetch reports real errors.
+func (s *WedosIPRange) warmup() {
+	urls := []string{s.URL}
+	if s.URLv4 != "" || s.URLv6 != "" {
+		urls = []string{s.URLv4, s.URLv6}
+	}
+	for _, u := range urls {
+		if u == "" {
+			continue
+		}
+		if err := s.warmupURL(u); err != nil {
+			s.logger.Debug("connection warmup failed", zap.String("url", u), zap.Error(err))
+		}
+	}
+}
+
+func (s *WedosIPRange) warmupURL(u string) error {
+	ctx, cancel := s.getContext()
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(uncharged(ctx), http.MethodHead, u, nil)
+	if err != nil {
+		return err
+	}
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	// Drain the body so the connection goes back to the pool.
+	io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
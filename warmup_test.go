@@ -0,0 +1,57 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestWarmupReusesConnection(t *testing.T) {
+	var conns, heads atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			heads.Add(1)
+			return
+		}
+		w.Write([]byte("192.0.2.0/24"))
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{URL: srv.URL, Warmup: true, RequireOnStart: true}
+	if err := r.Provision(ctx); err != nil {
+		t.Fatalf("provision error: %v", err)
+	}
+	defer r.Cleanup()
+
+	if heads.Load() != 1 {
+		t.Errorf("expected 1 warmup request, got %d", heads.Load())
+	}
+	if conns.Load() != 1 {
+		t.Errorf("expected the fetch to reuse the warmup connection, got %d connections", conns.Load())
+	}
+}
+
+func TestWarmupFailureIgnored(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{URL: "http://127.0.0.1:1/ips.txt", Warmup: true}
+	if err := r.Provision(ctx); err != nil {
+		t.Fatalf("warmup failure should not fail provisioning: %v", err)
+	}
+	r.Cleanup()
+}
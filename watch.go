@@ -0,0 +1,72 @@
+package caddy_wedos_ip
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// watchDebounce coalesces the burst of events a single update produces.
+const watchDebounce = 100 * time.Millisecond
+
+// startWatch starts watching path, signaling fileChanged when it changes.
+// The parent directory is watched so that atomic renames are seen. With
+// touch, a change of only its attributes, such as its mtime, counts too.
+// It reports false if watching is not supported.
+func (s *WedosIPRange) startWatch(path string, touch bool) bool {
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		err = watcher.Add(filepath.Dir(path))
+		if err != nil {
+			watcher.Close()
+		}
+	}
+	if err != nil {
+		s.logger.Warn("cannot watch file, falling back to polling", zap.String("path", path), zap.Error(err))
+		return false
+	}
+	go s.watchFile(watcher, path, touch)
+	return true
+}
+
+// watchFile signals fileChanged when path is written, replaced or
+// removed, until the module's context is done.
+func (s *WedosIPRange) watchFile(watcher *fsnotify.Watcher, path string, touch bool) {
+	defer watcher.Close()
+
+	name := filepath.Clean(path)
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+	for {
+		select {
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(ev.Name) == name && (touch || !ev.Has(fsnotify.Chmod)) {
+				debounce.Reset(watchDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			s.logger.Warn("watching file failed", zap.String("path", path), zap.Error(err))
+		case <-debounce.C:
+			s.signalFileChanged()
+		case <-s.ctx.Done():
+			debounce.Stop()
+			return
+		}
+	}
+}
+
+// signalFileChanged asks the refresh loop for a refresh, unless one is
+// already pending.
+func (s *WedosIPRange) signalFileChanged() {
+	select {
+	case s.fileChanged <- struct{}{}:
+	default:
+	}
+}
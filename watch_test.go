@@ -0,0 +1,72 @@
+package caddy_wedos_ip
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ips.txt")
+	if err := os.WriteFile(path, []byte("192.0.2.0/24\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{File: path, RequireOnStart: true}
+	if err := r.Provision(ctx); err != nil {
+		t.Fatalf("provision error: %v", err)
+	}
+	defer r.Cleanup()
+
+	if r.Source != sourceFile || r.URL != "" {
+		t.Errorf("expected the file source without a URL, got source %q url %q", r.Source, r.URL)
+	}
+	if got, want := r.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24"); !slices.Equal(got, want) {
+		t.Errorf("GetIPRanges() = %v, want %v", got, want)
+	}
+}
+
+func TestWatchReloadsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ips.txt")
+	if err := os.WriteFile(path, []byte("192.0.2.0/24\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{File: path, Watch: true, Interval: caddy.Duration(time.Hour), RequireOnStart: true}
+	if err := r.Provision(ctx); err != nil {
+		t.Fatalf("provision error: %v", err)
+	}
+	defer r.Cleanup()
+
+	// Replace the file atomically, as config management tools do.
+	if err := writeFileAtomic(path, []byte("198.51.100.0/24\n")); err != nil {
+		t.Fatal(err)
+	}
+	want := parsePrefixes(t, "198.51.100.0/24")
+	waitFor(t, func() bool { return slices.Equal(r.GetIPRanges(nil), want) })
+}
+
+func TestWatchRequiresFile(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+
+	r := WedosIPRange{Watch: true}
+	if err := r.Provision(ctx); err == nil {
+		t.Errorf("expected an error for watch without the file source")
+	}
+	r = WedosIPRange{Source: sourceFile}
+	if err := r.Provision(ctx); err == nil {
+		t.Errorf("expected an error for the file source without a file")
+	}
+}
@@ -0,0 +1,152 @@
+package caddy_wedos_ip
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultNotifyFailures is how many refreshes in a row must fail
+	// before NotifyURL is notified, if not configured.
+	defaultNotifyFailures = 3
+	// defaultNotifyTimeout bounds a notification if not configured.
+	defaultNotifyTimeout = 10 * time.Second
+	// notifyInterval is the minimum time between two failure
+	// notifications, so a flapping source can't spam the webhook.
+	notifyInterval = 10 * time.Minute
+)
+
+// States reported to NotifyURL.
+const (
+	notifyFailed    = "failed"
+	notifyRecovered = "recovered"
+)
+
+// notification is the JSON payload posted to NotifyURL.
+type notification struct {
+	State               string `json:"state"`
+	Source              string `json:"source"`
+	LastError           string `json:"last_error,omitempty"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	// Seconds since the last successful refresh, -1 if there was none.
+	AgeSeconds int64     `json:"age_seconds"`
+	Time       time.Time `json:"time"`
+}
+
+// provisionNotify validates NotifyURL and applies the notification
+// defaults.
+func (s *WedosIPRange) provisionNotify() error {
+	if s.NotifyURL == "" {
+		return nil
+	}
+	normalized, err := normalizeURL(s.NotifyURL)
+	if err != nil {
+		return fmt.Errorf("notify_url: %v", err)
+	}
+	u, err := url.Parse(normalized)
+	if err != nil {
+		return fmt.Errorf("notify_url: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("notify_url: %q is not an http or https URL", s.NotifyURL)
+	}
+	if s.RequireHTTPS && u.Scheme != "https" {
+		return fmt.Errorf("require_https: notify_url %q is not https", s.NotifyURL)
+	}
+	s.NotifyURL = normalized
+	if s.NotifyFailures < 0 || s.NotifyTimeout < 0 {
+		return fmt.Errorf("notify values must not be negative")
+	}
+	if s.NotifyFailures == 0 {
+		s.NotifyFailures = defaultNotifyFailures
+	}
+	if s.NotifyTimeout == 0 {
+		s.NotifyTimeout = caddy.Duration(defaultNotifyTimeout)
+	}
+	// Not s.client: its socket, TLS, HTTP/3 and rate limit settings are
+	// meant for the list host, not the webhook.
+	s.notifyClient = &http.Client{
+		Transport:     http.DefaultTransport.(*http.Transport).Clone(),
+		CheckRedirect: checkRedirect,
+		Timeout:       time.Duration(s.NotifyTimeout),
+	}
+	return nil
+}
+
+// updateNotify notifies NotifyURL when the module enters the failed state,
+// NotifyFailures refreshes in a row having failed or the ranges having got
+// older than MaxAge, and when it recovers from it. It is called by
+// recordRefresh, on the refresh goroutine.
+func (s *WedosIPRange) updateNotify(err error) {
+	if s.NotifyURL == "" {
+		return
+	}
+	now := s.now()
+	s.lock.RLock()
+	n := notification{
+		Source:              redactURL(s.source()),
+		LastError:           s.lastError,
+		ConsecutiveFailures: s.failures,
+		AgeSeconds:          -1,
+		Time:                now,
+	}
+	if !s.lastRefresh.IsZero() {
+		n.AgeSeconds = int64(ageAt(now, s.lastRefresh).Seconds())
+	}
+	stale := s.MaxAge > 0 && !s.freshAt(now)
+	s.lock.RUnlock()
+
+	switch {
+	case err != nil && !s.notified && (n.ConsecutiveFailures >= s.NotifyFailures || stale):
+		if !s.notifiedAt.IsZero() && now.Sub(s.notifiedAt) < notifyInterval {
+			return
+		}
+		s.notified, s.notifiedAt = true, now
+		n.State = notifyFailed
+	case err == nil && s.notified:
+		s.notified = false
+		n.State = notifyRecovered
+	default:
+		return
+	}
+	go s.postNotification(n)
+}
+
+// postNotification posts n to NotifyURL. Failures are only logged.
+func (s *WedosIPRange) postNotification(n notification) {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Duration(s.NotifyTimeout))
+	defer cancel()
+
+	body, err := json.Marshal(n)
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.NotifyURL, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.notifyClient.Do(req)
+	if err == nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			err = &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+		}
+	}
+	if err != nil {
+		s.logger.Warn("posting to notify_url failed",
+			zap.String("url", redactURL(s.NotifyURL)),
+			zap.String("state", n.State),
+			zap.Error(err))
+	}
+}
@@ -0,0 +1,144 @@
+package caddy_wedos_ip
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// notifyServer returns a webhook receiving notifications into a channel.
+func notifyServer(t *testing.T) (*httptest.Server, chan notification) {
+	ch := make(chan notification, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n notification
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ch <- n
+	}))
+	t.Cleanup(srv.Close)
+	return srv, ch
+}
+
+func receiveNotification(t *testing.T, ch chan notification) notification {
+	t.Helper()
+	select {
+	case n := <-ch:
+		return n
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification received")
+		return notification{}
+	}
+}
+
+func TestNotifyURL(t *testing.T) {
+	hook, ch := notifyServer(t)
+	s := newTestRange("https://example.com/ips.txt")
+	s.NotifyURL = hook.URL
+	if err := s.provisionNotify(); err != nil {
+		t.Fatal(err)
+	}
+	s.setRanges(parsePrefixes(t, "192.0.2.0/24"), time.Now().Add(-time.Minute))
+
+	failure := errors.New("unexpected response status 503")
+	for i := 0; i < defaultNotifyFailures-1; i++ {
+		s.recordRefresh(failure)
+	}
+	select {
+	case n := <-ch:
+		t.Fatalf("notified before the threshold: %+v", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.recordRefresh(failure)
+	n := receiveNotification(t, ch)
+	if n.State != notifyFailed || n.ConsecutiveFailures != defaultNotifyFailures || n.LastError != failure.Error() {
+		t.Errorf("unexpected failure notification %+v", n)
+	}
+	if n.Source != "https://example.com/ips.txt" || n.AgeSeconds < 60 {
+		t.Errorf("unexpected source or age in %+v", n)
+	}
+
+	// Further failures don't notify again.
+	s.recordRefresh(failure)
+	s.recordRefresh(nil)
+	if n := receiveNotification(t, ch); n.State != notifyRecovered {
+		t.Errorf("expected a recovery notification, got %+v", n)
+	}
+
+	// Failing again right away is debounced.
+	for i := 0; i < defaultNotifyFailures; i++ {
+		s.recordRefresh(failure)
+	}
+	s.recordRefresh(nil)
+	select {
+	case n := <-ch:
+		t.Errorf("expected flapping to be debounced, got %+v", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestNotifyURLStale(t *testing.T) {
+	hook, ch := notifyServer(t)
+	s := newTestRange("https://example.com/ips.txt")
+	s.NotifyURL = hook.URL
+	s.NotifyFailures = 100
+	s.MaxAge = caddy.Duration(time.Hour)
+	if err := s.provisionNotify(); err != nil {
+		t.Fatal(err)
+	}
+	s.setRanges(parsePrefixes(t, "192.0.2.0/24"), time.Now().Add(-2*time.Hour))
+
+	s.recordRefresh(errors.New("connection refused"))
+	if n := receiveNotification(t, ch); n.State != notifyFailed || n.ConsecutiveFailures != 1 {
+		t.Errorf("expected stale ranges to notify on the first failure, got %+v", n)
+	}
+}
+
+func TestNotifyURLOwnClient(t *testing.T) {
+	hook, ch := notifyServer(t)
+	s := newTestRange("http://unix/ips.txt")
+	s.UnixSocket = filepath.Join(t.TempDir(), "missing.sock")
+	s.client = s.newClient()
+	s.NotifyURL = hook.URL
+	if err := s.provisionNotify(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The list client would dial the socket, whatever the host.
+	go s.postNotification(notification{State: notifyFailed})
+	if n := receiveNotification(t, ch); n.State != notifyFailed {
+		t.Errorf("unexpected notification %+v", n)
+	}
+}
+
+func TestProvisionNotify(t *testing.T) {
+	for _, s := range []WedosIPRange{
+		{NotifyURL: "ftp://example.com/hook"},
+		{NotifyURL: "https://"},
+		{NotifyURL: "https://example.com/hook", NotifyFailures: -1},
+		{NotifyURL: "http://example.com/hook", RequireHTTPS: true},
+	} {
+		if err := s.provisionNotify(); err == nil {
+			t.Errorf("%+v: expected an error", s)
+		}
+	}
+	s := WedosIPRange{NotifyURL: "https://example.com/hook"}
+	if err := s.provisionNotify(); err != nil {
+		t.Fatal(err)
+	}
+	if s.NotifyFailures != defaultNotifyFailures || time.Duration(s.NotifyTimeout) != defaultNotifyTimeout {
+		t.Errorf("expected the defaults, got %d and %v", s.NotifyFailures, s.NotifyTimeout)
+	}
+}
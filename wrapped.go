@@ -0,0 +1,56 @@
+package caddy_wedos_ip
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// Values of Encoding.
+const (
+	encodingNone   = "none"
+	encodingBase64 = "base64"
+	encodingHex    = "hex"
+)
+
+// unwrapBody decodes a list body wrapped in Encoding. Whitespace, such as
+// line breaks inserted by the channel, is ignored, and Base64 may be
+// padded or not. Errors are reported as decoding errors, distinct from
+// the CIDR errors of the parser.
+func (s *WedosIPRange) unwrapBody(body io.Reader) (io.Reader, error) {
+	if s.Encoding == "" || s.Encoding == encodingNone {
+		return body, nil
+	}
+	raw, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	compact := bytes.Join(bytes.Fields(raw), nil)
+
+	var data []byte
+	switch s.Encoding {
+	case encodingBase64:
+		data = make([]byte, base64.RawStdEncoding.DecodedLen(len(compact)))
+		var n int
+		n, err = base64.RawStdEncoding.Decode(data, bytes.TrimRight(compact, "="))
+		data = data[:n]
+	case encodingHex:
+		data = make([]byte, hex.DecodedLen(len(compact)))
+		_, err = hex.Decode(data, compact)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s body: %w", s.Encoding, err)
+	}
+	return bytes.NewReader(data), nil
+}
+
+// checkEncoding validates Encoding.
+func (s *WedosIPRange) checkEncoding() error {
+	switch s.Encoding {
+	case "", encodingNone, encodingBase64, encodingHex:
+		return nil
+	}
+	return fmt.Errorf("unknown encoding %q", s.Encoding)
+}
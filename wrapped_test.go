@@ -0,0 +1,58 @@
+package caddy_wedos_ip
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEncoding(t *testing.T) {
+	list := "192.0.2.0/24\n198.51.100.0/24\n"
+	b64 := base64.StdEncoding.EncodeToString([]byte(list))
+	tests := []struct {
+		encoding, body string
+	}{
+		{encodingNone, list},
+		{encodingBase64, b64[:10] + "\r\n" + b64[10:]},
+		{encodingBase64, strings.TrimRight(b64, "=")},
+		{encodingHex, hex.EncodeToString([]byte(list)) + "\n"},
+	}
+	for _, tt := range tests {
+		s := newTestRange(sequenceServer(t, tt.body).URL)
+		s.Encoding = tt.encoding
+		if err := s.refresh(); err != nil {
+			t.Errorf("%s: %v", tt.encoding, err)
+			continue
+		}
+		if got, want := s.GetIPRanges(nil), parsePrefixes(t, "192.0.2.0/24", "198.51.100.0/24"); !slices.Equal(got, want) {
+			t.Errorf("%s: expected %v, got %v", tt.encoding, want, got)
+		}
+	}
+}
+
+func TestEncodingErrors(t *testing.T) {
+	for _, tt := range []struct {
+		encoding, body, want string
+	}{
+		{encodingBase64, "not base64!", "decoding base64 body"},
+		{encodingHex, "xyz", "decoding hex body"},
+		// A well-wrapped body with a bad CIDR is a parse error instead.
+		{encodingBase64, base64.StdEncoding.EncodeToString([]byte("192.0.2.0/33")), "token 1"},
+	} {
+		s := newTestRange(sequenceServer(t, tt.body).URL)
+		s.Encoding = tt.encoding
+		err := s.refresh()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s %q: expected an error containing %q, got %v", tt.encoding, tt.body, tt.want, err)
+		}
+		if err != nil && strings.Contains(tt.want, "decoding") && strings.Contains(err.Error(), "token") {
+			t.Errorf("%s %q: decoding error reported as a parse error: %v", tt.encoding, tt.body, err)
+		}
+	}
+
+	if err := (&WedosIPRange{Encoding: "rot13"}).checkEncoding(); err == nil {
+		t.Error("expected an unknown encoding to be rejected")
+	}
+}